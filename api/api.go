@@ -1,120 +1,296 @@
 package api
 
 import (
+	"bytes"
 	"context"
-	"crypto/md5"
-	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
+	"net/http/cookiejar"
+	"net/url"
 	"time"
 )
 
 const (
-	BaseSearchURL  = "https://api.hh.ru/vacancies"
-	BaseVacancyURL = "https://api.hh.ru/vacancies/"
+	BaseSearchURL      = "https://api.hh.ru/vacancies"
+	BaseVacancyURL     = "https://api.hh.ru/vacancies/"
+	BaseVacancyPageURL = "https://hh.ru/vacancy/"
+	BaseMeURL          = "https://api.hh.ru/me"
+
+	// TimeLayout is how the API formats timestamps such as published_at,
+	// e.g. 2024-01-15T10:00:00+0300, and how it expects date_from and
+	// date_to.
+	TimeLayout = "2006-01-02T15:04:05-0700"
+
+	cookieDomain = "hh.ru"
 )
 
+// SearchResult is one page of search results. Found is the total number of
+// vacancies the API reports for the query, which can exceed what paging
+// is able to reach. Items holds the raw search snippets in the same order
+// as IDs.
+type SearchResult struct {
+	IDs   []string
+	Items []map[string]interface{}
+	Pages int
+	Found int
+}
+
+// Locale and Host are sent with every request when set, e.g. locale=EN or
+// host=rabota.by for another hh portal. Throttle, when set, paces requests
+// by the rate-limit headers of earlier responses.
 type HHClient struct {
-	BearerToken string
-	HTTPClient  *http.Client
+	Tokens     *TokenPool
+	HTTPClient *http.Client
+	Locale     string
+	Host       string
+	Throttle   *Throttle
 }
 
-func NewHHClient(bearerToken string) *HHClient {
+func NewHHClient(bearerTokens ...string) *HHClient {
+	jar, _ := cookiejar.New(nil)
 	return &HHClient{
-		BearerToken: bearerToken,
-		HTTPClient:  &http.Client{Timeout: 30 * time.Second},
+		Tokens: NewTokenPool(bearerTokens, DefaultTokenCooldown),
+		HTTPClient: &http.Client{
+			Timeout:   30 * time.Second,
+			Transport: NewTransport(DefaultTransportConfig),
+			Jar:       jar,
+		},
 	}
 }
 
-func (c *HHClient) GetVacancyIDs(ctx context.Context, startDate, endDate, area, role string, page, perPage int) ([]string, int, error) {
-	searchURL := fmt.Sprintf("%s?area=%s&professional_role=%s&date_from=%s&date_to=%s&per_page=%d&page=%d",
-		BaseSearchURL, area, role, startDate, endDate, perPage, page)
-
-	req, err := http.NewRequestWithContext(ctx, "GET", searchURL, nil)
+// SetCookies adds cookies from a "name=value; name2=value2" string to the
+// client's jar for hh.ru and its subdomains, e.g. the ones issued after a
+// captcha was solved in the browser.
+func (c *HHClient) SetCookies(header string) error {
+	cookies, err := http.ParseCookie(header)
 	if err != nil {
-		return nil, 0, fmt.Errorf("failed to create request: %w", err)
+		return fmt.Errorf("invalid cookies: %w", err)
+	}
+	if c.HTTPClient.Jar == nil {
+		c.HTTPClient.Jar, _ = cookiejar.New(nil)
 	}
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.BearerToken))
+	for _, cookie := range cookies {
+		cookie.Domain = cookieDomain
+		cookie.Path = "/"
+	}
+	c.HTTPClient.Jar.SetCookies(&url.URL{Scheme: "https", Host: "api." + cookieDomain, Path: "/"}, cookies)
+	return nil
+}
+
+// maxResponseBytes bounds how much of a response body is read. Vacancy
+// payloads are tens of kilobytes; anything near this size is broken.
+const maxResponseBytes = 10 << 20
+
+func (c *HHClient) do(req *http.Request) (*http.Response, error) {
+	if err := c.Throttle.Wait(req.Context()); err != nil {
+		return nil, err
+	}
+	token, ok := req.Context().Value(tokenKey{}).(string)
+	if !ok {
+		token = c.Tokens.Next()
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
 
 	resp, err := c.HTTPClient.Do(req)
 	if err != nil {
-		return nil, 0, fmt.Errorf("HTTP request failed: %w", err)
+		return nil, err
+	}
+	c.Throttle.Observe(resp.Header)
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusForbidden {
+		c.Tokens.Bench(token)
+	}
+	return resp, nil
+}
+
+// doRequest sends an authorized request, maps error statuses and decodes a
+// 200 response body as JSON into out.
+func (c *HHClient) doRequest(ctx context.Context, method, url string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	resp, err := c.do(req)
+	if err != nil {
+		return fmt.Errorf("HTTP request failed: %w", err)
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, 0, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return fmt.Errorf("not found: %w", ErrVacancyNotFound)
+	case http.StatusUnauthorized:
+		return fmt.Errorf("unauthorized: %w", ErrTokenInvalid)
+	case http.StatusForbidden:
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, maxResponseBytes))
+		return forbiddenError(body)
+	case http.StatusTooManyRequests:
+		return fmt.Errorf("rate limited: %w", ErrRateLimited)
+	case http.StatusBadRequest:
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, maxResponseBytes))
+		if isPageBadArgument(body) {
+			return fmt.Errorf("bad_argument page: %w", ErrPaginationDepthExceeded)
+		}
+		return &StatusError{StatusCode: resp.StatusCode, Snippet: bodySnippet(body)}
+	default:
+		return newStatusError(resp)
 	}
 
-	body, err := ioutil.ReadAll(resp.Body)
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxResponseBytes))
 	if err != nil {
-		return nil, 0, fmt.Errorf("failed to read response body: %w", err)
+		return fmt.Errorf("failed to read response body: %w", err)
+	}
+	if err := json.Unmarshal(body, out); err != nil {
+		return &DecodeError{StatusCode: resp.StatusCode, Body: body, Err: err, Truncated: isTruncatedJSON(err, body)}
+	}
+	return nil
+}
+
+// isTruncatedJSON reports whether decoding failed only because the input
+// stopped early. A syntax error before the end of the body, or valid JSON
+// of the wrong shape, means the payload itself is bad.
+func isTruncatedJSON(err error, body []byte) bool {
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	var syntaxErr *json.SyntaxError
+	return errors.As(err, &syntaxErr) && syntaxErr.Offset >= int64(len(bytes.TrimRight(body, " \t\r\n")))
+}
+
+func (c *HHClient) addSiteParams(values url.Values) {
+	if c.Locale != "" {
+		values.Set("locale", c.Locale)
+	}
+	if c.Host != "" {
+		values.Set("host", c.Host)
+	}
+}
+
+// CheckAuth makes one cheap authenticated request per token to verify
+// them all, stopping at the first that fails. With several tokens the
+// error names the failing one by its position.
+func (c *HHClient) CheckAuth(ctx context.Context) error {
+	tokens := c.Tokens.Tokens()
+	for i, token := range tokens {
+		var me map[string]interface{}
+		if err := c.doRequest(withRequestLabel(withToken(ctx, token), "auth check"), http.MethodGet, BaseMeURL, &me); err != nil {
+			if len(tokens) > 1 {
+				return fmt.Errorf("token %d: %w", i+1, err)
+			}
+			return err
+		}
 	}
+	return nil
+}
+
+// GetVacancyIDs fetches one search page. If ctx is cancelled once the body
+// was read, the page's ids are still returned together with ctx's error.
+func (c *HHClient) GetVacancyIDs(ctx context.Context, query SearchQuery, page int) (SearchResult, error) {
+	values := query.Values(page)
+	c.addSiteParams(values)
+	searchURL := BaseSearchURL + "?" + values.Encode()
 
 	var searchResp struct {
-		Pages int `json:"pages"`
-		Items []struct {
-			ID string `json:"id"`
-		} `json:"items"`
+		Pages int                      `json:"pages"`
+		Found int                      `json:"found"`
+		Items []map[string]interface{} `json:"items"`
 	}
-	if err := json.Unmarshal(body, &searchResp); err != nil {
-		return nil, 0, fmt.Errorf("failed to parse JSON: %w", err)
+	ctx = withRequestLabel(ctx, fmt.Sprintf("page %d", page))
+	if err := c.doRequest(ctx, http.MethodGet, searchURL, &searchResp); err != nil {
+		return SearchResult{}, err
 	}
 
 	ids := make([]string, 0, len(searchResp.Items))
+	items := make([]map[string]interface{}, 0, len(searchResp.Items))
 	for _, item := range searchResp.Items {
-		ids = append(ids, item.ID)
+		id, _ := item["id"].(string)
+		if id == "" {
+			continue
+		}
+		ids = append(ids, id)
+		items = append(items, item)
 	}
 
-	return ids, searchResp.Pages, nil
+	result := SearchResult{IDs: ids, Items: items, Pages: searchResp.Pages, Found: searchResp.Found}
+	return result, ctx.Err()
 }
 
 func (c *HHClient) GetVacancyDetails(ctx context.Context, vacancyID string) (map[string]interface{}, error) {
 	vacancyURL := BaseVacancyURL + vacancyID
-
-	req, err := http.NewRequestWithContext(ctx, "GET", vacancyURL, nil)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+	values := url.Values{}
+	c.addSiteParams(values)
+	if len(values) > 0 {
+		vacancyURL += "?" + values.Encode()
 	}
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.BearerToken))
 
-	resp, err := c.HTTPClient.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("HTTP request failed: %w", err)
+	var data map[string]interface{}
+	ctx = withRequestLabel(ctx, "vacancy "+vacancyID)
+	if err := c.doRequest(ctx, http.MethodGet, vacancyURL, &data); err != nil {
+		return nil, err
 	}
-	defer resp.Body.Close()
+	return data, nil
+}
 
-	switch resp.StatusCode {
-	case http.StatusOK:
-		body, err := ioutil.ReadAll(resp.Body)
-		if err != nil {
-			return nil, fmt.Errorf("failed to read response body: %w", err)
+// forbiddenError tells token problems apart from rate limiting. A rejected
+// token comes back as 403 with an oauth error, e.g.
+// {"errors":[{"type":"oauth","value":"token_expired"}]}; any other 403 is
+// treated as a rate limit. A captcha_required error carries the URL to
+// solve it at, which is kept in the message.
+func forbiddenError(body []byte) error {
+	var apiErr struct {
+		Errors []struct {
+			Type       string `json:"type"`
+			Value      string `json:"value"`
+			CaptchaURL string `json:"captcha_url"`
+		} `json:"errors"`
+	}
+	if json.Unmarshal(body, &apiErr) == nil {
+		for _, e := range apiErr.Errors {
+			if e.Type == "oauth" || e.Value == "token_expired" || e.Value == "token_revoked" || e.Value == "bad_authorization" {
+				return fmt.Errorf("%s: %w", e.Value, ErrTokenInvalid)
+			}
+			if e.Type == "captcha_required" && e.CaptchaURL != "" {
+				return fmt.Errorf("captcha required, solve it at %s and pass the cookies with --cookies: %w", e.CaptchaURL, ErrRateLimited)
+			}
 		}
+	}
+	return fmt.Errorf("rate limited: %w", ErrRateLimited)
+}
 
-		var data map[string]interface{}
-		if err := json.Unmarshal(body, &data); err != nil {
-			return nil, fmt.Errorf("failed to parse JSON: %w", err)
+// isPageBadArgument matches the 400 body the API sends when page*per_page
+// goes past the result depth limit, e.g.
+// {"errors":[{"type":"bad_argument","value":"page"}],"bad_argument":"page"}.
+func isPageBadArgument(body []byte) bool {
+	var apiErr struct {
+		BadArgument string `json:"bad_argument"`
+		Errors      []struct {
+			Type  string `json:"type"`
+			Value string `json:"value"`
+		} `json:"errors"`
+	}
+	if err := json.Unmarshal(body, &apiErr); err != nil {
+		return false
+	}
+	if apiErr.BadArgument == "page" {
+		return true
+	}
+	for _, e := range apiErr.Errors {
+		if e.Type == "bad_argument" && e.Value == "page" {
+			return true
 		}
-		return data, nil
-
-	case http.StatusNotFound:
-		return nil, fmt.Errorf("vacancy not found: %w", ErrVacancyNotFound)
-	case http.StatusForbidden, http.StatusTooManyRequests:
-		return nil, fmt.Errorf("rate limited: %w", ErrRateLimited)
-	default:
-		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
 	}
+	return false
 }
 
-func MD5Hash(text string) string {
-	hash := md5.Sum([]byte(text))
-	return hex.EncodeToString(hash[:])
+func newStatusError(resp *http.Response) *StatusError {
+	body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 4*maxSnippetLen))
+	return &StatusError{StatusCode: resp.StatusCode, Snippet: bodySnippet(body)}
 }
 
-var (
-	ErrVacancyNotFound = errors.New("vacancy not found")
-	ErrRateLimited     = errors.New("rate limited")
-)
+func VacancyPageURL(vacancyID string) string {
+	return BaseVacancyPageURL + vacancyID
+}
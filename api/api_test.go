@@ -0,0 +1,467 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// serverTransport sends every request to a test server, keeping its path
+// and query, so the client can be tested against its real base URLs.
+type serverTransport struct {
+	server *url.URL
+	next   http.RoundTripper
+}
+
+func (t *serverTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.URL.Scheme = t.server.Scheme
+	req.URL.Host = t.server.Host
+	return t.next.RoundTrip(req)
+}
+
+func newTestClient(t *testing.T, handler http.Handler) *HHClient {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	serverURL, _ := url.Parse(server.URL)
+
+	client := NewHHClient("test-token")
+	client.HTTPClient.Transport = &serverTransport{server: serverURL, next: server.Client().Transport}
+	return client
+}
+
+func fixture(t *testing.T, name string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func serveFixture(t *testing.T, status int, name string) http.HandlerFunc {
+	body := fixture(t, name)
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write(body)
+	}
+}
+
+func TestGetVacancyIDs(t *testing.T) {
+	var got *http.Request
+	serve := serveFixture(t, http.StatusOK, "search_page.json")
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		serve(w, r)
+	}))
+	client.Locale = "EN"
+
+	query := SearchQuery{DateFrom: "2024-03-01T00:00:00", DateTo: "2024-03-02T00:00:00", Area: "1", Role: "96", PerPage: 20}
+	result, err := client.GetVacancyIDs(context.Background(), query, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Join(result.IDs, ",") != "101,102" {
+		t.Errorf("IDs = %v, want [101 102]", result.IDs)
+	}
+	if len(result.Items) != 2 || result.Items[1]["name"] != "Backend engineer (Go)" {
+		t.Errorf("Items do not match IDs: %v", result.Items)
+	}
+	if snippet, _ := result.Items[0]["snippet"].(map[string]interface{}); snippet["requirement"] != "Go, PostgreSQL, Kafka" {
+		t.Errorf("snippet = %v, want the search item's snippet kept", result.Items[0]["snippet"])
+	}
+	if result.Pages != 77 || result.Found != 1534 {
+		t.Errorf("Pages, Found = %d, %d, want 77, 1534", result.Pages, result.Found)
+	}
+
+	if got.URL.Path != "/vacancies" {
+		t.Errorf("path = %s, want /vacancies", got.URL.Path)
+	}
+	params := got.URL.Query()
+	for key, want := range map[string]string{"professional_role": "96", "area": "1", "page": "3", "per_page": "20", "locale": "EN"} {
+		if params.Get(key) != want {
+			t.Errorf("%s = %q, want %q", key, params.Get(key), want)
+		}
+	}
+	if auth := got.Header.Get("Authorization"); auth != "Bearer test-token" {
+		t.Errorf("Authorization = %q", auth)
+	}
+}
+
+// cancelOnEOF calls cancel once the whole body has been read.
+type cancelOnEOF struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b cancelOnEOF) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err == io.EOF {
+		b.cancel()
+	}
+	return n, err
+}
+
+func TestGetVacancyIDsCancelledAfterBody(t *testing.T) {
+	client := newTestClient(t, serveFixture(t, http.StatusOK, "search_page.json"))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	next := client.HTTPClient.Transport
+	client.HTTPClient.Transport = roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		resp, err := next.RoundTrip(req)
+		if err == nil {
+			resp.Body = cancelOnEOF{ReadCloser: resp.Body, cancel: cancel}
+		}
+		return resp, err
+	})
+
+	result, err := client.GetVacancyIDs(ctx, SearchQuery{Role: "96", PerPage: 20}, 0)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("error = %v, want context.Canceled", err)
+	}
+	if strings.Join(result.IDs, ",") != "101,102" || len(result.Items) != 2 || result.Pages != 77 {
+		t.Errorf("result = %v, %d items, %d pages, want the page read before the cancel", result.IDs, len(result.Items), result.Pages)
+	}
+}
+
+func TestGetVacancyDetails(t *testing.T) {
+	var path string
+	serve := serveFixture(t, http.StatusOK, "vacancy.json")
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		serve(w, r)
+	}))
+
+	data, err := client.GetVacancyDetails(context.Background(), "101")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path != "/vacancies/101" {
+		t.Errorf("path = %s, want /vacancies/101", path)
+	}
+	if data["id"] != "101" || data["name"] != "Go developer" {
+		t.Errorf("unexpected vacancy: id %v, name %v", data["id"], data["name"])
+	}
+	if !strings.Contains(data["description"].(string), "payment services") {
+		t.Errorf("description = %q", data["description"])
+	}
+	if skills, _ := data["key_skills"].([]interface{}); len(skills) != 3 {
+		t.Errorf("key_skills = %v, want 3 skills", data["key_skills"])
+	}
+}
+
+func TestErrorStatuses(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		fixture string
+		want    error
+	}{
+		{"not found", http.StatusNotFound, "not_found.json", ErrVacancyNotFound},
+		{"rate limited", http.StatusTooManyRequests, "too_many_requests.json", ErrRateLimited},
+		{"page too deep", http.StatusBadRequest, "page_bad_argument.json", ErrPaginationDepthExceeded},
+		{"expired token", http.StatusForbidden, "token_expired.json", ErrTokenInvalid},
+		{"unauthorized", http.StatusUnauthorized, "token_expired.json", ErrTokenInvalid},
+		{"forbidden rate limit", http.StatusForbidden, "too_many_requests.json", ErrRateLimited},
+		{"captcha", http.StatusForbidden, "captcha_required.json", ErrRateLimited},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newTestClient(t, serveFixture(t, tt.status, tt.fixture))
+
+			_, err := client.GetVacancyDetails(context.Background(), "101")
+			if !errors.Is(err, tt.want) {
+				t.Errorf("GetVacancyDetails error = %v, want %v", err, tt.want)
+			}
+			_, err = client.GetVacancyIDs(context.Background(), SearchQuery{Role: "96", PerPage: 20}, 0)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("GetVacancyIDs error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestCaptchaErrorKeepsURL(t *testing.T) {
+	client := newTestClient(t, serveFixture(t, http.StatusForbidden, "captcha_required.json"))
+	_, err := client.GetVacancyDetails(context.Background(), "101")
+	if err == nil || !strings.Contains(err.Error(), "https://hh.ru/account/captcha?state=example") {
+		t.Errorf("error = %v, want the captcha URL", err)
+	}
+}
+
+func TestSetCookies(t *testing.T) {
+	var cookies []string
+	serve := serveFixture(t, http.StatusOK, "vacancy.json")
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cookies = append(cookies, r.Header.Get("Cookie"))
+		if len(cookies) == 1 {
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "issued", Path: "/"})
+		}
+		serve(w, r)
+	}))
+
+	if err := client.SetCookies("hhtoken=solved; _xsrf=abc"); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := client.GetVacancyDetails(context.Background(), "101"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i, header := range cookies {
+		for _, want := range []string{"hhtoken=solved", "_xsrf=abc"} {
+			if !strings.Contains(header, want) {
+				t.Errorf("request %d cookies = %q, want %s", i, header, want)
+			}
+		}
+	}
+	if !strings.Contains(cookies[1], "session=issued") {
+		t.Errorf("second request cookies = %q, want the one the server set", cookies[1])
+	}
+
+	if err := client.SetCookies("no value"); err == nil {
+		t.Error("malformed cookie string accepted")
+	}
+}
+
+func TestOtherBadArgument(t *testing.T) {
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"errors": [{"type": "bad_argument", "value": "area"}], "bad_argument": "area"}`))
+	}))
+	_, err := client.GetVacancyIDs(context.Background(), SearchQuery{Area: "x", PerPage: 20}, 0)
+
+	var statusErr *StatusError
+	if errors.Is(err, ErrPaginationDepthExceeded) || !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusBadRequest {
+		t.Errorf("error = %v, want a plain 400 status error", err)
+	}
+}
+
+func TestDoRequest(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		want   error
+	}{
+		{"success", http.StatusOK, `{"id": "101", "name": "Go developer"}`, nil},
+		{"not found", http.StatusNotFound, `{"errors": [{"type": "not_found"}]}`, ErrVacancyNotFound},
+		{"rate limited", http.StatusTooManyRequests, `{"errors": [{"type": "too_many_requests"}]}`, ErrRateLimited},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got *http.Request
+			client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = r
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+
+			var out struct {
+				ID   string `json:"id"`
+				Name string `json:"name"`
+			}
+			err := client.doRequest(context.Background(), http.MethodGet, BaseVacancyURL+"101", &out)
+			if !errors.Is(err, tt.want) || (tt.want == nil && err != nil) {
+				t.Fatalf("doRequest error = %v, want %v", err, tt.want)
+			}
+			if tt.want == nil && (out.ID != "101" || out.Name != "Go developer") {
+				t.Errorf("decoded %+v", out)
+			}
+			if got.Method != http.MethodGet || got.Header.Get("Authorization") != "Bearer test-token" {
+				t.Errorf("request = %s with Authorization %q", got.Method, got.Header.Get("Authorization"))
+			}
+		})
+	}
+}
+
+func TestDoRequestDecodeError(t *testing.T) {
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"id": "101", "name": 42}`))
+	}))
+	var out struct {
+		Name string `json:"name"`
+	}
+	err := client.doRequest(context.Background(), http.MethodGet, BaseVacancyURL+"101", &out)
+
+	var decodeErr *DecodeError
+	if !errors.As(err, &decodeErr) {
+		t.Fatalf("error = %v, want *DecodeError", err)
+	}
+	if decodeErr.StatusCode != http.StatusOK || string(decodeErr.Body) != `{"id": "101", "name": 42}` || decodeErr.Truncated {
+		t.Errorf("DecodeError = %+v", decodeErr)
+	}
+}
+
+func TestDoRequestTransportError(t *testing.T) {
+	client := NewHHClient("test-token")
+	client.HTTPClient.Transport = roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		return nil, errors.New("connection refused")
+	})
+	var out map[string]interface{}
+	err := client.doRequest(context.Background(), http.MethodGet, BaseVacancyURL+"101", &out)
+	if err == nil || !strings.Contains(err.Error(), "HTTP request failed: ") || !strings.Contains(err.Error(), "connection refused") {
+		t.Errorf("error = %v, want the transport failure", err)
+	}
+	if _, ok := StatusCodeOf(err); ok {
+		t.Error("transport failure reported as an HTTP status")
+	}
+}
+
+func TestCheckAuth(t *testing.T) {
+	var path string
+	status := http.StatusOK
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		w.WriteHeader(status)
+		w.Write([]byte(`{}`))
+	}))
+
+	if err := client.CheckAuth(context.Background()); err != nil || path != "/me" {
+		t.Errorf("CheckAuth = %v against %s, want success against /me", err, path)
+	}
+	status = http.StatusUnauthorized
+	if err := client.CheckAuth(context.Background()); !errors.Is(err, ErrTokenInvalid) {
+		t.Errorf("CheckAuth on 401 = %v, want ErrTokenInvalid", err)
+	}
+	status = http.StatusBadGateway
+	if code, ok := StatusCodeOf(client.CheckAuth(context.Background())); !ok || code != http.StatusBadGateway {
+		t.Errorf("CheckAuth on 502 reported status %d, %v", code, ok)
+	}
+}
+
+func TestCheckAuthChecksEveryToken(t *testing.T) {
+	var seen []string
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		seen = append(seen, token)
+		if token == "expired" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{}`))
+	}))
+
+	client.Tokens = NewTokenPool([]string{"a", "b", "c"}, DefaultTokenCooldown)
+	client.Tokens.Next()
+	if err := client.CheckAuth(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(seen, ","); got != "a,b,c" {
+		t.Errorf("checked tokens %s, want each token once", got)
+	}
+
+	seen = nil
+	client.Tokens = NewTokenPool([]string{"a", "expired", "c"}, DefaultTokenCooldown)
+	err := client.CheckAuth(context.Background())
+	if !errors.Is(err, ErrTokenInvalid) || !strings.HasPrefix(err.Error(), "token 2: ") {
+		t.Errorf("CheckAuth = %v, want token 2 reported invalid", err)
+	}
+	if got := strings.Join(seen, ","); got != "a,expired" {
+		t.Errorf("checked tokens %s, want the check to stop at the invalid one", got)
+	}
+}
+
+func TestCheckAuthForbidden(t *testing.T) {
+	expired := newTestClient(t, serveFixture(t, http.StatusForbidden, "token_expired.json"))
+	if err := expired.CheckAuth(context.Background()); !errors.Is(err, ErrTokenInvalid) {
+		t.Errorf("CheckAuth with an expired token = %v, want ErrTokenInvalid", err)
+	}
+	limited := newTestClient(t, serveFixture(t, http.StatusForbidden, "too_many_requests.json"))
+	if err := limited.CheckAuth(context.Background()); errors.Is(err, ErrTokenInvalid) || !errors.Is(err, ErrRateLimited) {
+		t.Errorf("CheckAuth when rate limited = %v, want ErrRateLimited", err)
+	}
+}
+
+func TestForbiddenError(t *testing.T) {
+	for _, value := range []string{"token_expired", "token_revoked", "bad_authorization"} {
+		body := `{"errors": [{"type": "oauth", "value": "` + value + `"}]}`
+		if err := forbiddenError([]byte(body)); !errors.Is(err, ErrTokenInvalid) || errors.Is(err, ErrRateLimited) || !strings.Contains(err.Error(), value) {
+			t.Errorf("%s: error = %v, want ErrTokenInvalid naming it", value, err)
+		}
+	}
+	for _, body := range []string{`{"errors": [{"type": "forbidden"}]}`, "<html>Forbidden</html>", ""} {
+		if err := forbiddenError([]byte(body)); !errors.Is(err, ErrRateLimited) {
+			t.Errorf("body %q: error = %v, want ErrRateLimited", body, err)
+		}
+	}
+}
+
+func TestDecodeErrorTruncated(t *testing.T) {
+	full := fixture(t, "vacancy.json")
+	tests := []struct {
+		name      string
+		body      []byte
+		truncated bool
+	}{
+		{"cut off", full[:len(full)/2], true},
+		{"cut off before trailing newline", append(full[:len(full)/2:len(full)/2], '\n'), true},
+		{"malformed", []byte(`{"id": "101",, "name": "x"}`), false},
+		{"wrong shape", []byte(`["101"]`), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write(tt.body)
+			}))
+			_, err := client.GetVacancyDetails(context.Background(), "101")
+
+			var decodeErr *DecodeError
+			if !errors.As(err, &decodeErr) {
+				t.Fatalf("error = %v, want *DecodeError", err)
+			}
+			if decodeErr.Truncated != tt.truncated {
+				t.Errorf("Truncated = %v, want %v", decodeErr.Truncated, tt.truncated)
+			}
+		})
+	}
+}
+
+func TestSiteParams(t *testing.T) {
+	var queries []url.Values
+	serveSearch, serveVacancy := serveFixture(t, http.StatusOK, "search_page.json"), serveFixture(t, http.StatusOK, "vacancy.json")
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queries = append(queries, r.URL.Query())
+		if r.URL.Path == "/vacancies" {
+			serveSearch(w, r)
+			return
+		}
+		serveVacancy(w, r)
+	}))
+	fetch := func() {
+		t.Helper()
+		queries = nil
+		if _, err := client.GetVacancyIDs(context.Background(), SearchQuery{Role: "96", PerPage: 20}, 0); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := client.GetVacancyDetails(context.Background(), "101"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fetch()
+	for _, query := range queries {
+		if query.Has("locale") || query.Has("host") {
+			t.Errorf("site parameters sent by default: %v", query)
+		}
+	}
+
+	client.Locale, client.Host = "EN", "rabota.by"
+	fetch()
+	for i, query := range queries {
+		if query.Get("locale") != "EN" || query.Get("host") != "rabota.by" {
+			t.Errorf("request %d: locale %q, host %q, want EN, rabota.by", i, query.Get("locale"), query.Get("host"))
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+)
+
+const BaseAreasURL = "https://api.hh.ru/areas"
+
+// Area is a node of the areas dictionary: countries contain regions, which
+// contain cities.
+type Area struct {
+	ID       string `json:"id"`
+	ParentID string `json:"parent_id"`
+	Name     string `json:"name"`
+	Areas    []Area `json:"areas"`
+}
+
+func (c *HHClient) GetAreas(ctx context.Context) ([]Area, error) {
+	areasURL := BaseAreasURL
+	values := url.Values{}
+	c.addSiteParams(values)
+	if len(values) > 0 {
+		areasURL += "?" + values.Encode()
+	}
+
+	var areas []Area
+	ctx = withRequestLabel(ctx, "areas")
+	if err := c.doRequest(ctx, http.MethodGet, areasURL, &areas); err != nil {
+		return nil, err
+	}
+	return areas, nil
+}
+
+// AreaPaths maps every area id in tree to the names from its country down
+// to the area itself, e.g. "2019" -> [Россия, Московская область, Химки].
+func AreaPaths(tree []Area) map[string][]string {
+	paths := make(map[string][]string)
+	var walk func(areas []Area, parent []string)
+	walk = func(areas []Area, parent []string) {
+		for _, area := range areas {
+			path := make([]string, len(parent)+1)
+			copy(path, parent)
+			path[len(parent)] = area.Name
+			paths[area.ID] = path
+			walk(area.Areas, path)
+		}
+	}
+	walk(tree, nil)
+	return paths
+}
@@ -0,0 +1,47 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestAreaPaths(t *testing.T) {
+	var path string
+	serve := serveFixture(t, http.StatusOK, "areas.json")
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		serve(w, r)
+	}))
+	tree, err := client.GetAreas(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path != "/areas" {
+		t.Errorf("requested %s, want /areas", path)
+	}
+
+	paths := AreaPaths(tree)
+	tests := []struct {
+		id   string
+		want string
+	}{
+		{"113", "Россия"},
+		{"1", "Россия/Москва"},
+		{"2019", "Россия/Московская область"},
+		{"2034", "Россия/Московская область/Химки"},
+		{"1002", "Беларусь/Минск"},
+	}
+	for _, tt := range tests {
+		if got := strings.Join(paths[tt.id], "/"); got != tt.want {
+			t.Errorf("path of %s = %s, want %s", tt.id, got, tt.want)
+		}
+	}
+	if len(paths) != 6 {
+		t.Errorf("%d paths, want one per area", len(paths))
+	}
+	if _, ok := paths["99999"]; ok {
+		t.Error("unknown area has a path")
+	}
+}
@@ -0,0 +1,165 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+type BreakerState int
+
+const (
+	BreakerClosed BreakerState = iota
+	BreakerOpen
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+// CircuitBreaker opens after Threshold consecutive failures and rejects calls
+// with ErrCircuitOpen until Cooldown has passed. It then half-opens and lets a
+// single probe through: success closes it again, failure re-opens it.
+type CircuitBreaker struct {
+	Threshold     int
+	Cooldown      time.Duration
+	OnStateChange func(from, to BreakerState)
+
+	mu       sync.Mutex
+	state    BreakerState
+	failures int
+	openedAt time.Time
+	probing  bool
+	now      func() time.Time
+}
+
+func NewCircuitBreaker(threshold int, cooldown time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{
+		Threshold: threshold,
+		Cooldown:  cooldown,
+		now:       time.Now,
+	}
+}
+
+func (b *CircuitBreaker) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+func (b *CircuitBreaker) Allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerOpen:
+		if b.now().Sub(b.openedAt) < b.Cooldown {
+			return ErrCircuitOpen
+		}
+		b.setState(BreakerHalfOpen)
+		b.probing = true
+		return nil
+	case BreakerHalfOpen:
+		if b.probing {
+			return ErrCircuitOpen
+		}
+		b.probing = true
+		return nil
+	default:
+		return nil
+	}
+}
+
+func (b *CircuitBreaker) RecordSuccess() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures = 0
+	b.probing = false
+	if b.state != BreakerClosed {
+		b.setState(BreakerClosed)
+	}
+}
+
+func (b *CircuitBreaker) RecordFailure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+	b.failures++
+	if b.state == BreakerHalfOpen || (b.state == BreakerClosed && b.failures >= b.Threshold) {
+		b.openedAt = b.now()
+		b.setState(BreakerOpen)
+	}
+}
+
+// RecordNeutral releases a half-open probe without judging the outcome, for
+// calls that ended for reasons unrelated to API health.
+func (b *CircuitBreaker) RecordNeutral() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
+
+func (b *CircuitBreaker) setState(to BreakerState) {
+	from := b.state
+	b.state = to
+	if b.OnStateChange != nil {
+		b.OnStateChange(from, to)
+	}
+}
+
+type BreakerClient struct {
+	*HHClient
+	Breaker *CircuitBreaker
+}
+
+func (c *BreakerClient) GetVacancyIDs(ctx context.Context, query SearchQuery, page int) (SearchResult, error) {
+	if err := c.Breaker.Allow(); err != nil {
+		return SearchResult{}, err
+	}
+	result, err := c.HHClient.GetVacancyIDs(ctx, query, page)
+	c.record(ctx, err)
+	return result, err
+}
+
+func (c *BreakerClient) GetVacancyDetails(ctx context.Context, vacancyID string) (map[string]interface{}, error) {
+	if err := c.Breaker.Allow(); err != nil {
+		return nil, err
+	}
+	data, err := c.HHClient.GetVacancyDetails(ctx, vacancyID)
+	c.record(ctx, err)
+	return data, err
+}
+
+func (c *BreakerClient) record(ctx context.Context, err error) {
+	switch {
+	case err == nil, errors.Is(err, ErrVacancyNotFound), errors.Is(err, ErrRateLimited), errors.Is(err, ErrPaginationDepthExceeded),
+		errors.Is(err, ErrTokenInvalid):
+		c.Breaker.RecordSuccess()
+	case ctx.Err() != nil:
+		c.Breaker.RecordNeutral()
+	case isServerFailure(err):
+		c.Breaker.RecordFailure()
+	default:
+		c.Breaker.RecordNeutral()
+	}
+}
+
+func isServerFailure(err error) bool {
+	if code, ok := StatusCodeOf(err); ok {
+		return code >= 500
+	}
+	// Anything else that is not a status error is a transport failure:
+	// connection refused, reset or timed out.
+	return true
+}
@@ -0,0 +1,133 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTestBreaker(threshold int, cooldown time.Duration) (*CircuitBreaker, *fakeClock, *[]string) {
+	clock := &fakeClock{now: time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)}
+	b := NewCircuitBreaker(threshold, cooldown)
+	b.now = clock.Now
+	var transitions []string
+	b.OnStateChange = func(from, to BreakerState) {
+		transitions = append(transitions, fmt.Sprintf("%s->%s", from, to))
+	}
+	return b, clock, &transitions
+}
+
+func TestCircuitBreakerTransitions(t *testing.T) {
+	b, clock, transitions := newTestBreaker(3, time.Minute)
+
+	b.RecordFailure()
+	b.RecordFailure()
+	b.RecordSuccess()
+	b.RecordFailure()
+	b.RecordFailure()
+	if b.State() != BreakerClosed {
+		t.Fatal("opened without 3 consecutive failures")
+	}
+	b.RecordFailure()
+	if b.State() != BreakerOpen {
+		t.Fatalf("state = %s after 3 consecutive failures, want open", b.State())
+	}
+	if err := b.Allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("Allow while open = %v, want ErrCircuitOpen", err)
+	}
+
+	clock.Advance(time.Minute)
+	if err := b.Allow(); err != nil {
+		t.Fatalf("probe after the cooldown rejected: %v", err)
+	}
+	if b.State() != BreakerHalfOpen {
+		t.Fatalf("state = %s after the cooldown, want half-open", b.State())
+	}
+	if err := b.Allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("second call during the probe = %v, want ErrCircuitOpen", err)
+	}
+
+	b.RecordSuccess()
+	if b.State() != BreakerClosed || b.Allow() != nil {
+		t.Fatalf("state = %s after a successful probe, want closed", b.State())
+	}
+
+	if got, want := strings.Join(*transitions, ","), "closed->open,open->half-open,half-open->closed"; got != want {
+		t.Errorf("transitions = %s, want %s", got, want)
+	}
+}
+
+func TestCircuitBreakerFailedProbeReopens(t *testing.T) {
+	b, clock, _ := newTestBreaker(1, time.Minute)
+	b.RecordFailure()
+	clock.Advance(time.Minute)
+	b.Allow()
+	b.RecordFailure()
+	if b.State() != BreakerOpen {
+		t.Fatalf("state = %s after a failed probe, want open", b.State())
+	}
+	clock.Advance(30 * time.Second)
+	if err := b.Allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("Allow = %v, want a fresh cooldown after the failed probe", err)
+	}
+}
+
+func TestCircuitBreakerNeutralProbe(t *testing.T) {
+	b, clock, _ := newTestBreaker(1, time.Minute)
+	b.RecordFailure()
+	clock.Advance(time.Minute)
+	b.Allow()
+	b.RecordNeutral()
+	if b.State() != BreakerHalfOpen {
+		t.Fatalf("state = %s after a neutral probe, want half-open", b.State())
+	}
+	if err := b.Allow(); err != nil {
+		t.Errorf("next probe rejected after a neutral one: %v", err)
+	}
+}
+
+func TestBreakerClient(t *testing.T) {
+	var requests, status atomic.Int32
+	status.Store(http.StatusServiceUnavailable)
+	hhClient := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(int(status.Load()))
+		w.Write([]byte(`{}`))
+	}))
+	b, clock, _ := newTestBreaker(2, time.Minute)
+	client := &BreakerClient{HHClient: hhClient, Breaker: b}
+	ctx := context.Background()
+
+	client.GetVacancyDetails(ctx, "1")
+	client.GetVacancyIDs(ctx, SearchQuery{Role: "96", PerPage: 20}, 0)
+	if _, err := client.GetVacancyDetails(ctx, "2"); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("error = %v after two 503s, want ErrCircuitOpen", err)
+	}
+	if requests.Load() != 2 {
+		t.Errorf("%d requests sent, want none while the breaker is open", requests.Load())
+	}
+
+	// A missing vacancy shows the API is up.
+	clock.Advance(time.Minute)
+	status.Store(http.StatusNotFound)
+	if _, err := client.GetVacancyDetails(ctx, "3"); !errors.Is(err, ErrVacancyNotFound) {
+		t.Fatalf("probe error = %v, want ErrVacancyNotFound", err)
+	}
+	if b.State() != BreakerClosed {
+		t.Errorf("state = %s after a 404 probe, want closed", b.State())
+	}
+
+	// Client errors other than the above say nothing about API health.
+	status.Store(http.StatusBadRequest)
+	for i := 0; i < 3; i++ {
+		client.GetVacancyDetails(ctx, "4")
+	}
+	if b.State() != BreakerClosed {
+		t.Errorf("state = %s after 400s, want closed", b.State())
+	}
+}
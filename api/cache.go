@@ -0,0 +1,93 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httputil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+type CachingTransport struct {
+	Next http.RoundTripper
+	Dir  string
+	TTL  time.Duration
+}
+
+func NewCachingTransport(next http.RoundTripper, dir string, ttl time.Duration) (*CachingTransport, error) {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return nil, fmt.Errorf("failed to create cache directory: %w", err)
+	}
+	return &CachingTransport{Next: next, Dir: dir, TTL: ttl}, nil
+}
+
+func (t *CachingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet {
+		return t.Next.RoundTrip(req)
+	}
+
+	path := t.cachePath(req)
+	if resp, ok := t.load(path, req); ok {
+		return resp, nil
+	}
+
+	resp, err := t.Next.RoundTrip(req)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		return resp, err
+	}
+
+	dump, err := httputil.DumpResponse(resp, true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to buffer response for cache: %w", err)
+	}
+	t.store(path, dump)
+
+	return resp, nil
+}
+
+func (t *CachingTransport) cachePath(req *http.Request) string {
+	sum := sha256.Sum256([]byte(req.URL.String()))
+	return filepath.Join(t.Dir, hex.EncodeToString(sum[:]))
+}
+
+func (t *CachingTransport) load(path string, req *http.Request) (*http.Response, bool) {
+	info, err := os.Stat(path)
+	if err != nil || (t.TTL > 0 && time.Since(info.ModTime()) > t.TTL) {
+		return nil, false
+	}
+
+	dump, err := os.ReadFile(path)
+	if err != nil {
+		return nil, false
+	}
+
+	resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(dump)), req)
+	if err != nil {
+		return nil, false
+	}
+	return resp, true
+}
+
+func (t *CachingTransport) store(path string, dump []byte) {
+	tmp, err := os.CreateTemp(t.Dir, ".tmp-*")
+	if err != nil {
+		return
+	}
+	if _, err := tmp.Write(dump); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return
+	}
+	tmp.Close()
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+	}
+}
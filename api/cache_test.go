@@ -0,0 +1,112 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newCachedClient returns a client whose responses are cached in a fresh
+// directory, and a counter of the requests that reached the server.
+func newCachedClient(t *testing.T, ttl time.Duration, handler http.Handler) (*HHClient, string, *int32) {
+	t.Helper()
+	var hits int32
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		handler.ServeHTTP(w, r)
+	}))
+	dir := t.TempDir()
+	cache, err := NewCachingTransport(client.HTTPClient.Transport, dir, ttl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.HTTPClient.Transport = cache
+	return client, dir, &hits
+}
+
+// ageCache makes every cached response age old.
+func ageCache(t *testing.T, dir string, age time.Duration) {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-age)
+	for _, entry := range entries {
+		if err := os.Chtimes(filepath.Join(dir, entry.Name()), old, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCacheServesRepeatedRequest(t *testing.T) {
+	client, _, hits := newCachedClient(t, time.Hour, serveFixture(t, http.StatusOK, "vacancy.json"))
+
+	first, err := client.GetVacancyDetails(context.Background(), "101")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := client.GetVacancyDetails(context.Background(), "101")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *hits != 1 {
+		t.Errorf("server got %d requests, want the second served from cache", *hits)
+	}
+	if second["name"] != first["name"] || second["description"] != first["description"] {
+		t.Errorf("cached response differs: %v", second)
+	}
+
+	if _, err := client.GetVacancyDetails(context.Background(), "102"); err != nil {
+		t.Fatal(err)
+	}
+	if *hits != 2 {
+		t.Errorf("server got %d requests, want a miss for another URL", *hits)
+	}
+}
+
+func TestCacheExpiry(t *testing.T) {
+	client, dir, hits := newCachedClient(t, time.Hour, serveFixture(t, http.StatusOK, "search_page.json"))
+	query := SearchQuery{Role: "96", PerPage: 20}
+
+	if _, err := client.GetVacancyIDs(context.Background(), query, 0); err != nil {
+		t.Fatal(err)
+	}
+	ageCache(t, dir, 2*time.Hour)
+	if _, err := client.GetVacancyIDs(context.Background(), query, 0); err != nil {
+		t.Fatal(err)
+	}
+	if *hits != 2 {
+		t.Errorf("server got %d requests, want an expired entry refetched", *hits)
+	}
+	if _, err := client.GetVacancyIDs(context.Background(), query, 0); err != nil {
+		t.Fatal(err)
+	}
+	if *hits != 2 {
+		t.Errorf("server got %d requests, want the refetched entry cached again", *hits)
+	}
+}
+
+func TestCacheWithoutTTLNeverExpires(t *testing.T) {
+	client, dir, hits := newCachedClient(t, 0, serveFixture(t, http.StatusOK, "vacancy.json"))
+	client.GetVacancyDetails(context.Background(), "101")
+	ageCache(t, dir, 365*24*time.Hour)
+	client.GetVacancyDetails(context.Background(), "101")
+	if *hits != 1 {
+		t.Errorf("server got %d requests, want 1 with --cache-ttl=0", *hits)
+	}
+}
+
+func TestCacheSkipsErrors(t *testing.T) {
+	client, _, hits := newCachedClient(t, time.Hour, serveFixture(t, http.StatusNotFound, "not_found.json"))
+	for i := 0; i < 2; i++ {
+		client.GetVacancyDetails(context.Background(), "101")
+	}
+	if *hits != 2 {
+		t.Errorf("server got %d requests, want error responses left uncached", *hits)
+	}
+}
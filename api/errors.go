@@ -0,0 +1,113 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const maxSnippetLen = 200
+
+var (
+	ErrVacancyNotFound = errors.New("vacancy not found")
+	ErrRateLimited     = errors.New("rate limited")
+	ErrCircuitOpen     = errors.New("circuit breaker open")
+
+	// ErrPaginationDepthExceeded is returned when a search page lies beyond
+	// the 2000 results the API lets a single query page through.
+	ErrPaginationDepthExceeded = errors.New("pagination depth exceeded")
+
+	// ErrTokenInvalid means the bearer token was rejected as expired,
+	// revoked or malformed; retrying with it cannot succeed.
+	ErrTokenInvalid = errors.New("bearer token invalid or expired")
+)
+
+type StatusError struct {
+	StatusCode int
+	Snippet    string
+}
+
+func (e *StatusError) Error() string {
+	if e.Snippet == "" {
+		return fmt.Sprintf("unexpected status code: %d", e.StatusCode)
+	}
+	return fmt.Sprintf("unexpected status code: %d: body: %q", e.StatusCode, e.Snippet)
+}
+
+func StatusCodeOf(err error) (int, bool) {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode, true
+	}
+	return 0, false
+}
+
+// DecodeError is returned when a response body could not be parsed as JSON.
+// Body holds the raw bytes so callers can inspect or dead-letter them.
+// Truncated is set when the body ended mid-document, which points at a
+// dropped connection rather than a bad payload and is worth retrying.
+type DecodeError struct {
+	StatusCode int
+	Body       []byte
+	Err        error
+	Truncated  bool
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("failed to parse JSON (status %d): %v: body: %q", e.StatusCode, e.Err, bodySnippet(e.Body))
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// bodySnippet collapses whitespace and truncates body so an HTML error page
+// fits on one log line.
+func bodySnippet(body []byte) string {
+	snippet := strings.Join(strings.Fields(string(body)), " ")
+	if len(snippet) <= maxSnippetLen {
+		return snippet
+	}
+	cut := maxSnippetLen
+	for cut > 0 && !utf8.RuneStart(snippet[cut]) {
+		cut--
+	}
+	return snippet[:cut] + "..."
+}
+
+// StatusSet is a set of HTTP status codes.
+type StatusSet map[int]bool
+
+func ParseStatusSet(list string) (StatusSet, error) {
+	set := StatusSet{}
+	for _, item := range strings.Split(list, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		code, err := strconv.Atoi(item)
+		if err != nil || code < 100 || code > 599 {
+			return nil, fmt.Errorf("invalid HTTP status %q", item)
+		}
+		set[code] = true
+	}
+	return set, nil
+}
+
+// Retryable reports whether err is worth retrying. Rate limits count as 429
+// and status errors are looked up in the set; anything that is not an HTTP
+// status (network failures, storage errors) is always retryable.
+func (s StatusSet) Retryable(err error) bool {
+	if errors.Is(err, ErrRateLimited) {
+		return s[429]
+	}
+	if errors.Is(err, ErrVacancyNotFound) || errors.Is(err, ErrPaginationDepthExceeded) || errors.Is(err, ErrTokenInvalid) {
+		return false
+	}
+	if code, ok := StatusCodeOf(err); ok {
+		return s[code]
+	}
+	return true
+}
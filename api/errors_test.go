@@ -0,0 +1,118 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+const gatewayPage = "<html>\n  <head><title>502 Bad Gateway</title></head>\n  <body>Bad   gateway</body>\n</html>"
+
+func TestBodySnippet(t *testing.T) {
+	if got := bodySnippet([]byte(gatewayPage)); got != "<html> <head><title>502 Bad Gateway</title></head> <body>Bad gateway</body> </html>" {
+		t.Errorf("snippet = %q, want whitespace collapsed", got)
+	}
+
+	long := bodySnippet([]byte(strings.Repeat("x", 500)))
+	if len(long) != maxSnippetLen+len("...") || !strings.HasSuffix(long, "...") {
+		t.Errorf("snippet of a long body is %d bytes: %q", len(long), long)
+	}
+	// A cut inside a multi-byte rune backs off to the rune start.
+	cyrillic := bodySnippet([]byte("x" + strings.Repeat("я", 150)))
+	if !utf8.ValidString(cyrillic) || len(cyrillic) > maxSnippetLen+len("...") {
+		t.Errorf("snippet %q is not valid UTF-8 within %d bytes", cyrillic, maxSnippetLen)
+	}
+}
+
+func TestHTMLBodyDecodeError(t *testing.T) {
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(gatewayPage))
+	}))
+	_, detailsErr := client.GetVacancyDetails(context.Background(), "101")
+	_, searchErr := client.GetVacancyIDs(context.Background(), SearchQuery{Role: "96", PerPage: 20}, 0)
+
+	for method, err := range map[string]error{"GetVacancyDetails": detailsErr, "GetVacancyIDs": searchErr} {
+		var decodeErr *DecodeError
+		if !errors.As(err, &decodeErr) {
+			t.Errorf("%s error = %v, want *DecodeError", method, err)
+			continue
+		}
+		if decodeErr.StatusCode != http.StatusOK || string(decodeErr.Body) != gatewayPage {
+			t.Errorf("%s DecodeError = status %d, body %q", method, decodeErr.StatusCode, decodeErr.Body)
+		}
+		for _, want := range []string{"status 200", "<title>502 Bad Gateway</title>"} {
+			if !strings.Contains(err.Error(), want) {
+				t.Errorf("%s error %q does not contain %q", method, err, want)
+			}
+		}
+	}
+}
+
+func TestUnexpectedStatusKeepsSnippet(t *testing.T) {
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+		w.Write([]byte(gatewayPage))
+	}))
+	_, detailsErr := client.GetVacancyDetails(context.Background(), "101")
+	_, searchErr := client.GetVacancyIDs(context.Background(), SearchQuery{Role: "96", PerPage: 20}, 0)
+
+	for method, err := range map[string]error{"GetVacancyDetails": detailsErr, "GetVacancyIDs": searchErr} {
+		var statusErr *StatusError
+		if !errors.As(err, &statusErr) {
+			t.Errorf("%s error = %v, want *StatusError", method, err)
+			continue
+		}
+		if statusErr.StatusCode != http.StatusBadGateway || !strings.Contains(statusErr.Snippet, "<body>Bad gateway</body>") {
+			t.Errorf("%s StatusError = %d %q", method, statusErr.StatusCode, statusErr.Snippet)
+		}
+		if !strings.Contains(err.Error(), "502") {
+			t.Errorf("%s error %q lacks the status", method, err)
+		}
+	}
+}
+
+func TestParseStatusSet(t *testing.T) {
+	set, err := ParseStatusSet(" 429, 503,,")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(set) != 2 || !set[429] || !set[503] {
+		t.Errorf("set = %v, want 429 and 503", set)
+	}
+	for _, list := range []string{"abc", "99", "600"} {
+		if _, err := ParseStatusSet(list); err == nil {
+			t.Errorf("ParseStatusSet(%q) accepted", list)
+		}
+	}
+}
+
+func TestStatusSetRetryable(t *testing.T) {
+	set, _ := ParseStatusSet("429,500,502,503,504")
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"bad request", &StatusError{StatusCode: http.StatusBadRequest}, false},
+		{"forbidden", &StatusError{StatusCode: http.StatusForbidden}, false},
+		{"service unavailable", &StatusError{StatusCode: http.StatusServiceUnavailable}, true},
+		{"bad gateway decode error", &DecodeError{StatusCode: http.StatusBadGateway}, true},
+		{"rate limited", ErrRateLimited, true},
+		{"not found", ErrVacancyNotFound, false},
+		{"token invalid", ErrTokenInvalid, false},
+		{"network", errors.New("HTTP request failed: connection reset by peer"), true},
+	}
+	for _, tt := range tests {
+		if got := set.Retryable(tt.err); got != tt.want {
+			t.Errorf("%s: Retryable = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	if (StatusSet{}).Retryable(ErrRateLimited) {
+		t.Error("429 retried although it is not in the set")
+	}
+}
@@ -0,0 +1,69 @@
+package api
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+
+	"github.com/cespare/xxhash/v2"
+)
+
+const (
+	HashMD5    = "md5"
+	HashSHA256 = "sha256"
+	HashXXHash = "xxhash"
+)
+
+type Hasher interface {
+	Name() string
+	Hash(text string) string
+}
+
+func NewHasher(name string) (Hasher, error) {
+	switch name {
+	case "", HashMD5:
+		return md5Hasher{}, nil
+	case HashSHA256:
+		return sha256Hasher{}, nil
+	case HashXXHash:
+		return xxHasher{}, nil
+	default:
+		return nil, fmt.Errorf("unknown hash algorithm %q (valid: %s, %s, %s)", name, HashMD5, HashSHA256, HashXXHash)
+	}
+}
+
+type md5Hasher struct{}
+
+func (md5Hasher) Name() string { return HashMD5 }
+
+func (md5Hasher) Hash(text string) string { return MD5Hash(text) }
+
+type sha256Hasher struct{}
+
+func (sha256Hasher) Name() string { return HashSHA256 }
+
+func (sha256Hasher) Hash(text string) string {
+	hash := sha256.Sum256([]byte(text))
+	return hexString(hash[:])
+}
+
+type xxHasher struct{}
+
+func (xxHasher) Name() string { return HashXXHash }
+
+func (xxHasher) Hash(text string) string {
+	return strconv.FormatUint(xxhash.Sum64String(text), 16)
+}
+
+func MD5Hash(text string) string {
+	hash := md5.Sum([]byte(text))
+	return hexString(hash[:])
+}
+
+func hexString(sum []byte) string {
+	var buf [2 * sha256.Size]byte
+	n := hex.Encode(buf[:], sum)
+	return string(buf[:n])
+}
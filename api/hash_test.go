@@ -0,0 +1,81 @@
+package api
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+var benchDescription = strings.Repeat("<p>Go developer, MongoDB, Kubernetes, CI/CD.</p>", 100)
+
+func TestHashersMatchStdlib(t *testing.T) {
+	for _, text := range []string{"", "a", benchDescription} {
+		md5Sum := md5.Sum([]byte(text))
+		if got, want := MD5Hash(text), hex.EncodeToString(md5Sum[:]); got != want {
+			t.Errorf("MD5Hash(%.10q) = %s, want %s", text, got, want)
+		}
+		shaSum := sha256.Sum256([]byte(text))
+		if got, want := (sha256Hasher{}).Hash(text), hex.EncodeToString(shaSum[:]); got != want {
+			t.Errorf("sha256 Hash(%.10q) = %s, want %s", text, got, want)
+		}
+	}
+}
+
+func TestNewHasher(t *testing.T) {
+	for _, name := range []string{"", HashMD5, HashSHA256, HashXXHash} {
+		hasher, err := NewHasher(name)
+		if err != nil {
+			t.Fatalf("NewHasher(%q): %v", name, err)
+		}
+		if hasher.Hash("x") != hasher.Hash("x") {
+			t.Errorf("%s hash is not deterministic", hasher.Name())
+		}
+		if hasher.Hash("x") == hasher.Hash("y") {
+			t.Errorf("%s hash does not distinguish inputs", hasher.Name())
+		}
+	}
+	if _, err := NewHasher("crc32"); err == nil {
+		t.Error("NewHasher accepted an unknown algorithm")
+	}
+}
+
+// TestHashValues pins each algorithm's output, since stored
+// description_hash values are compared against fresh hashes across runs.
+func TestHashValues(t *testing.T) {
+	const text = "<p>Go developer</p>"
+	want := map[string]string{
+		HashMD5:    "351b195c6545d644bb4e661558c8a427",
+		HashSHA256: "73457443a3ce60ac5709edb3bd987ea1073d3586bd4e44ade74b0b9cbb83e4d4",
+		HashXXHash: "eaf759df2e42ae4c",
+	}
+	seen := map[string]string{}
+	for name, hash := range want {
+		hasher, _ := NewHasher(name)
+		if got := hasher.Hash(text); got != hash {
+			t.Errorf("%s hash = %s, want %s", name, got, hash)
+		}
+		if other, ok := seen[hash]; ok {
+			t.Errorf("%s and %s produce the same hash", name, other)
+		}
+		seen[hash] = name
+	}
+
+	if hasher, _ := NewHasher(""); hasher.Name() != HashMD5 || hasher.Hash(text) != want[HashMD5] {
+		t.Errorf("default hasher is %s, want md5 to match hashes stored before --hash", hasher.Name())
+	}
+}
+
+func BenchmarkHash(b *testing.B) {
+	for _, name := range []string{HashMD5, HashSHA256, HashXXHash} {
+		hasher, _ := NewHasher(name)
+		b.Run(name, func(b *testing.B) {
+			b.SetBytes(int64(len(benchDescription)))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				hasher.Hash(benchDescription)
+			}
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package api
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// RetryBudget is shared by all workers of a run. Once Threshold rate-limit
+// responses are recorded within Window it trips, and every caller of Wait
+// blocks until Cooldown has passed instead of retrying on its own.
+//
+// When ResumeAt is set and the budget trips LongPauseTrips times without a
+// successful request in between, the quota is treated as exhausted and the
+// pause lasts until ResumeAt(now) instead.
+type RetryBudget struct {
+	Threshold      int
+	Window         time.Duration
+	Cooldown       time.Duration
+	LongPauseTrips int
+	ResumeAt       func(now time.Time) time.Time
+
+	mu          sync.Mutex
+	hits        []time.Time
+	trips       int
+	pausedUntil time.Time
+	now         func() time.Time
+}
+
+func NewRetryBudget(threshold int, window, cooldown time.Duration) *RetryBudget {
+	return &RetryBudget{
+		Threshold: threshold,
+		Window:    window,
+		Cooldown:  cooldown,
+		now:       time.Now,
+	}
+}
+
+// RecordRateLimit registers a rate-limit response and reports whether it
+// tripped the budget.
+func (b *RetryBudget) RecordRateLimit() bool {
+	if b == nil || b.Threshold <= 0 {
+		return false
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+	cutoff := now.Add(-b.Window)
+	kept := b.hits[:0]
+	for _, hit := range b.hits {
+		if hit.After(cutoff) {
+			kept = append(kept, hit)
+		}
+	}
+	b.hits = append(kept, now)
+
+	if len(b.hits) < b.Threshold || now.Before(b.pausedUntil) {
+		return false
+	}
+	b.pausedUntil = now.Add(b.Cooldown)
+	b.hits = b.hits[:0]
+	b.trips++
+	if b.ResumeAt != nil && b.trips >= b.LongPauseTrips {
+		b.pausedUntil = b.ResumeAt(now)
+		b.trips = 0
+	}
+	return true
+}
+
+// RecordSuccess resets the count of consecutive trips.
+func (b *RetryBudget) RecordSuccess() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	b.trips = 0
+	b.mu.Unlock()
+}
+
+func (b *RetryBudget) PausedUntil() time.Time {
+	if b == nil {
+		return time.Time{}
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.pausedUntil
+}
+
+func (b *RetryBudget) Wait(ctx context.Context) error {
+	if b == nil {
+		return ctx.Err()
+	}
+
+	for {
+		b.mu.Lock()
+		remaining := b.pausedUntil.Sub(b.now())
+		b.mu.Unlock()
+		if remaining <= 0 {
+			return ctx.Err()
+		}
+
+		timer := time.NewTimer(remaining)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
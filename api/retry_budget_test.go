@@ -0,0 +1,156 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock is a settable time source for RetryBudget.
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	c.mu.Unlock()
+}
+
+func newTestBudget(threshold int, window, cooldown time.Duration) (*RetryBudget, *fakeClock) {
+	clock := &fakeClock{now: time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)}
+	b := NewRetryBudget(threshold, window, cooldown)
+	b.now = clock.Now
+	return b, clock
+}
+
+func TestRetryBudgetTrips(t *testing.T) {
+	b, clock := newTestBudget(3, time.Minute, 30*time.Second)
+	for i := 1; i <= 2; i++ {
+		if b.RecordRateLimit() {
+			t.Fatalf("tripped after %d rate limits, threshold 3", i)
+		}
+		clock.Advance(time.Second)
+	}
+	if !b.RecordRateLimit() {
+		t.Fatal("did not trip at the threshold")
+	}
+	if want := clock.Now().Add(30 * time.Second); !b.PausedUntil().Equal(want) {
+		t.Errorf("paused until %v, want %v", b.PausedUntil(), want)
+	}
+	if b.RecordRateLimit() {
+		t.Error("tripped again while paused")
+	}
+}
+
+func TestRetryBudgetWindow(t *testing.T) {
+	b, clock := newTestBudget(3, time.Minute, 30*time.Second)
+	b.RecordRateLimit()
+	b.RecordRateLimit()
+	clock.Advance(61 * time.Second)
+	if b.RecordRateLimit() {
+		t.Error("rate limits outside the window counted towards the threshold")
+	}
+}
+
+func TestRetryBudgetDisabled(t *testing.T) {
+	var nilBudget *RetryBudget
+	for _, b := range []*RetryBudget{nilBudget, NewRetryBudget(0, time.Minute, time.Minute)} {
+		for i := 0; i < 100; i++ {
+			if b.RecordRateLimit() {
+				t.Fatal("disabled budget tripped")
+			}
+		}
+		if err := b.Wait(context.Background()); err != nil {
+			t.Errorf("Wait = %v", err)
+		}
+	}
+}
+
+func TestRetryBudgetLongPause(t *testing.T) {
+	b, clock := newTestBudget(1, time.Minute, time.Second)
+	resume := clock.Now().Add(6 * time.Hour)
+	b.LongPauseTrips = 2
+	b.ResumeAt = func(time.Time) time.Time { return resume }
+
+	b.RecordRateLimit()
+	clock.Advance(2 * time.Second)
+	b.RecordSuccess()
+	b.RecordRateLimit()
+	if b.PausedUntil().Equal(resume) {
+		t.Fatal("long pause after trips separated by a success")
+	}
+	clock.Advance(2 * time.Second)
+	b.RecordRateLimit()
+	if !b.PausedUntil().Equal(resume) {
+		t.Errorf("paused until %v after consecutive trips, want %v", b.PausedUntil(), resume)
+	}
+}
+
+func TestRetryBudgetWaitsUntilResume(t *testing.T) {
+	b, clock := newTestBudget(1, time.Minute, time.Second)
+	resume := clock.Now().Add(6 * time.Hour)
+	b.LongPauseTrips = 1
+	b.ResumeAt = func(time.Time) time.Time { return resume }
+	b.RecordRateLimit()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := b.Wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Wait during the long pause = %v, want it to end with the context", err)
+	}
+
+	clock.Advance(6*time.Hour + time.Second)
+	done := make(chan error, 1)
+	go func() { done <- b.Wait(context.Background()) }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Wait after the resume time = %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Wait did not return once the resume time passed")
+	}
+}
+
+func TestRetryBudgetPausesAllWaiters(t *testing.T) {
+	const cooldown = 100 * time.Millisecond
+	b := NewRetryBudget(2, time.Minute, cooldown)
+	b.RecordRateLimit()
+	b.RecordRateLimit()
+	start := time.Now()
+
+	var wg sync.WaitGroup
+	waited := make([]time.Duration, 5)
+	for i := range waited {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			b.Wait(context.Background())
+			waited[i] = time.Since(start)
+		}()
+	}
+	wg.Wait()
+	for i, d := range waited {
+		if d < cooldown-10*time.Millisecond {
+			t.Errorf("waiter %d resumed after %v, before the %v cooldown", i, d, cooldown)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	b.RecordRateLimit()
+	b.RecordRateLimit()
+	cancel()
+	if err := b.Wait(ctx); err != context.Canceled {
+		t.Errorf("Wait with a cancelled context = %v", err)
+	}
+}
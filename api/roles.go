@@ -0,0 +1,72 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	BaseProfessionalRolesURL = "https://api.hh.ru/professional_roles"
+
+	// ITRoleCategoryID is the "Информационные технологии" category.
+	ITRoleCategoryID = "11"
+)
+
+type ProfessionalRole struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type RoleCategory struct {
+	ID    string             `json:"id"`
+	Name  string             `json:"name"`
+	Roles []ProfessionalRole `json:"roles"`
+}
+
+// RoleDictionary is the professional_roles dictionary grouped by category.
+type RoleDictionary []RoleCategory
+
+func (c *HHClient) GetProfessionalRoles(ctx context.Context) (RoleDictionary, error) {
+	rolesURL := BaseProfessionalRolesURL
+	values := url.Values{}
+	c.addSiteParams(values)
+	if len(values) > 0 {
+		rolesURL += "?" + values.Encode()
+	}
+
+	var resp struct {
+		Categories RoleDictionary `json:"categories"`
+	}
+	ctx = withRequestLabel(ctx, "professional roles")
+	if err := c.doRequest(ctx, http.MethodGet, rolesURL, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Categories, nil
+}
+
+// Resolve returns the id of the role whose id or name (case-insensitive)
+// equals value. The error for an unknown value lists the IT roles.
+func (d RoleDictionary) Resolve(value string) (string, error) {
+	value = strings.TrimSpace(value)
+	for _, category := range d {
+		for _, role := range category.Roles {
+			if role.ID == value || strings.EqualFold(role.Name, value) {
+				return role.ID, nil
+			}
+		}
+	}
+
+	var known []string
+	for _, category := range d {
+		if category.ID != ITRoleCategoryID {
+			continue
+		}
+		for _, role := range category.Roles {
+			known = append(known, fmt.Sprintf("%s (%s)", role.ID, role.Name))
+		}
+	}
+	return "", fmt.Errorf("unknown professional role %q; IT roles: %s", value, strings.Join(known, ", "))
+}
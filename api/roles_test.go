@@ -0,0 +1,60 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestGetProfessionalRoles(t *testing.T) {
+	var path string
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		w.Write(fixture(t, "professional_roles.json"))
+	}))
+
+	roles, err := client.GetProfessionalRoles(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path != "/professional_roles" {
+		t.Errorf("requested %s, want /professional_roles", path)
+	}
+	if len(roles) != 2 || roles[0].ID != ITRoleCategoryID || len(roles[0].Roles) != 3 {
+		t.Errorf("roles = %+v, want the IT and sales categories", roles)
+	}
+}
+
+func TestRoleDictionaryResolve(t *testing.T) {
+	roles := RoleDictionary{
+		{ID: ITRoleCategoryID, Roles: []ProfessionalRole{{ID: "96", Name: "Программист, разработчик"}, {ID: "160", Name: "DevOps-инженер"}}},
+		{ID: "17", Roles: []ProfessionalRole{{ID: "70", Name: "Менеджер по продажам"}}},
+	}
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"96", "96"},
+		{" 160 ", "160"},
+		{"devops-инженер", "160"},
+		{"70", "70"},
+	}
+	for _, tt := range tests {
+		if got, err := roles.Resolve(tt.value); err != nil || got != tt.want {
+			t.Errorf("Resolve(%q) = %q, %v, want %q", tt.value, got, err, tt.want)
+		}
+	}
+
+	_, err := roles.Resolve("9600")
+	if err == nil {
+		t.Fatal("unknown role resolved")
+	}
+	msg := err.Error()
+	if !strings.Contains(msg, `"9600"`) || !strings.Contains(msg, "96 (Программист, разработчик)") || !strings.Contains(msg, "160 (DevOps-инженер)") {
+		t.Errorf("error = %q, want the value and the IT roles", msg)
+	}
+	if strings.Contains(msg, "70") {
+		t.Errorf("error lists roles outside IT: %q", msg)
+	}
+}
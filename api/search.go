@@ -0,0 +1,116 @@
+package api
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+var OrderByValues = []string{"publication_time", "salary_desc", "salary_asc", "relevance", "distance"}
+
+var LabelValues = []string{
+	"with_address", "accept_handicapped", "not_from_agency", "accept_kids",
+	"accredited_it", "low_performance", "internship", "night_shifts",
+}
+
+type SearchQuery struct {
+	DateFrom string
+	DateTo   string
+	Area     string
+	Role     string
+	Text     string
+	OrderBy  string
+	PerPage  int
+
+	Salary         int
+	Currency       string
+	OnlyWithSalary bool
+
+	IncludeArchived bool
+	Labels          []string
+	Employers       []string
+	NoMagic         bool
+}
+
+func (q SearchQuery) Values(page int) url.Values {
+	values := url.Values{}
+	if !IsAllAreas(q.Area) {
+		values.Set("area", q.Area)
+	}
+	values.Set("professional_role", q.Role)
+	if q.Text != "" {
+		values.Set("text", q.Text)
+	}
+	values.Set("date_from", q.DateFrom)
+	values.Set("date_to", q.DateTo)
+	if q.OrderBy != "" {
+		values.Set("order_by", q.OrderBy)
+	}
+	if q.Salary > 0 {
+		values.Set("salary", strconv.Itoa(q.Salary))
+	}
+	if q.Currency != "" {
+		values.Set("currency", q.Currency)
+	}
+	if q.OnlyWithSalary {
+		values.Set("only_with_salary", "true")
+	}
+	for _, label := range q.Labels {
+		values.Add("label", label)
+	}
+	for _, employer := range q.Employers {
+		values.Add("employer_id", employer)
+	}
+	if q.IncludeArchived {
+		values.Set("archived", "true")
+	}
+	if q.NoMagic {
+		values.Set("no_magic", "true")
+	}
+	values.Set("per_page", strconv.Itoa(q.PerPage))
+	values.Set("page", strconv.Itoa(page))
+	return values
+}
+
+func IsAllAreas(area string) bool {
+	area = strings.TrimSpace(area)
+	return area == "" || strings.EqualFold(area, "all")
+}
+
+func ValidateOrderBy(orderBy string) error {
+	if orderBy == "" {
+		return nil
+	}
+	for _, valid := range OrderByValues {
+		if orderBy == valid {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown order_by %q (valid: %s)", orderBy, strings.Join(OrderByValues, ", "))
+}
+
+func ValidateLabels(labels []string) error {
+	for _, label := range labels {
+		known := false
+		for _, valid := range LabelValues {
+			if label == valid {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return fmt.Errorf("unknown label %q (valid: %s)", label, strings.Join(LabelValues, ", "))
+		}
+	}
+	return nil
+}
+
+func ValidateEmployers(ids []string) error {
+	for _, id := range ids {
+		if n, err := strconv.ParseUint(id, 10, 64); err != nil || n == 0 {
+			return fmt.Errorf("invalid employer id %q, expected a positive number", id)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestValuesArea(t *testing.T) {
+	for _, area := range []string{"", "all", " ALL "} {
+		if values := (SearchQuery{Area: area, Role: "96"}).Values(0); values.Has("area") {
+			t.Errorf("area %q sent as area=%q", area, values.Get("area"))
+		}
+	}
+	if values := (SearchQuery{Area: "113", Role: "96"}).Values(0); values.Get("area") != "113" {
+		t.Errorf("area = %q, want 113", values.Get("area"))
+	}
+}
+
+func TestAllRegionsSearchOmitsArea(t *testing.T) {
+	var query map[string][]string
+	serve := serveFixture(t, http.StatusOK, "search_page.json")
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.Query()
+		serve(w, r)
+	}))
+
+	if _, err := client.GetVacancyIDs(context.Background(), SearchQuery{Area: "all", Role: "96", PerPage: 20}, 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := query["area"]; ok {
+		t.Errorf("all-regions search sent area=%v", query["area"])
+	}
+}
+
+func TestValuesOrderBy(t *testing.T) {
+	if values := (SearchQuery{Role: "96"}).Values(0); values.Has("order_by") {
+		t.Errorf("order_by sent without being set: %q", values.Get("order_by"))
+	}
+	if values := (SearchQuery{Role: "96", OrderBy: "publication_time"}).Values(0); values.Get("order_by") != "publication_time" {
+		t.Errorf("order_by = %q, want publication_time", values.Get("order_by"))
+	}
+}
+
+func TestValidateOrderBy(t *testing.T) {
+	for _, orderBy := range append([]string{""}, OrderByValues...) {
+		if err := ValidateOrderBy(orderBy); err != nil {
+			t.Errorf("ValidateOrderBy(%q) = %v", orderBy, err)
+		}
+	}
+	for _, orderBy := range []string{"newest", "Publication_Time", "salary"} {
+		if err := ValidateOrderBy(orderBy); err == nil {
+			t.Errorf("ValidateOrderBy(%q) accepted an unknown value", orderBy)
+		}
+	}
+}
+
+func TestValuesSalary(t *testing.T) {
+	values := (SearchQuery{Role: "96"}).Values(0)
+	for _, key := range []string{"salary", "currency", "only_with_salary"} {
+		if values.Has(key) {
+			t.Errorf("%s sent without being set: %q", key, values.Get(key))
+		}
+	}
+
+	values = (SearchQuery{Role: "96", Salary: 300000, Currency: "RUR", OnlyWithSalary: true}).Values(0)
+	for key, want := range map[string]string{"salary": "300000", "currency": "RUR", "only_with_salary": "true"} {
+		if values.Get(key) != want {
+			t.Errorf("%s = %q, want %q", key, values.Get(key), want)
+		}
+	}
+}
+
+func TestValuesArchived(t *testing.T) {
+	if values := (SearchQuery{Role: "96"}).Values(0); values.Has("archived") {
+		t.Errorf("archived sent by default: %q", values.Get("archived"))
+	}
+	if values := (SearchQuery{Role: "96", IncludeArchived: true}).Values(0); values.Get("archived") != "true" {
+		t.Errorf("archived = %q, want true", values.Get("archived"))
+	}
+}
+
+func TestValuesLabels(t *testing.T) {
+	if values := (SearchQuery{Role: "96"}).Values(0); values.Has("label") {
+		t.Errorf("label sent without being set: %q", values["label"])
+	}
+	values := (SearchQuery{Role: "96", Labels: []string{"not_from_agency", "accredited_it"}}).Values(0)
+	if got := strings.Join(values["label"], ","); got != "not_from_agency,accredited_it" {
+		t.Errorf("label = %s, want both labels as repeated parameters", got)
+	}
+	if query := values.Encode(); !strings.Contains(query, "label=not_from_agency&label=accredited_it") {
+		t.Errorf("query = %s", query)
+	}
+}
+
+func TestValuesEmployers(t *testing.T) {
+	if values := (SearchQuery{Role: "96"}).Values(0); values.Has("employer_id") {
+		t.Errorf("employer_id sent without being set: %q", values["employer_id"])
+	}
+	query := SearchQuery{Role: "96", Text: "golang", Labels: []string{"not_from_agency"}, Employers: []string{"1740", "3529"}}
+	values := query.Values(2)
+	if got := strings.Join(values["employer_id"], ","); got != "1740,3529" {
+		t.Errorf("employer_id = %s, want both employers as repeated parameters", got)
+	}
+	if values.Get("text") != "golang" || values.Get("professional_role") != "96" || values.Get("label") != "not_from_agency" {
+		t.Errorf("employers replaced the other filters: %s", values.Encode())
+	}
+	if encoded := values.Encode(); !strings.Contains(encoded, "employer_id=1740&employer_id=3529") {
+		t.Errorf("query = %s", encoded)
+	}
+}
+
+func TestValuesNoMagic(t *testing.T) {
+	if values := (SearchQuery{Text: "golang"}).Values(0); values.Has("no_magic") {
+		t.Errorf("no_magic sent without being set: %s", values.Encode())
+	}
+	if values := (SearchQuery{Text: "golang", NoMagic: true}).Values(0); values.Get("no_magic") != "true" || values.Get("text") != "golang" {
+		t.Errorf("query = %s, want no_magic=true next to the text", values.Encode())
+	}
+}
+
+func TestValidateEmployers(t *testing.T) {
+	if err := ValidateEmployers([]string{"1740", "3529"}); err != nil {
+		t.Errorf("ValidateEmployers = %v", err)
+	}
+	for _, id := range []string{"yandex", "0", "-5", "17.4"} {
+		if err := ValidateEmployers([]string{"1740", id}); err == nil || !strings.Contains(err.Error(), id) {
+			t.Errorf("ValidateEmployers(%q) = %v, want the invalid id named", id, err)
+		}
+	}
+}
+
+func TestValidateLabels(t *testing.T) {
+	if err := ValidateLabels(LabelValues); err != nil {
+		t.Errorf("ValidateLabels(%v) = %v", LabelValues, err)
+	}
+	if err := ValidateLabels([]string{"not_from_agency", "remote"}); err == nil || !strings.Contains(err.Error(), `"remote"`) {
+		t.Errorf("ValidateLabels error = %v, want the unknown label named", err)
+	}
+}
@@ -0,0 +1,121 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// lowQuotaRatio is the remaining fraction of the quota below which requests
+// start being spaced out when the API reports no reset time.
+const lowQuotaRatio = 0.25
+
+// Throttle spaces requests out based on the rate-limit headers the API
+// returns, so the client slows down as its quota shrinks instead of running
+// into 429s. Until a response carries such headers it never delays.
+type Throttle struct {
+	MaxDelay time.Duration
+
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+	now      func() time.Time
+}
+
+func NewThrottle(maxDelay time.Duration) *Throttle {
+	return &Throttle{MaxDelay: maxDelay, now: time.Now}
+}
+
+// Wait blocks until the next request slot under the current interval.
+func (t *Throttle) Wait(ctx context.Context) error {
+	if t == nil {
+		return nil
+	}
+
+	t.mu.Lock()
+	now := t.now()
+	start := t.next
+	if start.Before(now) {
+		start = now
+	}
+	t.next = start.Add(t.interval)
+	t.mu.Unlock()
+
+	delay := start.Sub(now)
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// Observe adjusts the interval from X-RateLimit-Remaining together with
+// X-RateLimit-Reset (the remaining quota is spread over the time left) or
+// X-RateLimit-Limit (the delay grows as less than a quarter is left).
+// Responses without the headers leave the interval unchanged.
+func (t *Throttle) Observe(header http.Header) {
+	if t == nil {
+		return
+	}
+	remaining, ok := headerInt(header, "X-RateLimit-Remaining", "RateLimit-Remaining")
+	if !ok {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var interval time.Duration
+	if reset, ok := headerInt(header, "X-RateLimit-Reset", "RateLimit-Reset"); ok {
+		left := time.Duration(reset) * time.Second
+		// Large values are a Unix timestamp rather than seconds left.
+		if reset > 1_000_000_000 {
+			left = time.Unix(reset, 0).Sub(t.now())
+		}
+		if left > 0 {
+			interval = left / time.Duration(remaining+1)
+		}
+	} else if limit, ok := headerInt(header, "X-RateLimit-Limit", "RateLimit-Limit"); ok && limit > 0 {
+		ratio := float64(remaining) / float64(limit)
+		if ratio < lowQuotaRatio {
+			interval = time.Duration(float64(t.MaxDelay) * (1 - ratio/lowQuotaRatio))
+		}
+	}
+	if interval > t.MaxDelay {
+		interval = t.MaxDelay
+	}
+	t.interval = interval
+}
+
+// Interval returns the current spacing between requests.
+func (t *Throttle) Interval() time.Duration {
+	if t == nil {
+		return 0
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.interval
+}
+
+func headerInt(header http.Header, names ...string) (int64, bool) {
+	for _, name := range names {
+		value := header.Get(name)
+		if value == "" {
+			continue
+		}
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || n < 0 {
+			return 0, false
+		}
+		return n, true
+	}
+	return 0, false
+}
@@ -0,0 +1,111 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func newTestThrottle(maxDelay time.Duration) (*Throttle, *fakeClock) {
+	clock := &fakeClock{now: time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)}
+	throttle := NewThrottle(maxDelay)
+	throttle.now = clock.Now
+	return throttle, clock
+}
+
+func rateLimitHeaders(pairs ...string) http.Header {
+	header := http.Header{}
+	for i := 0; i < len(pairs); i += 2 {
+		header.Set(pairs[i], pairs[i+1])
+	}
+	return header
+}
+
+func TestThrottleObserve(t *testing.T) {
+	tests := []struct {
+		name   string
+		header http.Header
+		want   time.Duration
+	}{
+		{"no headers", http.Header{}, 0},
+		{"remaining over seconds left", rateLimitHeaders("X-RateLimit-Remaining", "9", "X-RateLimit-Reset", "10"), time.Second},
+		{"unprefixed headers", rateLimitHeaders("RateLimit-Remaining", "4", "RateLimit-Reset", "10"), 2 * time.Second},
+		{"capped", rateLimitHeaders("X-RateLimit-Remaining", "0", "X-RateLimit-Reset", "3600"), 5 * time.Second},
+		{"plenty left of the limit", rateLimitHeaders("X-RateLimit-Remaining", "500", "X-RateLimit-Limit", "1000"), 0},
+		{"an eighth left of the limit", rateLimitHeaders("X-RateLimit-Remaining", "125", "X-RateLimit-Limit", "1000"), 2500 * time.Millisecond},
+		{"limit exhausted", rateLimitHeaders("X-RateLimit-Remaining", "0", "X-RateLimit-Limit", "1000"), 5 * time.Second},
+		{"garbage", rateLimitHeaders("X-RateLimit-Remaining", "soon", "X-RateLimit-Reset", "10"), 0},
+	}
+	for _, tt := range tests {
+		throttle, _ := newTestThrottle(5 * time.Second)
+		throttle.Observe(tt.header)
+		if got := throttle.Interval(); got != tt.want {
+			t.Errorf("%s: interval = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestThrottleResetTimestamp(t *testing.T) {
+	throttle, clock := newTestThrottle(time.Minute)
+	reset := clock.Now().Add(20 * time.Second).Unix()
+	throttle.Observe(rateLimitHeaders("X-RateLimit-Remaining", "3", "X-RateLimit-Reset", strconv.FormatInt(reset, 10)))
+	if got := throttle.Interval(); got != 5*time.Second {
+		t.Errorf("interval = %v, want 20s spread over 4 requests", got)
+	}
+}
+
+func TestThrottleKeepsIntervalWithoutHeaders(t *testing.T) {
+	throttle, _ := newTestThrottle(5 * time.Second)
+	throttle.Observe(rateLimitHeaders("X-RateLimit-Remaining", "1", "X-RateLimit-Reset", "2"))
+	throttle.Observe(http.Header{})
+	if got := throttle.Interval(); got != time.Second {
+		t.Errorf("interval = %v after a response without headers, want 1s kept", got)
+	}
+	throttle.Observe(rateLimitHeaders("X-RateLimit-Remaining", "900", "X-RateLimit-Limit", "1000"))
+	if got := throttle.Interval(); got != 0 {
+		t.Errorf("interval = %v once the quota recovered, want 0", got)
+	}
+}
+
+func TestThrottleWait(t *testing.T) {
+	var nilThrottle *Throttle
+	if err := nilThrottle.Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	throttle := NewThrottle(20 * time.Millisecond)
+	throttle.Observe(rateLimitHeaders("X-RateLimit-Remaining", "0", "X-RateLimit-Reset", "1"))
+	interval := throttle.Interval()
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if err := throttle.Wait(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 2*interval {
+		t.Errorf("3 requests took %v, want them %v apart", elapsed, interval)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := throttle.Wait(ctx); err == nil {
+		t.Error("Wait ignored a cancelled context")
+	}
+}
+
+func TestClientObservesRateLimitHeaders(t *testing.T) {
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-RateLimit-Remaining", "1")
+		w.Header().Set("X-RateLimit-Reset", "2")
+		w.Write(fixture(t, "vacancy.json"))
+	}))
+	client.Throttle = NewThrottle(5 * time.Second)
+	if _, err := client.GetVacancyDetails(context.Background(), "101"); err != nil {
+		t.Fatal(err)
+	}
+	if got := client.Throttle.Interval(); got != time.Second {
+		t.Errorf("interval = %v after the response headers, want 1s", got)
+	}
+}
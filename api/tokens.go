@@ -0,0 +1,95 @@
+package api
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const DefaultTokenCooldown = time.Minute
+
+// TokenPool hands out bearer tokens round-robin. A token that was rate
+// limited is benched for Cooldown and skipped while other tokens are free.
+type TokenPool struct {
+	Cooldown time.Duration
+
+	mu           sync.Mutex
+	tokens       []string
+	benchedUntil []time.Time
+	rateLimits   []int
+	next         int
+	now          func() time.Time
+}
+
+func NewTokenPool(tokens []string, cooldown time.Duration) *TokenPool {
+	return &TokenPool{
+		Cooldown:     cooldown,
+		tokens:       tokens,
+		benchedUntil: make([]time.Time, len(tokens)),
+		rateLimits:   make([]int, len(tokens)),
+		now:          time.Now,
+	}
+}
+
+func (p *TokenPool) Len() int {
+	return len(p.tokens)
+}
+
+// Tokens returns every token in the pool, benched or not.
+func (p *TokenPool) Tokens() []string {
+	return append([]string(nil), p.tokens...)
+}
+
+type tokenKey struct{}
+
+// withToken makes the request sent with ctx use token instead of the next
+// token from the pool.
+func withToken(ctx context.Context, token string) context.Context {
+	return context.WithValue(ctx, tokenKey{}, token)
+}
+
+// Next returns the next token that is not benched. When every token is
+// benched it returns the one whose cooldown ends first.
+func (p *TokenPool) Next() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.tokens) == 0 {
+		return ""
+	}
+
+	now := p.now()
+	soonest := -1
+	for i := 0; i < len(p.tokens); i++ {
+		idx := (p.next + i) % len(p.tokens)
+		if !now.Before(p.benchedUntil[idx]) {
+			p.next = idx + 1
+			return p.tokens[idx]
+		}
+		if soonest == -1 || p.benchedUntil[idx].Before(p.benchedUntil[soonest]) {
+			soonest = idx
+		}
+	}
+	p.next = soonest + 1
+	return p.tokens[soonest]
+}
+
+func (p *TokenPool) Bench(token string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for i, t := range p.tokens {
+		if t == token {
+			p.rateLimits[i]++
+			p.benchedUntil[i] = p.now().Add(p.Cooldown)
+			return
+		}
+	}
+}
+
+// RateLimits reports how many times each token (by position) was rate limited.
+func (p *TokenPool) RateLimits() []int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]int(nil), p.rateLimits...)
+}
@@ -0,0 +1,96 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestPool(tokens ...string) (*TokenPool, *fakeClock) {
+	clock := &fakeClock{now: time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)}
+	pool := NewTokenPool(tokens, time.Minute)
+	pool.now = clock.Now
+	return pool, clock
+}
+
+func nextTokens(pool *TokenPool, n int) string {
+	var tokens []string
+	for i := 0; i < n; i++ {
+		tokens = append(tokens, pool.Next())
+	}
+	return strings.Join(tokens, ",")
+}
+
+func TestTokenPoolRoundRobin(t *testing.T) {
+	pool, _ := newTestPool("a", "b", "c")
+	if got := nextTokens(pool, 7); got != "a,b,c,a,b,c,a" {
+		t.Errorf("tokens = %s, want round-robin", got)
+	}
+	if empty, _ := newTestPool(); empty.Next() != "" {
+		t.Error("empty pool returned a token")
+	}
+}
+
+func TestTokenPoolBench(t *testing.T) {
+	pool, clock := newTestPool("a", "b", "c")
+	pool.Bench("b")
+	if got := nextTokens(pool, 4); got != "a,c,a,c" {
+		t.Errorf("tokens with b benched = %s, want b skipped", got)
+	}
+
+	clock.Advance(time.Minute)
+	if got := nextTokens(pool, 3); !strings.Contains(got, "b") {
+		t.Errorf("tokens after the cooldown = %s, want b back", got)
+	}
+	if limits := pool.RateLimits(); limits[0] != 0 || limits[1] != 1 || limits[2] != 0 {
+		t.Errorf("RateLimits = %v, want [0 1 0]", limits)
+	}
+}
+
+func TestTokenPoolAllBenched(t *testing.T) {
+	pool, clock := newTestPool("a", "b")
+	pool.Bench("a")
+	clock.Advance(time.Second)
+	pool.Bench("b")
+	if got := pool.Next(); got != "a" {
+		t.Errorf("Next with every token benched = %s, want a, whose cooldown ends first", got)
+	}
+}
+
+func TestClientBenchesRateLimitedToken(t *testing.T) {
+	var mu sync.Mutex
+	var used []string
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		mu.Lock()
+		used = append(used, token)
+		mu.Unlock()
+		if token == "limited" {
+			w.WriteHeader(http.StatusTooManyRequests)
+			w.Write(fixture(t, "too_many_requests.json"))
+			return
+		}
+		w.Write(fixture(t, "vacancy.json"))
+	}))
+	client.Tokens = NewTokenPool([]string{"limited", "ok"}, time.Minute)
+
+	ctx := context.Background()
+	if _, err := client.GetVacancyDetails(ctx, "101"); !errors.Is(err, ErrRateLimited) {
+		t.Fatalf("first request error = %v, want ErrRateLimited", err)
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := client.GetVacancyDetails(ctx, "101"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := strings.Join(used, ","); got != "limited,ok,ok,ok" {
+		t.Errorf("tokens used = %s, want the rate-limited token benched", got)
+	}
+	if limits := client.Tokens.RateLimits(); limits[0] != 1 {
+		t.Errorf("RateLimits = %v, want one for the first token", limits)
+	}
+}
@@ -0,0 +1,106 @@
+package api
+
+import (
+	"context"
+	"crypto/tls"
+	"log"
+	"net/http"
+	"net/http/httptrace"
+	"strconv"
+	"time"
+)
+
+type requestLabelKey struct{}
+
+func withRequestLabel(ctx context.Context, label string) context.Context {
+	return context.WithValue(ctx, requestLabelKey{}, label)
+}
+
+func requestLabel(ctx context.Context) string {
+	label, _ := ctx.Value(requestLabelKey{}).(string)
+	return label
+}
+
+type LoggingTransport struct {
+	Next   http.RoundTripper
+	Logger *log.Logger
+}
+
+func NewLoggingTransport(next http.RoundTripper, logger *log.Logger) *LoggingTransport {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &LoggingTransport{Next: next, Logger: logger}
+}
+
+func (t *LoggingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	label := requestLabel(req.Context())
+	if label == "" {
+		label = "-"
+	}
+
+	t.Logger.Printf("[%s] --> %s %s headers=%v", label, req.Method, req.URL.String(), redactHeaders(req.Header))
+
+	// GotConn runs before RoundTrip returns, so reused is set by the time
+	// the response line is logged.
+	reused := "unknown"
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			reused = strconv.FormatBool(info.Reused)
+		},
+	}
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+
+	start := time.Now()
+	resp, err := t.Next.RoundTrip(req)
+	elapsed := time.Since(start)
+	if err != nil {
+		t.Logger.Printf("[%s] <-- %s %s error=%v (%v)", label, req.Method, req.URL.String(), err, elapsed)
+		return nil, err
+	}
+
+	t.Logger.Printf("[%s] <-- %s %s status=%d proto=%s reused=%s (%v)", label, req.Method, req.URL.String(), resp.StatusCode, resp.Proto, reused, elapsed)
+	return resp, nil
+}
+
+func redactHeaders(h http.Header) http.Header {
+	redacted := h.Clone()
+	if redacted.Get("Authorization") != "" {
+		redacted.Set("Authorization", "Bearer [REDACTED]")
+	}
+	if redacted.Get("Cookie") != "" {
+		redacted.Set("Cookie", "[REDACTED]")
+	}
+	return redacted
+}
+
+// TransportConfig tunes connection reuse. The stdlib default of two idle
+// connections per host forces new TLS handshakes once more than two
+// workers hit api.hh.ru at the same time. HTTP/2 is negotiated when the
+// server offers it unless ForceHTTP1 is set.
+type TransportConfig struct {
+	MaxIdleConns        int
+	MaxIdleConnsPerHost int
+	IdleConnTimeout     time.Duration
+	ForceHTTP1          bool
+}
+
+var DefaultTransportConfig = TransportConfig{
+	MaxIdleConns:        100,
+	MaxIdleConnsPerHost: 32,
+	IdleConnTimeout:     90 * time.Second,
+}
+
+func NewTransport(cfg TransportConfig) *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConns = cfg.MaxIdleConns
+	transport.MaxIdleConnsPerHost = cfg.MaxIdleConnsPerHost
+	transport.IdleConnTimeout = cfg.IdleConnTimeout
+	transport.DisableKeepAlives = false
+	transport.ForceAttemptHTTP2 = !cfg.ForceHTTP1
+	if cfg.ForceHTTP1 {
+		// A non-nil empty map keeps the transport from upgrading to h2.
+		transport.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	}
+	return transport
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"hh_it_scrapper/storage"
+)
+
+// runCompact implements "compact --memory-state PATH". MongoDB runs rebuild
+// their hash set from the stored documents on every start, so the only
+// persisted hash set that can collect orphans is a --memory-state snapshot.
+func runCompact(args []string) int {
+	fs := flag.NewFlagSet("compact", flag.ContinueOnError)
+	statePath := fs.String("memory-state", "", "Memory-state snapshot to compact (required)")
+	if err := fs.Parse(args); err != nil {
+		return exitConfigError
+	}
+	if *statePath == "" {
+		log.Print("--memory-state must be provided; MongoDB hash sets are rebuilt from stored documents on every run")
+		return exitConfigError
+	}
+
+	release, err := storage.AcquireLock(*statePath + ".lock")
+	if err != nil {
+		log.Print(err)
+		return exitConfigError
+	}
+	defer release()
+
+	memStore := storage.NewMemoryStore()
+	if err := memStore.Load(*statePath); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			fmt.Println("Nothing to compact: state file does not exist")
+			return exitOK
+		}
+		log.Print(err)
+		return exitConfigError
+	}
+
+	kept, pruned := memStore.Compact()
+	if err := memStore.Save(*statePath); err != nil {
+		log.Print(err)
+		return exitConfigError
+	}
+	fmt.Printf("Description hashes kept: %d, pruned: %d\n", kept, pruned)
+	return exitOK
+}
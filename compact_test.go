@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"hh_it_scrapper/api"
+	"hh_it_scrapper/storage"
+)
+
+func TestCompactPrunesClosedVacancies(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json.gz")
+	store := storage.NewMemoryStore()
+	if err := executeWithin(t, newTestPipeline(t, loadTestConfig(t), newFakeAPI(1, 2), store), context.Background(), nil); err != nil {
+		t.Fatal(err)
+	}
+	// Vacancy 2 is taken down before the next refresh.
+	client := newFakeAPI(1, 2)
+	client.detail = func(ctx context.Context, id string) (map[string]interface{}, error) {
+		if id == "2" {
+			return nil, api.ErrVacancyNotFound
+		}
+		return testVacancy(id), nil
+	}
+	if err := executeWithin(t, newTestPipeline(t, loadTestConfig(t, "--mode=refresh"), client, store), context.Background(), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Save(path); err != nil {
+		t.Fatal(err)
+	}
+
+	if code := runCompact([]string{"--memory-state=" + path}); code != exitOK {
+		t.Fatalf("exit code = %d", code)
+	}
+
+	compacted := storage.NewMemoryStore()
+	if err := compacted.Load(path); err != nil {
+		t.Fatal(err)
+	}
+	if compacted.DescriptionHashExists(api.MD5Hash("<p>Description of vacancy 2</p>")) {
+		t.Error("closed vacancy's hash kept")
+	}
+	if !compacted.DescriptionHashExists(api.MD5Hash("<p>Description of vacancy 1</p>")) {
+		t.Error("open vacancy's hash pruned")
+	}
+	if !compacted.VacancyExists("1") || !compacted.VacancyExists("2") {
+		t.Error("stored ids lost")
+	}
+	if _, err := os.Stat(path + ".lock"); !os.IsNotExist(err) {
+		t.Error("lock not released")
+	}
+}
+
+func TestCompactRespectsLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json.gz")
+	store := storage.NewMemoryStore()
+	store.UpsertVacancy(map[string]interface{}{"id": "102", "description_hash": "closed"})
+	store.AddDescriptionHash("closed")
+	store.SetFields("102", map[string]interface{}{"closed": true})
+	if err := store.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	release, err := storage.AcquireLock(path + ".lock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+
+	if code := runCompact([]string{"--memory-state=" + path}); code != exitConfigError {
+		t.Errorf("exit code = %d while another process holds the lock, want %d", code, exitConfigError)
+	}
+	unchanged := storage.NewMemoryStore()
+	if err := unchanged.Load(path); err != nil || !unchanged.DescriptionHashExists("closed") {
+		t.Errorf("snapshot changed under the lock: %v", err)
+	}
+}
+
+func TestCompactArguments(t *testing.T) {
+	if code := runCompact(nil); code != exitConfigError {
+		t.Errorf("without --memory-state: exit code = %d, want %d", code, exitConfigError)
+	}
+	missing := filepath.Join(t.TempDir(), "missing.json.gz")
+	if code := runCompact([]string{"--memory-state=" + missing}); code != exitOK {
+		t.Errorf("missing snapshot: exit code = %d, want %d", code, exitOK)
+	}
+}
@@ -2,38 +2,575 @@ package config
 
 import (
 	"flag"
+	"fmt"
 	"os"
+	"strconv"
+	"strings"
 	"time"
+
+	"hh_it_scrapper/api"
+
+	"gopkg.in/yaml.v3"
 )
 
+const MaxPerPage = 100
+
+const dateLayout = "2006-01-02"
+
+const (
+	DupPolicySkip  = "skip"
+	DupPolicyFlag  = "flag"
+	DupPolicyStore = "store"
+)
+
+const (
+	ModeNew     = "new"
+	ModeRefresh = "refresh"
+)
+
+// What enqueueing does when the prefetch buffer is full.
+const (
+	OverflowBlock = "block"
+	OverflowSpill = "spill"
+	OverflowDrop  = "drop"
+)
+
+// Target is one search from the targets file. Empty fields fall back to
+// the corresponding command-line values.
+type Target struct {
+	Name           string  `yaml:"name" json:"name"`
+	Area           string  `yaml:"area" json:"area"`
+	Role           string  `yaml:"role" json:"role"`
+	Text           string  `yaml:"text" json:"text"`
+	OrderBy        string  `yaml:"order_by" json:"order_by"`
+	MinSalary      int     `yaml:"min_salary" json:"min_salary"`
+	Currency       string  `yaml:"currency" json:"currency"`
+	OnlyWithSalary bool    `yaml:"only_with_salary" json:"only_with_salary"`
+	QPS            float64 `yaml:"qps" json:"qps"`
+}
+
 type AppConfig struct {
-	StartDate        string
-	EndDate          string
-	BearerToken      string
-	MongoURI         string
-	MaxRetries       int
-	RetryDelay       time.Duration
-	Concurrency      int
-	PerPage          int
-	Area             string
-	ProfessionalRole string
+	StartDate              string
+	EndDate                string
+	BearerTokens           []string
+	MongoURI               string
+	Retry                  RetryPolicy
+	Concurrency            int
+	SearchConcurrency      int
+	DetailConcurrency      int
+	PerPage                int
+	Area                   string
+	ProfessionalRole       string
+	Text                   string
+	DebugHTTP              bool
+	MaxDuration            time.Duration
+	NoPreload              bool
+	IDsFile                string
+	CacheDir               string
+	CacheTTL               time.Duration
+	TrackChanges           bool
+	WriteBatchSize         int
+	OrderBy                string
+	MinSalary              int
+	Currency               string
+	OnlyWithSalary         bool
+	WriteConcern           string
+	ReadPreference         string
+	Mode                   string
+	MaxFailureRatio        float64
+	HashAlgorithm          string
+	RateLimitThreshold     int
+	RateLimitWindow        time.Duration
+	RateLimitCooldown      time.Duration
+	BreakerThreshold       int
+	BreakerCooldown        time.Duration
+	SinceID                bool
+	TokensFile             string
+	FieldMap               string
+	DLQ                    string
+	TargetsFile            string
+	Reprocess              bool
+	TimeZone               string
+	Location               *time.Location
+	MaxIdleConns           int
+	MaxIdleConnsPerHost    int
+	IdleConnTimeout        time.Duration
+	DropDescription        bool
+	BatchSize              int
+	IncludeArchived        bool
+	NoProgress             bool
+	RetryStatuses          string
+	Sinks                  []string
+	SinkFile               string
+	Watch                  bool
+	Interval               time.Duration
+	Partition              string
+	SummaryOut             string
+	SummaryFormat          string
+	MemoryState            string
+	DupPolicy              string
+	NoDedupDescription     bool
+	IDsOut                 string
+	IDsOnly                bool
+	PageDelay              time.Duration
+	Cookies                string
+	UniqueDescriptionIndex bool
+	InterleaveTargets      bool
+	TargetQPS              float64
+	ServerErrorAttempts    int
+	VacancyBudget          time.Duration
+	DedupFields            []string
+	StartPage              int
+	EndPage                int
+	Resilient              bool
+	MaxConsecutiveFailures int
+	RegionPath             bool
+	RefreshStale           time.Duration
+	RefreshLimit           int
+	HTTP1                  bool
+	MinFreeSpaceMB         int
+	RequireSpace           bool
+	OverflowPolicy         string
+	OverflowFile           string
+	SkipAuthCheck          bool
+	SearchOnly             bool
+	PrefetchBuffer         int
+	Labels                 []string
+	Employers              []string
+	ShardKey               []string
+	Deterministic          bool
+	NoMagic                bool
+	DupByIDWins            bool
+	FilterPublishedAt      bool
+	RecordLatency          bool
+	Locale                 string
+	Host                   string
+	CaptureContacts        bool
+	RampUp                 time.Duration
+	RampStart              int
+	StoreRaw               string
+	ResumeAt               string
+	ResumeAfterTrips       int
+	NoSalaryFields         bool
+	SelfThrottle           bool
+	SelfThrottleMaxDelay   time.Duration
+	Targets                []Target
+	Warnings               []string
 }
 
 func LoadConfig() *AppConfig {
 	from := flag.String("from", "", "Start date in YYYY-MM-DD format (required)")
 	to := flag.String("to", "", "End date in YYYY-MM-DD format (required)")
+	debugHTTP := flag.Bool("debug-http", false, "Log every HTTP request and response to logs/debug.log")
+	maxDuration := flag.Duration("max-duration", 0, "Stop the run after this duration, e.g. 2h (0 = no limit)")
+	noPreload := flag.Bool("no-preload", false, "Skip loading all stored ids/hashes upfront and check existence on demand")
+	idsFile := flag.String("ids-file", "", "Fetch the newline-separated vacancy IDs from this file instead of searching")
+	cacheDir := flag.String("cache-dir", "", "Cache successful API GET responses in this directory (disabled when empty)")
+	cacheTTL := flag.Duration("cache-ttl", time.Hour, "How long cached API responses stay fresh (0 = never expire)")
+	perPage := flag.Int("per-page", MaxPerPage, "Search results per page (1-100)")
+	area := flag.String("area", "113", "HH area ID to search in (\"all\" or empty searches every region)")
+	trackChanges := flag.Bool("track-changes", false, "Re-fetch known vacancies and keep a history of description edits")
+	concurrency := flag.Int("concurrency", 10, "Default worker count for the detail phase")
+	searchConcurrency := flag.Int("search-concurrency", 1, "Concurrent search page requests; pages are fetched one at a time by default")
+	detailConcurrency := flag.Int("detail-concurrency", 0, "Concurrent vacancy detail requests (defaults to --concurrency)")
+	writeBatchSize := flag.Int("write-batch-size", 0, "Buffer this many vacancies per bulk upsert (0 or 1 writes each immediately)")
+	orderBy := flag.String("order-by", "", "Search result ordering: publication_time, salary_desc, salary_asc, relevance or distance")
+	minSalary := flag.Int("min-salary", 0, "Only return vacancies offering at least this salary")
+	currency := flag.String("currency", "", "Currency code for --min-salary, e.g. RUR or USD")
+	onlyWithSalary := flag.Bool("only-with-salary", false, "Only return vacancies that specify a salary")
+	writeConcern := flag.String("write-concern", os.Getenv("MONGO_WRITE_CONCERN"), "MongoDB write concern, e.g. majority or 1 (driver default when empty)")
+	readPreference := flag.String("read-preference", os.Getenv("MONGO_READ_PREFERENCE"), "MongoDB read preference, e.g. primary or secondaryPreferred")
+	mode := flag.String("mode", ModeNew, "new: only fetch vacancies not stored yet; refresh: re-fetch every matched vacancy")
+	maxFailureRatio := flag.Float64("max-failure-ratio", 0.5, "Mark the run failed when more than this fraction of vacancies fail permanently (0-1)")
+	hashAlgorithm := flag.String("hash", "md5", "Description hash algorithm for dedup: md5, sha256 or xxhash")
+	rateLimitThreshold := flag.Int("rate-limit-threshold", 20, "Pause all workers after this many rate-limit responses within --rate-limit-window (0 disables)")
+	rateLimitWindow := flag.Duration("rate-limit-window", time.Minute, "Window for counting rate-limit responses")
+	rateLimitCooldown := flag.Duration("rate-limit-cooldown", time.Minute, "How long all workers pause once the rate-limit budget trips")
+	breakerThreshold := flag.Int("breaker-threshold", 0, "Open the HH API circuit breaker after this many consecutive 5xx/network failures, e.g. 5 (0 disables)")
+	breakerCooldown := flag.Duration("breaker-cooldown", 30*time.Second, "How long the open circuit breaker rejects calls before probing again")
+	text := flag.String("text", "", "Free-text search query")
+	sinceID := flag.Bool("since-id", false, "Stop paging once a whole page is at or below the highest stored vacancy id")
+	tokensFile := flag.String("tokens-file", os.Getenv("BEARER_TOKENS_FILE"), "File with one HH bearer token per line, used in rotation with BEARER_TOKEN")
+	fieldMap := flag.String("field-map", "", "Rename fields before storing: a JSON file of {\"from\": \"to\"} or inline from=to,from=to (dot paths allowed)")
+	dlq := flag.String("dlq", "", "Dead-letter target for unprocessable vacancies: \"mongo\" (dead_letters collection) or a JSONL file path")
+	targetsFile := flag.String("targets-file", "", "YAML or JSON file listing search targets (area, role, text, filters) to scrape in one run")
+	reprocess := flag.Bool("reprocess", false, "Re-derive computed fields for every stored vacancy without calling the API")
+	tz := flag.String("tz", "UTC", "IANA timezone the --from/--to dates are interpreted in, e.g. Europe/Moscow")
+	maxIdleConns := flag.Int("max-idle-conns", 100, "Maximum idle HTTP connections kept across all hosts")
+	maxIdleConnsPerHost := flag.Int("max-idle-conns-per-host", 0, "Maximum idle HTTP connections kept per host (defaults to search + detail concurrency)")
+	idleConnTimeout := flag.Duration("idle-conn-timeout", 90*time.Second, "How long an idle HTTP connection is kept for reuse")
+	dropDescription := flag.Bool("drop-description", false, "Remove the HTML description after hashing it; description_hash is kept for dedup")
+	batchSize := flag.Int("batch-size", 1000, "Documents per cursor batch when scanning the stored collection (0 = server default)")
+	includeArchived := flag.Bool("include-archived", false, "Also search archived vacancies; stored documents keep their archived flag")
+	noProgress := flag.Bool("no-progress", false, "Disable the live progress bar shown when stderr is a terminal")
+	retryStatuses := flag.String("retry-statuses", "429,500,502,503,504", "Comma-separated HTTP statuses that are retried; other 4xx/5xx fail immediately")
+	sinks := flag.String("sinks", "mongo", "Comma-separated sinks every vacancy is written to: mongo, file (mongo answers dedup checks)")
+	sinkFile := flag.String("sink-file", "vacancies.jsonl", "JSONL file used by the file sink")
+	watch := flag.Bool("watch", false, "Keep running: after each run wait --interval and scrape again from where the last run started")
+	interval := flag.Duration("interval", 15*time.Minute, "Pause between runs in --watch mode")
+	partition := flag.String("partition", "", "Collection layout: empty for a single collection, \"monthly\" for one collection per publication month")
+	summaryOut := flag.String("summary-out", "-", "Where to write the run summary: - for stdout, a file path, or empty to suppress it")
+	summaryFormat := flag.String("summary-format", "text", "Run summary format: text or json")
+	memoryState := flag.String("memory-state", "", "Run without MongoDB: keep dedup state in memory, loaded from and saved to this gzipped JSON file")
+	dupPolicy := flag.String("dup-policy", DupPolicySkip, "Vacancies with an already stored description: skip, flag (store with is_duplicate/duplicate_of) or store")
+	prefetchBuffer := flag.Int("prefetch-buffer", 500, "Vacancy ids buffered between search pages and detail workers")
+	var labels []string
+	flag.Func("labels", "Search label filter, e.g. not_from_agency or accredited_it (comma-separated, repeatable)", func(value string) error {
+		labels = append(labels, splitList(value)...)
+		return nil
+	})
+	filterPublishedAt := flag.Bool("filter-published-at", false, "Discard fetched vacancies whose published_at lies outside the --from/--to window")
+	recordLatency := flag.Bool("record-latency", false, "Store each vacancy's detail fetch time as fetch_latency_ms")
+	locale := flag.String("locale", "", "API locale for returned content, e.g. EN (API default when empty)")
+	host := flag.String("host", "", "hh portal to query, e.g. hh.ru, rabota.by or hh.kz (API default when empty)")
+	captureContacts := flag.Bool("capture-contacts", false, "Store the vacancy's contact person, email and phones (personal data, off by default)")
+	rampUp := flag.Duration("ramp-up", 0, "Grow detail concurrency from --ramp-start to --detail-concurrency over this warm-up, e.g. 30s (0 disables)")
+	rampStart := flag.Int("ramp-start", 2, "Detail workers allowed at the start of --ramp-up and after a rate limit halves it")
+	storeRaw := flag.String("store-raw", "", "Keep the untouched API payload in a raw field for --reprocess: json or gzip (off when empty)")
+	resumeAt := flag.String("resume-at", "", "Clock time (HH:MM in --tz) to pause until once rate limiting persists, e.g. 00:05 after a daily quota reset")
+	resumeAfterTrips := flag.Int("resume-after-trips", 3, "Consecutive rate-limit budget trips without a success that trigger the --resume-at pause")
+	noSalaryFields := flag.Bool("no-salary-fields", false, "Do not derive salary_from_num, salary_to_num, salary_mid_num and has_salary")
+	selfThrottle := flag.Bool("self-throttle", false, "Slow requests down as X-RateLimit-Remaining/-Reset/-Limit response headers report a shrinking quota")
+	selfThrottleMaxDelay := flag.Duration("self-throttle-max-delay", 5*time.Second, "Upper bound on the delay --self-throttle inserts between requests")
+	noDedupDescription := flag.Bool("no-dedup-description", false, "Store every new vacancy even if its description is already stored (same as --dup-policy=store)")
+	role := flag.String("role", "96", "Professional role id or exact name; checked against the professional_roles dictionary at startup")
+	idsOut := flag.String("ids-out", "", "Append each newly discovered vacancy id to this file (- for stdout)")
+	idsOnly := flag.Bool("ids-only", false, "Only write new ids to --ids-out; do not fetch or store vacancy details")
+	pageDelay := flag.Duration("page-delay", 0, "Minimum time between search page requests, shared by all search workers")
+	cookies := flag.String("cookies", os.Getenv("HH_COOKIES"), "Cookies sent to hh.ru, e.g. the ones issued after solving a captcha: \"name=value; name2=value2\"")
+	uniqueDescriptionIndex := flag.Bool("unique-description-index", false, "Create a partial unique index on description_hash so MongoDB itself rejects duplicate descriptions")
+	interleaveTargets := flag.Bool("interleave-targets", false, "Search all targets at once, sharing the search workers fairly, instead of one after another")
+	targetQPS := flag.Float64("target-qps", 0, "Default cap on search page requests per second for each target (0 is unlimited; targets may set qps)")
+	serverErrorAttempts := flag.Int("server-error-attempts", 4, "Attempts for a vacancy that keeps returning 5xx before it is dead-lettered and skipped")
+	dedupFields := flag.String("dedup-fields", "description", "Comma-separated fields (dot paths such as employer.id) hashed together into description_hash for duplicate detection")
+	startPage := flag.Int("start-page", 0, "First search page to fetch (0-based) for each target")
+	endPage := flag.Int("end-page", -1, "Last search page to fetch, inclusive (-1 fetches to the end)")
+	resilient := flag.Bool("resilient", false, "In --watch mode, retry cycles that fail with a configuration, token or MongoDB error instead of stopping")
+	maxConsecutiveFailures := flag.Int("max-consecutive-failures", 5, "Failed cycles in a row after which --watch mode exits")
+	regionPath := flag.Bool("region-path", false, "Store region_path, the area names from country to city, resolved from the areas dictionary")
+	var refreshStale time.Duration
+	flag.Func("refresh-stale", "Re-fetch stored vacancies whose last_seen is older than this age (e.g. 7d or 36h) instead of searching; vanished ones are marked closed", func(value string) error {
+		age, err := parseAge(value)
+		refreshStale = age
+		return err
+	})
+	refreshLimit := flag.Int("refresh-limit", 1000, "Maximum number of stale vacancies --refresh-stale re-fetches per run, oldest first")
+	http1 := flag.Bool("http1", false, "Force HTTP/1.1 instead of negotiating HTTP/2, for troubleshooting")
+	minFreeSpace := flag.Int("min-free-space", 100, "Free space in MB expected in the log, cache and output directories at startup (0 disables the check)")
+	requireSpace := flag.Bool("require-space", false, "Abort instead of warning when --min-free-space is not met")
+	overflowPolicy := flag.String("overflow-policy", OverflowBlock, "When the prefetch buffer is full: block search, spill ids to --overflow-file, or drop them with a warning")
+	overflowFile := flag.String("overflow-file", "overflow_ids.txt", "File the spill overflow policy appends ids to (usable as --ids-file later)")
+	skipAuthCheck := flag.Bool("skip-auth-check", false, "Do not verify BEARER_TOKEN with a request to /me before the run")
+	searchOnly := flag.Bool("search-only", false, "Store the search result snippets as they are instead of fetching vacancy details")
+	retryBase := flag.Duration("retry-base", DefaultRetryPolicy.Base, "Delay before the first retry of a failed request")
+	retryCap := flag.Duration("retry-cap", DefaultRetryPolicy.Cap, "Upper bound on the delay between retries")
+	retryMultiplier := flag.Float64("retry-multiplier", DefaultRetryPolicy.Multiplier, "Factor the retry delay grows by after each attempt")
+	retryMaxAttempts := flag.Int("retry-max-attempts", DefaultRetryPolicy.MaxAttempts, "Attempts per request, the first one included")
+	retryJitter := flag.Float64("retry-jitter", DefaultRetryPolicy.Jitter, "Random spread applied to each retry delay as a fraction, e.g. 0.2 for ±20%")
+	var employers []string
+	flag.Func("employers", "Only search vacancies of these employer ids (comma-separated, repeatable)", func(value string) error {
+		employers = append(employers, splitList(value)...)
+		return nil
+	})
+	shardKey := flag.String("shard-key", "", "Shard key fields of a sharded vacancies collection, e.g. area.id,id; added to upsert filters and indexed")
+	deterministic := flag.Bool("deterministic", false, "Use one search and one detail worker and no retry jitter, so runs against the same data process ids in the same order")
+	noMagic := flag.Bool("no-magic", false, "Send no_magic=true so hh.ru does not rewrite --text into automatic filters")
+	dupByIDWins := flag.Bool("dup-by-id-wins", false, "Store a new id even if its description is already stored, recording the collision (same as --dup-policy=flag)")
+	vacancyBudget := flag.Duration("vacancy-budget", 0, "Total time for all attempts on one vacancy before it is dead-lettered, e.g. 30s (0 = no limit)")
 	flag.Parse()
 
-	return &AppConfig{
-		StartDate:        *from,
-		EndDate:          *to,
-		BearerToken:      os.Getenv("BEARER_TOKEN"),
-		MongoURI:         os.Getenv("MONGO_URI"),
-		MaxRetries:       3,
-		RetryDelay:       10 * time.Second,
-		Concurrency:      10,
-		PerPage:          100,
-		Area:             "113",
-		ProfessionalRole: "96",
+	cfg := &AppConfig{
+		StartDate:          *from,
+		EndDate:            *to,
+		BearerTokens:       splitList(os.Getenv("BEARER_TOKEN")),
+		MongoURI:           os.Getenv("MONGO_URI"),
+		Concurrency:        *concurrency,
+		SearchConcurrency:  *searchConcurrency,
+		DetailConcurrency:  *detailConcurrency,
+		PerPage:            *perPage,
+		Area:               *area,
+		ProfessionalRole:   *role,
+		Text:               *text,
+		DebugHTTP:          *debugHTTP,
+		MaxDuration:        *maxDuration,
+		NoPreload:          *noPreload,
+		IDsFile:            *idsFile,
+		CacheDir:           *cacheDir,
+		CacheTTL:           *cacheTTL,
+		TrackChanges:       *trackChanges,
+		WriteBatchSize:     *writeBatchSize,
+		OrderBy:            *orderBy,
+		MinSalary:          *minSalary,
+		Currency:           strings.ToUpper(*currency),
+		OnlyWithSalary:     *onlyWithSalary,
+		WriteConcern:       *writeConcern,
+		ReadPreference:     *readPreference,
+		Mode:               *mode,
+		MaxFailureRatio:    *maxFailureRatio,
+		HashAlgorithm:      *hashAlgorithm,
+		RateLimitThreshold: *rateLimitThreshold,
+		RateLimitWindow:    *rateLimitWindow,
+		RateLimitCooldown:  *rateLimitCooldown,
+		BreakerThreshold:   *breakerThreshold,
+		BreakerCooldown:    *breakerCooldown,
+		SinceID:            *sinceID,
+		FieldMap:           *fieldMap,
+		DLQ:                *dlq,
+	}
+	cfg.TokensFile = *tokensFile
+	cfg.TargetsFile = *targetsFile
+	cfg.Reprocess = *reprocess
+	cfg.TimeZone = *tz
+	cfg.MaxIdleConns = *maxIdleConns
+	cfg.MaxIdleConnsPerHost = *maxIdleConnsPerHost
+	cfg.IdleConnTimeout = *idleConnTimeout
+	cfg.DropDescription = *dropDescription
+	cfg.BatchSize = *batchSize
+	cfg.IncludeArchived = *includeArchived
+	cfg.NoProgress = *noProgress
+	cfg.RetryStatuses = *retryStatuses
+	cfg.Sinks = splitList(*sinks)
+	cfg.SinkFile = *sinkFile
+	cfg.Watch = *watch
+	cfg.Interval = *interval
+	cfg.Partition = *partition
+	cfg.SummaryOut = *summaryOut
+	cfg.SummaryFormat = *summaryFormat
+	cfg.MemoryState = *memoryState
+	cfg.DupPolicy = *dupPolicy
+	cfg.NoDedupDescription = *noDedupDescription
+	cfg.IDsOut = *idsOut
+	cfg.IDsOnly = *idsOnly
+	cfg.PageDelay = *pageDelay
+	cfg.Cookies = *cookies
+	cfg.UniqueDescriptionIndex = *uniqueDescriptionIndex
+	cfg.InterleaveTargets = *interleaveTargets
+	cfg.TargetQPS = *targetQPS
+	cfg.ServerErrorAttempts = *serverErrorAttempts
+	cfg.StartPage = *startPage
+	cfg.EndPage = *endPage
+	cfg.Resilient = *resilient
+	cfg.MaxConsecutiveFailures = *maxConsecutiveFailures
+	cfg.RegionPath = *regionPath
+	cfg.RefreshStale = refreshStale
+	cfg.RefreshLimit = *refreshLimit
+	cfg.HTTP1 = *http1
+	cfg.MinFreeSpaceMB = *minFreeSpace
+	cfg.RequireSpace = *requireSpace
+	cfg.OverflowPolicy = *overflowPolicy
+	cfg.OverflowFile = *overflowFile
+	cfg.SkipAuthCheck = *skipAuthCheck
+	cfg.SearchOnly = *searchOnly
+	cfg.Retry = RetryPolicy{
+		Base:        *retryBase,
+		Cap:         *retryCap,
+		Multiplier:  *retryMultiplier,
+		MaxAttempts: *retryMaxAttempts,
+		Jitter:      *retryJitter,
+	}
+	if fields := splitList(*dedupFields); !(len(fields) == 1 && fields[0] == "description") {
+		cfg.DedupFields = fields
+	}
+	cfg.PrefetchBuffer = *prefetchBuffer
+	cfg.Labels = labels
+	cfg.Employers = employers
+	cfg.ShardKey = splitList(*shardKey)
+	cfg.Deterministic = *deterministic
+	cfg.NoMagic = *noMagic
+	cfg.DupByIDWins = *dupByIDWins
+	cfg.VacancyBudget = *vacancyBudget
+	cfg.FilterPublishedAt = *filterPublishedAt
+	cfg.RecordLatency = *recordLatency
+	cfg.Locale = strings.ToUpper(*locale)
+	cfg.Host = *host
+	cfg.CaptureContacts = *captureContacts
+	cfg.RampUp = *rampUp
+	cfg.RampStart = *rampStart
+	cfg.StoreRaw = *storeRaw
+	cfg.ResumeAt = *resumeAt
+	cfg.ResumeAfterTrips = *resumeAfterTrips
+	cfg.NoSalaryFields = *noSalaryFields
+	cfg.SelfThrottle = *selfThrottle
+	cfg.SelfThrottleMaxDelay = *selfThrottleMaxDelay
+	cfg.clampPerPage()
+	if cfg.SinceID && cfg.OrderBy == "" {
+		cfg.OrderBy = "publication_time"
+	}
+	if cfg.Deterministic {
+		cfg.applyDeterministic()
+	}
+	if cfg.DetailConcurrency <= 0 {
+		cfg.DetailConcurrency = cfg.Concurrency
+	}
+	if cfg.MaxIdleConnsPerHost <= 0 {
+		cfg.MaxIdleConnsPerHost = cfg.SearchConcurrency + cfg.DetailConcurrency
+	}
+
+	return cfg
+}
+
+// applyDeterministic removes the sources of run-to-run variation in
+// ordering and timing: the worker fan-out, interleaved targets, the
+// concurrency ramp and retry jitter. Search pages are then fetched in page
+// order and details in the order their ids were found.
+func (c *AppConfig) applyDeterministic() {
+	c.Concurrency = 1
+	c.SearchConcurrency = 1
+	c.DetailConcurrency = 1
+	c.InterleaveTargets = false
+	c.RampUp = 0
+	c.Retry.Jitter = 0
+}
+
+func (c *AppConfig) clampPerPage() {
+	if c.PerPage > MaxPerPage {
+		c.Warnings = append(c.Warnings, fmt.Sprintf("per-page %d exceeds the API maximum, clamped to %d", c.PerPage, MaxPerPage))
+		c.PerPage = MaxPerPage
+	}
+}
+
+// ApplyTimeZone loads TimeZone and rewrites StartDate and EndDate into
+// timestamps covering the whole of both days in that zone, so the window
+// does not depend on the server's local time.
+func (c *AppConfig) ApplyTimeZone() error {
+	loc, err := time.LoadLocation(c.TimeZone)
+	if err != nil {
+		return fmt.Errorf("invalid --tz %q: %w", c.TimeZone, err)
+	}
+	c.Location = loc
+
+	if c.StartDate != "" {
+		start, err := time.ParseInLocation(dateLayout, c.StartDate, loc)
+		if err != nil {
+			return fmt.Errorf("invalid --from date: %w", err)
+		}
+		c.StartDate = start.Format(api.TimeLayout)
+	}
+	if c.EndDate != "" {
+		end, err := time.ParseInLocation(dateLayout, c.EndDate, loc)
+		if err != nil {
+			return fmt.Errorf("invalid --to date: %w", err)
+		}
+		c.EndDate = end.AddDate(0, 0, 1).Add(-time.Second).Format(api.TimeLayout)
+	}
+	return nil
+}
+
+// SetWindow replaces the date window with exact timestamps in Location.
+func (c *AppConfig) SetWindow(from, to time.Time) {
+	c.StartDate = from.In(c.Location).Format(api.TimeLayout)
+	c.EndDate = to.In(c.Location).Format(api.TimeLayout)
+}
+
+// Window parses StartDate and EndDate once ApplyTimeZone or SetWindow has
+// turned them into timestamps.
+func (c *AppConfig) Window() (time.Time, time.Time, error) {
+	from, err := time.Parse(api.TimeLayout, c.StartDate)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid window start: %w", err)
+	}
+	to, err := time.Parse(api.TimeLayout, c.EndDate)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid window end: %w", err)
+	}
+	return from, to, nil
+}
+
+// NextResumeAt returns the first occurrence of the ResumeAt clock time in
+// Location after now.
+func (c *AppConfig) NextResumeAt(now time.Time) (time.Time, error) {
+	clock, err := time.Parse("15:04", c.ResumeAt)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid --resume-at %q, expected HH:MM: %w", c.ResumeAt, err)
+	}
+	local := now.In(c.Location)
+	resume := time.Date(local.Year(), local.Month(), local.Day(), clock.Hour(), clock.Minute(), 0, 0, c.Location)
+	if !resume.After(now) {
+		resume = resume.AddDate(0, 0, 1)
+	}
+	return resume, nil
+}
+
+// LoadTokensFile appends the tokens listed one per line in TokensFile.
+func (c *AppConfig) LoadTokensFile() error {
+	if c.TokensFile == "" {
+		return nil
+	}
+	data, err := os.ReadFile(c.TokensFile)
+	if err != nil {
+		return fmt.Errorf("failed to read tokens file: %w", err)
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if token := strings.TrimSpace(line); token != "" && !strings.HasPrefix(token, "#") {
+			c.BearerTokens = append(c.BearerTokens, token)
+		}
+	}
+	return nil
+}
+
+// LoadTargetsFile reads the search targets listed in TargetsFile. JSON is
+// accepted as well since it is valid YAML.
+func (c *AppConfig) LoadTargetsFile() error {
+	if c.TargetsFile == "" {
+		return nil
+	}
+	data, err := os.ReadFile(c.TargetsFile)
+	if err != nil {
+		return fmt.Errorf("failed to read targets file: %w", err)
+	}
+
+	var file struct {
+		Targets []Target `yaml:"targets"`
+	}
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("failed to parse targets file: %w", err)
+	}
+	if len(file.Targets) == 0 {
+		return fmt.Errorf("targets file %s lists no targets", c.TargetsFile)
+	}
+	for i := range file.Targets {
+		file.Targets[i].Currency = strings.ToUpper(file.Targets[i].Currency)
+	}
+	c.Targets = file.Targets
+	return nil
+}
+
+// BearerTokensFromEnv returns the tokens from BEARER_TOKEN and
+// BEARER_TOKENS_FILE without parsing any flags.
+func BearerTokensFromEnv() ([]string, error) {
+	cfg := &AppConfig{
+		BearerTokens: splitList(os.Getenv("BEARER_TOKEN")),
+		TokensFile:   os.Getenv("BEARER_TOKENS_FILE"),
+	}
+	if err := cfg.LoadTokensFile(); err != nil {
+		return nil, err
+	}
+	return cfg.BearerTokens, nil
+}
+
+// parseAge accepts a whole number of days such as "7d" as well as any
+// time.ParseDuration value.
+func parseAge(value string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n <= 0 {
+			return 0, fmt.Errorf("invalid age %q", value)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	age, err := time.ParseDuration(value)
+	if err != nil || age <= 0 {
+		return 0, fmt.Errorf("invalid age %q", value)
+	}
+	return age, nil
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
 	}
+	return items
 }
@@ -0,0 +1,284 @@
+package config
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// loadConfig runs LoadConfig with args as the command line.
+func loadConfig(t *testing.T, args ...string) *AppConfig {
+	t.Helper()
+	oldArgs, oldFlags := os.Args, flag.CommandLine
+	t.Cleanup(func() { os.Args, flag.CommandLine = oldArgs, oldFlags })
+	os.Args = append([]string{"hh_it_scrapper"}, args...)
+	flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	return LoadConfig()
+}
+
+func TestPerPageClamped(t *testing.T) {
+	cfg := loadConfig(t, "--per-page=250")
+	if cfg.PerPage != MaxPerPage {
+		t.Errorf("PerPage = %d, want %d", cfg.PerPage, MaxPerPage)
+	}
+	if len(cfg.Warnings) != 1 || cfg.Warnings[0] != "per-page 250 exceeds the API maximum, clamped to 100" {
+		t.Errorf("Warnings = %q", cfg.Warnings)
+	}
+}
+
+func TestPerPageInRange(t *testing.T) {
+	for _, args := range [][]string{{"--per-page=1"}, {"--per-page=50"}, {"--per-page=100"}, nil} {
+		cfg := loadConfig(t, args...)
+		if len(cfg.Warnings) != 0 {
+			t.Errorf("%v: unexpected warnings %q", args, cfg.Warnings)
+		}
+	}
+	if cfg := loadConfig(t, "--per-page=50"); cfg.PerPage != 50 {
+		t.Errorf("PerPage = %d, want 50", cfg.PerPage)
+	}
+	if cfg := loadConfig(t); cfg.PerPage != MaxPerPage {
+		t.Errorf("PerPage defaults to %d, want %d", cfg.PerPage, MaxPerPage)
+	}
+}
+
+func TestConcurrencyDefaults(t *testing.T) {
+	tests := []struct {
+		args           []string
+		search, detail int
+	}{
+		{nil, 1, 10},
+		{[]string{"--concurrency=4"}, 1, 4},
+		{[]string{"--concurrency=4", "--detail-concurrency=6"}, 1, 6},
+		{[]string{"--search-concurrency=3", "--detail-concurrency=2"}, 3, 2},
+	}
+	for _, tt := range tests {
+		cfg := loadConfig(t, tt.args...)
+		if cfg.SearchConcurrency != tt.search || cfg.DetailConcurrency != tt.detail {
+			t.Errorf("%v: search, detail concurrency = %d, %d, want %d, %d",
+				tt.args, cfg.SearchConcurrency, cfg.DetailConcurrency, tt.search, tt.detail)
+		}
+	}
+}
+
+func TestBreakerDisabledByDefault(t *testing.T) {
+	if cfg := loadConfig(t); cfg.BreakerThreshold != 0 {
+		t.Errorf("BreakerThreshold defaults to %d, want 0 (disabled)", cfg.BreakerThreshold)
+	}
+	if cfg := loadConfig(t, "--breaker-threshold=5"); cfg.BreakerThreshold != 5 {
+		t.Errorf("BreakerThreshold = %d, want 5", cfg.BreakerThreshold)
+	}
+}
+
+func TestBearerTokensFromEnv(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens")
+	if err := os.WriteFile(path, []byte("# team tokens\nfile-1\n\n  file-2  \n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("BEARER_TOKEN", "env-1, env-2")
+	t.Setenv("BEARER_TOKENS_FILE", path)
+
+	tokens, err := BearerTokensFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(tokens, ","); got != "env-1,env-2,file-1,file-2" {
+		t.Errorf("tokens = %s, want env-1,env-2,file-1,file-2", got)
+	}
+
+	t.Setenv("BEARER_TOKENS_FILE", filepath.Join(t.TempDir(), "missing"))
+	if _, err := BearerTokensFromEnv(); err == nil {
+		t.Error("missing tokens file accepted")
+	}
+}
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadTargetsFile(t *testing.T) {
+	yamlFile := writeFile(t, "targets.yaml", `targets:
+  - name: go-moscow
+    area: "1"
+    role: "96"
+    text: golang
+    min_salary: 300000
+    currency: rur
+  - name: qa-everywhere
+    role: "124"
+    only_with_salary: true
+    qps: 0.5
+`)
+	jsonFile := writeFile(t, "targets.json", `{"targets": [
+  {"name": "go-moscow", "area": "1", "role": "96", "text": "golang", "min_salary": 300000, "currency": "RUR"},
+  {"name": "qa-everywhere", "role": "124", "only_with_salary": true, "qps": 0.5}
+]}`)
+	want := []Target{
+		{Name: "go-moscow", Area: "1", Role: "96", Text: "golang", MinSalary: 300000, Currency: "RUR"},
+		{Name: "qa-everywhere", Role: "124", OnlyWithSalary: true, QPS: 0.5},
+	}
+	for _, path := range []string{yamlFile, jsonFile} {
+		cfg := &AppConfig{TargetsFile: path}
+		if err := cfg.LoadTargetsFile(); err != nil {
+			t.Fatalf("%s: %v", filepath.Base(path), err)
+		}
+		if !reflect.DeepEqual(cfg.Targets, want) {
+			t.Errorf("%s: targets = %+v, want %+v", filepath.Base(path), cfg.Targets, want)
+		}
+	}
+}
+
+func TestLoadTargetsFileInvalid(t *testing.T) {
+	for _, path := range []string{
+		writeFile(t, "empty.yaml", "targets: []\n"),
+		writeFile(t, "broken.yaml", "targets: [name: a\n"),
+		filepath.Join(t.TempDir(), "missing.yaml"),
+	} {
+		cfg := &AppConfig{TargetsFile: path}
+		if err := cfg.LoadTargetsFile(); err == nil {
+			t.Errorf("%s accepted", filepath.Base(path))
+		}
+	}
+}
+
+func TestApplyTimeZone(t *testing.T) {
+	tests := []struct {
+		tz                 string
+		startDate, endDate string
+		from, to           time.Time
+	}{
+		{"UTC", "2024-03-01T00:00:00+0000", "2024-03-01T23:59:59+0000",
+			time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), time.Date(2024, 3, 1, 23, 59, 59, 0, time.UTC)},
+		{"Europe/Moscow", "2024-03-01T00:00:00+0300", "2024-03-01T23:59:59+0300",
+			time.Date(2024, 2, 29, 21, 0, 0, 0, time.UTC), time.Date(2024, 3, 1, 20, 59, 59, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		cfg := loadConfig(t, "--from=2024-03-01", "--to=2024-03-01", "--tz="+tt.tz)
+		if err := cfg.ApplyTimeZone(); err != nil {
+			t.Fatal(err)
+		}
+		if cfg.StartDate != tt.startDate || cfg.EndDate != tt.endDate {
+			t.Errorf("%s: window %s to %s, want %s to %s", tt.tz, cfg.StartDate, cfg.EndDate, tt.startDate, tt.endDate)
+		}
+		from, to, err := cfg.Window()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !from.Equal(tt.from) || !to.Equal(tt.to) {
+			t.Errorf("%s: window covers %v to %v, want %v to %v", tt.tz, from.UTC(), to.UTC(), tt.from, tt.to)
+		}
+	}
+}
+
+func TestApplyTimeZoneInvalid(t *testing.T) {
+	for _, args := range [][]string{
+		{"--tz=Mars/Olympus_Mons"},
+		{"--from=01.03.2024"},
+	} {
+		cfg := loadConfig(t, args...)
+		if err := cfg.ApplyTimeZone(); err == nil {
+			t.Errorf("%v accepted", args)
+		}
+	}
+}
+
+func TestNextResumeAt(t *testing.T) {
+	cfg := loadConfig(t, "--tz=Europe/Moscow", "--resume-at=00:05")
+	if err := cfg.ApplyTimeZone(); err != nil {
+		t.Fatal(err)
+	}
+	// 20:30 UTC is 23:30 in Moscow, so the reset is 35 minutes away.
+	now := time.Date(2024, 3, 1, 20, 30, 0, 0, time.UTC)
+	resume, err := cfg.NextResumeAt(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := time.Date(2024, 3, 1, 21, 5, 0, 0, time.UTC); !resume.Equal(want) {
+		t.Errorf("NextResumeAt = %v, want %v", resume.UTC(), want)
+	}
+}
+
+func TestConnectionPoolDefaults(t *testing.T) {
+	cfg := loadConfig(t, "--search-concurrency=2", "--detail-concurrency=12")
+	if cfg.MaxIdleConnsPerHost != 14 {
+		t.Errorf("MaxIdleConnsPerHost = %d, want search + detail concurrency", cfg.MaxIdleConnsPerHost)
+	}
+	if cfg.MaxIdleConns != 100 || cfg.IdleConnTimeout != 90*time.Second {
+		t.Errorf("MaxIdleConns, IdleConnTimeout = %d, %v, want 100, 90s", cfg.MaxIdleConns, cfg.IdleConnTimeout)
+	}
+	if cfg := loadConfig(t, "--max-idle-conns-per-host=4", "--idle-conn-timeout=5s"); cfg.MaxIdleConnsPerHost != 4 || cfg.IdleConnTimeout != 5*time.Second {
+		t.Errorf("MaxIdleConnsPerHost, IdleConnTimeout = %d, %v, want 4, 5s", cfg.MaxIdleConnsPerHost, cfg.IdleConnTimeout)
+	}
+}
+
+func TestLabelsFlag(t *testing.T) {
+	cfg := loadConfig(t, "--labels=not_from_agency, accredited_it", "--labels=with_address")
+	if got := strings.Join(cfg.Labels, ","); got != "not_from_agency,accredited_it,with_address" {
+		t.Errorf("Labels = %s, want the comma-separated and repeated values", got)
+	}
+	if cfg := loadConfig(t); len(cfg.Labels) != 0 {
+		t.Errorf("Labels default to %v, want none", cfg.Labels)
+	}
+}
+
+func TestEmployersFlag(t *testing.T) {
+	cfg := loadConfig(t, "--employers=1740, 3529", "--employers=78638")
+	if got := strings.Join(cfg.Employers, ","); got != "1740,3529,78638" {
+		t.Errorf("Employers = %s, want the comma-separated and repeated values", got)
+	}
+}
+
+func TestLocaleAndHost(t *testing.T) {
+	cfg := loadConfig(t, "--locale=en", "--host=rabota.by")
+	if cfg.Locale != "EN" || cfg.Host != "rabota.by" {
+		t.Errorf("locale, host = %q, %q, want EN, rabota.by", cfg.Locale, cfg.Host)
+	}
+	if cfg := loadConfig(t); cfg.Locale != "" || cfg.Host != "" {
+		t.Errorf("locale, host default to %q, %q, want unset", cfg.Locale, cfg.Host)
+	}
+}
+
+func TestParseAge(t *testing.T) {
+	tests := []struct {
+		value string
+		want  time.Duration
+		ok    bool
+	}{
+		{"7d", 7 * 24 * time.Hour, true},
+		{"36h", 36 * time.Hour, true},
+		{"90m", 90 * time.Minute, true},
+		{"0d", 0, false},
+		{"-1h", 0, false},
+		{"1.5d", 0, false},
+		{"week", 0, false},
+	}
+	for _, tt := range tests {
+		got, err := parseAge(tt.value)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("parseAge(%q) = %v, %v, want %v", tt.value, got, err, tt.want)
+		}
+	}
+
+	if cfg := loadConfig(t, "--refresh-stale=7d", "--refresh-limit=50"); cfg.RefreshStale != 7*24*time.Hour || cfg.RefreshLimit != 50 {
+		t.Errorf("refresh stale %v, limit %d, want 168h and 50", cfg.RefreshStale, cfg.RefreshLimit)
+	}
+}
+
+func TestDeterministic(t *testing.T) {
+	cfg := loadConfig(t, "--deterministic", "--concurrency=10", "--search-concurrency=4", "--detail-concurrency=8",
+		"--interleave-targets", "--ramp-up=10s", "--retry-jitter=0.5")
+	if cfg.Concurrency != 1 || cfg.SearchConcurrency != 1 || cfg.DetailConcurrency != 1 {
+		t.Errorf("concurrency = %d/%d/%d, want 1/1/1", cfg.Concurrency, cfg.SearchConcurrency, cfg.DetailConcurrency)
+	}
+	if cfg.InterleaveTargets || cfg.RampUp != 0 || cfg.Retry.Jitter != 0 {
+		t.Errorf("interleave %v, ramp-up %v, jitter %v, want all disabled", cfg.InterleaveTargets, cfg.RampUp, cfg.Retry.Jitter)
+	}
+}
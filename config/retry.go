@@ -0,0 +1,62 @@
+package config
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// RetryPolicy is the backoff shared by every retry loop. The delay before
+// retry n (counting from 0) is Base*Multiplier^n, capped at Cap and then
+// spread by ±Jitter (a fraction, e.g. 0.2) so workers that failed together
+// do not retry together.
+type RetryPolicy struct {
+	Base        time.Duration
+	Cap         time.Duration
+	Multiplier  float64
+	MaxAttempts int
+	Jitter      float64
+}
+
+// DefaultRetryPolicy keeps the historical schedule, three retries 10s apart.
+// Backoff and jitter are opt-in through --retry-multiplier and --retry-jitter.
+var DefaultRetryPolicy = RetryPolicy{
+	Base:        10 * time.Second,
+	Cap:         time.Minute,
+	Multiplier:  1,
+	MaxAttempts: 4,
+}
+
+// Retries is how many times a failed call may be repeated.
+func (r RetryPolicy) Retries() int {
+	return r.MaxAttempts - 1
+}
+
+func (r RetryPolicy) Delay(retry int) time.Duration {
+	delay := float64(r.Base) * math.Pow(r.Multiplier, float64(retry))
+	if r.Cap > 0 && delay > float64(r.Cap) {
+		delay = float64(r.Cap)
+	}
+	if r.Jitter > 0 {
+		delay *= 1 + r.Jitter*(2*rand.Float64()-1)
+	}
+	return time.Duration(delay)
+}
+
+// Validate checks the policy built from the --retry-* flags.
+func (r RetryPolicy) Validate() error {
+	switch {
+	case r.Base <= 0:
+		return errors.New("--retry-base must be positive")
+	case r.Cap < r.Base:
+		return errors.New("--retry-cap must be at least --retry-base")
+	case r.Multiplier < 1:
+		return errors.New("--retry-multiplier must be at least 1")
+	case r.MaxAttempts < 1:
+		return errors.New("--retry-max-attempts must be at least 1")
+	case r.Jitter < 0 || r.Jitter >= 1:
+		return errors.New("--retry-jitter must be in [0, 1)")
+	}
+	return nil
+}
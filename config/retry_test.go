@@ -0,0 +1,78 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRetryPolicyDelay(t *testing.T) {
+	policy := RetryPolicy{Base: time.Second, Cap: 10 * time.Second, Multiplier: 2, MaxAttempts: 6}
+	for retry, want := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second, 10 * time.Second} {
+		if got := policy.Delay(retry); got != want {
+			t.Errorf("Delay(%d) = %v, want %v", retry, got, want)
+		}
+	}
+	if policy.Retries() != 5 {
+		t.Errorf("Retries() = %d, want 5", policy.Retries())
+	}
+
+	// The historical schedule: a flat 10s between three retries.
+	for retry := 0; retry < DefaultRetryPolicy.Retries(); retry++ {
+		if got := DefaultRetryPolicy.Delay(retry); got != 10*time.Second {
+			t.Errorf("default Delay(%d) = %v, want 10s", retry, got)
+		}
+	}
+	if DefaultRetryPolicy.Retries() != 3 {
+		t.Errorf("default Retries() = %d, want 3", DefaultRetryPolicy.Retries())
+	}
+}
+
+func TestRetryPolicyJitter(t *testing.T) {
+	policy := RetryPolicy{Base: time.Second, Cap: time.Second, Multiplier: 1, MaxAttempts: 2, Jitter: 0.2}
+	seen := map[time.Duration]bool{}
+	for i := 0; i < 100; i++ {
+		delay := policy.Delay(3)
+		if delay < 800*time.Millisecond || delay > 1200*time.Millisecond {
+			t.Fatalf("Delay = %v, want within 20%% of the 1s cap", delay)
+		}
+		seen[delay] = true
+	}
+	if len(seen) < 2 {
+		t.Error("jitter did not spread the delays")
+	}
+}
+
+func TestRetryPolicyValidate(t *testing.T) {
+	valid := RetryPolicy{Base: time.Second, Cap: time.Minute, Multiplier: 2, MaxAttempts: 3, Jitter: 0.1}
+	if err := valid.Validate(); err != nil {
+		t.Errorf("Validate(%+v) = %v", valid, err)
+	}
+	if err := DefaultRetryPolicy.Validate(); err != nil {
+		t.Errorf("default policy invalid: %v", err)
+	}
+	for _, mutate := range []func(*RetryPolicy){
+		func(p *RetryPolicy) { p.Base = 0 },
+		func(p *RetryPolicy) { p.Cap = time.Millisecond },
+		func(p *RetryPolicy) { p.Multiplier = 0.5 },
+		func(p *RetryPolicy) { p.MaxAttempts = 0 },
+		func(p *RetryPolicy) { p.Jitter = 1 },
+		func(p *RetryPolicy) { p.Jitter = -0.1 },
+	} {
+		policy := valid
+		mutate(&policy)
+		if err := policy.Validate(); err == nil {
+			t.Errorf("Validate(%+v) accepted", policy)
+		}
+	}
+}
+
+func TestRetryFlags(t *testing.T) {
+	cfg := loadConfig(t, "--retry-base=2s", "--retry-cap=30s", "--retry-multiplier=3", "--retry-max-attempts=5", "--retry-jitter=0.25")
+	want := RetryPolicy{Base: 2 * time.Second, Cap: 30 * time.Second, Multiplier: 3, MaxAttempts: 5, Jitter: 0.25}
+	if cfg.Retry != want {
+		t.Errorf("Retry = %+v, want %+v", cfg.Retry, want)
+	}
+	if cfg := loadConfig(t); cfg.Retry != DefaultRetryPolicy {
+		t.Errorf("Retry = %+v, want the default policy", cfg.Retry)
+	}
+}
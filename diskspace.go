@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+
+	"hh_it_scrapper/config"
+	"hh_it_scrapper/logger"
+)
+
+// freeSpace reports the writable bytes left in a directory; tests replace it.
+var freeSpace = availableBytes
+
+// checkDiskSpace warns when a directory the run writes to has less than
+// --min-free-space left, and fails with --require-space, so a small
+// container does not crash mid-run on a full disk.
+func checkDiskSpace(cfg *config.AppConfig, logger *logger.AppLogger) error {
+	dirs := []string{"logs"}
+	if cfg.CacheDir != "" {
+		dirs = append(dirs, cfg.CacheDir)
+	}
+	if containsSink(cfg.Sinks, "file") {
+		dirs = append(dirs, filepath.Dir(cfg.SinkFile))
+	}
+	if cfg.MemoryState != "" {
+		dirs = append(dirs, filepath.Dir(cfg.MemoryState))
+	}
+
+	minBytes := uint64(cfg.MinFreeSpaceMB) << 20
+	for _, dir := range dirs {
+		free, ok := freeSpace(dir)
+		if !ok || free >= minBytes {
+			continue
+		}
+		msg := fmt.Sprintf("only %d MB free in %s, below --min-free-space %d MB", free>>20, dir, cfg.MinFreeSpaceMB)
+		if cfg.RequireSpace {
+			return fmt.Errorf("%s", msg)
+		}
+		log.Printf("Warning: %s", msg)
+		logger.Error.Printf("Disk space warning: %s", msg)
+	}
+	return nil
+}
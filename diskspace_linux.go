@@ -0,0 +1,13 @@
+package main
+
+import "syscall"
+
+// availableBytes reports the space unprivileged users can still write in
+// the file system holding dir.
+func availableBytes(dir string) (uint64, bool) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(dir, &stat); err != nil {
+		return 0, false
+	}
+	return stat.Bavail * uint64(stat.Bsize), true
+}
@@ -0,0 +1,16 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestAvailableBytes(t *testing.T) {
+	dir := t.TempDir()
+	if free, ok := availableBytes(dir); !ok || free == 0 {
+		t.Errorf("availableBytes(%s) = %d, %v, want the free space", dir, free, ok)
+	}
+	if _, ok := availableBytes(filepath.Join(dir, "missing")); ok {
+		t.Error("space reported for a missing directory")
+	}
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package main
+
+// availableBytes is only implemented on Linux, where the scraper's
+// containers run; elsewhere the disk space check is skipped.
+func availableBytes(dir string) (uint64, bool) {
+	return 0, false
+}
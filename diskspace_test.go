@@ -0,0 +1,72 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckDiskSpace(t *testing.T) {
+	dir := t.TempDir()
+	cacheDir := filepath.Join(dir, "cache")
+	tests := []struct {
+		name    string
+		args    []string
+		free    map[string]uint64
+		err     string
+		warning string
+	}{
+		{"enough space", nil, map[string]uint64{"logs": 600 << 20, cacheDir: 600 << 20}, "", ""},
+		{"low cache warns", nil, map[string]uint64{"logs": 600 << 20, cacheDir: 100 << 20}, "", "only 100 MB free in " + cacheDir},
+		{"low cache aborts", []string{"--require-space"}, map[string]uint64{"logs": 600 << 20, cacheDir: 100 << 20}, "only 100 MB free in " + cacheDir, ""},
+		{"exactly the minimum", []string{"--require-space"}, map[string]uint64{"logs": 500 << 20, cacheDir: 500 << 20}, "", ""},
+		{"unknown space is skipped", []string{"--require-space"}, map[string]uint64{}, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := loadTestConfig(t, append([]string{"--min-free-space=500", "--cache-dir=" + cacheDir}, tt.args...)...)
+			var checked []string
+			stubFreeSpace(t, func(dir string) (uint64, bool) {
+				checked = append(checked, dir)
+				free, ok := tt.free[dir]
+				return free, ok
+			})
+			appLogger, errorLog := bufferLogger()
+
+			err := checkDiskSpace(cfg, appLogger)
+			if tt.err == "" && err != nil || tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+				t.Errorf("error = %v, want %q", err, tt.err)
+			}
+			if tt.warning == "" && errorLog.Len() > 0 || !strings.Contains(errorLog.String(), tt.warning) {
+				t.Errorf("logged %q, want %q", errorLog, tt.warning)
+			}
+			if strings.Join(checked, ",") != "logs,"+cacheDir {
+				t.Errorf("checked %v, want the log and cache directories", checked)
+			}
+		})
+	}
+}
+
+func TestCheckDiskSpaceDirectories(t *testing.T) {
+	dir := t.TempDir()
+	cfg := loadTestConfig(t, "--sinks=mongo,file", "--sink-file="+filepath.Join(dir, "out", "vacancies.jsonl"), "--memory-state="+filepath.Join(dir, "state", "state.json.gz"))
+	var checked []string
+	stubFreeSpace(t, func(dir string) (uint64, bool) {
+		checked = append(checked, dir)
+		return 1 << 40, true
+	})
+	if err := checkDiskSpace(cfg, testLogger()); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"logs", filepath.Join(dir, "out"), filepath.Join(dir, "state")}
+	if strings.Join(checked, ",") != strings.Join(want, ",") {
+		t.Errorf("checked %v, want %v", checked, want)
+	}
+}
+
+func stubFreeSpace(t *testing.T, fn func(dir string) (uint64, bool)) {
+	t.Helper()
+	saved := freeSpace
+	freeSpace = fn
+	t.Cleanup(func() { freeSpace = saved })
+}
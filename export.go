@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"hh_it_scrapper/storage"
+)
+
+// runExport implements "export [--filter EXPR] [--out PATH]", writing the
+// matching stored vacancies as JSON lines.
+func runExport(args []string) int {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	filterExpr := fs.String("filter", "", "Comma-separated key=value filter: area, currency, min-salary, role, from, to")
+	out := fs.String("out", "-", "Output file, or - for stdout")
+	batchSize := fs.Int("batch-size", 1000, "Cursor batch size for the scan")
+	timeout := fs.Duration("timeout", time.Hour, "Timeout for the whole command")
+	if err := fs.Parse(args); err != nil {
+		return exitConfigError
+	}
+	filter, err := storage.ParseExportFilter(*filterExpr)
+	if err != nil {
+		log.Print(err)
+		return exitConfigError
+	}
+
+	mongoURI := os.Getenv("MONGO_URI")
+	if mongoURI == "" {
+		log.Print("MONGO_URI must be provided")
+		return exitConfigError
+	}
+
+	w := os.Stdout
+	if *out != "-" {
+		file, err := os.Create(*out)
+		if err != nil {
+			log.Print(err)
+			return exitConfigError
+		}
+		defer file.Close()
+		w = file
+	}
+	buf := bufio.NewWriter(w)
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	mongoStore, err := storage.NewMongoStore(mongoURI, "vacancy_db", "vacancies")
+	if err != nil {
+		log.Print(err)
+		return exitDBError
+	}
+	defer mongoStore.Collection.Database().Client().Disconnect(context.Background())
+	mongoStore.BatchSize = int32(*batchSize)
+
+	enc := json.NewEncoder(buf)
+	exported := 0
+	err = mongoStore.Export(ctx, filter, func(data map[string]interface{}) error {
+		exported++
+		return enc.Encode(data)
+	})
+	if err == nil {
+		err = buf.Flush()
+	}
+	if err != nil {
+		log.Print(err)
+		return exitDBError
+	}
+	fmt.Fprintf(os.Stderr, "%d vacancies exported\n", exported)
+	return exitOK
+}
@@ -2,9 +2,14 @@ module hh_it_scrapper
 
 go 1.23.4
 
-require go.mongodb.org/mongo-driver v1.17.4
+require (
+	github.com/cespare/xxhash/v2 v2.3.0
+	go.mongodb.org/mongo-driver v1.17.4
+	gopkg.in/yaml.v3 v3.0.1
+)
 
 require (
+	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/golang/snappy v0.0.4 // indirect
 	github.com/klauspost/compress v1.16.7 // indirect
 	github.com/montanaflynn/stats v0.7.1 // indirect
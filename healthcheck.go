@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"hh_it_scrapper/api"
+	"hh_it_scrapper/config"
+	"hh_it_scrapper/logger"
+	"hh_it_scrapper/storage"
+)
+
+type healthChecker interface {
+	Ping(ctx context.Context) error
+}
+
+type authChecker interface {
+	CheckAuth(ctx context.Context) error
+}
+
+// runHealthcheck implements "healthcheck [--api] [--timeout 5s]". It only
+// pings MongoDB and, with --api, makes one authenticated request, then
+// prints a one-line status and returns an exit code.
+func runHealthcheck(args []string) int {
+	fs := flag.NewFlagSet("healthcheck", flag.ContinueOnError)
+	checkAPI := fs.Bool("api", false, "Also verify the bearer token with one authenticated API request")
+	timeout := fs.Duration("timeout", 5*time.Second, "Timeout for the whole check")
+	if err := fs.Parse(args); err != nil {
+		return exitConfigError
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	mongoURI := os.Getenv("MONGO_URI")
+	if mongoURI == "" {
+		fmt.Println("unhealthy: MONGO_URI must be provided")
+		return exitConfigError
+	}
+	mongoStore, err := storage.NewMongoStore(mongoURI, "vacancy_db", "vacancies")
+	if err != nil {
+		fmt.Println(logger.RedactURIs(fmt.Sprintf("unhealthy: %v", err)))
+		return exitDBError
+	}
+	defer mongoStore.Collection.Database().Client().Disconnect(context.Background())
+
+	var auth authChecker
+	if *checkAPI {
+		tokens, err := config.BearerTokensFromEnv()
+		if err != nil {
+			fmt.Printf("unhealthy: %v\n", err)
+			return exitConfigError
+		}
+		if len(tokens) == 0 {
+			fmt.Println("unhealthy: BEARER_TOKEN must be provided for --api")
+			return exitConfigError
+		}
+		auth = api.NewHHClient(tokens...)
+	}
+
+	// The output goes to stdout for probes, past the redacting log writer,
+	// and driver errors can quote MONGO_URI.
+	code, message := checkHealth(ctx, mongoStore, auth)
+	fmt.Println(logger.RedactURIs(message))
+	return code
+}
+
+func checkHealth(ctx context.Context, db healthChecker, auth authChecker) (int, string) {
+	if err := db.Ping(ctx); err != nil {
+		return exitDBError, fmt.Sprintf("unhealthy: MongoDB: %v", err)
+	}
+	if auth != nil {
+		if err := auth.CheckAuth(ctx); err != nil {
+			return exitAPIError, fmt.Sprintf("unhealthy: HH API: %v", err)
+		}
+	}
+	return exitOK, "healthy"
+}
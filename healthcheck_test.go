@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"hh_it_scrapper/api"
+)
+
+type fakeHealth struct {
+	err   error
+	calls int
+}
+
+func (f *fakeHealth) Ping(ctx context.Context) error {
+	f.calls++
+	return f.err
+}
+
+func (f *fakeHealth) CheckAuth(ctx context.Context) error {
+	f.calls++
+	return f.err
+}
+
+func TestCheckHealth(t *testing.T) {
+	tests := []struct {
+		name    string
+		db      error
+		auth    error
+		noAuth  bool
+		code    int
+		message string
+	}{
+		{"healthy", nil, nil, false, exitOK, "healthy"},
+		{"auth not checked", nil, nil, true, exitOK, "healthy"},
+		{"mongo unreachable", errors.New("server selection error: connection refused"), nil, false, exitDBError, "unhealthy: MongoDB: server selection error"},
+		{"token invalid", nil, fmt.Errorf("unauthorized: %w", api.ErrTokenInvalid), false, exitAPIError, "unhealthy: HH API: unauthorized"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, auth := &fakeHealth{err: tt.db}, &fakeHealth{err: tt.auth}
+			var checker authChecker = auth
+			if tt.noAuth {
+				checker = nil
+			}
+			code, message := checkHealth(context.Background(), db, checker)
+			if code != tt.code || !strings.HasPrefix(message, tt.message) {
+				t.Errorf("checkHealth = %d, %q, want %d, %q", code, message, tt.code, tt.message)
+			}
+			if tt.db != nil && auth.calls != 0 {
+				t.Error("auth checked although MongoDB is down")
+			}
+		})
+	}
+}
+
+func TestHealthcheckNeedsMongoURI(t *testing.T) {
+	t.Setenv("MONGO_URI", "")
+	if code := runHealthcheck([]string{"--timeout=1s"}); code != exitConfigError {
+		t.Errorf("exit code = %d, want %d", code, exitConfigError)
+	}
+}
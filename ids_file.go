@@ -0,0 +1,53 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"hh_it_scrapper/logger"
+)
+
+func readIDsFile(path string, logger *logger.AppLogger) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open IDs file: %w", err)
+	}
+	defer file.Close()
+
+	var ids []string
+	seen := make(map[string]struct{})
+	scanner := bufio.NewScanner(file)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if !isVacancyID(line) {
+			logger.Error.Printf("Skipping malformed vacancy ID on line %d of %s: %q", lineNo, path, line)
+			continue
+		}
+		if _, dup := seen[line]; dup {
+			continue
+		}
+		seen[line] = struct{}{}
+		ids = append(ids, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read IDs file: %w", err)
+	}
+
+	return ids, nil
+}
+
+func isVacancyID(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"hh_it_scrapper/api"
+	"hh_it_scrapper/storage"
+)
+
+func writeIDsFile(t *testing.T, lines ...string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "ids.txt")
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestReadIDsFile(t *testing.T) {
+	path := writeIDsFile(t, "101", "", "# backfill", "abc", " 102 ", "101", "10x3", "103")
+	appLogger, errors := bufferLogger()
+
+	ids, err := readIDsFile(path, appLogger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(ids, ",") != "101,102,103" {
+		t.Errorf("ids = %v, want [101 102 103]", ids)
+	}
+	for _, want := range []string{`line 4 of ` + path + `: "abc"`, `line 7 of ` + path + `: "10x3"`} {
+		if !strings.Contains(errors.String(), want) {
+			t.Errorf("no warning for %s in:\n%s", want, errors)
+		}
+	}
+}
+
+func TestReadIDsFileMissing(t *testing.T) {
+	if _, err := readIDsFile(filepath.Join(t.TempDir(), "missing.txt"), testLogger()); err == nil {
+		t.Error("missing file accepted")
+	}
+}
+
+func TestIDsFileRun(t *testing.T) {
+	path := writeIDsFile(t, "101", "102", "103")
+	cfg := loadTestConfig(t, "--ids-file="+path, "--detail-concurrency=1")
+	ids, err := readIDsFile(path, testLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := newFakeAPI(0, 0)
+	failed := false
+	client.detail = func(ctx context.Context, id string) (map[string]interface{}, error) {
+		if id == "103" && !failed {
+			failed = true
+			return nil, &api.StatusError{StatusCode: http.StatusServiceUnavailable}
+		}
+		return testVacancy(id), nil
+	}
+	store := storage.NewMemoryStore()
+	store.UpsertVacancy(testVacancy("102"))
+	p := newTestPipeline(t, cfg, client, store)
+
+	if err := executeWithin(t, p, context.Background(), ids); err != nil {
+		t.Fatal(err)
+	}
+	search, _, _ := client.counts()
+	if search != 0 {
+		t.Errorf("%d search requests in --ids-file mode", search)
+	}
+	if got := strings.Join(client.detailCalls, ","); got != "101,103,103" {
+		t.Errorf("detail requests = %s, want 101 and 103 retried once; 102 is stored already", got)
+	}
+	if !store.VacancyExists("101") || !store.VacancyExists("103") || p.stats.Saved() != 2 {
+		t.Errorf("saved = %d, want 101 and 103 stored", p.stats.Saved())
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// idWriter appends vacancy ids to a file or stdout, one per line. Writes
+// are buffered; Flush pushes them out.
+type idWriter struct {
+	path   string
+	mu     sync.Mutex
+	buf    *bufio.Writer
+	closer io.Closer
+}
+
+func openIDWriter(path string) (*idWriter, error) {
+	if path == "-" {
+		return &idWriter{path: "stdout", buf: bufio.NewWriter(os.Stdout)}, nil
+	}
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0666)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open id file: %w", err)
+	}
+	return &idWriter{path: path, buf: bufio.NewWriter(file), closer: file}, nil
+}
+
+func (w *idWriter) Write(id string) error {
+	if w == nil {
+		return nil
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if _, err := w.buf.WriteString(id + "\n"); err != nil {
+		return fmt.Errorf("failed to write ids to %s: %w", w.path, err)
+	}
+	return nil
+}
+
+func (w *idWriter) Flush() error {
+	if w == nil {
+		return nil
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := w.buf.Flush(); err != nil {
+		return fmt.Errorf("failed to flush ids to %s: %w", w.path, err)
+	}
+	return nil
+}
+
+func (w *idWriter) Close() error {
+	err := w.Flush()
+	if w.closer != nil {
+		if closeErr := w.closer.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"hh_it_scrapper/api"
+	"hh_it_scrapper/config"
+)
+
+func TestIDsOut(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		fetched int
+	}{
+		{"with details", nil, 3},
+		{"ids only", []string{"--ids-only"}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "ids.txt")
+			cfg := loadTestConfig(t, append([]string{"--ids-out=" + path}, tt.args...)...)
+			client := newFakeAPI(0, 0)
+			client.pages = [][]string{{"1", "2", "3"}, {"3", "4"}}
+			store := newCountingStore()
+			if err := store.MemoryStore.UpsertVacancy(testVacancy("2")); err != nil {
+				t.Fatal(err)
+			}
+			writer, err := openIDWriter(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			p := newTestPipeline(t, cfg, client, store)
+			p.idsOut = writer
+			if err := executeWithin(t, p, context.Background(), nil); err != nil {
+				t.Fatal(err)
+			}
+			if err := writer.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ids := strings.Fields(string(data))
+			sort.Strings(ids)
+			if got := strings.Join(ids, ","); got != "1,3,4" {
+				t.Errorf("ids written = %s, want the new ids 1,3,4", got)
+			}
+			if _, detail, _ := client.counts(); detail != tt.fetched {
+				t.Errorf("%d vacancies fetched, want %d", detail, tt.fetched)
+			}
+		})
+	}
+}
+
+func TestIDWriterAppends(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ids.txt")
+	for _, id := range []string{"1", "2"} {
+		writer, err := openIDWriter(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := writer.Write(id); err != nil {
+			t.Fatal(err)
+		}
+		if data, _ := os.ReadFile(path); strings.Contains(string(data), id) {
+			t.Errorf("id %s written before Flush", id)
+		}
+		if err := writer.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if data, _ := os.ReadFile(path); string(data) != "1\n2\n" {
+		t.Errorf("file = %q, want both runs' ids", data)
+	}
+
+	var nilWriter *idWriter
+	if err := nilWriter.Write("1"); err != nil || nilWriter.Flush() != nil {
+		t.Error("nil writer is not a no-op")
+	}
+}
+
+func TestValidateConfigIDsOut(t *testing.T) {
+	for _, args := range [][]string{
+		{"--ids-only"},
+		{"--ids-out=ids.txt", "--reprocess"},
+	} {
+		setArgs(t, append(append([]string{}, testArgs...), args...)...)
+		if err := validateConfig(config.LoadConfig()); err == nil {
+			t.Errorf("%v accepted", args)
+		}
+	}
+}
+
+func TestCancelledPageKeepsParsedIDs(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ids.txt")
+	cfg := loadTestConfig(t, "--ids-out="+path)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client := newFakeAPI(2, 3)
+	client.search = func(ctx context.Context, page int) (api.SearchResult, error) {
+		// The run is cancelled after the page body was read.
+		cancel()
+		return client.page(page), ctx.Err()
+	}
+	writer, err := openIDWriter(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := newTestPipeline(t, cfg, client, newCountingStore())
+	p.idsOut = writer
+	var infoLog bytes.Buffer
+	p.logger.Info = log.New(&infoLog, "", 0)
+
+	if err := executeWithin(t, p, ctx, nil); !errors.Is(err, context.Canceled) {
+		t.Errorf("execute error = %v, want context.Canceled", err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, _ := os.ReadFile(path)
+	if got := strings.Join(strings.Fields(string(data)), ","); got != "1,2,3" {
+		t.Errorf("ids written = %s, want the cancelled page's ids", got)
+	}
+	if !strings.Contains(infoLog.String(), "run cancelled on page 0, 3 parsed ids kept") {
+		t.Errorf("log does not report the kept ids:\n%s", infoLog.String())
+	}
+}
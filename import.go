@@ -0,0 +1,225 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"hh_it_scrapper/api"
+	"hh_it_scrapper/storage"
+	"hh_it_scrapper/transform"
+)
+
+// maxImportLine bounds one NDJSON document; stored vacancies with their
+// HTML description stay far below it.
+const maxImportLine = 16 << 20
+
+// importDateFields are the dates the scraper stores. JSON exports carry them
+// as RFC 3339 strings, so they are parsed back before the upsert.
+var importDateFields = []string{
+	"first_seen", "last_seen", "closed_at",
+	"published_at_date", "created_at_date", "initial_created_at_date",
+}
+
+type importStats struct {
+	imported   int
+	duplicates int
+	rehashed   int
+	malformed  int
+}
+
+// runImport implements "import --file PATH", seeding the store from NDJSON
+// vacancy documents such as the ones export writes. Each description_hash
+// is recomputed like the scraper does, and documents whose hash is already
+// stored under another id are skipped as duplicates.
+func runImport(args []string) int {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	file := fs.String("file", "", "NDJSON file with one vacancy document per line, or - for stdin")
+	hashAlgorithm := fs.String("hash", "md5", "Description hash algorithm the store uses: md5, sha256 or xxhash")
+	dedupFields := fs.String("dedup-fields", "description", "Fields hashed together into description_hash; match the scraper's --dedup-fields")
+	if err := fs.Parse(args); err != nil {
+		return exitConfigError
+	}
+	if *file == "" {
+		log.Print("--file must be provided")
+		return exitConfigError
+	}
+	hasher, err := api.NewHasher(*hashAlgorithm)
+	if err != nil {
+		log.Print(err)
+		return exitConfigError
+	}
+
+	mongoURI := os.Getenv("MONGO_URI")
+	if mongoURI == "" {
+		log.Print("MONGO_URI must be provided")
+		return exitConfigError
+	}
+
+	var r io.Reader = os.Stdin
+	if *file != "-" {
+		f, err := os.Open(*file)
+		if err != nil {
+			log.Print(err)
+			return exitConfigError
+		}
+		defer f.Close()
+		r = f
+	}
+
+	mongoStore, err := storage.NewMongoStore(mongoURI, "vacancy_db", "vacancies")
+	if err != nil {
+		log.Print(err)
+		return exitDBError
+	}
+	defer mongoStore.Collection.Database().Client().Disconnect(context.Background())
+	if err := mongoStore.LoadExistingData(); err != nil {
+		log.Printf("Failed to load existing data: %v", err)
+		return exitDBError
+	}
+
+	var fields []string
+	for _, field := range strings.Split(*dedupFields, ",") {
+		if field = strings.TrimSpace(field); field != "" {
+			fields = append(fields, field)
+		}
+	}
+	if len(fields) == 1 && fields[0] == "description" {
+		fields = nil
+	}
+
+	stats, err := importVacancies(r, mongoStore, hasher, fields)
+	if err != nil {
+		log.Print(err)
+		return exitDBError
+	}
+	fmt.Fprintf(os.Stderr, "%d vacancies imported, %d duplicates skipped, %d hashes recomputed, %d malformed lines skipped\n",
+		stats.imported, stats.duplicates, stats.rehashed, stats.malformed)
+	return exitOK
+}
+
+// importVacancies upserts the documents read from r. With dedupFields the
+// hash covers those fields, as the scraper's --dedup-fields does; without
+// them it covers the description alone.
+func importVacancies(r io.Reader, store *storage.MongoStore, hasher api.Hasher, dedupFields []string) (importStats, error) {
+	var stats importStats
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxImportLine)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var data map[string]interface{}
+		if err := json.Unmarshal(scanner.Bytes(), &data); err != nil {
+			stats.malformed++
+			log.Printf("Line %d skipped: %v", line, err)
+			continue
+		}
+		id, hash, err := importHash(data, hasher, dedupFields)
+		if err == nil {
+			err = restoreExported(data)
+		}
+		if err != nil {
+			stats.malformed++
+			log.Printf("Line %d skipped: %v", line, err)
+			continue
+		}
+		if stored, ok := data["description_hash"].(string); ok && stored != hash {
+			stats.rehashed++
+		}
+		data["description_hash"] = hash
+
+		if store.DescriptionHashExists(hash) {
+			if owner, ok := store.DescriptionHashOwner(hash); !ok || owner != id {
+				stats.duplicates++
+				continue
+			}
+		}
+		if err := store.UpsertVacancy(data); err != nil {
+			if errors.Is(err, storage.ErrDuplicateDescription) {
+				stats.duplicates++
+				continue
+			}
+			return stats, fmt.Errorf("line %d: %w", line, err)
+		}
+		store.AddDescriptionHash(hash)
+		stats.imported++
+	}
+	if err := scanner.Err(); err != nil {
+		return stats, fmt.Errorf("failed to read import file: %w", err)
+	}
+	return stats, nil
+}
+
+// importHash returns the document's id and the description hash to store.
+// Documents stored with --drop-description have no description left, so
+// their existing hash is trusted.
+func importHash(data map[string]interface{}, hasher api.Hasher, dedupFields []string) (string, string, error) {
+	id, ok := data["id"].(string)
+	if !ok || id == "" {
+		return "", "", errors.New("document has no string id")
+	}
+	if len(dedupFields) > 0 {
+		if key, ok := transform.DedupKey(data, dedupFields); ok {
+			return id, hasher.Hash(key), nil
+		}
+	} else if description, ok := data["description"].(string); ok && description != "" {
+		return id, hasher.Hash(description), nil
+	}
+	if hash, ok := data["description_hash"].(string); ok && hash != "" {
+		return id, hash, nil
+	}
+	return "", "", fmt.Errorf("vacancy %s has neither description nor description_hash", id)
+}
+
+// restoreExported undoes what the JSON export does to a stored document:
+// it drops any _id, parses the dates back into times and decodes
+// a gzip raw payload, which JSON carries as base64.
+func restoreExported(data map[string]interface{}) error {
+	delete(data, "_id")
+	for _, field := range importDateFields {
+		if err := parseImportDate(data, field); err != nil {
+			return err
+		}
+	}
+	if history, ok := data["description_history"].([]interface{}); ok {
+		for _, entry := range history {
+			if entry, ok := entry.(map[string]interface{}); ok {
+				if err := parseImportDate(entry, "replaced_at"); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	if raw, ok := data["raw"].(string); ok && !json.Valid([]byte(raw)) {
+		decoded, err := base64.StdEncoding.DecodeString(raw)
+		if err != nil || !bytes.HasPrefix(decoded, []byte{0x1f, 0x8b}) {
+			return errors.New("raw is neither JSON nor base64 gzip")
+		}
+		data["raw"] = decoded
+	}
+	return nil
+}
+
+func parseImportDate(doc map[string]interface{}, field string) error {
+	value, ok := doc[field].(string)
+	if !ok {
+		return nil
+	}
+	parsed, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return fmt.Errorf("invalid %s %q: %w", field, value, err)
+	}
+	doc[field] = parsed.UTC()
+	return nil
+}
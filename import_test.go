@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"strings"
+	"testing"
+	"time"
+
+	"hh_it_scrapper/api"
+	"hh_it_scrapper/storage"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestImportVacancies(t *testing.T) {
+	hasher, err := api.NewHasher("md5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	goHash, rustHash := hasher.Hash("<p>Go</p>"), hasher.Hash("<p>Rust</p>")
+	dump := strings.Join([]string{
+		`{"id": "1", "name": "Go developer", "description": "<p>Go</p>", "description_hash": "stale"}`,
+		`{"id": "2", "name": "truncated`,
+		`{"id": "3", "description": "<p>Go</p>"}`,
+		``,
+		`{"name": "no id"}`,
+		`{"id": "4", "description": "<p>Rust</p>"}`,
+		`{"id": "5", "description_hash": "kept"}`,
+	}, "\n")
+
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	mt.Run("mock", func(mt *mtest.T) {
+		t := mt.T
+		var logs bytes.Buffer
+		defer log.SetOutput(log.Writer())
+		log.SetOutput(&logs)
+		update := mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1})
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "test.vacancies", mtest.FirstBatch,
+				bson.D{{Key: "id", Value: "9"}, {Key: "description_hash", Value: rustHash}}),
+			update, update,
+		)
+		store := &storage.MongoStore{Collection: mt.Coll}
+		if err := store.LoadExistingData(); err != nil {
+			t.Fatal(err)
+		}
+
+		stats, err := importVacancies(strings.NewReader(dump), store, hasher, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stats != (importStats{imported: 2, duplicates: 2, rehashed: 1, malformed: 2}) {
+			t.Errorf("stats = %+v", stats)
+		}
+		for _, want := range []string{"Line 2 skipped", "Line 5 skipped: document has no string id"} {
+			if !strings.Contains(logs.String(), want) {
+				t.Errorf("log does not contain %q:\n%s", want, logs.String())
+			}
+		}
+
+		var stored []string
+		for _, event := range mt.GetAllStartedEvents() {
+			if event.CommandName != "update" {
+				continue
+			}
+			set := event.Command.Lookup("updates").Array().Index(0).Value().Document().Lookup("u", "$set").Document()
+			stored = append(stored, set.Lookup("id").StringValue()+"="+set.Lookup("description_hash").StringValue())
+		}
+		if got, want := strings.Join(stored, ","), "1="+goHash+",5=kept"; got != want {
+			t.Errorf("stored %s, want %s", got, want)
+		}
+		if owner, ok := store.DescriptionHashOwner(goHash); !ok || owner != "1" || !store.DescriptionHashExists("kept") || !store.VacancyExists("5") {
+			t.Error("imported vacancies not added to the dedup caches")
+		}
+	})
+}
+
+func TestImportExportRoundTrip(t *testing.T) {
+	hasher, err := api.NewHasher("md5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := encodeRaw(map[string]interface{}{"id": "1", "name": "Go developer"}, rawModeGzip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC)
+	stored := bson.D{
+		{Key: "_id", Value: primitive.NewObjectID()},
+		{Key: "id", Value: "1"},
+		{Key: "name", Value: "Go developer"},
+		{Key: "description", Value: "<p>Go</p>"},
+		{Key: "description_hash", Value: "old"},
+		{Key: "first_seen", Value: primitive.NewDateTimeFromTime(seen)},
+		{Key: "last_seen", Value: primitive.NewDateTimeFromTime(seen)},
+		{Key: "published_at_date", Value: primitive.NewDateTimeFromTime(seen)},
+		{Key: "raw", Value: primitive.Binary{Data: raw.([]byte)}},
+		{Key: "description_history", Value: bson.A{
+			bson.D{{Key: "description", Value: "<p>Old</p>"}, {Key: "replaced_at", Value: primitive.NewDateTimeFromTime(seen)}},
+		}},
+	}
+
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	mt.Run("mock", func(mt *mtest.T) {
+		t := mt.T
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "test.vacancies", mtest.FirstBatch, stored),
+			mtest.CreateCursorResponse(0, "test.vacancies", mtest.FirstBatch),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}),
+		)
+		store := &storage.MongoStore{Collection: mt.Coll}
+		var dump bytes.Buffer
+		enc := json.NewEncoder(&dump)
+		if err := store.Export(context.Background(), storage.ExportFilter{}, func(data map[string]interface{}) error {
+			return enc.Encode(data)
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.LoadExistingData(); err != nil {
+			t.Fatal(err)
+		}
+
+		fields := []string{"name", "description"}
+		stats, err := importVacancies(&dump, store, hasher, fields)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stats != (importStats{imported: 1, rehashed: 1}) {
+			t.Fatalf("stats = %+v", stats)
+		}
+
+		var update bson.Raw
+		for _, event := range mt.GetAllStartedEvents() {
+			if event.CommandName == "update" {
+				update = event.Command.Lookup("updates").Array().Index(0).Value().Document().Lookup("u").Document()
+			}
+		}
+		set := update.Lookup("$set").Document()
+		if _, err := set.LookupErr("_id"); err == nil {
+			t.Error("_id was imported")
+		}
+		if got, want := set.Lookup("description_hash").StringValue(), hasher.Hash("Go developer\x1f<p>Go</p>"); got != want {
+			t.Errorf("description_hash = %s, want the --dedup-fields hash %s", got, want)
+		}
+		for _, date := range []bson.RawValue{
+			set.Lookup("last_seen"),
+			set.Lookup("published_at_date"),
+			set.Lookup("description_history", "0", "replaced_at"),
+			update.Lookup("$setOnInsert", "first_seen"),
+		} {
+			if date.Type != bsontype.DateTime || !date.Time().Equal(seen) {
+				t.Errorf("date came back as %s %v", date.Type, date)
+			}
+		}
+		_, data := set.Lookup("raw").Binary()
+		if payload, err := decodeRaw(data); err != nil || payload["name"] != "Go developer" {
+			t.Errorf("raw = %v, %v", payload, err)
+		}
+	})
+}
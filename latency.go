@@ -0,0 +1,54 @@
+package main
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// latencyStats collects detail fetch durations for the run summary.
+type latencyStats struct {
+	mu      sync.Mutex
+	samples []time.Duration
+}
+
+type latencySummary struct {
+	Count int64   `json:"count" bson:"count"`
+	MinMS float64 `json:"min_ms" bson:"min_ms"`
+	AvgMS float64 `json:"avg_ms" bson:"avg_ms"`
+	P95MS float64 `json:"p95_ms" bson:"p95_ms"`
+}
+
+func (l *latencyStats) record(d time.Duration) {
+	l.mu.Lock()
+	l.samples = append(l.samples, d)
+	l.mu.Unlock()
+}
+
+// summary uses the nearest-rank p95: the smallest sample that at least
+// 95% of the samples do not exceed.
+func (l *latencyStats) summary() latencySummary {
+	l.mu.Lock()
+	samples := append([]time.Duration(nil), l.samples...)
+	l.mu.Unlock()
+	if len(samples) == 0 {
+		return latencySummary{}
+	}
+
+	sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+	var total time.Duration
+	for _, d := range samples {
+		total += d
+	}
+	rank := (95*len(samples) + 99) / 100
+	return latencySummary{
+		Count: int64(len(samples)),
+		MinMS: milliseconds(samples[0]),
+		AvgMS: milliseconds(total / time.Duration(len(samples))),
+		P95MS: milliseconds(samples[rank-1]),
+	}
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestLatencySummary(t *testing.T) {
+	var l latencyStats
+	if got := l.summary(); got != (latencySummary{}) {
+		t.Errorf("empty summary = %+v", got)
+	}
+
+	// 1ms to 20ms: the average is 10.5ms and the 95th percentile by
+	// nearest rank is the 19th sample.
+	for ms := 20; ms >= 1; ms-- {
+		l.record(time.Duration(ms) * time.Millisecond)
+	}
+	want := latencySummary{Count: 20, MinMS: 1, AvgMS: 10.5, P95MS: 19}
+	if got := l.summary(); got != want {
+		t.Errorf("summary = %+v, want %+v", got, want)
+	}
+
+	var single latencyStats
+	single.record(1500 * time.Microsecond)
+	if got := single.summary(); got != (latencySummary{Count: 1, MinMS: 1.5, AvgMS: 1.5, P95MS: 1.5}) {
+		t.Errorf("single sample summary = %+v", got)
+	}
+}
+
+func TestRecordLatency(t *testing.T) {
+	for _, record := range []bool{false, true} {
+		args := []string{}
+		if record {
+			args = append(args, "--record-latency")
+		}
+		cfg := loadTestConfig(t, args...)
+		client := newFakeAPI(1, 2)
+		client.detail = func(ctx context.Context, id string) (map[string]interface{}, error) {
+			time.Sleep(5 * time.Millisecond)
+			return testVacancy(id), nil
+		}
+		store := newCountingStore()
+		p := newTestPipeline(t, cfg, client, store)
+		if err := executeWithin(t, p, context.Background(), nil); err != nil {
+			t.Fatal(err)
+		}
+
+		for id, doc := range store.docs {
+			latency, ok := doc["fetch_latency_ms"].(int64)
+			if ok != record || record && latency < 5 {
+				t.Errorf("--record-latency=%v: vacancy %s fetch_latency_ms = %v", record, id, doc["fetch_latency_ms"])
+			}
+		}
+		if summary := p.latency.summary(); summary.Count != 2 || summary.MinMS < 5 {
+			t.Errorf("latency summary = %+v, want 2 samples of at least 5ms", summary)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package logger
 
 import (
+	"io"
 	"log"
 	"os"
 )
@@ -8,9 +9,10 @@ import (
 type AppLogger struct {
 	Info  *log.Logger
 	Error *log.Logger
+	Debug *log.Logger
 }
 
-func NewAppLogger() *AppLogger {
+func NewAppLogger(debug bool) *AppLogger {
 	if err := os.MkdirAll("logs", os.ModePerm); err != nil {
 		log.Fatalf("Failed to create logs directory: %v", err)
 	}
@@ -25,8 +27,18 @@ func NewAppLogger() *AppLogger {
 		log.Fatalf("Failed to open error log file: %v", err)
 	}
 
+	var debugOut io.Writer = io.Discard
+	if debug {
+		debugFile, err := os.OpenFile("logs/debug.log", os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0666)
+		if err != nil {
+			log.Fatalf("Failed to open debug log file: %v", err)
+		}
+		debugOut = debugFile
+	}
+
 	return &AppLogger{
-		Info:  log.New(infoFile, "INFO: ", log.Ldate|log.Ltime),
-		Error: log.New(errorFile, "ERROR: ", log.Ldate|log.Ltime|log.Lshortfile),
+		Info:  log.New(NewRedactingWriter(infoFile), "INFO: ", log.Ldate|log.Ltime),
+		Error: log.New(NewRedactingWriter(errorFile), "ERROR: ", log.Ldate|log.Ltime|log.Lshortfile),
+		Debug: log.New(NewRedactingWriter(debugOut), "DEBUG: ", log.Ldate|log.Ltime|log.Lmicroseconds),
 	}
 }
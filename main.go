@@ -5,159 +5,796 @@ import (
 	"errors"
 	"fmt"
 	"log"
-	"sync"
-	"sync/atomic"
+	"math"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
+	_ "time/tzdata"
 
 	"hh_it_scrapper/api"
 	"hh_it_scrapper/config"
 	"hh_it_scrapper/logger"
 	"hh_it_scrapper/storage"
+	"hh_it_scrapper/transform"
 )
 
+const (
+	exitOK          = 0
+	exitConfigError = 1
+	exitAPIError    = 2
+	exitDBError     = 3
+	exitTimeout     = 4
+	exitInterrupted = 5
+)
+
+var exitCodeDescriptions = map[int]string{
+	exitOK:          "success",
+	exitConfigError: "configuration error",
+	exitAPIError:    "HH API failure",
+	exitDBError:     "MongoDB failure",
+	exitTimeout:     "maximum run duration exceeded",
+	exitInterrupted: "stopped by signal",
+}
+
 func main() {
+	log.SetOutput(logger.NewRedactingWriter(os.Stderr))
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "healthcheck":
+			os.Exit(runHealthcheck(os.Args[2:]))
+		case "sample":
+			os.Exit(runSample(os.Args[2:]))
+		case "compact":
+			os.Exit(runCompact(os.Args[2:]))
+		case "export":
+			os.Exit(runExport(os.Args[2:]))
+		case "migrate":
+			os.Exit(runMigrate(os.Args[2:]))
+		case "import":
+			os.Exit(runImport(os.Args[2:]))
+		}
+	}
+	os.Exit(run())
+}
+
+func run() int {
 	cfg := config.LoadConfig()
-	if cfg.StartDate == "" || cfg.EndDate == "" {
-		log.Fatal("Both --from and --to date arguments must be provided")
+	if err := validateConfig(cfg); err != nil {
+		log.Print(err)
+		return exitConfigError
 	}
-	if cfg.BearerToken == "" {
-		log.Fatal("BEARER_TOKEN must be provided")
+
+	hasher, err := api.NewHasher(cfg.HashAlgorithm)
+	if err != nil {
+		log.Print(err)
+		return exitConfigError
 	}
-	if cfg.MongoURI == "" {
-		log.Fatal("MONGO_URI must be provided")
+
+	fieldMap, err := transform.ParseFieldMap(cfg.FieldMap)
+	if err != nil {
+		log.Print(err)
+		return exitConfigError
 	}
 
-	logger := logger.NewAppLogger()
-	mongoStore, err := storage.NewMongoStore(cfg.MongoURI, "vacancy_db", "vacancies")
+	retryStatuses, err := api.ParseStatusSet(cfg.RetryStatuses)
 	if err != nil {
-		logger.Error.Fatalf("MongoDB connection error: %v", err)
+		log.Printf("--retry-statuses: %v", err)
+		return exitConfigError
+	}
+
+	logger := logger.NewAppLogger(cfg.DebugHTTP)
+	for _, warning := range cfg.Warnings {
+		log.Printf("Warning: %s", warning)
+		logger.Error.Printf("Config warning: %s", warning)
+	}
+	if err := checkDiskSpace(cfg, logger); err != nil {
+		log.Print(err)
+		return exitConfigError
+	}
+
+	var listedIDs []string
+	if cfg.IDsFile != "" {
+		var err error
+		listedIDs, err = readIDsFile(cfg.IDsFile, logger)
+		if err != nil {
+			log.Print(err)
+			return exitConfigError
+		}
+	}
+
+	hhClient := api.NewHHClient(cfg.BearerTokens...)
+	hhClient.Locale = cfg.Locale
+	hhClient.Host = cfg.Host
+	if cfg.Cookies != "" {
+		if err := hhClient.SetCookies(cfg.Cookies); err != nil {
+			log.Printf("--cookies: %v", err)
+			return exitConfigError
+		}
+	}
+	if cfg.SelfThrottle {
+		hhClient.Throttle = api.NewThrottle(cfg.SelfThrottleMaxDelay)
+	}
+	hhClient.HTTPClient.Transport = api.NewTransport(api.TransportConfig{
+		MaxIdleConns:        cfg.MaxIdleConns,
+		MaxIdleConnsPerHost: cfg.MaxIdleConnsPerHost,
+		IdleConnTimeout:     cfg.IdleConnTimeout,
+		ForceHTTP1:          cfg.HTTP1,
+	})
+	if cfg.DebugHTTP {
+		hhClient.HTTPClient.Transport = api.NewLoggingTransport(hhClient.HTTPClient.Transport, logger.Debug)
+	}
+	// The auth probe uses a copy of the client made before the cache is in
+	// place so a cached answer cannot hide an expired token.
+	authClient := *hhClient
+	authHTTP := *hhClient.HTTPClient
+	authClient.HTTPClient = &authHTTP
+	if cfg.CacheDir != "" {
+		cache, err := api.NewCachingTransport(hhClient.HTTPClient.Transport, cfg.CacheDir, cfg.CacheTTL)
+		if err != nil {
+			log.Print(err)
+			return exitConfigError
+		}
+		hhClient.HTTPClient.Transport = cache
+	}
+
+	var client vacancyAPI = hhClient
+	if cfg.BreakerThreshold > 0 {
+		breaker := api.NewCircuitBreaker(cfg.BreakerThreshold, cfg.BreakerCooldown)
+		breaker.OnStateChange = func(from, to api.BreakerState) {
+			logger.Error.Printf("HH API circuit breaker %s -> %s", from, to)
+		}
+		client = &api.BreakerClient{HHClient: hhClient, Breaker: breaker}
+	}
+
+	r := &runner{
+		cfg:           cfg,
+		client:        client,
+		hhClient:      hhClient,
+		authClient:    &authClient,
+		hasher:        hasher,
+		fieldMap:      fieldMap,
+		retryStatuses: retryStatuses,
+		listedIDs:     listedIDs,
+		logger:        logger,
+	}
+	defer r.close()
+	if cfg.IDsOut != "" {
+		idsOut, err := openIDWriter(cfg.IDsOut)
+		if err != nil {
+			log.Print(err)
+			return exitConfigError
+		}
+		defer idsOut.Close()
+		r.idsOut = idsOut
+	}
+	if cfg.OverflowPolicy == config.OverflowSpill {
+		spill, err := openIDWriter(cfg.OverflowFile)
+		if err != nil {
+			log.Print(err)
+			return exitConfigError
+		}
+		defer spill.Close()
+		r.spill = spill
+	}
+	if cfg.RegionPath {
+		r.areaPaths = loadAreaPaths(hhClient, logger)
+	}
+
+	// Stopping on SIGINT/SIGTERM through the context lets the deferred
+	// cleanup run: buffered writes are drained, --memory-state is saved and
+	// the run record is finalized.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if cfg.Watch {
+		return r.watch(ctx)
+	}
+	if code := r.prepare(); code != exitOK {
+		return code
+	}
+	return r.runCycle(ctx)
+}
+
+// prepare checks the token and, until that first succeeds, resolves the
+// roles and opens the store. Watch mode calls it before every cycle, so a
+// cycle that cannot start is handled like any other failed cycle.
+func (r *runner) prepare() int {
+	cfg, logger := r.cfg, r.logger
+	if code := checkAuth(cfg, r.authClient, logger); code != exitOK {
+		return code
+	}
+	if r.store != nil {
+		return exitOK
+	}
+	if code := resolveRoles(cfg, r.hhClient, logger); code != exitOK {
+		return code
+	}
+
+	store, mongoStore, closeStore, code := openStore(cfg, logger)
+	if code != exitOK {
+		return code
+	}
+	closers := []func(){closeStore}
+	fail := func(code int) int {
+		for i := len(closers) - 1; i >= 0; i-- {
+			closers[i]()
+		}
+		return code
 	}
-	defer mongoStore.Collection.Database().Client().Disconnect(context.Background())
 
-	if err := mongoStore.LoadExistingData(); err != nil {
-		logger.Error.Fatalf("Failed to load existing data: %v", err)
+	if cfg.RefreshStale > 0 {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		listedIDs, err := mongoStore.StaleVacancyIDs(ctx, time.Now().Add(-cfg.RefreshStale), cfg.RefreshLimit)
+		cancel()
+		if err != nil {
+			logger.Error.Printf("%v", err)
+			return fail(exitDBError)
+		}
+		logger.Info.Printf("Refreshing %d vacancies not seen for %v", len(listedIDs), cfg.RefreshStale)
+		r.listedIDs = listedIDs
+	}
+
+	if cfg.WriteBatchSize > 1 && mongoStore != nil {
+		store = storage.NewBatchWriter(mongoStore, cfg.WriteBatchSize)
+	}
+	if containsSink(cfg.Sinks, "file") {
+		fileStore, err := storage.NewFileStore(cfg.SinkFile)
+		if err != nil {
+			log.Print(err)
+			return fail(exitConfigError)
+		}
+		closers = append(closers, func() { fileStore.Close() })
+		store = storage.NewMultiStore(store, fileStore)
+	}
+	if cfg.DLQ != "" {
+		dlq, err := openDeadLetterQueue(cfg.DLQ, mongoStore)
+		if err != nil {
+			log.Print(err)
+			return fail(exitConfigError)
+		}
+		closers = append(closers, func() { dlq.Close() })
+		r.dlq = dlq
+	}
+	if mongoStore != nil {
+		r.runs = &storage.RunLog{Collection: mongoStore.Collection.Database().Collection("runs")}
+	}
+
+	r.store = store
+	r.closers = closers
+	return exitOK
+}
+
+// close releases what prepare opened, in reverse order.
+func (r *runner) close() {
+	for i := len(r.closers) - 1; i >= 0; i-- {
+		r.closers[i]()
 	}
+	r.closers = nil
+}
+
+// runner holds what stays the same across runs so that watch mode can
+// start a fresh pipeline, with its own run ID and counters, every cycle.
+type runner struct {
+	cfg           *config.AppConfig
+	client        vacancyAPI
+	hhClient      *api.HHClient
+	authClient    *api.HHClient
+	store         storage.Store
+	hasher        api.Hasher
+	fieldMap      transform.FieldMap
+	retryStatuses api.StatusSet
+	dlq           storage.DeadLetterQueue
+	idsOut        *idWriter
+	spill         *idWriter
+	areaPaths     map[string][]string
+	runs          *storage.RunLog
+	listedIDs     []string
+	closers       []func()
+	logger        *logger.AppLogger
+}
 
-	hhClient := api.NewHHClient(cfg.BearerToken)
+func (r *runner) runCycle(ctx context.Context) int {
+	cfg, logger := r.cfg, r.logger
+	if cfg.MaxDuration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cfg.MaxDuration)
+		defer cancel()
+	}
 
 	startTime := time.Now()
 	logger.Info.Println("Job started...")
-	savedCount, err := fetchAndStoreVacancies(context.Background(), cfg, mongoStore, hhClient, logger)
-	if err != nil {
-		logger.Error.Printf("Job failed: %v", err)
-	} else {
+
+	runID := newRunID()
+	logger.Info.Printf("Run ID: %s", runID)
+	p := newPipeline(cfg, r.client, r.store, r.hasher, runID, logger)
+	p.fieldMap = r.fieldMap
+	p.retryStatuses = r.retryStatuses
+	p.dlq = r.dlq
+	p.idsOut = r.idsOut
+	p.spill = r.spill
+	p.areaPaths = r.areaPaths
+	r.recordRunStart(runID)
+	stopProgress := startProgress(p, os.Stderr, !cfg.NoProgress && isTerminal(os.Stderr), logger)
+	err := p.execute(ctx, r.listedIDs)
+	stopProgress()
+	code := exitCodeFor(err)
+	switch code {
+	case exitOK:
 		logger.Info.Println("Job completed successfully.")
+	case exitTimeout:
+		logger.Error.Printf("Job stopped: maximum run duration of %v exceeded", cfg.MaxDuration)
+	case exitInterrupted:
+		logger.Error.Println("Job stopped by signal")
+	default:
+		logger.Error.Printf("Job failed: %v", err)
 	}
 	duration := time.Since(startTime)
 	logger.Info.Printf("Duration: %v", duration)
 
-	fmt.Printf("Number of successfully saved vacancies: %d\n", savedCount)
+	summary := runSummary{
+		RunID:           runID,
+		Duration:        duration.String(),
+		TokenRateLimits: r.hhClient.Tokens.RateLimits(),
+		Saved:           p.stats.Saved(),
+		Failed:          p.stats.Failed(),
+		Duplicates:      p.stats.Duplicates(),
+		DeadLettered:    p.stats.DeadLettered(),
+		Unchanged:       p.stats.Unchanged(),
+		OutOfWindow:     p.stats.OutOfWindow(),
+		Latency:         p.latency.summary(),
+		Flushed:         p.stats.Flushed(),
+		Overflowed:      p.stats.Overflowed(),
+		LowCoverage:     p.lowCoverage,
+		Warnings:        cfg.Warnings,
+		ExitCode:        code,
+		ExitDescription: exitCodeDescriptions[code],
+	}
+	summary.Seen, summary.Found = p.coverage()
+	for _, t := range p.targets {
+		summary.Targets = append(summary.Targets, targetSummary{Name: t.name, Saved: t.savedCount(), Pages: t.pagesDone()})
+	}
+	r.recordRunFinish(runID, err, summary)
+	if err := writeSummary(summary, cfg.SummaryOut, cfg.SummaryFormat); err != nil {
+		logger.Error.Printf("Failed to write summary: %v", err)
+	}
+	return code
 }
 
-func fetchAndStoreVacancies(ctx context.Context, cfg *config.AppConfig, store *storage.MongoStore, client *api.HHClient, logger *logger.AppLogger) (int64, error) {
-	var savedCount int64
-	page := 0
-	var totalPages int
-
-	for {
-		select {
-		case <-ctx.Done():
-			return atomic.LoadInt64(&savedCount), ctx.Err()
-		default:
-			vacancyIDs, pages, err := client.GetVacancyIDs(ctx, cfg.StartDate, cfg.EndDate, cfg.Area, cfg.ProfessionalRole, page, cfg.PerPage)
-			if err != nil {
-				logger.Error.Printf("Failed to fetch search page %d: %v", page, err)
-				page++
-				continue
+// openStore sets up the primary store. With --memory-state that is a
+// MemoryStore restored from disk and saved again by the returned close
+// func; otherwise it is MongoDB, optionally partitioned. mongoStore is nil
+// in memory mode.
+func openStore(cfg *config.AppConfig, logger *logger.AppLogger) (storage.Store, *storage.MongoStore, func(), int) {
+	if cfg.MemoryState != "" {
+		release, err := storage.AcquireLock(cfg.MemoryState + ".lock")
+		if err != nil {
+			log.Print(err)
+			return nil, nil, nil, exitConfigError
+		}
+		memStore := storage.NewMemoryStore()
+		if err := memStore.Load(cfg.MemoryState); err != nil && !errors.Is(err, os.ErrNotExist) {
+			release()
+			log.Print(err)
+			return nil, nil, nil, exitConfigError
+		}
+		closeStore := func() {
+			if err := memStore.Save(cfg.MemoryState); err != nil {
+				logger.Error.Printf("Failed to save memory state: %v", err)
 			}
+			release()
+		}
+		return memStore, nil, closeStore, exitOK
+	}
 
-			if page == 0 {
-				totalPages = pages
-				logger.Info.Printf("Total pages to fetch: %d", totalPages)
-			}
+	collectionOpts, err := storage.CollectionOptions(cfg.WriteConcern, cfg.ReadPreference)
+	if err != nil {
+		log.Print(err)
+		return nil, nil, nil, exitConfigError
+	}
 
-			var newIDs []string
-			for _, id := range vacancyIDs {
-				if !store.VacancyExists(id) {
-					newIDs = append(newIDs, id)
-				}
-			}
+	mongoStore, err := storage.NewMongoStore(cfg.MongoURI, "vacancy_db", "vacancies", collectionOpts)
+	if err != nil {
+		logger.Error.Printf("MongoDB connection error: %v", err)
+		return nil, nil, nil, exitDBError
+	}
+	closeStore := func() {
+		mongoStore.Collection.Database().Client().Disconnect(context.Background())
+	}
+	mongoStore.BatchSize = int32(cfg.BatchSize)
+	mongoStore.ShardKey = cfg.ShardKey
 
-			logger.Info.Printf("Processing page %d: %d new vacancies found", page, len(newIDs))
-			if len(newIDs) > 0 {
-				if err := fetchAndProcessVacancies(ctx, client, store, newIDs, cfg.MaxRetries, cfg.RetryDelay, &savedCount, logger); err != nil {
-					logger.Error.Printf("Failed to process vacancies: %v", err)
-				}
-			}
+	if len(cfg.ShardKey) > 0 {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		err := mongoStore.EnsureShardKeyIndex(ctx)
+		cancel()
+		if err != nil {
+			logger.Error.Printf("%v", err)
+			closeStore()
+			return nil, nil, nil, exitDBError
+		}
+	}
 
-			if page >= totalPages-1 {
-				return atomic.LoadInt64(&savedCount), nil
-			}
-			page++
+	if cfg.UniqueDescriptionIndex && cfg.Partition == "" {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		err := mongoStore.EnsureUniqueDescriptionIndex(ctx)
+		cancel()
+		if err != nil {
+			logger.Error.Printf("%v", err)
+			closeStore()
+			return nil, nil, nil, exitDBError
+		}
+	}
+
+	var store storage.Store = mongoStore
+	if cfg.Partition == "monthly" {
+		partitioned := storage.NewPartitionedStore(mongoStore.Collection.Database(), "vacancies", collectionOpts)
+		partitioned.BatchSize = int32(cfg.BatchSize)
+		partitioned.UniqueDescriptions = cfg.UniqueDescriptionIndex
+		if err := partitioned.Open(context.Background(), cfg.NoPreload); err != nil {
+			logger.Error.Printf("Failed to open partitions: %v", err)
+			closeStore()
+			return nil, nil, nil, exitDBError
 		}
+		store = partitioned
+	} else if cfg.NoPreload {
+		mongoStore.UseLazyLookups()
+	} else if err := mongoStore.LoadExistingData(); err != nil {
+		logger.Error.Printf("Failed to load existing data: %v", err)
+		closeStore()
+		return nil, nil, nil, exitDBError
 	}
+	return store, mongoStore, closeStore, exitOK
 }
 
-func fetchAndProcessVacancies(ctx context.Context, client *api.HHClient, store *storage.MongoStore, ids []string, maxRetries int, retryDelay time.Duration, savedCount *int64, logger *logger.AppLogger) error {
-	var wg sync.WaitGroup
-	sem := make(chan struct{}, 10) // Concurrency control
+// runLogTimeout bounds run log writes, which use their own context so a
+// cancelled or timed-out run is still finalized.
+const runLogTimeout = 10 * time.Second
 
-	for _, id := range ids {
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		case sem <- struct{}{}:
-			wg.Add(1)
-			go func(vacancyID string) {
-				defer wg.Done()
-				defer func() { <-sem }()
+func (r *runner) recordRunStart(runID string) {
+	if r.runs == nil {
+		return
+	}
+	cfg := r.cfg
+	params := map[string]interface{}{
+		"from":         cfg.StartDate,
+		"to":           cfg.EndDate,
+		"area":         cfg.Area,
+		"role":         cfg.ProfessionalRole,
+		"text":         cfg.Text,
+		"mode":         cfg.Mode,
+		"ids_file":     cfg.IDsFile,
+		"targets_file": cfg.TargetsFile,
+		"reprocess":    cfg.Reprocess,
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), runLogTimeout)
+	defer cancel()
+	if err := r.runs.Start(ctx, runID, params); err != nil {
+		r.logger.Error.Printf("%v", err)
+	}
+}
 
-				for retries := 0; retries <= maxRetries; retries++ {
-					if err := processVacancy(ctx, client, store, vacancyID, savedCount, logger); err == nil {
-						return
-					} else if retries < maxRetries {
-						logger.Error.Printf("Retrying vacancy %s (%d/%d): %v", vacancyID, retries+1, maxRetries, err)
-						time.Sleep(retryDelay)
-					} else {
-						logger.Error.Printf("Failed to process vacancy %s after %d retries: %v", vacancyID, maxRetries, err)
-					}
-				}
-			}(id)
-		}
+func (r *runner) recordRunFinish(runID string, runErr error, summary runSummary) {
+	if r.runs == nil {
+		return
 	}
+	status, message := storage.RunStatusSucceeded, ""
+	if runErr != nil {
+		status, message = storage.RunStatusFailed, runErr.Error()
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), runLogTimeout)
+	defer cancel()
+	if err := r.runs.Finish(ctx, runID, status, message, summary); err != nil {
+		r.logger.Error.Printf("%v", err)
+	}
+}
+
+func openDeadLetterQueue(target string, mongoStore *storage.MongoStore) (storage.DeadLetterQueue, error) {
+	if target == "mongo" {
+		return &storage.MongoDeadLetters{Collection: mongoStore.Collection.Database().Collection("dead_letters")}, nil
+	}
+	return storage.NewFileDeadLetters(target)
+}
 
-	wg.Wait()
+func validateConfig(cfg *config.AppConfig) error {
+	if cfg.Reprocess && cfg.IDsFile != "" {
+		return errors.New("--reprocess cannot be combined with --ids-file")
+	}
+	if cfg.RefreshStale > 0 {
+		if cfg.Reprocess || cfg.IDsFile != "" || cfg.Watch {
+			return errors.New("--refresh-stale cannot be combined with --reprocess, --ids-file or --watch")
+		}
+		if cfg.MemoryState != "" || cfg.Partition != "" {
+			return errors.New("--refresh-stale needs the single MongoDB collection (no --memory-state or --partition)")
+		}
+		if cfg.RefreshLimit < 1 {
+			return errors.New("--refresh-limit must be at least 1")
+		}
+		cfg.Mode = config.ModeRefresh
+	}
+	if cfg.IDsFile == "" && !cfg.Reprocess && cfg.RefreshStale == 0 && (cfg.StartDate == "" || cfg.EndDate == "") {
+		return errors.New("both --from and --to date arguments must be provided (or --ids-file)")
+	}
+	if err := cfg.ApplyTimeZone(); err != nil {
+		return err
+	}
+	if cfg.Watch && (cfg.IDsFile != "" || cfg.Reprocess) {
+		return errors.New("--watch only applies to date-window searches")
+	}
+	if cfg.Watch && cfg.Interval <= 0 {
+		return errors.New("--interval must be positive")
+	}
+	if cfg.Partition != "" && cfg.Partition != "monthly" {
+		return fmt.Errorf("unknown --partition %q, expected monthly", cfg.Partition)
+	}
+	if cfg.Partition != "" && len(cfg.ShardKey) > 0 {
+		return errors.New("--shard-key is not supported with --partition")
+	}
+	if cfg.Partition != "" && cfg.WriteBatchSize > 1 {
+		return errors.New("--write-batch-size is not supported with --partition")
+	}
+	if cfg.SummaryFormat != "text" && cfg.SummaryFormat != "json" {
+		return errors.New("--summary-format must be text or json")
+	}
+	switch cfg.DupPolicy {
+	case config.DupPolicySkip, config.DupPolicyFlag, config.DupPolicyStore:
+	default:
+		return fmt.Errorf("--dup-policy must be %q, %q or %q", config.DupPolicySkip, config.DupPolicyFlag, config.DupPolicyStore)
+	}
+	if cfg.NoDedupDescription {
+		if cfg.DupPolicy == config.DupPolicyFlag {
+			return errors.New("--no-dedup-description conflicts with --dup-policy=flag")
+		}
+		cfg.DupPolicy = config.DupPolicyStore
+	}
+	if cfg.DupByIDWins {
+		if cfg.NoDedupDescription || cfg.DupPolicy == config.DupPolicyStore {
+			return errors.New("--dup-by-id-wins conflicts with --dup-policy=store and --no-dedup-description")
+		}
+		cfg.DupPolicy = config.DupPolicyFlag
+	}
+	if cfg.UniqueDescriptionIndex && cfg.DupPolicy != config.DupPolicySkip {
+		return errors.New("--unique-description-index requires --dup-policy=skip")
+	}
+	if cfg.StoreRaw != "" && cfg.StoreRaw != rawModeJSON && cfg.StoreRaw != rawModeGzip {
+		return fmt.Errorf("--store-raw must be %q or %q", rawModeJSON, rawModeGzip)
+	}
+	switch cfg.OverflowPolicy {
+	case config.OverflowBlock, config.OverflowSpill, config.OverflowDrop:
+	default:
+		return fmt.Errorf("--overflow-policy must be %q, %q or %q", config.OverflowBlock, config.OverflowSpill, config.OverflowDrop)
+	}
+	if cfg.PrefetchBuffer < 0 {
+		return errors.New("--prefetch-buffer must not be negative")
+	}
+	if cfg.ResumeAt != "" {
+		if _, err := cfg.NextResumeAt(time.Now()); err != nil {
+			return err
+		}
+		if cfg.ResumeAfterTrips < 1 {
+			return errors.New("--resume-after-trips must be at least 1")
+		}
+	}
+	if cfg.SelfThrottle && cfg.SelfThrottleMaxDelay <= 0 {
+		return errors.New("--self-throttle-max-delay must be positive")
+	}
+	if cfg.IDsOnly && cfg.IDsOut == "" {
+		return errors.New("--ids-only requires --ids-out")
+	}
+	if cfg.IDsOut != "" && cfg.Reprocess {
+		return errors.New("--ids-out cannot be combined with --reprocess")
+	}
+	if cfg.SearchOnly {
+		if cfg.IDsFile != "" || cfg.Reprocess || cfg.RefreshStale > 0 {
+			return errors.New("--search-only only applies to searches (no --ids-file, --reprocess or --refresh-stale)")
+		}
+		if cfg.Mode == config.ModeRefresh || cfg.TrackChanges || cfg.IDsOnly {
+			return errors.New("--search-only cannot be combined with --mode=refresh, --track-changes or --ids-only")
+		}
+	}
+	if cfg.Resilient && !cfg.Watch {
+		return errors.New("--resilient requires --watch")
+	}
+	if cfg.MaxConsecutiveFailures < 1 {
+		return errors.New("--max-consecutive-failures must be at least 1")
+	}
+	if cfg.StartPage < 0 {
+		return errors.New("--start-page must not be negative")
+	}
+	if cfg.EndPage < -1 || (cfg.EndPage >= 0 && cfg.EndPage < cfg.StartPage) {
+		return errors.New("--end-page must be -1 or at least --start-page")
+	}
+	if (cfg.StartPage > 0 || cfg.EndPage >= 0) && cfg.SinceID {
+		return errors.New("--start-page/--end-page cannot be combined with --since-id")
+	}
+	if err := cfg.Retry.Validate(); err != nil {
+		return err
+	}
+	if cfg.VacancyBudget < 0 {
+		return errors.New("--vacancy-budget must not be negative")
+	}
+	if cfg.ServerErrorAttempts < 1 {
+		return errors.New("--server-error-attempts must be at least 1")
+	}
+	if cfg.TargetQPS < 0 {
+		return errors.New("--target-qps must not be negative")
+	}
+	if cfg.PageDelay < 0 {
+		return errors.New("--page-delay cannot be negative")
+	}
+	if cfg.PerPage < 1 {
+		return fmt.Errorf("--per-page must be between 1 and %d", config.MaxPerPage)
+	}
+	if cfg.SearchConcurrency < 1 || cfg.DetailConcurrency < 1 {
+		return errors.New("concurrency must be at least 1")
+	}
+	if cfg.Mode != config.ModeNew && cfg.Mode != config.ModeRefresh {
+		return fmt.Errorf("--mode must be %q or %q", config.ModeNew, config.ModeRefresh)
+	}
+	if cfg.MaxFailureRatio < 0 || cfg.MaxFailureRatio > 1 {
+		return errors.New("--max-failure-ratio must be between 0 and 1")
+	}
+	if cfg.BatchSize < 0 || cfg.BatchSize > math.MaxInt32 {
+		return errors.New("--batch-size must be between 0 and 2147483647")
+	}
+	for _, sink := range cfg.Sinks {
+		if sink != "mongo" && sink != "file" {
+			return fmt.Errorf("unknown sink %q, expected mongo or file", sink)
+		}
+	}
+	if cfg.MemoryState == "" && !containsSink(cfg.Sinks, "mongo") {
+		return errors.New("--sinks must include mongo, which answers dedup checks")
+	}
+	if cfg.MemoryState != "" && (cfg.Partition != "" || cfg.DLQ == "mongo") {
+		return errors.New("--memory-state cannot be combined with --partition or --dlq=mongo")
+	}
+	// The memory store only keeps ids and hashes, so modes that read stored
+	// documents back or need MongoDB indexes cannot work with it.
+	if cfg.MemoryState != "" && (cfg.TrackChanges || cfg.SinceID || cfg.Reprocess) {
+		return errors.New("--memory-state cannot be combined with --track-changes, --since-id or --reprocess")
+	}
+	if cfg.MemoryState != "" && (cfg.UniqueDescriptionIndex || len(cfg.ShardKey) > 0) {
+		return errors.New("--memory-state cannot be combined with --unique-description-index or --shard-key")
+	}
+	// Batched writes are bulk upserts into MongoDB; the memory store and
+	// the file sink write each vacancy as it comes.
+	if cfg.MemoryState != "" && cfg.WriteBatchSize > 1 {
+		return errors.New("--write-batch-size is not supported with --memory-state")
+	}
+	if cfg.MinSalary < 0 {
+		return errors.New("--min-salary must not be negative")
+	}
+	if err := api.ValidateOrderBy(cfg.OrderBy); err != nil {
+		return err
+	}
+	if err := api.ValidateEmployers(cfg.Employers); err != nil {
+		return err
+	}
+	if err := api.ValidateLabels(cfg.Labels); err != nil {
+		return err
+	}
+	if err := cfg.LoadTargetsFile(); err != nil {
+		return err
+	}
+	for _, target := range cfg.Targets {
+		if err := api.ValidateOrderBy(target.OrderBy); err != nil {
+			return fmt.Errorf("target %q: %w", target.Name, err)
+		}
+		if target.MinSalary < 0 {
+			return fmt.Errorf("target %q: min_salary must not be negative", target.Name)
+		}
+		if target.QPS < 0 {
+			return fmt.Errorf("target %q: qps must not be negative", target.Name)
+		}
+	}
+	if err := cfg.LoadTokensFile(); err != nil {
+		return err
+	}
+	if len(cfg.BearerTokens) == 0 && !cfg.Reprocess {
+		return errors.New("BEARER_TOKEN (or --tokens-file) must be provided")
+	}
+	if cfg.MongoURI == "" && cfg.MemoryState == "" {
+		return errors.New("MONGO_URI (or --memory-state) must be provided")
+	}
 	return nil
 }
 
-func processVacancy(ctx context.Context, client *api.HHClient, store *storage.MongoStore, vacancyID string, savedCount *int64, logger *logger.AppLogger) error {
-	data, err := client.GetVacancyDetails(ctx, vacancyID)
+// checkAuth spends one request on /me so a rejected token fails the run
+// before the store is opened and preloaded. Other probe failures are left
+// for the run itself to deal with.
+func checkAuth(cfg *config.AppConfig, hhClient *api.HHClient, logger *logger.AppLogger) int {
+	if cfg.SkipAuthCheck || cfg.Reprocess {
+		return exitOK
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	err := hhClient.CheckAuth(ctx)
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.Is(err, api.ErrTokenInvalid):
+		log.Printf("BEARER_TOKEN is invalid or expired: %v", err)
+		logger.Error.Printf("Auth check failed, BEARER_TOKEN is invalid or expired: %v", err)
+		return exitConfigError
+	default:
+		logger.Error.Printf("Auth check inconclusive, continuing: %v", err)
+		return exitOK
+	}
+}
+
+// loadAreaPaths fetches the areas dictionary for region_path. Without it
+// vacancies are stored without the path rather than failing the run.
+func loadAreaPaths(hhClient *api.HHClient, logger *logger.AppLogger) map[string][]string {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	areas, err := hhClient.GetAreas(ctx)
 	if err != nil {
-		if errors.Is(err, api.ErrVacancyNotFound) {
-			logger.Info.Printf("Vacancy %s not found, skipping", vacancyID)
-			return nil
-		}
-		return fmt.Errorf("failed to get vacancy details: %w", err)
+		logger.Error.Printf("Could not load the areas dictionary, storing vacancies without region_path: %v", err)
+		return nil
+	}
+	return api.AreaPaths(areas)
+}
+
+// resolveRoles replaces the --role and per-target role values with ids from
+// the professional_roles dictionary, so a typo fails the run up front
+// instead of silently finding nothing. If the dictionary cannot be fetched
+// the roles are used as given.
+func resolveRoles(cfg *config.AppConfig, hhClient *api.HHClient, logger *logger.AppLogger) int {
+	if cfg.Reprocess || cfg.IDsFile != "" || cfg.RefreshStale > 0 {
+		return exitOK
 	}
 
-	description, ok := data["description"].(string)
-	if !ok || description == "" {
-		return fmt.Errorf("vacancy %s has invalid description", vacancyID)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	roles, err := hhClient.GetProfessionalRoles(ctx)
+	if err != nil {
+		logger.Error.Printf("Could not load the professional roles dictionary, using roles unchecked: %v", err)
+		return exitOK
 	}
 
-	descriptionHash := api.MD5Hash(description)
-	if store.DescriptionHashExists(descriptionHash) {
-		logger.Info.Printf("Vacancy %s skipped due to duplicate description", vacancyID)
+	resolve := func(value *string) error {
+		if *value == "" {
+			return nil
+		}
+		id, err := roles.Resolve(*value)
+		if err != nil {
+			return err
+		}
+		*value = id
 		return nil
 	}
+	if err := resolve(&cfg.ProfessionalRole); err != nil {
+		log.Printf("--role: %v", err)
+		return exitConfigError
+	}
+	for i := range cfg.Targets {
+		if err := resolve(&cfg.Targets[i].Role); err != nil {
+			log.Printf("target %d: %v", i+1, err)
+			return exitConfigError
+		}
+	}
+	return exitOK
+}
 
-	data["description_hash"] = descriptionHash
-	if err := store.UpsertVacancy(data); err != nil {
-		return fmt.Errorf("MongoDB insertion error: %w", err)
+func containsSink(sinks []string, name string) bool {
+	for _, sink := range sinks {
+		if sink == name {
+			return true
+		}
 	}
+	return false
+}
 
-	store.AddDescriptionHash(descriptionHash)
-	atomic.AddInt64(savedCount, 1)
-	logger.Info.Printf("Vacancy %s stored successfully", vacancyID)
-	return nil
+func exitCodeFor(err error) int {
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.Is(err, errStoreFailed):
+		return exitDBError
+	case errors.Is(err, context.DeadlineExceeded):
+		return exitTimeout
+	case errors.Is(err, context.Canceled):
+		return exitInterrupted
+	default:
+		return exitAPIError
+	}
 }
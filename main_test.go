@@ -0,0 +1,617 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"hh_it_scrapper/api"
+	"hh_it_scrapper/config"
+	"hh_it_scrapper/storage"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+// newTestRunner builds a runner around client and store the way run does,
+// with the summary suppressed.
+func newTestRunner(t *testing.T, cfg *config.AppConfig, client vacancyAPI, store storage.Store) *runner {
+	t.Helper()
+	hasher, err := api.NewHasher(cfg.HashAlgorithm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	retryStatuses, err := api.ParseStatusSet(cfg.RetryStatuses)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.SummaryOut = ""
+	return &runner{
+		cfg:           cfg,
+		client:        client,
+		hhClient:      api.NewHHClient("test-token"),
+		store:         store,
+		hasher:        hasher,
+		retryStatuses: retryStatuses,
+		logger:        testLogger(),
+	}
+}
+
+func TestMaxDurationStopsRun(t *testing.T) {
+	cfg := loadTestConfig(t, "--max-duration=50ms")
+	client := newFakeAPI(1, 20)
+	client.detail = func(ctx context.Context, id string) (map[string]interface{}, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	r := newTestRunner(t, cfg, client, storage.NewMemoryStore())
+
+	start := time.Now()
+	if code := r.runCycle(context.Background()); code != exitTimeout {
+		t.Errorf("exit code = %d, want %d (%s)", code, exitTimeout, exitCodeDescriptions[exitTimeout])
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("run took %v with --max-duration=50ms", elapsed)
+	}
+}
+
+func TestNoMaxDuration(t *testing.T) {
+	cfg := loadTestConfig(t)
+	if cfg.MaxDuration != 0 {
+		t.Fatalf("MaxDuration defaults to %v, want no limit", cfg.MaxDuration)
+	}
+	r := newTestRunner(t, cfg, newFakeAPI(2, 10), storage.NewMemoryStore())
+	if code := r.runCycle(context.Background()); code != exitOK {
+		t.Errorf("exit code = %d, want %d", code, exitOK)
+	}
+}
+
+// highWaterStore answers --since-id from max and err.
+type highWaterStore struct {
+	*storage.MemoryStore
+	max int64
+	err error
+}
+
+func (s *highWaterStore) MaxVacancyID(ctx context.Context) (int64, error) {
+	return s.max, s.err
+}
+
+func TestExitCodeFor(t *testing.T) {
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{nil, exitOK},
+		{fmt.Errorf("%w: connection refused", errStoreFailed), exitDBError},
+		{fmt.Errorf("page 3: %w", context.DeadlineExceeded), exitTimeout},
+		{fmt.Errorf("page 3: %w", context.Canceled), exitInterrupted},
+		{fmt.Errorf("%w: page 0: 502", errSearchFailed), exitAPIError},
+		{fmt.Errorf("%w: 9 of 10", errTooManyFails), exitAPIError},
+	}
+	for _, tt := range tests {
+		if got := exitCodeFor(tt.err); got != tt.want {
+			t.Errorf("exitCodeFor(%v) = %d, want %d", tt.err, got, tt.want)
+		}
+		if exitCodeDescriptions[tt.want] == "" {
+			t.Errorf("exit code %d is not documented", tt.want)
+		}
+	}
+}
+
+func TestRunCycleExitCodes(t *testing.T) {
+	searchFails := newFakeAPI(1, 5)
+	searchFails.search = func(ctx context.Context, page int) (api.SearchResult, error) {
+		return api.SearchResult{}, &api.StatusError{StatusCode: http.StatusBadGateway}
+	}
+	detailsFail := newFakeAPI(1, 5)
+	detailsFail.detail = func(ctx context.Context, id string) (map[string]interface{}, error) {
+		return nil, &api.StatusError{StatusCode: http.StatusBadRequest}
+	}
+	hangs := newFakeAPI(1, 5)
+	hangs.detail = func(ctx context.Context, id string) (map[string]interface{}, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+
+	tests := []struct {
+		name   string
+		args   []string
+		client vacancyAPI
+		store  storage.Store
+		want   int
+	}{
+		{"success", nil, newFakeAPI(2, 5), storage.NewMemoryStore(), exitOK},
+		{"search fails", nil, searchFails, storage.NewMemoryStore(), exitAPIError},
+		{"vacancies fail", nil, detailsFail, storage.NewMemoryStore(), exitAPIError},
+		{"store fails", []string{"--since-id"}, newFakeAPI(1, 5), &highWaterStore{MemoryStore: storage.NewMemoryStore(), err: errors.New("connection refused")}, exitDBError},
+		{"timeout", []string{"--max-duration=20ms"}, hangs, storage.NewMemoryStore(), exitTimeout},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := loadTestConfig(t, tt.args...)
+			r := newTestRunner(t, cfg, tt.client, tt.store)
+			if got := r.runCycle(context.Background()); got != tt.want {
+				t.Errorf("exit code = %d (%s), want %d (%s)", got, exitCodeDescriptions[got], tt.want, exitCodeDescriptions[tt.want])
+			}
+		})
+	}
+}
+
+func TestRunCycleStoppedBySignal(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "summary.json")
+	cfg := loadTestConfig(t, "--summary-format=json")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client := newFakeAPI(1, 5)
+	client.detail = func(ctx context.Context, id string) (map[string]interface{}, error) {
+		cancel()
+		return nil, ctx.Err()
+	}
+
+	r := newTestRunner(t, cfg, client, storage.NewMemoryStore())
+	cfg.SummaryOut = path
+	if code := r.runCycle(ctx); code != exitInterrupted {
+		t.Errorf("exit code = %d (%s), want %d", code, exitCodeDescriptions[code], exitInterrupted)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var summary runSummary
+	if err := json.Unmarshal(data, &summary); err != nil {
+		t.Fatal(err)
+	}
+	if summary.ExitCode != exitInterrupted || summary.ExitDescription != "stopped by signal" {
+		t.Errorf("summary exit = %d (%s), want %d (stopped by signal)", summary.ExitCode, summary.ExitDescription, exitInterrupted)
+	}
+}
+
+func TestRunConfigErrors(t *testing.T) {
+	for _, args := range [][]string{
+		{},
+		{"--from=2024-03-01", "--to=2024-03-01", "--tz=Nowhere/Special"},
+		{"--from=2024-03-01", "--to=2024-03-01", "--per-page=0"},
+	} {
+		setArgs(t, args...)
+		if got := run(); got != exitConfigError {
+			t.Errorf("run() with %v = %d, want %d", args, got, exitConfigError)
+		}
+	}
+}
+
+func TestValidateConfigOrderBy(t *testing.T) {
+	if cfg := loadTestConfig(t, "--order-by=salary_desc"); cfg.OrderBy != "salary_desc" {
+		t.Errorf("OrderBy = %q, want salary_desc", cfg.OrderBy)
+	}
+	setArgs(t, append(append([]string{}, testArgs...), "--order-by=newest")...)
+	if err := validateConfig(config.LoadConfig()); err == nil || !strings.Contains(err.Error(), `unknown order_by "newest"`) {
+		t.Errorf("validateConfig error = %v, want unknown order_by", err)
+	}
+}
+
+func TestSalaryFlagsReachSearch(t *testing.T) {
+	cfg := loadTestConfig(t, "--min-salary=250000", "--currency=usd", "--only-with-salary")
+	client := newFakeAPI(1, 2)
+	if code := newTestRunner(t, cfg, client, storage.NewMemoryStore()).runCycle(context.Background()); code != exitOK {
+		t.Fatalf("exit code = %d", code)
+	}
+	query := client.queries[0]
+	if query.Salary != 250000 || query.Currency != "USD" || !query.OnlyWithSalary {
+		t.Errorf("salary, currency, only with salary = %d, %q, %v", query.Salary, query.Currency, query.OnlyWithSalary)
+	}
+
+	setArgs(t, append(append([]string{}, testArgs...), "--min-salary=-1")...)
+	if err := validateConfig(config.LoadConfig()); err == nil {
+		t.Error("negative --min-salary accepted")
+	}
+}
+
+// roleAPI answers each search with the ids listed for its role, on a
+// single page.
+type roleAPI struct {
+	*fakeAPI
+	ids map[string][]string
+}
+
+func (a *roleAPI) GetVacancyIDs(ctx context.Context, query api.SearchQuery, page int) (api.SearchResult, error) {
+	a.fakeAPI.GetVacancyIDs(ctx, query, page)
+	result := api.SearchResult{IDs: a.ids[query.Role], Pages: 1, Found: len(a.ids[query.Role])}
+	for _, id := range result.IDs {
+		result.Items = append(result.Items, map[string]interface{}{"id": id})
+	}
+	return result, nil
+}
+
+func TestTargetsFileRun(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "targets.yaml")
+	targets := "targets:\n  - {name: go, area: \"1\", role: \"96\", text: golang}\n  - {name: qa, area: \"2\", role: \"124\"}\n"
+	if err := os.WriteFile(path, []byte(targets), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := loadTestConfig(t, "--targets-file="+path, "--summary-format=json")
+	client := &roleAPI{fakeAPI: newFakeAPI(0, 0), ids: map[string][]string{
+		"96":  {"1", "2", "3"},
+		"124": {"3", "4"},
+	}}
+	r := newTestRunner(t, cfg, client, storage.NewMemoryStore())
+	cfg.SummaryOut = filepath.Join(t.TempDir(), "summary.json")
+
+	if code := r.runCycle(context.Background()); code != exitOK {
+		t.Fatalf("exit code = %d", code)
+	}
+
+	if len(client.queries) != 2 {
+		t.Fatalf("%d searches, want one per target", len(client.queries))
+	}
+	for i, want := range []api.SearchQuery{{Area: "1", Role: "96", Text: "golang"}, {Area: "2", Role: "124"}} {
+		got := client.queries[i]
+		if got.Area != want.Area || got.Role != want.Role || got.Text != want.Text {
+			t.Errorf("search %d = area %q, role %q, text %q, want %+v", i, got.Area, got.Role, got.Text, want)
+		}
+	}
+	// Vacancy 3 matches both targets but is fetched once.
+	if _, detail, _ := client.counts(); detail != 4 {
+		t.Errorf("%d vacancies fetched, want 4", detail)
+	}
+
+	var summary runSummary
+	data, _ := os.ReadFile(cfg.SummaryOut)
+	if err := json.Unmarshal(data, &summary); err != nil {
+		t.Fatal(err)
+	}
+	saved := map[string]int64{}
+	for _, target := range summary.Targets {
+		saved[target.Name] = target.Saved
+	}
+	if summary.Saved != 4 || saved["go"]+saved["qa"] != 4 || saved["go"] < 2 || saved["qa"] < 1 {
+		t.Errorf("saved %d, per target %v, want 4 split between go and qa", summary.Saved, saved)
+	}
+}
+
+func TestCoverageCheck(t *testing.T) {
+	tests := []struct {
+		name    string
+		found   int
+		warning bool
+	}{
+		{"all seen", 20, false},
+		{"within tolerance", 22, false},
+		{"capped", 2500, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := loadTestConfig(t, "--summary-format=json")
+			client := newFakeAPI(2, 10)
+			client.search = func(ctx context.Context, page int) (api.SearchResult, error) {
+				result := client.page(page)
+				result.Found = tt.found
+				return result, nil
+			}
+			r := newTestRunner(t, cfg, client, storage.NewMemoryStore())
+			appLogger, errorLog := bufferLogger()
+			r.logger = appLogger
+			cfg.SummaryOut = filepath.Join(t.TempDir(), "summary.json")
+
+			if code := r.runCycle(context.Background()); code != exitOK {
+				t.Fatalf("exit code = %d", code)
+			}
+			warned := strings.Contains(errorLog.String(), fmt.Sprintf("Coverage warning: saw 20 unique vacancies but the API reported %d found", tt.found))
+			if warned != tt.warning {
+				t.Errorf("coverage warning logged: %v, want %v\n%s", warned, tt.warning, errorLog)
+			}
+
+			var summary runSummary
+			data, _ := os.ReadFile(cfg.SummaryOut)
+			if err := json.Unmarshal(data, &summary); err != nil {
+				t.Fatal(err)
+			}
+			if summary.Seen != 20 || summary.Found != int64(tt.found) || summary.LowCoverage != tt.warning {
+				t.Errorf("summary seen %d, found %d, low coverage %v", summary.Seen, summary.Found, summary.LowCoverage)
+			}
+		})
+	}
+}
+
+func TestValidateConfigSinks(t *testing.T) {
+	tests := []struct {
+		sinks string
+		want  string
+	}{
+		{"mongo,file", ""},
+		{"mongo,s3", `unknown sink "s3"`},
+		{"file", "--sinks must include mongo"},
+	}
+	for _, tt := range tests {
+		setArgs(t, append(append([]string{}, testArgs...), "--sinks="+tt.sinks)...)
+		err := validateConfig(config.LoadConfig())
+		if tt.want == "" && err != nil || tt.want != "" && (err == nil || !strings.Contains(err.Error(), tt.want)) {
+			t.Errorf("--sinks=%s: error = %v, want %q", tt.sinks, err, tt.want)
+		}
+	}
+}
+
+func TestMemoryStateResumesDedup(t *testing.T) {
+	cfg := loadTestConfig(t, "--memory-state="+filepath.Join(t.TempDir(), "state.json.gz"))
+
+	run := func() *fakeAPI {
+		t.Helper()
+		store, mongoStore, closeStore, code := openStore(cfg, testLogger())
+		if code != exitOK || mongoStore != nil {
+			t.Fatalf("openStore = %d, mongo store %v", code, mongoStore)
+		}
+		defer closeStore()
+		client := newFakeAPI(1, 3)
+		if code := newTestRunner(t, cfg, client, store).runCycle(context.Background()); code != exitOK {
+			t.Fatalf("exit code = %d", code)
+		}
+		return client
+	}
+
+	if _, detail, _ := run().counts(); detail != 3 {
+		t.Fatalf("first run fetched %d vacancies, want 3", detail)
+	}
+	if _, detail, _ := run().counts(); detail != 0 {
+		t.Errorf("second run fetched %d vacancies the first one saved", detail)
+	}
+}
+
+func TestValidateConfigMemoryState(t *testing.T) {
+	for _, flag := range []string{"--partition=monthly", "--dlq=mongo", "--track-changes", "--since-id", "--unique-description-index", "--write-batch-size=50"} {
+		setArgs(t, append(append([]string{}, testArgs...), "--memory-state=state.json.gz", flag)...)
+		if err := validateConfig(config.LoadConfig()); err == nil {
+			t.Errorf("--memory-state accepted with %s", flag)
+		}
+	}
+	setArgs(t, append(append([]string{}, testArgs...), "--memory-state=state.json.gz", "--write-batch-size=1")...)
+	if err := validateConfig(config.LoadConfig()); err != nil {
+		t.Errorf("--memory-state rejected with the unbatched --write-batch-size=1: %v", err)
+	}
+}
+
+func TestValidateConfigDupPolicy(t *testing.T) {
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"--no-dedup-description"}, "store"},
+		{[]string{"--dup-by-id-wins"}, "flag"},
+		{[]string{"--dup-policy=keep"}, ""},
+		{[]string{"--no-dedup-description", "--dup-policy=flag"}, ""},
+		{[]string{"--unique-description-index", "--dup-policy=store"}, ""},
+	}
+	for _, tt := range tests {
+		setArgs(t, append(append([]string{}, testArgs...), tt.args...)...)
+		cfg := config.LoadConfig()
+		err := validateConfig(cfg)
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("%v accepted", tt.args)
+			}
+			continue
+		}
+		if err != nil || cfg.DupPolicy != tt.want {
+			t.Errorf("%v: policy %q, error %v, want %q", tt.args, cfg.DupPolicy, err, tt.want)
+		}
+	}
+}
+
+func TestLabelsReachSearch(t *testing.T) {
+	cfg := loadTestConfig(t, "--labels=not_from_agency,accredited_it")
+	client := newFakeAPI(1, 2)
+	if code := newTestRunner(t, cfg, client, storage.NewMemoryStore()).runCycle(context.Background()); code != exitOK {
+		t.Fatalf("exit code = %d", code)
+	}
+	if got := strings.Join(client.queries[0].Labels, ","); got != "not_from_agency,accredited_it" {
+		t.Errorf("search labels = %s", got)
+	}
+
+	setArgs(t, append(append([]string{}, testArgs...), "--labels=remote")...)
+	if err := validateConfig(config.LoadConfig()); err == nil {
+		t.Error("unknown label accepted")
+	}
+}
+
+func TestEmployersReachSearch(t *testing.T) {
+	cfg := loadTestConfig(t, "--employers=1740,3529", "--labels=not_from_agency")
+	client := newFakeAPI(1, 2)
+	if code := newTestRunner(t, cfg, client, storage.NewMemoryStore()).runCycle(context.Background()); code != exitOK {
+		t.Fatalf("exit code = %d", code)
+	}
+	query := client.queries[0]
+	if strings.Join(query.Employers, ",") != "1740,3529" || len(query.Labels) != 1 {
+		t.Errorf("search employers %v, labels %v", query.Employers, query.Labels)
+	}
+
+	setArgs(t, append(append([]string{}, testArgs...), "--employers=yandex")...)
+	if err := validateConfig(config.LoadConfig()); err == nil {
+		t.Error("non-numeric employer id accepted")
+	}
+}
+
+func TestRunRecordLifecycle(t *testing.T) {
+	searchFails := newFakeAPI(1, 2)
+	searchFails.search = func(ctx context.Context, page int) (api.SearchResult, error) {
+		return api.SearchResult{}, &api.StatusError{StatusCode: http.StatusBadGateway}
+	}
+	tests := []struct {
+		name   string
+		client *fakeAPI
+		cancel bool
+		status string
+	}{
+		{"success", newFakeAPI(1, 2), false, storage.RunStatusSucceeded},
+		{"failure", searchFails, false, storage.RunStatusFailed},
+		{"cancelled", newFakeAPI(1, 2), true, storage.RunStatusFailed},
+	}
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			t := mt.T
+			reply := mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1})
+			mt.AddMockResponses(reply, reply)
+			r := newTestRunner(t, loadTestConfig(t), tt.client, storage.NewMemoryStore())
+			r.runs = &storage.RunLog{Collection: mt.Coll}
+			ctx, cancel := context.WithCancel(context.Background())
+			if tt.cancel {
+				cancel()
+			}
+			defer cancel()
+			r.runCycle(ctx)
+
+			var sets []bson.Raw
+			for _, event := range mt.GetAllStartedEvents() {
+				sets = append(sets, event.Command.Lookup("updates").Array().Index(0).Value().Document().Lookup("u", "$set").Document())
+			}
+			if len(sets) != 2 {
+				t.Fatalf("%d run log writes, want start and finish", len(sets))
+			}
+			if status := sets[0].Lookup("status").StringValue(); status != storage.RunStatusRunning {
+				t.Errorf("start status = %s", status)
+			}
+			if status := sets[1].Lookup("status").StringValue(); status != tt.status {
+				t.Errorf("finish status = %s, want %s", status, tt.status)
+			}
+			runID := sets[0].Lookup("run_id").StringValue()
+			if runID == "" || sets[1].Lookup("stats", "run_id").StringValue() != runID {
+				t.Errorf("finish stats belong to run %v, want %q", sets[1].Lookup("stats", "run_id"), runID)
+			}
+			_, err := sets[1].LookupErr("error")
+			if hasError := err == nil; hasError != (tt.status == storage.RunStatusFailed) {
+				t.Errorf("error recorded: %v, status %s", hasError, tt.status)
+			}
+		})
+	}
+}
+
+// rolesTransport answers every request with the professional roles
+// dictionary, or with status when it is set.
+type rolesTransport struct {
+	status int
+}
+
+func (t rolesTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	status, body := http.StatusOK, `{"categories": [{"id": "11", "roles": [{"id": "96", "name": "Программист, разработчик"}, {"id": "124", "name": "Тестировщик"}]}]}`
+	if t.status != 0 {
+		status, body = t.status, `{"errors": [{"type": "service_unavailable"}]}`
+	}
+	return &http.Response{StatusCode: status, Header: http.Header{}, Body: io.NopCloser(strings.NewReader(body)), Request: req}, nil
+}
+
+func TestResolveRoles(t *testing.T) {
+	tests := []struct {
+		name       string
+		role       string
+		targetRole string
+		status     int
+		want       int
+		wantRole   string
+		wantTarget string
+	}{
+		{"ids", "96", "124", 0, exitOK, "96", "124"},
+		{"names", "программист, разработчик", "Тестировщик", 0, exitOK, "96", "124"},
+		{"unknown role", "9600", "", 0, exitConfigError, "", ""},
+		{"unknown target role", "96", "QA", 0, exitConfigError, "", ""},
+		{"dictionary unavailable", "Тестировщик", "", http.StatusServiceUnavailable, exitOK, "Тестировщик", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := loadTestConfig(t, "--role="+tt.role)
+			cfg.Targets = []config.Target{{Name: "qa", Role: tt.targetRole}}
+			hhClient := api.NewHHClient("test-token")
+			hhClient.HTTPClient.Transport = rolesTransport{status: tt.status}
+
+			if got := resolveRoles(cfg, hhClient, testLogger()); got != tt.want {
+				t.Fatalf("resolveRoles = %d, want %d", got, tt.want)
+			}
+			if tt.want == exitOK && (cfg.ProfessionalRole != tt.wantRole || cfg.Targets[0].Role != tt.wantTarget) {
+				t.Errorf("roles = %q, %q, want %q, %q", cfg.ProfessionalRole, cfg.Targets[0].Role, tt.wantRole, tt.wantTarget)
+			}
+		})
+	}
+}
+
+// statusTransport answers every request with status and body and counts
+// the requests.
+type statusTransport struct {
+	status int
+	body   string
+	calls  int
+}
+
+func (t *statusTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.calls++
+	return &http.Response{StatusCode: t.status, Header: http.Header{}, Body: io.NopCloser(strings.NewReader(t.body)), Request: req}, nil
+}
+
+func TestCheckAuthProbe(t *testing.T) {
+	tests := []struct {
+		name   string
+		args   []string
+		status int
+		body   string
+		code   int
+		calls  int
+	}{
+		{"valid token", nil, http.StatusOK, `{"id": "1"}`, exitOK, 1},
+		{"unauthorized", nil, http.StatusUnauthorized, `{}`, exitConfigError, 1},
+		{"expired token", nil, http.StatusForbidden, `{"errors": [{"type": "oauth", "value": "token_expired"}]}`, exitConfigError, 1},
+		{"api unavailable", nil, http.StatusServiceUnavailable, `{}`, exitOK, 1},
+		{"skipped", []string{"--skip-auth-check"}, http.StatusUnauthorized, `{}`, exitOK, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := loadTestConfig(t, tt.args...)
+			transport := &statusTransport{status: tt.status, body: tt.body}
+			client := api.NewHHClient("test-token")
+			client.HTTPClient.Transport = transport
+			appLogger, errorLog := bufferLogger()
+
+			if code := checkAuth(cfg, client, appLogger); code != tt.code {
+				t.Errorf("checkAuth = %d, want %d", code, tt.code)
+			}
+			if transport.calls != tt.calls {
+				t.Errorf("%d probe requests, want %d", transport.calls, tt.calls)
+			}
+			if tt.code == exitConfigError && !strings.Contains(errorLog.String(), "BEARER_TOKEN is invalid or expired") {
+				t.Errorf("log does not name the token:\n%s", errorLog)
+			}
+		})
+	}
+}
+
+func TestValidateConfigShardKey(t *testing.T) {
+	if cfg := loadTestConfig(t, "--shard-key=area.id,id"); strings.Join(cfg.ShardKey, ",") != "area.id,id" {
+		t.Errorf("ShardKey = %v, want [area.id id]", cfg.ShardKey)
+	}
+	for _, args := range [][]string{
+		{"--shard-key=area.id", "--partition=monthly"},
+		{"--shard-key=area.id", "--memory-state=state.json"},
+	} {
+		setArgs(t, append(append([]string{}, testArgs...), args...)...)
+		if err := validateConfig(config.LoadConfig()); err == nil {
+			t.Errorf("%v accepted", args)
+		}
+	}
+}
+
+func TestNoMagicReachesSearch(t *testing.T) {
+	for _, noMagic := range []bool{false, true} {
+		cfg := loadTestConfig(t, fmt.Sprintf("--no-magic=%v", noMagic))
+		client := newFakeAPI(1, 2)
+		if code := newTestRunner(t, cfg, client, storage.NewMemoryStore()).runCycle(context.Background()); code != exitOK {
+			t.Fatalf("exit code = %d", code)
+		}
+		if client.queries[0].NoMagic != noMagic {
+			t.Errorf("--no-magic=%v: search NoMagic = %v", noMagic, client.queries[0].NoMagic)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"hh_it_scrapper/storage"
+)
+
+// migration upgrades a document from schema version from to from+1.
+type migration struct {
+	from  int
+	apply func(data map[string]interface{})
+}
+
+// migrations are applied in order. Documents stored before schema_version
+// existed count as version 0.
+var migrations = []migration{
+	{from: 0, apply: fillCanonicalFields},
+}
+
+// migrateDocument applies every migration above the document's version and
+// reports whether anything changed. Documents already at schemaVersion are
+// left alone, so running it twice is harmless.
+func migrateDocument(data map[string]interface{}) bool {
+	version := documentSchemaVersion(data)
+	if version >= schemaVersion {
+		return false
+	}
+	for _, m := range migrations {
+		if m.from == version {
+			m.apply(data)
+			version++
+		}
+	}
+	data["schema_version"] = version
+	return true
+}
+
+func documentSchemaVersion(data map[string]interface{}) int {
+	switch v := data["schema_version"].(type) {
+	case int32:
+		return int(v)
+	case int64:
+		return int(v)
+	case int:
+		return v
+	case float64:
+		return int(v)
+	}
+	return 0
+}
+
+// runMigrate implements "migrate", upgrading stored vacancies to the
+// current schema_version. Only documents below that version are read, so
+// an interrupted migration resumes where it stopped when run again.
+func runMigrate(args []string) int {
+	fs := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	batchSize := fs.Int("batch-size", 1000, "Cursor batch size for the scan")
+	timeout := fs.Duration("timeout", 6*time.Hour, "Timeout for the whole command")
+	if err := fs.Parse(args); err != nil {
+		return exitConfigError
+	}
+
+	mongoURI := os.Getenv("MONGO_URI")
+	if mongoURI == "" {
+		log.Print("MONGO_URI must be provided")
+		return exitConfigError
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	mongoStore, err := storage.NewMongoStore(mongoURI, "vacancy_db", "vacancies")
+	if err != nil {
+		log.Print(err)
+		return exitDBError
+	}
+	defer mongoStore.Collection.Database().Client().Disconnect(context.Background())
+	mongoStore.BatchSize = int32(*batchSize)
+
+	migrated, err := migrateVacancies(ctx, mongoStore)
+	if err != nil {
+		log.Printf("Migration stopped after %d vacancies: %v", migrated, err)
+		return exitDBError
+	}
+	fmt.Fprintf(os.Stderr, "%d vacancies migrated to schema version %d\n", migrated, schemaVersion)
+	return exitOK
+}
+
+// migrateVacancies rewrites every stored vacancy below schemaVersion and
+// returns how many were migrated.
+func migrateVacancies(ctx context.Context, mongoStore *storage.MongoStore) (int, error) {
+	migrated := 0
+	err := mongoStore.EachBelowSchemaVersion(ctx, schemaVersion, func(data map[string]interface{}) error {
+		if !migrateDocument(data) {
+			return nil
+		}
+		if err := mongoStore.ReplaceVacancy(ctx, data); err != nil {
+			return err
+		}
+		migrated++
+		return nil
+	})
+	return migrated, err
+}
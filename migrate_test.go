@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"hh_it_scrapper/storage"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestMigrateDocument(t *testing.T) {
+	legacy := map[string]interface{}{"id": "1", "name": "Go developer"}
+	if !migrateDocument(legacy) {
+		t.Fatal("version 0 document not migrated")
+	}
+	if documentSchemaVersion(legacy) != schemaVersion {
+		t.Errorf("schema_version = %v, want %d", legacy["schema_version"], schemaVersion)
+	}
+	for _, field := range canonicalFields {
+		if _, ok := legacy[field]; !ok {
+			t.Errorf("canonical field %s missing after migration", field)
+		}
+	}
+
+	// Versions come back from MongoDB as int32.
+	current := map[string]interface{}{"id": "2", "schema_version": int32(schemaVersion)}
+	if migrateDocument(current) {
+		t.Error("current document migrated again")
+	}
+	if len(current) != 2 {
+		t.Errorf("current document changed: %v", current)
+	}
+}
+
+func TestMigrateVacancies(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	mt.Run("mock", func(mt *mtest.T) {
+		t := mt.T
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "test.vacancies", mtest.FirstBatch,
+				bson.D{{Key: "id", Value: "1"}, {Key: "name", Value: "Go developer"}},
+				bson.D{{Key: "id", Value: "2"}, {Key: "schema_version", Value: int32(0)}},
+			),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}),
+		)
+
+		migrated, err := migrateVacancies(context.Background(), &storage.MongoStore{Collection: mt.Coll})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if migrated != 2 {
+			t.Errorf("%d vacancies migrated, want 2", migrated)
+		}
+
+		events := mt.GetAllStartedEvents()
+		if len(events) != 3 {
+			t.Fatalf("%d commands, want a find and two replacements", len(events))
+		}
+		if _, err := events[0].Command.LookupErr("filter", "$or"); err != nil {
+			t.Errorf("find = %v, want only documents below the current version", events[0].Command)
+		}
+		for _, event := range events[1:] {
+			replacement := event.Command.Lookup("updates").Array().Index(0).Value().Document().Lookup("u").Document()
+			if version := replacement.Lookup("schema_version"); version.AsInt64() != schemaVersion {
+				t.Errorf("replacement schema_version = %v, want %d", version, schemaVersion)
+			}
+			if _, err := replacement.LookupErr("content_hash"); err != nil {
+				t.Errorf("replacement %v lacks the canonical fields", replacement)
+			}
+		}
+	})
+}
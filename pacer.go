@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// pacer spaces calls at least interval apart, across all goroutines that
+// share it. A nil pacer never waits.
+type pacer struct {
+	interval time.Duration
+
+	mu   sync.Mutex
+	next time.Time
+	now  func() time.Time
+}
+
+func newPacer(interval time.Duration) *pacer {
+	if interval <= 0 {
+		return nil
+	}
+	return &pacer{interval: interval, now: time.Now}
+}
+
+// wait reserves the next slot and sleeps until it, returning early with
+// the context's error if it is cancelled.
+func (p *pacer) wait(ctx context.Context) error {
+	if p == nil {
+		return ctx.Err()
+	}
+
+	p.mu.Lock()
+	now := p.now()
+	slot := p.next
+	if slot.Before(now) {
+		slot = now
+	}
+	p.next = slot.Add(p.interval)
+	p.mu.Unlock()
+
+	delay := slot.Sub(now)
+	if delay <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"hh_it_scrapper/api"
+)
+
+func TestPacerSpacesCalls(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	p := newPacer(time.Hour)
+	p.now = func() time.Time { return now }
+
+	if err := p.wait(context.Background()); err != nil {
+		t.Fatalf("first wait = %v", err)
+	}
+	if want := now.Add(time.Hour); !p.next.Equal(want) {
+		t.Errorf("next slot = %v, want %v", p.next, want)
+	}
+
+	// The second call's slot is an hour away, so only cancellation ends it.
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := p.wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("wait inside the interval = %v, want the context error", err)
+	}
+
+	// Once the clock passes the reserved slots, calls go straight through.
+	now = now.Add(3 * time.Hour)
+	start := time.Now()
+	if err := p.wait(context.Background()); err != nil || time.Since(start) > time.Second {
+		t.Errorf("wait after the interval = %v after %v", err, time.Since(start))
+	}
+}
+
+func TestPacerDisabled(t *testing.T) {
+	if p := newPacer(0); p != nil {
+		t.Fatalf("newPacer(0) = %+v, want nil", p)
+	}
+	var p *pacer
+	if err := p.wait(context.Background()); err != nil {
+		t.Errorf("nil pacer wait = %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := p.wait(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("nil pacer with a cancelled context = %v", err)
+	}
+}
+
+func TestPageDelayBetweenSearchPages(t *testing.T) {
+	const delay = 30 * time.Millisecond
+	cfg := loadTestConfig(t, "--page-delay="+delay.String())
+	client := newFakeAPI(3, 2)
+	var mu sync.Mutex
+	var times []time.Time
+	client.search = func(ctx context.Context, page int) (api.SearchResult, error) {
+		mu.Lock()
+		times = append(times, time.Now())
+		mu.Unlock()
+		return client.page(page), nil
+	}
+	p := newTestPipeline(t, cfg, client, newCountingStore())
+	if err := executeWithin(t, p, context.Background(), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(times) != 3 {
+		t.Fatalf("%d searches, want 3", len(times))
+	}
+	// Slots are reserved before sleeping, so scheduling jitter can shift
+	// one request relative to the next but not the schedule as a whole.
+	const jitter = 5 * time.Millisecond
+	for i := 1; i < len(times); i++ {
+		if since := times[i].Sub(times[0]); since < time.Duration(i)*delay-jitter {
+			t.Errorf("page %d requested %v after page 0, want about %v", i, since, time.Duration(i)*delay)
+		}
+	}
+}
@@ -0,0 +1,1233 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"hh_it_scrapper/api"
+	"hh_it_scrapper/config"
+	"hh_it_scrapper/logger"
+	"hh_it_scrapper/storage"
+	"hh_it_scrapper/transform"
+)
+
+// minCoverageRatio is the share of the API's reported total a search has to
+// see before the run stops warning about missed vacancies.
+const minCoverageRatio = 0.9
+
+var (
+	errSearchFailed = errors.New("search request failed")
+	errStoreFailed  = errors.New("store write failed")
+	errTooManyFails = errors.New("too many vacancies failed")
+)
+
+type vacancyAPI interface {
+	GetVacancyIDs(ctx context.Context, query api.SearchQuery, page int) (api.SearchResult, error)
+	GetVacancyDetails(ctx context.Context, vacancyID string) (map[string]interface{}, error)
+}
+
+type pipeline struct {
+	cfg           *config.AppConfig
+	client        vacancyAPI
+	store         storage.Store
+	logger        *logger.AppLogger
+	hasher        api.Hasher
+	runID         string
+	fieldMap      transform.FieldMap
+	retryStatuses api.StatusSet
+	highWater     int64
+	retryBudget   *api.RetryBudget
+	searchSem     chan struct{}
+	pageDelay     *pacer
+	detailQueue   chan detailJob
+	queuedIDs     sync.Map
+	stats         *RunStats
+	latency       latencyStats
+	ramp          *concurrencyRamp
+	targets       []*scrapeTarget
+	seenIDs       sync.Map
+	lowCoverage   bool
+	dlq           storage.DeadLetterQueue
+	idsOut        *idWriter
+	spill         *idWriter
+	areaPaths     map[string][]string
+
+	// With a buffering store, writes are only counted once flushed.
+	buffered       bool
+	bufferedWrites sync.Map
+	bufferedHashes sync.Map
+}
+
+// unprocessableError marks a vacancy whose payload can never be stored, so it
+// is dead-lettered instead of retried.
+type unprocessableError struct {
+	err error
+	raw []byte
+}
+
+func (e *unprocessableError) Error() string {
+	return e.err.Error()
+}
+
+func (e *unprocessableError) Unwrap() error {
+	return e.err
+}
+
+func newPipeline(cfg *config.AppConfig, client vacancyAPI, store storage.Store, hasher api.Hasher, runID string, logger *logger.AppLogger) *pipeline {
+	p := &pipeline{
+		cfg:         cfg,
+		runID:       runID,
+		client:      client,
+		store:       store,
+		hasher:      hasher,
+		retryBudget: newRetryBudget(cfg),
+		stats:       &RunStats{},
+		logger:      logger,
+		searchSem:   make(chan struct{}, cfg.SearchConcurrency),
+		pageDelay:   newPacer(cfg.PageDelay),
+	}
+	if notifier, ok := store.(storage.WriteNotifier); ok {
+		p.buffered = notifier.NotifyWrites(p.onFlushed)
+	}
+	return p
+}
+
+func (p *pipeline) countSaved(t *scrapeTarget) {
+	p.stats.IncSaved()
+	if t != nil {
+		atomic.AddInt64(&t.saved, 1)
+	}
+}
+
+type bufferedWrite struct {
+	target *scrapeTarget
+	hash   string
+}
+
+// recordWrite counts a successful UpsertVacancy and registers its
+// description hash. A buffering store has not written anything yet, so the
+// write is only remembered until onFlushed reports it; meanwhile its hash
+// still counts for duplicate checks within the run.
+func (p *pipeline) recordWrite(t *scrapeTarget, vacancyID, hash string) {
+	if p.buffered {
+		p.bufferedWrites.Store(vacancyID, bufferedWrite{target: t, hash: hash})
+		if hash != "" {
+			p.bufferedHashes.Store(hash, true)
+		}
+		return
+	}
+	if hash != "" {
+		p.store.AddDescriptionHash(hash)
+	}
+	p.countSaved(t)
+}
+
+func (p *pipeline) onFlushed(data map[string]interface{}, err error) {
+	vacancyID, _ := data["id"].(string)
+	value, ok := p.bufferedWrites.LoadAndDelete(vacancyID)
+	if !ok {
+		return
+	}
+	write := value.(bufferedWrite)
+	if write.hash != "" {
+		p.bufferedHashes.Delete(write.hash)
+	}
+	if errors.Is(err, storage.ErrDuplicateDescription) {
+		p.stats.IncDuplicate()
+		p.logger.Info.Printf("Vacancy %s rejected by the unique description index, skipping", vacancyID)
+		return
+	}
+	if write.hash != "" {
+		p.store.AddDescriptionHash(write.hash)
+	}
+	p.countSaved(write.target)
+}
+
+func (p *pipeline) descriptionStored(hash string) bool {
+	if _, ok := p.bufferedHashes.Load(hash); ok {
+		return true
+	}
+	return p.store.DescriptionHashExists(hash)
+}
+
+func newRetryBudget(cfg *config.AppConfig) *api.RetryBudget {
+	budget := api.NewRetryBudget(cfg.RateLimitThreshold, cfg.RateLimitWindow, cfg.RateLimitCooldown)
+	if cfg.ResumeAt != "" {
+		budget.LongPauseTrips = cfg.ResumeAfterTrips
+		budget.ResumeAt = func(now time.Time) time.Time {
+			resume, _ := cfg.NextResumeAt(now)
+			return resume
+		}
+	}
+	return budget
+}
+
+func (p *pipeline) execute(ctx context.Context, listedIDs []string) (err error) {
+	defer func() {
+		if drainErr := p.drain(); drainErr != nil && err == nil {
+			err = drainErr
+		}
+		if flushErr := p.idsOut.Flush(); flushErr != nil && err == nil {
+			err = flushErr
+		}
+		if flushErr := p.spill.Flush(); flushErr != nil && err == nil {
+			err = flushErr
+		}
+	}()
+
+	switch {
+	case p.cfg.Reprocess:
+		err = p.reprocess(ctx)
+	case p.cfg.IDsFile != "" || p.cfg.RefreshStale > 0:
+		waitDetails := p.startDetailWorkers(ctx)
+		err = p.runListed(ctx, listedIDs)
+		waitDetails()
+	default:
+		waitDetails := p.startDetailWorkers(ctx)
+		err = p.runTargets(ctx)
+		waitDetails()
+		p.checkCoverage()
+	}
+	if err == nil {
+		// Workers skip the queued vacancies once ctx is done, so a run
+		// cancelled after its search finished is still incomplete.
+		err = ctx.Err()
+	}
+	if err != nil {
+		return err
+	}
+	return p.checkFailureRatio()
+}
+
+func (p *pipeline) checkFailureRatio() error {
+	attempted := p.stats.Attempted()
+	failed := p.stats.Failed()
+	if attempted == 0 || failed == 0 {
+		return nil
+	}
+
+	ratio := float64(failed) / float64(attempted)
+	if ratio > p.cfg.MaxFailureRatio {
+		return fmt.Errorf("%w: %d of %d (%.1f%%, threshold %.1f%%)", errTooManyFails, failed, attempted, ratio*100, p.cfg.MaxFailureRatio*100)
+	}
+	return nil
+}
+
+func (p *pipeline) drain() error {
+	flusher, ok := p.store.(storage.Flusher)
+	if !ok {
+		return nil
+	}
+	pending := flusher.Pending()
+	if pending == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := flusher.Flush(ctx); err != nil {
+		p.logger.Error.Printf("Failed to flush %d buffered vacancies: %v", pending, err)
+		return fmt.Errorf("%w: %v", errStoreFailed, err)
+	}
+
+	p.stats.SetFlushed(pending)
+	p.logger.Info.Printf("Flushed %d buffered vacancies on shutdown", pending)
+	return nil
+}
+
+// scrapeTarget is one search of the run. pacer, when set, caps the rate of
+// its search page requests.
+type scrapeTarget struct {
+	name  string
+	query api.SearchQuery
+	pacer *pacer
+	saved int64
+	pages int64
+}
+
+func (t *scrapeTarget) savedCount() int64 {
+	return atomic.LoadInt64(&t.saved)
+}
+
+func (t *scrapeTarget) pagesDone() int64 {
+	return atomic.LoadInt64(&t.pages)
+}
+
+func (p *pipeline) runTargets(ctx context.Context) error {
+	p.targets = p.searchTargets()
+	if p.cfg.InterleaveTargets && len(p.targets) > 1 {
+		return p.runTargetsInterleaved(ctx)
+	}
+
+	var firstErr error
+	for _, t := range p.targets {
+		if err := p.runSearch(ctx, t); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			p.logger.Error.Printf("Target %s failed: %v", t.name, err)
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	return firstErr
+}
+
+// runTargetsInterleaved searches every target at once. All of them queue
+// for the same search workers, and goroutines blocked on a channel send are
+// served in arrival order, so busy targets take turns with quiet ones
+// instead of starving them.
+func (p *pipeline) runTargetsInterleaved(ctx context.Context) error {
+	errs := make([]error, len(p.targets))
+	var wg sync.WaitGroup
+	for i, t := range p.targets {
+		wg.Add(1)
+		go func(i int, t *scrapeTarget) {
+			defer wg.Done()
+			errs[i] = p.runSearch(ctx, t)
+		}(i, t)
+	}
+	wg.Wait()
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	var firstErr error
+	for i, err := range errs {
+		if err == nil {
+			continue
+		}
+		p.logger.Error.Printf("Target %s failed: %v", p.targets[i].name, err)
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+func (p *pipeline) runSearch(ctx context.Context, t *scrapeTarget) error {
+	if p.cfg.SinceID {
+		return p.runSearchSinceID(ctx, t)
+	}
+
+	startPage := p.cfg.StartPage
+	first, err := p.processSearchPage(ctx, t, startPage)
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return fmt.Errorf("%w: page %d: %v", errSearchFailed, startPage, err)
+	}
+	totalPages := first.Pages
+	endPage := totalPages - 1
+	if p.cfg.EndPage >= 0 && p.cfg.EndPage < endPage {
+		endPage = p.cfg.EndPage
+	}
+	p.logger.Info.Printf("Target %s: total pages: %d, fetching %d-%d", t.name, totalPages, startPage, endPage)
+
+	var depthExceeded int32
+	var wg sync.WaitGroup
+	for page := startPage + 1; page <= endPage; page++ {
+		select {
+		case <-ctx.Done():
+			wg.Wait()
+			return ctx.Err()
+		case p.searchSem <- struct{}{}:
+			wg.Add(1)
+			go func(page int) {
+				defer wg.Done()
+				defer func() { <-p.searchSem }()
+				if ctx.Err() != nil || atomic.LoadInt32(&depthExceeded) == 1 {
+					return
+				}
+
+				_, err := p.processSearchPage(ctx, t, page)
+				switch {
+				case err == nil, ctx.Err() != nil:
+				case errors.Is(err, api.ErrPaginationDepthExceeded):
+					if atomic.CompareAndSwapInt32(&depthExceeded, 0, 1) {
+						p.logger.Error.Printf("Target %s: page %d is past the API's result depth limit, narrow the date window to see the rest", t.name, page)
+					}
+				default:
+					p.logger.Error.Printf("Target %s: failed to fetch search page %d: %v", t.name, page, err)
+				}
+			}(page)
+		}
+	}
+
+	wg.Wait()
+	return ctx.Err()
+}
+
+// runSearchSinceID walks pages in publication order and stops once a whole
+// page consists of ids at or below the highest id already stored. Stopping
+// only on a full page keeps slightly out-of-order ids from ending the run early.
+func (p *pipeline) runSearchSinceID(ctx context.Context, t *scrapeTarget) error {
+	marker, ok := p.store.(storage.HighWaterMarker)
+	if !ok {
+		return fmt.Errorf("store does not support --since-id")
+	}
+	highWater, err := marker.MaxVacancyID(ctx)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errStoreFailed, err)
+	}
+	p.highWater = highWater
+	p.logger.Info.Printf("Since-id mode: highest stored vacancy id is %d", highWater)
+
+	totalPages := 1
+	for page := 0; page < totalPages; page++ {
+		result, err := p.processSearchPage(ctx, t, page)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if page == 0 {
+				return fmt.Errorf("%w: page 0: %v", errSearchFailed, err)
+			}
+			p.logger.Error.Printf("Failed to fetch search page %d: %v", page, err)
+			continue
+		}
+		totalPages = result.Pages
+
+		if highWater > 0 && len(result.IDs) > 0 && p.allAtOrBelowHighWater(result.IDs) {
+			p.logger.Info.Printf("Page %d is entirely at or below id %d, stopping", page, highWater)
+			return nil
+		}
+	}
+	return nil
+}
+
+func (p *pipeline) allAtOrBelowHighWater(ids []string) bool {
+	for _, id := range ids {
+		if !p.atOrBelowHighWater(id) {
+			return false
+		}
+	}
+	return true
+}
+
+func (p *pipeline) atOrBelowHighWater(id string) bool {
+	n, err := strconv.ParseInt(id, 10, 64)
+	return err == nil && p.highWater > 0 && n <= p.highWater
+}
+
+func (p *pipeline) processSearchPage(ctx context.Context, t *scrapeTarget, page int) (api.SearchResult, error) {
+	if err := p.retryBudget.Wait(ctx); err != nil {
+		return api.SearchResult{}, err
+	}
+	if err := t.pacer.wait(ctx); err != nil {
+		return api.SearchResult{}, err
+	}
+	if err := p.pageDelay.wait(ctx); err != nil {
+		return api.SearchResult{}, err
+	}
+	result, err := p.client.GetVacancyIDs(ctx, t.query, page)
+	if err != nil {
+		p.noteRateLimit(err)
+		if ctx.Err() != nil && len(result.IDs) > 0 {
+			p.keepPartialPage(t, page, result.IDs)
+		}
+		return api.SearchResult{}, err
+	}
+	if page == p.cfg.StartPage {
+		p.stats.AddSearchTotals(result.Found, result.Pages)
+	}
+	p.markSeen(result.IDs)
+
+	newIDs, err := p.selectIDsToFetch(result.IDs)
+	if err != nil {
+		return api.SearchResult{}, err
+	}
+	p.logger.Info.Printf("Target %s: processing page %d: %d new vacancies found", t.name, page, len(newIDs))
+	if p.cfg.SearchOnly {
+		err = p.storeSnippets(t, result, newIDs)
+	} else {
+		err = p.enqueueDetails(ctx, t, newIDs)
+	}
+	if err != nil {
+		return api.SearchResult{}, err
+	}
+
+	p.stats.IncPagesDone()
+	atomic.AddInt64(&t.pages, 1)
+	return result, nil
+}
+
+// keepPartialPage records the ids of a page whose processing was cut short
+// by cancellation, so they reach --ids-out even though no details are
+// fetched for them.
+func (p *pipeline) keepPartialPage(t *scrapeTarget, page int, ids []string) {
+	p.markSeen(ids)
+	kept := 0
+	for _, id := range ids {
+		if _, queued := p.queuedIDs.LoadOrStore(id, true); queued {
+			continue
+		}
+		if err := p.idsOut.Write(id); err != nil {
+			p.logger.Error.Printf("Target %s: failed to record ids of cancelled page %d: %v", t.name, page, err)
+			return
+		}
+		kept++
+	}
+	p.logger.Info.Printf("Target %s: run cancelled on page %d, %d parsed ids kept", t.name, page, kept)
+}
+
+func (p *pipeline) markSeen(ids []string) {
+	for _, id := range ids {
+		if _, loaded := p.seenIDs.LoadOrStore(id, true); !loaded {
+			p.stats.IncSeen()
+		}
+	}
+}
+
+// checkCoverage compares the unique vacancies the search returned with the
+// total the API reported as found. A large gap usually means the 2000-result
+// paging cap or failed pages hid part of the window.
+func (p *pipeline) checkCoverage() {
+	seen, found := p.coverage()
+	if found == 0 || p.cfg.SinceID || p.cfg.StartPage > 0 || p.cfg.EndPage >= 0 {
+		return
+	}
+	if float64(seen) < float64(found)*minCoverageRatio {
+		p.lowCoverage = true
+		p.logger.Error.Printf("Coverage warning: saw %d unique vacancies but the API reported %d found", seen, found)
+	}
+}
+
+func (p *pipeline) coverage() (seen, found int64) {
+	return p.stats.Seen(), p.stats.Found()
+}
+
+func (p *pipeline) searchTargets() []*scrapeTarget {
+	cfg := p.cfg
+	base := api.SearchQuery{
+		DateFrom: cfg.StartDate,
+		DateTo:   cfg.EndDate,
+		Area:     cfg.Area,
+		Role:     cfg.ProfessionalRole,
+		Text:     cfg.Text,
+		OrderBy:  cfg.OrderBy,
+		PerPage:  cfg.PerPage,
+
+		Salary:         cfg.MinSalary,
+		Currency:       cfg.Currency,
+		OnlyWithSalary: cfg.OnlyWithSalary,
+
+		IncludeArchived: cfg.IncludeArchived,
+		Labels:          cfg.Labels,
+		Employers:       cfg.Employers,
+		NoMagic:         cfg.NoMagic,
+	}
+	if len(cfg.Targets) == 0 {
+		return []*scrapeTarget{{name: "default", query: base, pacer: qpsPacer(cfg.TargetQPS)}}
+	}
+
+	targets := make([]*scrapeTarget, 0, len(cfg.Targets))
+	for i, spec := range cfg.Targets {
+		query := base
+		if spec.Area != "" {
+			query.Area = spec.Area
+		}
+		if spec.Role != "" {
+			query.Role = spec.Role
+		}
+		if spec.Text != "" {
+			query.Text = spec.Text
+		}
+		if spec.OrderBy != "" {
+			query.OrderBy = spec.OrderBy
+		}
+		if spec.MinSalary > 0 {
+			query.Salary = spec.MinSalary
+		}
+		if spec.Currency != "" {
+			query.Currency = spec.Currency
+		}
+		if spec.OnlyWithSalary {
+			query.OnlyWithSalary = true
+		}
+
+		name := spec.Name
+		if name == "" {
+			name = fmt.Sprintf("#%d (area=%s role=%s)", i+1, query.Area, query.Role)
+		}
+		qps := cfg.TargetQPS
+		if spec.QPS > 0 {
+			qps = spec.QPS
+		}
+		targets = append(targets, &scrapeTarget{name: name, query: query, pacer: qpsPacer(qps)})
+	}
+	return targets
+}
+
+func qpsPacer(qps float64) *pacer {
+	if qps <= 0 {
+		return nil
+	}
+	return newPacer(time.Duration(float64(time.Second) / qps))
+}
+
+func (p *pipeline) sourceQuery(t *scrapeTarget) map[string]interface{} {
+	if t == nil {
+		return map[string]interface{}{
+			"ids_file": p.cfg.IDsFile,
+			"run_id":   p.runID,
+		}
+	}
+
+	return map[string]interface{}{
+		"target":    t.name,
+		"area":      t.query.Area,
+		"role":      t.query.Role,
+		"text":      t.query.Text,
+		"date_from": t.query.DateFrom,
+		"date_to":   t.query.DateTo,
+		"run_id":    p.runID,
+	}
+}
+
+func (p *pipeline) runListed(ctx context.Context, ids []string) error {
+	newIDs, err := p.selectIDsToFetch(ids)
+	if err != nil {
+		return err
+	}
+	p.logger.Info.Printf("Processing %d listed vacancies: %d new", len(ids), len(newIDs))
+	return p.enqueueDetails(ctx, nil, newIDs)
+}
+
+// selectIDsToFetch fails when a store lookup fails rather than treating a
+// possibly stored vacancy as new.
+func (p *pipeline) selectIDsToFetch(ids []string) ([]string, error) {
+	if p.cfg.TrackChanges || p.cfg.Mode == config.ModeRefresh {
+		if p.highWater == 0 {
+			return ids, nil
+		}
+		var newer []string
+		for _, id := range ids {
+			if !p.atOrBelowHighWater(id) {
+				newer = append(newer, id)
+			}
+		}
+		return newer, nil
+	}
+
+	var newIDs []string
+	for _, id := range ids {
+		if p.atOrBelowHighWater(id) {
+			continue
+		}
+		exists, err := p.vacancyExists(id)
+		if err != nil {
+			return nil, fmt.Errorf("existence check failed: %w", err)
+		}
+		if !exists || p.storedAsSnippet(id) {
+			newIDs = append(newIDs, id)
+		}
+	}
+	return newIDs, nil
+}
+
+// storedAsSnippet reports a vacancy stored by an earlier --search-only run.
+// Its details were never fetched, so a regular run fetches them like a new
+// vacancy's.
+func (p *pipeline) storedAsSnippet(id string) bool {
+	if p.cfg.SearchOnly {
+		return false
+	}
+	checker, ok := p.store.(storage.SnippetChecker)
+	return ok && checker.StoredAsSnippet(id)
+}
+
+func (p *pipeline) vacancyExists(id string) (bool, error) {
+	if lookup, ok := p.store.(storage.VacancyLookup); ok {
+		return lookup.LookupVacancy(id)
+	}
+	return p.store.VacancyExists(id), nil
+}
+
+type detailJob struct {
+	target    *scrapeTarget
+	vacancyID string
+}
+
+// startDetailWorkers starts DetailConcurrency workers draining the detail
+// queue, so search pages only have to hand ids over instead of waiting for
+// every detail request. The returned func closes the queue and waits for
+// the workers to finish.
+func (p *pipeline) startDetailWorkers(ctx context.Context) func() {
+	p.detailQueue = make(chan detailJob, p.cfg.PrefetchBuffer)
+	if p.cfg.RampUp > 0 {
+		p.ramp = newConcurrencyRamp(p.cfg.RampStart, p.cfg.DetailConcurrency, p.cfg.RampUp)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < p.cfg.DetailConcurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range p.detailQueue {
+				if ctx.Err() != nil {
+					continue
+				}
+				if p.ramp != nil {
+					if p.ramp.acquire(ctx) != nil {
+						continue
+					}
+				}
+				p.stats.IncAttempted()
+				p.processWithRetries(ctx, job.target, job.vacancyID)
+				if p.ramp != nil {
+					p.ramp.release()
+				}
+			}
+		}()
+	}
+
+	return func() {
+		close(p.detailQueue)
+		wg.Wait()
+	}
+}
+
+// enqueueDetails blocks while the queue is full. An id that shows up on
+// more than one page or target is only queued once.
+func (p *pipeline) enqueueDetails(ctx context.Context, t *scrapeTarget, ids []string) error {
+	for _, id := range ids {
+		if _, queued := p.queuedIDs.LoadOrStore(id, true); queued {
+			continue
+		}
+		if err := p.idsOut.Write(id); err != nil {
+			return err
+		}
+		if p.cfg.IDsOnly {
+			continue
+		}
+		job := detailJob{target: t, vacancyID: id}
+		if p.cfg.OverflowPolicy != config.OverflowBlock {
+			select {
+			case p.detailQueue <- job:
+			default:
+				if err := p.overflow(id); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case p.detailQueue <- job:
+		}
+	}
+	return nil
+}
+
+// storeSnippets stores the search items for ids with --search-only. The
+// items lack the description and a few other detail fields, so they skip
+// description dedup and are marked search_only.
+func (p *pipeline) storeSnippets(t *scrapeTarget, result api.SearchResult, ids []string) error {
+	wanted := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		wanted[id] = true
+	}
+	for i, id := range result.IDs {
+		if !wanted[id] {
+			continue
+		}
+		if _, queued := p.queuedIDs.LoadOrStore(id, true); queued {
+			continue
+		}
+		if err := p.idsOut.Write(id); err != nil {
+			return err
+		}
+		p.stats.IncAttempted()
+		data := result.Items[i]
+		if !p.inWindow(data) {
+			p.stats.IncOutOfWindow()
+			continue
+		}
+		data["url"] = api.VacancyPageURL(id)
+		data["search_only"] = true
+		p.markDiscovery(data)
+		data["source_query"] = p.sourceQuery(t)
+		if _, ok := data["archived"].(bool); !ok {
+			data["archived"] = false
+		}
+		p.applyContactsPolicy(data)
+		p.applySalaryFields(data)
+		applyTimestamps(data)
+		p.applyRegionPath(data)
+		p.fieldMap.Apply(data)
+		applySchema(data, p.fieldMap)
+
+		if err := p.store.UpsertVacancy(data); err != nil {
+			p.stats.IncFailed()
+			p.logger.Error.Printf("Vacancy %s snippet not stored: %v", id, err)
+			continue
+		}
+		p.recordWrite(t, id, "")
+	}
+	return nil
+}
+
+// overflow handles an id that found the prefetch buffer full under the
+// spill or drop policy.
+func (p *pipeline) overflow(id string) error {
+	p.stats.IncOverflowed()
+	if p.cfg.OverflowPolicy == config.OverflowDrop {
+		p.logger.Error.Printf("Prefetch buffer full, dropping vacancy %s", id)
+		return nil
+	}
+	return p.spill.Write(id)
+}
+
+// processWithRetries gives all attempts for one vacancy, including the
+// waits between them, at most --vacancy-budget before the vacancy is
+// dead-lettered and the worker moves on.
+func (p *pipeline) processWithRetries(runCtx context.Context, t *scrapeTarget, vacancyID string) {
+	ctx := runCtx
+	if p.cfg.VacancyBudget > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(runCtx, p.cfg.VacancyBudget)
+		defer cancel()
+	}
+	serverErrors := 0
+
+	for retries := 0; ; retries++ {
+		if p.retryBudget.Wait(ctx) != nil {
+			p.abandonIfOverBudget(runCtx, ctx, vacancyID, nil)
+			return
+		}
+
+		err := p.processVacancy(ctx, t, vacancyID)
+		if err == nil {
+			p.retryBudget.RecordSuccess()
+			return
+		}
+		if ctx.Err() != nil {
+			p.abandonIfOverBudget(runCtx, ctx, vacancyID, err)
+			return
+		}
+		p.noteRateLimit(err)
+
+		var unprocessable *unprocessableError
+		if errors.As(err, &unprocessable) {
+			p.stats.IncFailed()
+			p.logger.Error.Printf("Vacancy %s is unprocessable: %v", vacancyID, err)
+			p.deadLetter(vacancyID, unprocessable.Error(), unprocessable.raw)
+			return
+		}
+
+		if errors.Is(err, api.ErrTokenInvalid) {
+			p.logger.Error.Printf("Bearer token rejected for vacancy %s: %v; refresh BEARER_TOKEN", vacancyID, err)
+		}
+		if !p.retryStatuses.Retryable(err) {
+			p.stats.IncFailed()
+			p.logger.Error.Printf("Vacancy %s failed with a non-retryable error: %v", vacancyID, err)
+			return
+		}
+
+		// A listing that keeps failing server-side is broken rather than
+		// unlucky; it gets its own attempt limit and is dead-lettered.
+		limit := p.cfg.Retry.Retries()
+		if code, ok := api.StatusCodeOf(err); ok && code >= 500 {
+			serverErrors++
+			limit = p.cfg.ServerErrorAttempts - 1
+			if serverErrors >= p.cfg.ServerErrorAttempts {
+				p.stats.IncFailed()
+				p.logger.Error.Printf("Vacancy %s failed with status %d on %d attempts, skipping it: %v", vacancyID, code, serverErrors, err)
+				p.deadLetter(vacancyID, fmt.Sprintf("status %d on %d attempts: %v", code, serverErrors, err), nil)
+				return
+			}
+		}
+		if retries >= limit {
+			p.stats.IncFailed()
+			p.logger.Error.Printf("Failed to process vacancy %s after %d retries: %v", vacancyID, retries, err)
+			return
+		}
+
+		p.logger.Error.Printf("Retrying vacancy %s (%d/%d): %v", vacancyID, retries+1, limit, err)
+		select {
+		case <-ctx.Done():
+			p.abandonIfOverBudget(runCtx, ctx, vacancyID, err)
+			return
+		case <-time.After(p.cfg.Retry.Delay(retries)):
+		}
+	}
+}
+
+// abandonIfOverBudget dead-letters a vacancy whose own context expired
+// while the run is still going. A cancelled run is not the vacancy's fault.
+func (p *pipeline) abandonIfOverBudget(runCtx, ctx context.Context, vacancyID string, lastErr error) {
+	if runCtx.Err() != nil || ctx.Err() == nil {
+		return
+	}
+	p.stats.IncFailed()
+	reason := fmt.Sprintf("exceeded --vacancy-budget of %v", p.cfg.VacancyBudget)
+	if lastErr != nil {
+		reason += fmt.Sprintf(", last error: %v", lastErr)
+	}
+	p.logger.Error.Printf("Vacancy %s abandoned: %s", vacancyID, reason)
+	p.deadLetter(vacancyID, reason, nil)
+}
+
+func (p *pipeline) deadLetter(vacancyID, reason string, raw []byte) {
+	if p.dlq == nil {
+		return
+	}
+
+	letter := storage.DeadLetter{
+		VacancyID: vacancyID,
+		Reason:    reason,
+		Raw:       string(raw),
+		RunID:     p.runID,
+		FailedAt:  time.Now().UTC(),
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := p.dlq.Add(ctx, letter); err != nil {
+		p.logger.Error.Printf("Failed to dead-letter vacancy %s: %v", vacancyID, err)
+		return
+	}
+	p.stats.IncDeadLettered()
+}
+
+func (p *pipeline) noteRateLimit(err error) {
+	if errors.Is(err, api.ErrRateLimited) && p.ramp != nil {
+		p.ramp.backOff()
+	}
+	if errors.Is(err, api.ErrRateLimited) && p.retryBudget.RecordRateLimit() {
+		p.logger.Error.Printf("Rate limit budget exhausted, pausing all workers until %s", p.retryBudget.PausedUntil().Format(time.RFC3339))
+	}
+}
+
+func (p *pipeline) processVacancy(ctx context.Context, t *scrapeTarget, vacancyID string) error {
+	fetchStart := time.Now()
+	data, err := p.client.GetVacancyDetails(ctx, vacancyID)
+	latency := time.Since(fetchStart)
+	p.latency.record(latency)
+	if err != nil {
+		if errors.Is(err, api.ErrVacancyNotFound) {
+			exists, err := p.vacancyExists(vacancyID)
+			if err != nil {
+				return err
+			}
+			if exists {
+				p.logger.Info.Printf("Stored vacancy %s no longer exists, marking it closed", vacancyID)
+				p.setFields(vacancyID, map[string]interface{}{"closed": true, "closed_at": time.Now().UTC()})
+				return nil
+			}
+			p.logger.Info.Printf("Vacancy %s not found, skipping", vacancyID)
+			return nil
+		}
+		var decodeErr *api.DecodeError
+		if errors.As(err, &decodeErr) && !decodeErr.Truncated {
+			return &unprocessableError{err: err, raw: decodeErr.Body}
+		}
+		return fmt.Errorf("failed to get vacancy details: %w", err)
+	}
+
+	if !p.inWindow(data) {
+		p.stats.IncOutOfWindow()
+		p.logger.Info.Printf("Vacancy %s published at %v is outside the search window, skipping", vacancyID, data["published_at"])
+		return nil
+	}
+
+	contentHash, err := p.hashContent(data)
+	if err != nil {
+		return fmt.Errorf("vacancy %s content hash: %w", vacancyID, err)
+	}
+	var raw interface{}
+	if p.cfg.StoreRaw != "" {
+		if raw, err = encodeRaw(data, p.cfg.StoreRaw); err != nil {
+			return fmt.Errorf("vacancy %s raw payload: %w", vacancyID, err)
+		}
+		if raw == nil {
+			p.logger.Error.Printf("Vacancy %s raw payload exceeds %d bytes, not storing it", vacancyID, maxRawBytes)
+		}
+	}
+	known, err := p.vacancyExists(vacancyID)
+	if err != nil {
+		return err
+	}
+	if checker, ok := p.store.(storage.ContentChecker); ok && known && checker.ContentUnchanged(vacancyID, contentHash) {
+		p.stats.IncUnchanged()
+		p.logger.Info.Printf("Vacancy %s unchanged since last store, skipping write", vacancyID)
+		p.setFields(vacancyID, map[string]interface{}{"last_seen": time.Now().UTC()})
+		return nil
+	}
+	data["content_hash"] = contentHash
+	p.markDiscovery(data)
+	data["source_query"] = p.sourceQuery(t)
+	if p.cfg.RecordLatency {
+		data["fetch_latency_ms"] = latency.Milliseconds()
+	}
+	if raw != nil {
+		data["raw"] = raw
+	}
+	if _, ok := data["archived"].(bool); !ok {
+		data["archived"] = false
+	}
+
+	descriptionHash, err := p.deriveFields(vacancyID, data)
+	if err != nil {
+		raw, _ := json.Marshal(data)
+		return &unprocessableError{err: err, raw: raw}
+	}
+
+	if p.cfg.TrackChanges && known {
+		return p.updateTrackedVacancy(t, data)
+	}
+
+	// A refreshed vacancy already owns its stored hash, so only new ids are
+	// checked for duplicate descriptions.
+	refreshing := known && p.cfg.Mode == config.ModeRefresh
+	if !refreshing && p.descriptionStored(descriptionHash) {
+		p.stats.IncDuplicate()
+		switch p.cfg.DupPolicy {
+		case config.DupPolicySkip:
+			p.logger.Info.Printf("Vacancy %s skipped due to duplicate description", vacancyID)
+			return nil
+		case config.DupPolicyFlag:
+			data["is_duplicate"] = true
+			if owner, ok := p.store.(storage.DescriptionOwner); ok {
+				if originalID, ok := owner.DescriptionHashOwner(descriptionHash); ok && originalID != vacancyID {
+					data["duplicate_of"] = originalID
+				}
+			}
+		}
+	}
+
+	if err := p.store.UpsertVacancy(data); err != nil {
+		if errors.Is(err, storage.ErrDuplicateDescription) {
+			p.stats.IncDuplicate()
+			p.logger.Info.Printf("Vacancy %s rejected by the unique description index, skipping", vacancyID)
+			return nil
+		}
+		return fmt.Errorf("MongoDB insertion error: %w", err)
+	}
+
+	p.recordWrite(t, vacancyID, descriptionHash)
+	p.logger.Info.Printf("Vacancy %s stored successfully", vacancyID)
+	return nil
+}
+
+// inWindow reports whether the vacancy's published_at lies in the search
+// window. It only filters with --filter-published-at during date searches;
+// vacancies without a parseable published_at are kept.
+func (p *pipeline) inWindow(data map[string]interface{}) bool {
+	if !p.cfg.FilterPublishedAt || p.cfg.IDsFile != "" || p.cfg.RefreshStale > 0 {
+		return true
+	}
+	from, to, err := p.cfg.Window()
+	if err != nil {
+		return true
+	}
+	publishedAt, _ := data["published_at"].(string)
+	published, err := time.Parse(api.TimeLayout, publishedAt)
+	if err != nil {
+		return true
+	}
+	return !published.Before(from) && !published.After(to)
+}
+
+// deriveFields fills in the fields computed from the API payload. It runs
+// for fresh fetches and again over stored documents in --reprocess mode.
+func (p *pipeline) deriveFields(vacancyID string, data map[string]interface{}) (string, error) {
+	if _, ok := data["url"]; !ok {
+		data["url"] = api.VacancyPageURL(vacancyID)
+	}
+
+	description, ok := data["description"].(string)
+	if !ok || description == "" {
+		// Documents stored with --drop-description only keep their hash.
+		if hash, ok := data["description_hash"].(string); ok && p.cfg.DropDescription && hash != "" {
+			p.applyContactsPolicy(data)
+			p.applySalaryFields(data)
+			applyTimestamps(data)
+			p.applyRegionPath(data)
+			p.fieldMap.Apply(data)
+			applySchema(data, p.fieldMap)
+			return hash, nil
+		}
+		return "", fmt.Errorf("vacancy %s has invalid description", vacancyID)
+	}
+
+	descriptionHash := p.hasher.Hash(description)
+	if len(p.cfg.DedupFields) > 0 {
+		key, ok := transform.DedupKey(data, p.cfg.DedupFields)
+		if !ok {
+			return "", fmt.Errorf("vacancy %s has none of the --dedup-fields", vacancyID)
+		}
+		descriptionHash = p.hasher.Hash(key)
+	}
+	data["description_hash"] = descriptionHash
+	p.applyContactsPolicy(data)
+	p.applySalaryFields(data)
+	applyTimestamps(data)
+	p.applyRegionPath(data)
+	if p.cfg.DropDescription {
+		delete(data, "description")
+	}
+	p.fieldMap.Apply(data)
+	applySchema(data, p.fieldMap)
+	return descriptionHash, nil
+}
+
+// applyContactsPolicy keeps contact details only with --capture-contacts,
+// since they identify recruiters personally.
+func (p *pipeline) applyContactsPolicy(data map[string]interface{}) {
+	contacts, ok := transform.NormalizeContacts(data["contacts"])
+	if !ok || !p.cfg.CaptureContacts {
+		delete(data, "contacts")
+		return
+	}
+	data["contacts"] = contacts
+}
+
+// applyTimestamps stores the API's timestamp strings again as dates. The
+// strings stay as they are since partitioning and the published_at filters
+// compare them as text.
+func applyTimestamps(data map[string]interface{}) {
+	for key, value := range transform.Timestamps(data) {
+		data[key] = value
+	}
+}
+
+func (p *pipeline) applySalaryFields(data map[string]interface{}) {
+	if p.cfg.NoSalaryFields {
+		return
+	}
+	for key, value := range transform.SalaryFields(data["salary"]) {
+		data[key] = value
+	}
+}
+
+// markDiscovery stamps last_seen on every write. first_seen and
+// first_seen_run_id only reach the document when it is inserted, so they
+// keep pointing at the run that discovered the vacancy.
+func (p *pipeline) markDiscovery(data map[string]interface{}) {
+	now := time.Now().UTC()
+	data["last_seen"] = now
+	data["first_seen"] = now
+	data["first_seen_run_id"] = p.runID
+}
+
+// setFields updates single fields of a stored vacancy when the store
+// supports it. Failures are only logged; the fields are bookkeeping.
+func (p *pipeline) setFields(vacancyID string, fields map[string]interface{}) {
+	setter, ok := p.store.(storage.FieldSetter)
+	if !ok {
+		return
+	}
+	if err := setter.SetFields(vacancyID, fields); err != nil {
+		p.logger.Error.Printf("Failed to update vacancy %s: %v", vacancyID, err)
+	}
+}
+
+// applyRegionPath stores the names from the country down to the vacancy's
+// area as region_path. Areas missing from the dictionary get no path.
+func (p *pipeline) applyRegionPath(data map[string]interface{}) {
+	if p.areaPaths == nil {
+		return
+	}
+	area, _ := data["area"].(map[string]interface{})
+	id, _ := area["id"].(string)
+	path, ok := p.areaPaths[id]
+	if !ok {
+		return
+	}
+	regionPath := make([]interface{}, len(path))
+	for i, name := range path {
+		regionPath[i] = name
+	}
+	data["region_path"] = regionPath
+}
+
+// reprocess re-runs deriveFields over every stored vacancy and writes the
+// results back without calling the API. Documents stored with --store-raw
+// first get their original payload fields restored from raw.
+func (p *pipeline) reprocess(ctx context.Context) error {
+	scanner, ok := p.store.(storage.VacancyScanner)
+	if !ok {
+		return fmt.Errorf("store does not support --reprocess")
+	}
+
+	err := scanner.EachVacancy(ctx, func(data map[string]interface{}) error {
+		p.stats.IncAttempted()
+		vacancyID, _ := data["id"].(string)
+		if raw, ok := data["raw"]; ok {
+			original, err := decodeRaw(raw)
+			if err != nil {
+				p.stats.IncFailed()
+				p.logger.Error.Printf("Vacancy %s not reprocessed: %v", vacancyID, err)
+				return nil
+			}
+			for key, value := range original {
+				data[key] = value
+			}
+		}
+		descriptionHash, err := p.deriveFields(vacancyID, data)
+		if err != nil {
+			p.stats.IncFailed()
+			p.logger.Error.Printf("Vacancy %s not reprocessed: %v", vacancyID, err)
+			return nil
+		}
+
+		if err := p.store.UpsertVacancy(data); err != nil {
+			return fmt.Errorf("%w: %v", errStoreFailed, err)
+		}
+		p.recordWrite(nil, vacancyID, descriptionHash)
+		return nil
+	})
+	if err != nil && !errors.Is(err, errStoreFailed) && ctx.Err() == nil {
+		return fmt.Errorf("%w: %v", errStoreFailed, err)
+	}
+	return err
+}
+
+func (p *pipeline) updateTrackedVacancy(t *scrapeTarget, data map[string]interface{}) error {
+	tracker, ok := p.store.(storage.ChangeTracker)
+	if !ok {
+		return fmt.Errorf("store does not support change tracking")
+	}
+
+	changed, err := tracker.UpsertVacancyTrackingChanges(data)
+	if err != nil {
+		return fmt.Errorf("MongoDB update error: %w", err)
+	}
+
+	hash, _ := data["description_hash"].(string)
+	if hash != "" {
+		p.store.AddDescriptionHash(hash)
+	}
+	p.countSaved(t)
+	if changed {
+		p.logger.Info.Printf("Vacancy %s description changed, previous version added to history", data["id"])
+	} else {
+		p.logger.Info.Printf("Vacancy %s refreshed, description unchanged", data["id"])
+	}
+	return nil
+}
+
+func (p *pipeline) hashContent(data map[string]interface{}) (string, error) {
+	return contentHash(p.hasher, data, schemaVersion)
+}
+
+// contentHash covers the API payload and the schema version it is derived
+// with, so a schema bump makes every stored vacancy count as changed and
+// get its new fields, while unchanged payloads are still skipped.
+func contentHash(hasher api.Hasher, data map[string]interface{}, version int) (string, error) {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return "", err
+	}
+	return hasher.Hash(strconv.Itoa(version) + ":" + string(encoded)), nil
+}
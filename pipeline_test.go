@@ -0,0 +1,2257 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"hh_it_scrapper/api"
+	"hh_it_scrapper/config"
+	"hh_it_scrapper/logger"
+	"hh_it_scrapper/storage"
+	"hh_it_scrapper/transform"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// testArgs keep test runs fast: retries wait a millisecond and the
+// rate-limit budget never pauses.
+var testArgs = []string{"--from=2024-03-01", "--to=2024-03-01", "--retry-base=1ms", "--retry-cap=1ms", "--rate-limit-threshold=0"}
+
+// setArgs makes args the command line for the rest of the test, with a
+// fresh flag set and a token and MongoDB URI in the environment.
+func setArgs(t *testing.T, args ...string) {
+	t.Helper()
+	t.Setenv("BEARER_TOKEN", "test-token")
+	t.Setenv("BEARER_TOKENS_FILE", "")
+	t.Setenv("MONGO_URI", "mongodb://localhost:27017")
+	oldArgs, oldFlags := os.Args, flag.CommandLine
+	t.Cleanup(func() { os.Args, flag.CommandLine = oldArgs, oldFlags })
+
+	os.Args = append([]string{"hh_it_scrapper"}, args...)
+	flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+}
+
+// loadTestConfig parses args after testArgs as command-line flags and
+// validates the result like run does.
+func loadTestConfig(t *testing.T, args ...string) *config.AppConfig {
+	t.Helper()
+	setArgs(t, append(append([]string{}, testArgs...), args...)...)
+	cfg := config.LoadConfig()
+	if err := validateConfig(cfg); err != nil {
+		t.Fatalf("validateConfig(%v): %v", args, err)
+	}
+	return cfg
+}
+
+func testLogger() *logger.AppLogger {
+	discard := log.New(io.Discard, "", 0)
+	return &logger.AppLogger{Info: discard, Error: discard, Debug: discard}
+}
+
+// bufferLogger collects error log lines in the returned buffer.
+func bufferLogger() (*logger.AppLogger, *bytes.Buffer) {
+	var buf bytes.Buffer
+	appLogger := testLogger()
+	appLogger.Error = log.New(&buf, "", 0)
+	return appLogger, &buf
+}
+
+// newTestPipeline wires a pipeline the way runCycle does.
+func newTestPipeline(t *testing.T, cfg *config.AppConfig, client vacancyAPI, store storage.Store) *pipeline {
+	t.Helper()
+	hasher, err := api.NewHasher(cfg.HashAlgorithm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := newPipeline(cfg, client, store, hasher, "test-run", testLogger())
+	if p.fieldMap, err = transform.ParseFieldMap(cfg.FieldMap); err != nil {
+		t.Fatal(err)
+	}
+	if p.retryStatuses, err = api.ParseStatusSet(cfg.RetryStatuses); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+// fakeAPI serves search pages and vacancy details from memory. search and
+// detail, when set, replace the default responses. Every call is counted,
+// and so is every call made with an already cancelled context.
+type fakeAPI struct {
+	pages  [][]string
+	search func(ctx context.Context, page int) (api.SearchResult, error)
+	detail func(ctx context.Context, id string) (map[string]interface{}, error)
+
+	mu               sync.Mutex
+	searchCalls      []int
+	queries          []api.SearchQuery
+	detailCalls      []string
+	callsAfterCancel int
+}
+
+// newFakeAPI serves pages pages of perPage sequential ids, starting at 1.
+func newFakeAPI(pages, perPage int) *fakeAPI {
+	f := &fakeAPI{}
+	for page := 0; page < pages; page++ {
+		var ids []string
+		for i := 1; i <= perPage; i++ {
+			ids = append(ids, strconv.Itoa(page*perPage+i))
+		}
+		f.pages = append(f.pages, ids)
+	}
+	return f
+}
+
+func (f *fakeAPI) GetVacancyIDs(ctx context.Context, query api.SearchQuery, page int) (api.SearchResult, error) {
+	f.mu.Lock()
+	f.searchCalls = append(f.searchCalls, page)
+	f.queries = append(f.queries, query)
+	if ctx.Err() != nil {
+		f.callsAfterCancel++
+	}
+	f.mu.Unlock()
+	if f.search != nil {
+		return f.search(ctx, page)
+	}
+	return f.page(page), nil
+}
+
+func (f *fakeAPI) page(page int) api.SearchResult {
+	result := api.SearchResult{Pages: len(f.pages)}
+	for _, ids := range f.pages {
+		result.Found += len(ids)
+	}
+	if page < len(f.pages) {
+		result.IDs = f.pages[page]
+		for _, id := range result.IDs {
+			result.Items = append(result.Items, map[string]interface{}{"id": id, "name": "Vacancy " + id})
+		}
+	}
+	return result
+}
+
+func (f *fakeAPI) GetVacancyDetails(ctx context.Context, id string) (map[string]interface{}, error) {
+	f.mu.Lock()
+	f.detailCalls = append(f.detailCalls, id)
+	if ctx.Err() != nil {
+		f.callsAfterCancel++
+	}
+	f.mu.Unlock()
+	if f.detail != nil {
+		return f.detail(ctx, id)
+	}
+	return testVacancy(id), nil
+}
+
+func (f *fakeAPI) counts() (search, detail, afterCancel int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.searchCalls), len(f.detailCalls), f.callsAfterCancel
+}
+
+// testVacancy is a detail payload with a description unique to id.
+func testVacancy(id string) map[string]interface{} {
+	return map[string]interface{}{
+		"id":           id,
+		"name":         "Vacancy " + id,
+		"description":  fmt.Sprintf("<p>Description of vacancy %s</p>", id),
+		"published_at": "2024-03-01T10:00:00+0300",
+		"area":         map[string]interface{}{"id": "1", "name": "Moscow"},
+	}
+}
+
+// executeWithin runs p and fails the test if it does not return in time.
+func executeWithin(t *testing.T, p *pipeline, ctx context.Context, listedIDs []string) error {
+	t.Helper()
+	done := make(chan error, 1)
+	go func() { done <- p.execute(ctx, listedIDs) }()
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(5 * time.Second):
+		t.Fatal("pipeline did not return")
+		return nil
+	}
+}
+
+// waitForGoroutines fails the test unless the goroutine count drops back
+// to baseline, i.e. every worker the pipeline started has exited.
+func waitForGoroutines(t *testing.T, baseline int) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for runtime.NumGoroutine() > baseline {
+		if time.Now().After(deadline) {
+			buf := make([]byte, 1<<16)
+			n := runtime.Stack(buf, true)
+			t.Fatalf("%d goroutines still running, want %d:\n%s", runtime.NumGoroutine(), baseline, buf[:n])
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestCancelWhileDetailsInFlight(t *testing.T) {
+	cfg := loadTestConfig(t, "--detail-concurrency=4", "--search-concurrency=2", "--prefetch-buffer=5")
+	client := newFakeAPI(3, 20)
+	inFlight := make(chan string, 100)
+	client.detail = func(ctx context.Context, id string) (map[string]interface{}, error) {
+		inFlight <- id
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	store := storage.NewMemoryStore()
+	p := newTestPipeline(t, cfg, client, store)
+	baseline := runtime.NumGoroutine()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- p.execute(ctx, nil) }()
+	for i := 0; i < 4; i++ {
+		<-inFlight
+	}
+	cancel()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("execute error = %v, want context.Canceled", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("pipeline did not stop after cancellation")
+	}
+	waitForGoroutines(t, baseline)
+
+	search, detail, afterCancel := client.counts()
+	if afterCancel != 0 {
+		t.Errorf("%d API calls made after cancellation", afterCancel)
+	}
+	if search != 1 || detail != 4 {
+		t.Errorf("API calls: %d search, %d detail, want 1 and 4", search, detail)
+	}
+	if got := p.stats.Attempted(); got != 4 {
+		t.Errorf("attempted = %d, want the 4 in-flight vacancies", got)
+	}
+	if p.stats.Saved() != 0 || p.stats.Failed() != 0 {
+		t.Errorf("saved, failed = %d, %d, want 0, 0: cancelled vacancies are neither", p.stats.Saved(), p.stats.Failed())
+	}
+}
+
+func TestCancelCountsCompletedWork(t *testing.T) {
+	cfg := loadTestConfig(t, "--detail-concurrency=1")
+	client := newFakeAPI(1, 20)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	calls := 0
+	client.detail = func(ctx context.Context, id string) (map[string]interface{}, error) {
+		calls++
+		if calls == 8 {
+			cancel()
+			return nil, ctx.Err()
+		}
+		return testVacancy(id), nil
+	}
+	store := storage.NewMemoryStore()
+	p := newTestPipeline(t, cfg, client, store)
+	baseline := runtime.NumGoroutine()
+
+	if err := executeWithin(t, p, ctx, nil); !errors.Is(err, context.Canceled) {
+		t.Errorf("execute error = %v, want context.Canceled", err)
+	}
+	waitForGoroutines(t, baseline)
+
+	_, detail, afterCancel := client.counts()
+	if afterCancel != 0 || detail != 8 {
+		t.Errorf("detail calls = %d (%d after cancellation), want 8 (0)", detail, afterCancel)
+	}
+	if got := p.stats.Saved(); got != 7 {
+		t.Errorf("saved = %d, want the 7 vacancies fetched before cancellation", got)
+	}
+	for i := 1; i <= 8; i++ {
+		id := strconv.Itoa(i)
+		if stored := store.VacancyExists(id); stored != (i < 8) {
+			t.Errorf("vacancy %s stored = %v", id, stored)
+		}
+	}
+}
+
+func TestCancelDuringSearch(t *testing.T) {
+	cfg := loadTestConfig(t, "--detail-concurrency=1")
+	client := newFakeAPI(5, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client.search = func(_ context.Context, page int) (api.SearchResult, error) {
+		if page == 2 {
+			cancel()
+			return api.SearchResult{}, ctx.Err()
+		}
+		return client.page(page), nil
+	}
+	store := storage.NewMemoryStore()
+	p := newTestPipeline(t, cfg, client, store)
+	baseline := runtime.NumGoroutine()
+
+	if err := executeWithin(t, p, ctx, nil); !errors.Is(err, context.Canceled) {
+		t.Errorf("execute error = %v, want context.Canceled", err)
+	}
+	waitForGoroutines(t, baseline)
+
+	client.mu.Lock()
+	pages := client.searchCalls
+	client.mu.Unlock()
+	if len(pages) != 3 {
+		t.Errorf("search pages requested = %v, want pages 0-2 only", pages)
+	}
+	if got := p.stats.PagesDone(); got != 2 {
+		t.Errorf("pages done = %d, want 2", got)
+	}
+	stored := 0
+	for i := 1; i <= 50; i++ {
+		if store.VacancyExists(strconv.Itoa(i)) {
+			stored++
+			if i > 20 {
+				t.Errorf("vacancy %d from a page after the cancellation was stored", i)
+			}
+		}
+	}
+	if int64(stored) != p.stats.Saved() {
+		t.Errorf("saved = %d, but %d vacancies are stored", p.stats.Saved(), stored)
+	}
+}
+
+// lookupFailStore fails every existence lookup, like a lazy MongoStore
+// whose queries time out.
+type lookupFailStore struct {
+	*storage.MemoryStore
+}
+
+func (lookupFailStore) LookupVacancy(id string) (bool, error) {
+	return false, errors.New("lookup timed out")
+}
+
+func TestFailedLookupIsNotTreatedAsNew(t *testing.T) {
+	cfg := loadTestConfig(t)
+	client := newFakeAPI(1, 5)
+	p := newTestPipeline(t, cfg, client, lookupFailStore{storage.NewMemoryStore()})
+
+	err := executeWithin(t, p, context.Background(), nil)
+	if !errors.Is(err, errSearchFailed) {
+		t.Errorf("execute error = %v, want the search page to fail", err)
+	}
+	if _, detail, _ := client.counts(); detail != 0 {
+		t.Errorf("%d vacancies fetched although their existence is unknown", detail)
+	}
+}
+
+func TestTargetsMixAllRegionsAndAreas(t *testing.T) {
+	cfg := loadTestConfig(t, "--area=all")
+	cfg.Targets = []config.Target{{Name: "everywhere"}, {Name: "moscow", Area: "1"}}
+	p := newTestPipeline(t, cfg, newFakeAPI(0, 0), storage.NewMemoryStore())
+
+	targets := p.searchTargets()
+	if values := targets[0].query.Values(0); values.Has("area") {
+		t.Errorf("target %s sent area=%s", targets[0].name, values.Get("area"))
+	}
+	if values := targets[1].query.Values(0); values.Get("area") != "1" {
+		t.Errorf("target %s sent area=%q, want 1", targets[1].name, values.Get("area"))
+	}
+}
+
+// trackingStore records description changes the way
+// MongoStore.UpsertVacancyTrackingChanges does.
+type trackingStore struct {
+	*storage.MemoryStore
+	hashes  map[string]string
+	history map[string]int
+}
+
+func newTrackingStore() *trackingStore {
+	return &trackingStore{MemoryStore: storage.NewMemoryStore(), hashes: map[string]string{}, history: map[string]int{}}
+}
+
+func (s *trackingStore) UpsertVacancyTrackingChanges(data map[string]interface{}) (bool, error) {
+	id := data["id"].(string)
+	hash := data["description_hash"].(string)
+	old, known := s.hashes[id]
+	changed := known && old != hash
+	if changed {
+		s.history[id]++
+	}
+	s.hashes[id] = hash
+	return changed, s.UpsertVacancy(data)
+}
+
+func (s *trackingStore) UpsertVacancy(data map[string]interface{}) error {
+	s.hashes[data["id"].(string)] = data["description_hash"].(string)
+	return s.MemoryStore.UpsertVacancy(data)
+}
+
+func TestTrackChangesRefetchesKnownVacancies(t *testing.T) {
+	store := newTrackingStore()
+	edited := false
+	for run := 0; run < 3; run++ {
+		cfg := loadTestConfig(t, "--track-changes", "--detail-concurrency=1")
+		client := newFakeAPI(1, 3)
+		client.detail = func(ctx context.Context, id string) (map[string]interface{}, error) {
+			data := testVacancy(id)
+			if id == "2" && edited {
+				data["description"] = "<p>Edited description</p>"
+			}
+			return data, nil
+		}
+		p := newTestPipeline(t, cfg, client, store)
+		if err := executeWithin(t, p, context.Background(), nil); err != nil {
+			t.Fatal(err)
+		}
+		if _, detail, _ := client.counts(); detail != 3 {
+			t.Errorf("run %d fetched %d vacancies, want all 3 again", run, detail)
+		}
+		edited = run >= 1
+	}
+
+	if store.history["2"] != 1 || store.history["1"] != 0 || store.history["3"] != 0 {
+		t.Errorf("history entries = %v, want one for the vacancy edited once", store.history)
+	}
+}
+
+// peakCounter records the most calls that were in flight at once.
+type peakCounter struct {
+	mu       sync.Mutex
+	inFlight int
+	peak     int
+}
+
+// hold counts one call in flight for d.
+func (c *peakCounter) hold(d time.Duration) {
+	c.mu.Lock()
+	c.inFlight++
+	if c.inFlight > c.peak {
+		c.peak = c.inFlight
+	}
+	c.mu.Unlock()
+	time.Sleep(d)
+	c.mu.Lock()
+	c.inFlight--
+	c.mu.Unlock()
+}
+
+func (c *peakCounter) max() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.peak
+}
+
+func TestWorkerPoolSizes(t *testing.T) {
+	tests := []struct {
+		args           []string
+		search, detail int
+	}{
+		{[]string{"--search-concurrency=3", "--detail-concurrency=2"}, 3, 2},
+		{[]string{"--search-concurrency=1", "--detail-concurrency=5"}, 1, 5},
+	}
+	for _, tt := range tests {
+		cfg := loadTestConfig(t, tt.args...)
+		client := newFakeAPI(8, 5)
+		var searches, details peakCounter
+		client.search = func(ctx context.Context, page int) (api.SearchResult, error) {
+			searches.hold(20 * time.Millisecond)
+			return client.page(page), nil
+		}
+		client.detail = func(ctx context.Context, id string) (map[string]interface{}, error) {
+			details.hold(5 * time.Millisecond)
+			return testVacancy(id), nil
+		}
+		if err := executeWithin(t, newTestPipeline(t, cfg, client, storage.NewMemoryStore()), context.Background(), nil); err != nil {
+			t.Fatal(err)
+		}
+		if searches.max() != tt.search {
+			t.Errorf("%v: %d search requests in flight, want %d", tt.args, searches.max(), tt.search)
+		}
+		if details.max() != tt.detail {
+			t.Errorf("%v: %d detail requests in flight, want %d", tt.args, details.max(), tt.detail)
+		}
+	}
+}
+
+// bufferingStore holds upserts until Flush, like storage.BatchWriter with a
+// batch size that is never reached.
+type bufferingStore struct {
+	*storage.MemoryStore
+	mu      sync.Mutex
+	pending []map[string]interface{}
+	notify  func(data map[string]interface{}, err error)
+}
+
+func (s *bufferingStore) NotifyWrites(fn func(data map[string]interface{}, err error)) bool {
+	s.notify = fn
+	return true
+}
+
+func (s *bufferingStore) UpsertVacancy(data map[string]interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pending = append(s.pending, data)
+	return nil
+}
+
+func (s *bufferingStore) Flush(ctx context.Context) error {
+	s.mu.Lock()
+	batch := s.pending
+	s.pending = nil
+	s.mu.Unlock()
+	for _, data := range batch {
+		if err := s.MemoryStore.UpsertVacancy(data); err != nil {
+			return err
+		}
+		s.notify(data, nil)
+	}
+	return nil
+}
+
+func (s *bufferingStore) Pending() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.pending)
+}
+
+func TestCancelFlushesBufferedWrites(t *testing.T) {
+	cfg := loadTestConfig(t, "--detail-concurrency=1")
+	store := &bufferingStore{MemoryStore: storage.NewMemoryStore()}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client := newFakeAPI(1, 10)
+	client.detail = func(ctx context.Context, id string) (map[string]interface{}, error) {
+		if id == "4" {
+			cancel()
+			return nil, ctx.Err()
+		}
+		return testVacancy(id), nil
+	}
+	p := newTestPipeline(t, cfg, client, store)
+
+	if err := executeWithin(t, p, ctx, nil); !errors.Is(err, context.Canceled) {
+		t.Fatalf("execute error = %v, want context.Canceled", err)
+	}
+	if store.Pending() != 0 {
+		t.Errorf("%d vacancies left in the buffer", store.Pending())
+	}
+	for _, id := range []string{"1", "2", "3"} {
+		if !store.VacancyExists(id) {
+			t.Errorf("buffered vacancy %s was not persisted", id)
+		}
+	}
+	if p.stats.Flushed() != 3 || p.stats.Saved() != 3 {
+		t.Errorf("flushed %d, saved %d, want 3 and 3", p.stats.Flushed(), p.stats.Saved())
+	}
+}
+
+// countingStore counts the writes that reach the store, including the
+// change-tracking upserts of refetched vacancies, and keeps the last
+// document written for each id.
+type countingStore struct {
+	*storage.MemoryStore
+	mu      sync.Mutex
+	upserts []string
+	docs    map[string]map[string]interface{}
+}
+
+func newCountingStore() *countingStore {
+	return &countingStore{MemoryStore: storage.NewMemoryStore(), docs: map[string]map[string]interface{}{}}
+}
+
+func (s *countingStore) UpsertVacancy(data map[string]interface{}) error {
+	s.mu.Lock()
+	s.upserts = append(s.upserts, data["id"].(string))
+	s.docs[data["id"].(string)] = data
+	s.mu.Unlock()
+	return s.MemoryStore.UpsertVacancy(data)
+}
+
+func (s *countingStore) UpsertVacancyTrackingChanges(data map[string]interface{}) (bool, error) {
+	return false, s.UpsertVacancy(data)
+}
+
+func TestUnchangedVacanciesAreNotRewritten(t *testing.T) {
+	store := newCountingStore()
+	edited := false
+	run := func() *pipeline {
+		t.Helper()
+		store.upserts = nil
+		cfg := loadTestConfig(t, "--track-changes", "--detail-concurrency=1")
+		client := newFakeAPI(1, 3)
+		client.detail = func(ctx context.Context, id string) (map[string]interface{}, error) {
+			data := testVacancy(id)
+			if id == "3" && edited {
+				data["name"] = "Senior vacancy 3"
+			}
+			return data, nil
+		}
+		p := newTestPipeline(t, cfg, client, store)
+		if err := executeWithin(t, p, context.Background(), nil); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+
+	if p := run(); len(store.upserts) != 3 || p.stats.Unchanged() != 0 {
+		t.Fatalf("first run wrote %v, %d unchanged, want all 3 written", store.upserts, p.stats.Unchanged())
+	}
+	if p := run(); len(store.upserts) != 0 || p.stats.Unchanged() != 3 {
+		t.Errorf("identical run wrote %v, %d unchanged, want no writes", store.upserts, p.stats.Unchanged())
+	}
+	edited = true
+	if p := run(); strings.Join(store.upserts, ",") != "3" || p.stats.Unchanged() != 2 {
+		t.Errorf("run with one edit wrote %v, %d unchanged, want only 3 written", store.upserts, p.stats.Unchanged())
+	}
+}
+
+func TestRefreshRewritesOnSchemaBump(t *testing.T) {
+	hasher, _ := api.NewHasher("md5")
+	for _, mode := range []string{"--mode=refresh", "--refresh-stale=24h"} {
+		t.Run(mode, func(t *testing.T) {
+			// Vacancy 1 was stored under the current schema, 2 under the
+			// previous one; neither payload changed since.
+			store := newCountingStore()
+			for id, version := range map[string]int{"1": schemaVersion, "2": schemaVersion - 1} {
+				hash, err := contentHash(hasher, testVacancy(id), version)
+				if err != nil {
+					t.Fatal(err)
+				}
+				store.MemoryStore.UpsertVacancy(map[string]interface{}{"id": id, "content_hash": hash})
+			}
+
+			cfg := loadTestConfig(t, mode, "--detail-concurrency=1")
+			p := newTestPipeline(t, cfg, newFakeAPI(1, 2), store)
+			if err := executeWithin(t, p, context.Background(), []string{"1", "2"}); err != nil {
+				t.Fatal(err)
+			}
+			if got := strings.Join(store.upserts, ","); got != "2" || p.stats.Unchanged() != 1 {
+				t.Errorf("rewrote %s with %d unchanged, want only vacancy 2", got, p.stats.Unchanged())
+			}
+			if version := store.docs["2"]["schema_version"]; version != schemaVersion {
+				t.Errorf("vacancy 2 schema_version = %v, want %d", version, schemaVersion)
+			}
+		})
+	}
+}
+
+func TestStoredVacanciesLinkToTheirListing(t *testing.T) {
+	cfg := loadTestConfig(t)
+	client := newFakeAPI(1, 2)
+	client.detail = func(ctx context.Context, id string) (map[string]interface{}, error) {
+		data := testVacancy(id)
+		if id == "2" {
+			data["alternate_url"] = "https://spb.hh.ru/vacancy/2"
+		}
+		return data, nil
+	}
+	store := newCountingStore()
+	if err := executeWithin(t, newTestPipeline(t, cfg, client, store), context.Background(), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if url := store.docs["1"]["url"]; url != "https://hh.ru/vacancy/1" {
+		t.Errorf("url = %v, want https://hh.ru/vacancy/1", url)
+	}
+	if alternate := store.docs["2"]["alternate_url"]; alternate != "https://spb.hh.ru/vacancy/2" {
+		t.Errorf("alternate_url = %v, want the API value kept", alternate)
+	}
+}
+
+func TestModes(t *testing.T) {
+	tests := []struct {
+		mode            string
+		fetched, stored string
+	}{
+		{"new", "3,4", "3"},
+		// The unchanged vacancies 1 and 2 are re-fetched but not rewritten.
+		{"refresh", "1,2,3,4", "3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			store := newCountingStore()
+			seed := newTestPipeline(t, loadTestConfig(t), newFakeAPI(1, 2), store)
+			if err := executeWithin(t, seed, context.Background(), nil); err != nil {
+				t.Fatal(err)
+			}
+			store.upserts = nil
+
+			cfg := loadTestConfig(t, "--mode="+tt.mode, "--detail-concurrency=1")
+			client := newFakeAPI(1, 4)
+			client.detail = func(ctx context.Context, id string) (map[string]interface{}, error) {
+				if id == "4" {
+					// A repost of vacancy 1 under a new id.
+					data := testVacancy("1")
+					data["id"] = "4"
+					return data, nil
+				}
+				return testVacancy(id), nil
+			}
+			p := newTestPipeline(t, cfg, client, store)
+			if err := executeWithin(t, p, context.Background(), nil); err != nil {
+				t.Fatal(err)
+			}
+
+			if got := strings.Join(client.detailCalls, ","); got != tt.fetched {
+				t.Errorf("fetched %s, want %s", got, tt.fetched)
+			}
+			if got := strings.Join(store.upserts, ","); got != tt.stored {
+				t.Errorf("stored %s, want %s", got, tt.stored)
+			}
+			if p.stats.Duplicates() != 1 {
+				t.Errorf("%d duplicates, want the repost of vacancy 1", p.stats.Duplicates())
+			}
+		})
+	}
+}
+
+func TestFailureRatio(t *testing.T) {
+	tests := []struct {
+		failing int
+		ratio   string
+		wantErr bool
+	}{
+		{0, "0.5", false},
+		{3, "0.5", false},
+		{5, "0.5", false},
+		{6, "0.5", true},
+		{3, "0.2", true},
+		{1, "0", true},
+	}
+	for _, tt := range tests {
+		name := fmt.Sprintf("%d of 10 failing, max %s", tt.failing, tt.ratio)
+		t.Run(name, func(t *testing.T) {
+			cfg := loadTestConfig(t, "--max-failure-ratio="+tt.ratio)
+			client := newFakeAPI(1, 10)
+			client.detail = func(ctx context.Context, id string) (map[string]interface{}, error) {
+				if n, _ := strconv.Atoi(id); n <= tt.failing {
+					return nil, &api.StatusError{StatusCode: http.StatusBadRequest}
+				}
+				return testVacancy(id), nil
+			}
+			p := newTestPipeline(t, cfg, client, storage.NewMemoryStore())
+
+			err := executeWithin(t, p, context.Background(), nil)
+			if p.stats.Failed() != int64(tt.failing) || p.stats.Attempted() != 10 {
+				t.Errorf("failed %d of %d, want %d of 10", p.stats.Failed(), p.stats.Attempted(), tt.failing)
+			}
+			if got := errors.Is(err, errTooManyFails); got != tt.wantErr {
+				t.Errorf("execute error = %v, want errTooManyFails: %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestHashFlag(t *testing.T) {
+	const description = "<p>Description of vacancy 1</p>"
+	for _, name := range []string{"", api.HashMD5, api.HashSHA256, api.HashXXHash} {
+		args := []string{}
+		if name != "" {
+			args = append(args, "--hash="+name)
+		}
+		cfg := loadTestConfig(t, args...)
+		store := newCountingStore()
+		if err := executeWithin(t, newTestPipeline(t, cfg, newFakeAPI(1, 1), store), context.Background(), nil); err != nil {
+			t.Fatal(err)
+		}
+
+		hasher, _ := api.NewHasher(name)
+		if got := store.docs["1"]["description_hash"]; got != hasher.Hash(description) {
+			t.Errorf("--hash=%s stored description_hash %v, want %s", name, got, hasher.Hash(description))
+		}
+	}
+}
+
+func TestRateLimitStormPausesAllWorkers(t *testing.T) {
+	const cooldown = 200 * time.Millisecond
+	cfg := loadTestConfig(t, "--detail-concurrency=4", "--rate-limit-threshold=4", "--rate-limit-window=1m", "--rate-limit-cooldown="+cooldown.String())
+	client := newFakeAPI(1, 8)
+	appLogger, errorLog := bufferLogger()
+	p := newTestPipeline(t, cfg, client, storage.NewMemoryStore())
+	p.logger = appLogger
+	// Every request is rate limited until the budget trips; requests made
+	// after that must wait out the pause.
+	var mu sync.Mutex
+	var early []time.Duration
+	client.detail = func(ctx context.Context, id string) (map[string]interface{}, error) {
+		pausedUntil := p.retryBudget.PausedUntil()
+		if pausedUntil.IsZero() {
+			return nil, api.ErrRateLimited
+		}
+		if d := time.Until(pausedUntil); d > 0 {
+			mu.Lock()
+			early = append(early, d)
+			mu.Unlock()
+		}
+		return testVacancy(id), nil
+	}
+
+	if err := executeWithin(t, p, context.Background(), nil); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(errorLog.String(), "Rate limit budget exhausted, pausing all workers") {
+		t.Errorf("budget did not trip:\n%s", errorLog)
+	}
+	for _, d := range early {
+		t.Errorf("a worker made a request %v before the %v pause ended", d, cooldown)
+	}
+	if p.stats.Saved() != 8 {
+		t.Errorf("saved %d of 8 vacancies after the pause", p.stats.Saved())
+	}
+}
+
+func TestSourceQuery(t *testing.T) {
+	store := newCountingStore()
+	client := newFakeAPI(1, 1)
+	run := func(runID, mode string, target config.Target) {
+		t.Helper()
+		cfg := loadTestConfig(t, "--mode="+mode)
+		cfg.Targets = []config.Target{target}
+		p := newTestPipeline(t, cfg, client, store)
+		p.runID = runID
+		if err := executeWithin(t, p, context.Background(), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	run("run-1", "new", config.Target{Name: "go-moscow", Area: "1", Role: "96", Text: "golang"})
+	source, _ := store.docs["1"]["source_query"].(map[string]interface{})
+	want := map[string]interface{}{
+		"target": "go-moscow", "area": "1", "role": "96", "text": "golang",
+		"date_from": "2024-03-01T00:00:00+0000", "run_id": "run-1",
+	}
+	for key, value := range want {
+		if source[key] != value {
+			t.Errorf("source_query.%s = %v, want %v", key, source[key], value)
+		}
+	}
+	if source["date_to"] == "" || source["date_to"] == nil {
+		t.Error("source_query has no date_to")
+	}
+
+	// The latest query that rewrote a vacancy replaces the earlier one.
+	// Unchanged vacancies are not rewritten, so the refresh sees an edit.
+	client.detail = func(ctx context.Context, id string) (map[string]interface{}, error) {
+		data := testVacancy(id)
+		data["name"] = "Senior vacancy " + id
+		return data, nil
+	}
+	run("run-2", "refresh", config.Target{Name: "go-spb", Area: "2", Role: "96"})
+	source, _ = store.docs["1"]["source_query"].(map[string]interface{})
+	if source["target"] != "go-spb" || source["area"] != "2" || source["run_id"] != "run-2" {
+		t.Errorf("source_query after a refresh = %v, want the go-spb target of run-2", source)
+	}
+}
+
+func TestListedSourceQuery(t *testing.T) {
+	path := writeIDsFile(t, "7")
+	cfg := loadTestConfig(t, "--ids-file="+path)
+	store := newCountingStore()
+	p := newTestPipeline(t, cfg, newFakeAPI(0, 0), store)
+	if err := executeWithin(t, p, context.Background(), []string{"7"}); err != nil {
+		t.Fatal(err)
+	}
+	source, _ := store.docs["7"]["source_query"].(map[string]interface{})
+	if source["ids_file"] != path || source["run_id"] != "test-run" {
+		t.Errorf("source_query = %v, want the ids file and run id", source)
+	}
+}
+
+// descendingAPI serves pages of ids counting down from top, like a search
+// ordered by publication time.
+func descendingAPI(top, pages, perPage int) *fakeAPI {
+	f := &fakeAPI{}
+	for page := 0; page < pages; page++ {
+		var ids []string
+		for i := 0; i < perPage; i++ {
+			ids = append(ids, strconv.Itoa(top-page*perPage-i))
+		}
+		f.pages = append(f.pages, ids)
+	}
+	return f
+}
+
+func TestSinceID(t *testing.T) {
+	tests := []struct {
+		name      string
+		highWater int64
+		// outOfOrder, when set, replaces the last id of page 2.
+		outOfOrder string
+		searched   string
+		fetched    string
+	}{
+		{"empty store", 0, "", "0,1,2,3", "110-71"},
+		{"stops at the first page below", 95, "", "0,1,2", "110-96"},
+		{"newer id on an old page", 95, "120", "0,1,2,3", "120,110-96"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := loadTestConfig(t, "--since-id")
+			client := descendingAPI(110, 4, 10)
+			if tt.outOfOrder != "" {
+				client.pages[2][9] = tt.outOfOrder
+			}
+			store := &highWaterStore{MemoryStore: storage.NewMemoryStore(), max: tt.highWater}
+			p := newTestPipeline(t, cfg, client, store)
+			if err := executeWithin(t, p, context.Background(), nil); err != nil {
+				t.Fatal(err)
+			}
+
+			var searched []string
+			for _, page := range client.searchCalls {
+				searched = append(searched, strconv.Itoa(page))
+			}
+			if got := strings.Join(searched, ","); got != tt.searched {
+				t.Errorf("searched pages %s, want %s", got, tt.searched)
+			}
+			if got := idRanges(client.detailCalls); got != tt.fetched {
+				t.Errorf("fetched %s, want %s", got, tt.fetched)
+			}
+		})
+	}
+}
+
+func TestSinceIDNeedsHighWaterMark(t *testing.T) {
+	cfg := loadTestConfig(t, "--since-id")
+	p := newTestPipeline(t, cfg, descendingAPI(10, 1, 10), storage.NewMemoryStore())
+	if err := executeWithin(t, p, context.Background(), nil); err == nil {
+		t.Error("--since-id ran against a store without MaxVacancyID")
+	}
+}
+
+// idRanges sorts ids in descending order and collapses consecutive runs,
+// e.g. "120,110-96".
+func idRanges(ids []string) string {
+	nums := make([]int, 0, len(ids))
+	for _, id := range ids {
+		n, _ := strconv.Atoi(id)
+		nums = append(nums, n)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(nums)))
+	var ranges []string
+	for i := 0; i < len(nums); {
+		j := i
+		for j+1 < len(nums) && nums[j+1] == nums[j]-1 {
+			j++
+		}
+		if i == j {
+			ranges = append(ranges, strconv.Itoa(nums[i]))
+		} else {
+			ranges = append(ranges, fmt.Sprintf("%d-%d", nums[i], nums[j]))
+		}
+		i = j + 1
+	}
+	return strings.Join(ranges, ",")
+}
+
+func TestFieldMapAppliedBeforeUpsert(t *testing.T) {
+	cfg := loadTestConfig(t, "--field-map=name=title,alternate_url=url")
+	client := newFakeAPI(1, 1)
+	client.detail = func(ctx context.Context, id string) (map[string]interface{}, error) {
+		data := testVacancy(id)
+		data["alternate_url"] = "https://hh.ru/vacancy/" + id + "?from=api"
+		return data, nil
+	}
+	store := newCountingStore()
+	if err := executeWithin(t, newTestPipeline(t, cfg, client, store), context.Background(), nil); err != nil {
+		t.Fatal(err)
+	}
+	doc := store.docs["1"]
+	if doc["title"] != "Vacancy 1" || doc["url"] != "https://hh.ru/vacancy/1?from=api" {
+		t.Errorf("title, url = %v, %v, want the renamed fields", doc["title"], doc["url"])
+	}
+	for _, field := range []string{"name", "alternate_url"} {
+		if _, ok := doc[field]; ok {
+			t.Errorf("%s kept alongside its new name", field)
+		}
+	}
+	if doc["description_hash"] == nil || doc["published_at"] == nil {
+		t.Errorf("unmapped fields lost: %v", doc)
+	}
+}
+
+// memoryDeadLetters collects dead letters in memory.
+type memoryDeadLetters struct {
+	mu      sync.Mutex
+	letters map[string]storage.DeadLetter
+}
+
+func (q *memoryDeadLetters) Add(ctx context.Context, letter storage.DeadLetter) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.letters == nil {
+		q.letters = map[string]storage.DeadLetter{}
+	}
+	q.letters[letter.VacancyID] = letter
+	return nil
+}
+
+func (q *memoryDeadLetters) Close() error { return nil }
+
+func TestUnprocessableVacanciesAreDeadLettered(t *testing.T) {
+	cfg := loadTestConfig(t)
+	client := newFakeAPI(1, 3)
+	client.detail = func(ctx context.Context, id string) (map[string]interface{}, error) {
+		switch id {
+		case "2":
+			data := testVacancy(id)
+			data["description"] = ""
+			return data, nil
+		case "3":
+			return nil, &api.DecodeError{StatusCode: http.StatusOK, Body: []byte(`{"id": "3", "name": `), Err: errors.New("unexpected end of JSON input")}
+		}
+		return testVacancy(id), nil
+	}
+	dlq := &memoryDeadLetters{}
+	p := newTestPipeline(t, cfg, client, storage.NewMemoryStore())
+	p.dlq = dlq
+
+	if err := executeWithin(t, p, context.Background(), nil); !errors.Is(err, errTooManyFails) {
+		t.Fatalf("execute error = %v, want errTooManyFails", err)
+	}
+	if _, ok := dlq.letters["1"]; ok || len(dlq.letters) != 2 {
+		t.Fatalf("dead letters for %v, want 2 and 3", dlq.letters)
+	}
+
+	invalid := dlq.letters["2"]
+	if !strings.Contains(invalid.Reason, "vacancy 2 has invalid description") || !strings.Contains(invalid.Raw, `"id":"2"`) {
+		t.Errorf("dead letter for 2 = %+v, want the invalid description and its payload", invalid)
+	}
+	badJSON := dlq.letters["3"]
+	if !strings.Contains(badJSON.Reason, "failed to parse JSON") || badJSON.Raw != `{"id": "3", "name": ` {
+		t.Errorf("dead letter for 3 = %+v, want the parse error and raw body", badJSON)
+	}
+	if badJSON.RunID != "test-run" || badJSON.FailedAt.IsZero() {
+		t.Errorf("dead letter for 3 has run id %q, failed at %v", badJSON.RunID, badJSON.FailedAt)
+	}
+	if p.stats.DeadLettered() != 2 || p.stats.Failed() != 2 {
+		t.Errorf("dead-lettered %d, failed %d, want 2 and 2", p.stats.DeadLettered(), p.stats.Failed())
+	}
+	if _, detail, _ := client.counts(); detail != 3 {
+		t.Errorf("%d detail calls, want unprocessable vacancies not retried", detail)
+	}
+}
+
+// scanStore serves seeded documents to EachVacancy, as stored by an
+// earlier run.
+type scanStore struct {
+	*countingStore
+	seeded []map[string]interface{}
+}
+
+func (s *scanStore) EachVacancy(ctx context.Context, fn func(data map[string]interface{}) error) error {
+	for _, data := range s.seeded {
+		if err := fn(data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestReprocess(t *testing.T) {
+	payload := testVacancy("2")
+	payload["salary"] = map[string]interface{}{"from": 200000.0, "to": 300000.0, "currency": "RUR"}
+	rawJSON, err := encodeRaw(payload, "json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gzPayload := testVacancy("3")
+	gzPayload["salary"] = map[string]interface{}{"from": 150000.0, "currency": "RUR"}
+	rawGzip, err := encodeRaw(gzPayload, rawModeGzip)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	legacy := testVacancy("1")
+	legacy["salary"] = map[string]interface{}{"from": 100000.0, "to": 200000.0, "currency": "RUR"}
+	store := &scanStore{countingStore: newCountingStore(), seeded: []map[string]interface{}{
+		legacy,
+		{"id": "2", "name": "Vacancy 2", "raw": rawJSON},
+		{"id": "3", "name": "Vacancy 3", "raw": rawGzip},
+		{"id": "4", "name": "Vacancy 4", "raw": "{not json"},
+	}}
+	cfg := loadTestConfig(t, "--reprocess")
+	client := newFakeAPI(1, 5)
+	p := newTestPipeline(t, cfg, client, store)
+
+	if err := executeWithin(t, p, context.Background(), nil); err != nil {
+		t.Fatal(err)
+	}
+	if search, detail, _ := client.counts(); search+detail != 0 {
+		t.Errorf("%d search and %d detail requests while reprocessing", search, detail)
+	}
+
+	for id, mid := range map[string]float64{"1": 150000, "2": 250000, "3": 150000} {
+		doc := store.docs[id]
+		if doc == nil {
+			t.Errorf("vacancy %s not rewritten", id)
+			continue
+		}
+		if doc["salary_mid_num"] != mid {
+			t.Errorf("vacancy %s salary_mid_num = %v, want %v", id, doc["salary_mid_num"], mid)
+		}
+		if doc["schema_version"] != schemaVersion || doc["url"] != "https://hh.ru/vacancy/"+id || doc["description_hash"] == nil {
+			t.Errorf("vacancy %s lacks derived fields: %v", id, doc)
+		}
+	}
+	if _, ok := store.docs["4"]; ok || p.stats.Failed() != 1 {
+		t.Errorf("vacancy with a broken raw payload rewritten, %d failed", p.stats.Failed())
+	}
+}
+
+func TestReprocessWithFieldMap(t *testing.T) {
+	payload := testVacancy("2")
+	rawJSON, err := encodeRaw(payload, "json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored := testVacancy("1")
+	delete(stored, "name")
+	stored["title"] = "Go developer"
+	store := &scanStore{countingStore: newCountingStore(), seeded: []map[string]interface{}{
+		stored,
+		{"id": "2", "title": "Vacancy 2", "raw": rawJSON},
+	}}
+	cfg := loadTestConfig(t, "--reprocess", "--field-map=name=title")
+	if err := executeWithin(t, newTestPipeline(t, cfg, newFakeAPI(0, 0), store), context.Background(), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	for id, title := range map[string]string{"1": "Go developer", "2": payload["name"].(string)} {
+		doc := store.docs[id]
+		if doc["title"] != title {
+			t.Errorf("vacancy %s: title = %v, want %q", id, doc["title"], title)
+		}
+		if _, ok := doc["name"]; ok {
+			t.Errorf("vacancy %s: unmapped name stored: %v", id, doc["name"])
+		}
+	}
+}
+
+func TestPublishedAtFilterUsesTimeZone(t *testing.T) {
+	// 01:00 on March 1 in Moscow, still February 29 in UTC.
+	const publishedAt = "2024-02-29T22:00:00+0000"
+	for tz, wantSaved := range map[string]int64{"UTC": 0, "Europe/Moscow": 1} {
+		cfg := loadTestConfig(t, "--tz="+tz, "--filter-published-at")
+		client := newFakeAPI(1, 1)
+		client.detail = func(ctx context.Context, id string) (map[string]interface{}, error) {
+			data := testVacancy(id)
+			data["published_at"] = publishedAt
+			return data, nil
+		}
+		p := newTestPipeline(t, cfg, client, storage.NewMemoryStore())
+		if err := executeWithin(t, p, context.Background(), nil); err != nil {
+			t.Fatal(err)
+		}
+		if p.stats.Saved() != wantSaved {
+			t.Errorf("--tz=%s: saved %d vacancies published at %s, want %d", tz, p.stats.Saved(), publishedAt, wantSaved)
+		}
+	}
+}
+
+func TestDropDescription(t *testing.T) {
+	cfg := loadTestConfig(t, "--drop-description")
+	store := newCountingStore()
+	client := newFakeAPI(1, 2)
+	if err := executeWithin(t, newTestPipeline(t, cfg, client, store), context.Background(), nil); err != nil {
+		t.Fatal(err)
+	}
+	doc := store.docs["1"]
+	if _, ok := doc["description"]; ok {
+		t.Error("description stored with --drop-description")
+	}
+	if doc["description_hash"] != api.MD5Hash("<p>Description of vacancy 1</p>") {
+		t.Errorf("description_hash = %v, want the hash of the dropped description", doc["description_hash"])
+	}
+
+	// A later run still recognises the description as a duplicate.
+	cfg = loadTestConfig(t, "--drop-description")
+	client = newFakeAPI(1, 3)
+	client.detail = func(ctx context.Context, id string) (map[string]interface{}, error) {
+		data := testVacancy(id)
+		if id == "3" {
+			data["description"] = "<p>Description of vacancy 1</p>"
+		}
+		return data, nil
+	}
+	p := newTestPipeline(t, cfg, client, store)
+	if err := executeWithin(t, p, context.Background(), nil); err != nil {
+		t.Fatal(err)
+	}
+	if p.stats.Duplicates() != 1 || store.docs["3"] != nil {
+		t.Errorf("%d duplicates, vacancy 3 stored: %v, want its repeated description caught", p.stats.Duplicates(), store.docs["3"] != nil)
+	}
+}
+
+func TestReprocessKeepsDroppedDescriptionHash(t *testing.T) {
+	store := &scanStore{countingStore: newCountingStore(), seeded: []map[string]interface{}{
+		{"id": "1", "name": "Vacancy 1", "description_hash": "abc123"},
+	}}
+	cfg := loadTestConfig(t, "--reprocess", "--drop-description")
+	if err := executeWithin(t, newTestPipeline(t, cfg, newFakeAPI(0, 0), store), context.Background(), nil); err != nil {
+		t.Fatal(err)
+	}
+	if doc := store.docs["1"]; doc == nil || doc["description_hash"] != "abc123" {
+		t.Errorf("reprocessed document = %v, want description_hash abc123 kept", doc)
+	}
+}
+
+func TestIncludeArchived(t *testing.T) {
+	cfg := loadTestConfig(t, "--include-archived")
+	client := newFakeAPI(1, 2)
+	client.detail = func(ctx context.Context, id string) (map[string]interface{}, error) {
+		data := testVacancy(id)
+		if id == "2" {
+			data["archived"] = true
+		}
+		return data, nil
+	}
+	store := newCountingStore()
+	if err := executeWithin(t, newTestPipeline(t, cfg, client, store), context.Background(), nil); err != nil {
+		t.Fatal(err)
+	}
+	if !client.queries[0].IncludeArchived {
+		t.Error("search did not ask for archived vacancies")
+	}
+	if store.docs["1"]["archived"] != false || store.docs["2"]["archived"] != true {
+		t.Errorf("archived = %v, %v, want false for the active vacancy and true for the archived one",
+			store.docs["1"]["archived"], store.docs["2"]["archived"])
+	}
+}
+
+func TestRetryStatuses(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		status   int
+		attempts int
+	}{
+		{"bad request fails fast", nil, http.StatusBadRequest, 1},
+		{"service unavailable is retried", nil, http.StatusServiceUnavailable, 4},
+		{"status left out of the set", []string{"--retry-statuses=429"}, http.StatusServiceUnavailable, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := loadTestConfig(t, tt.args...)
+			client := newFakeAPI(1, 1)
+			client.detail = func(ctx context.Context, id string) (map[string]interface{}, error) {
+				return nil, &api.StatusError{StatusCode: tt.status}
+			}
+			p := newTestPipeline(t, cfg, client, storage.NewMemoryStore())
+			executeWithin(t, p, context.Background(), nil)
+
+			if _, detail, _ := client.counts(); detail != tt.attempts {
+				t.Errorf("vacancy fetched %d times, want %d", detail, tt.attempts)
+			}
+			if p.stats.Failed() != 1 {
+				t.Errorf("failed = %d, want 1", p.stats.Failed())
+			}
+		})
+	}
+}
+
+func TestServerErrorsAreDeadLettered(t *testing.T) {
+	cfg := loadTestConfig(t, "--server-error-attempts=3", "--max-failure-ratio=1")
+	client := newFakeAPI(1, 3)
+	var mu sync.Mutex
+	attempts := map[string]int{}
+	client.detail = func(ctx context.Context, id string) (map[string]interface{}, error) {
+		mu.Lock()
+		attempts[id]++
+		n := attempts[id]
+		mu.Unlock()
+		switch {
+		case id == "2":
+			return nil, &api.StatusError{StatusCode: http.StatusInternalServerError}
+		case id == "3" && n == 1:
+			return nil, &api.StatusError{StatusCode: http.StatusServiceUnavailable}
+		}
+		return testVacancy(id), nil
+	}
+	dlq := &memoryDeadLetters{}
+	store := newCountingStore()
+	p := newTestPipeline(t, cfg, client, store)
+	p.dlq = dlq
+	if err := executeWithin(t, p, context.Background(), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if attempts["2"] != 3 || attempts["3"] != 2 {
+		t.Errorf("attempts = %v, want 3 for the broken listing and 2 for the transient error", attempts)
+	}
+	letter, ok := dlq.letters["2"]
+	if !ok || len(dlq.letters) != 1 {
+		t.Fatalf("dead letters = %v, want only vacancy 2", dlq.letters)
+	}
+	if !strings.Contains(letter.Reason, "status 500 on 3 attempts") {
+		t.Errorf("reason = %q", letter.Reason)
+	}
+	if _, stored := store.docs["3"]; !stored {
+		t.Error("vacancy that recovered from a 503 was not stored")
+	}
+	if p.stats.Failed() != 1 || p.stats.DeadLettered() != 1 {
+		t.Errorf("failed, dead lettered = %d, %d, want 1, 1", p.stats.Failed(), p.stats.DeadLettered())
+	}
+
+	setArgs(t, append(append([]string{}, testArgs...), "--server-error-attempts=0")...)
+	if err := validateConfig(config.LoadConfig()); err == nil {
+		t.Error("--server-error-attempts=0 accepted")
+	}
+}
+
+func TestPageRange(t *testing.T) {
+	tests := []struct {
+		name  string
+		args  []string
+		pages string
+	}{
+		{"whole search", nil, "0,1,2,3,4,5"},
+		{"start only", []string{"--start-page=3"}, "3,4,5"},
+		{"start and end", []string{"--start-page=2", "--end-page=3"}, "2,3"},
+		{"single page", []string{"--start-page=4", "--end-page=4"}, "4"},
+		{"end past the last page", []string{"--start-page=4", "--end-page=40"}, "4,5"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := loadTestConfig(t, tt.args...)
+			client := newFakeAPI(6, 2)
+			store := newCountingStore()
+			p := newTestPipeline(t, cfg, client, store)
+			if err := executeWithin(t, p, context.Background(), nil); err != nil {
+				t.Fatal(err)
+			}
+
+			pages := append([]int{}, client.searchCalls...)
+			sort.Ints(pages)
+			var got []string
+			for _, page := range pages {
+				got = append(got, strconv.Itoa(page))
+			}
+			if strings.Join(got, ",") != tt.pages {
+				t.Errorf("searched pages %v, want %s", got, tt.pages)
+			}
+			if want := int64(2 * len(pages)); p.stats.Saved() != want {
+				t.Errorf("saved %d, want %d from the pages in range", p.stats.Saved(), want)
+			}
+		})
+	}
+}
+
+func TestValidateConfigPageRange(t *testing.T) {
+	for _, args := range [][]string{
+		{"--start-page=-1"},
+		{"--start-page=5", "--end-page=4"},
+		{"--end-page=-2"},
+		{"--start-page=2", "--since-id"},
+	} {
+		setArgs(t, append(append([]string{}, testArgs...), args...)...)
+		if err := validateConfig(config.LoadConfig()); err == nil {
+			t.Errorf("%v accepted", args)
+		}
+	}
+}
+
+func TestRetryPolicyLimitsVacancyRetries(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		attempts int
+	}{
+		{"default attempts", nil, 4},
+		{"fewer attempts", []string{"--retry-max-attempts=2"}, 2},
+		{"no retries", []string{"--retry-max-attempts=1"}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := loadTestConfig(t, tt.args...)
+			client := newFakeAPI(1, 1)
+			client.detail = func(ctx context.Context, id string) (map[string]interface{}, error) {
+				return nil, &api.StatusError{StatusCode: http.StatusTooManyRequests}
+			}
+			p := newTestPipeline(t, cfg, client, storage.NewMemoryStore())
+			executeWithin(t, p, context.Background(), nil)
+			if _, detail, _ := client.counts(); detail != tt.attempts {
+				t.Errorf("vacancy fetched %d times, want %d", detail, tt.attempts)
+			}
+		})
+	}
+}
+
+func TestVacancyBudget(t *testing.T) {
+	cfg := loadTestConfig(t, "--vacancy-budget=50ms", "--retry-base=1s", "--retry-cap=1s", "--retry-max-attempts=100",
+		"--detail-concurrency=1", "--max-failure-ratio=1")
+	client := newFakeAPI(1, 2)
+	client.detail = func(ctx context.Context, id string) (map[string]interface{}, error) {
+		if id == "1" {
+			return nil, &api.StatusError{StatusCode: http.StatusTooManyRequests}
+		}
+		return testVacancy(id), nil
+	}
+	dlq := &memoryDeadLetters{}
+	store := newCountingStore()
+	p := newTestPipeline(t, cfg, client, store)
+	p.dlq = dlq
+	start := time.Now()
+	if err := executeWithin(t, p, context.Background(), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("run took %v, want the failing vacancy abandoned after its 50ms budget", elapsed)
+	}
+	if got := strings.Join(store.upserts, ","); got != "2" {
+		t.Errorf("stored %s, want the worker freed for vacancy 2", got)
+	}
+	letter, ok := dlq.letters["1"]
+	if !ok || !strings.Contains(letter.Reason, "exceeded --vacancy-budget of 50ms") {
+		t.Errorf("dead letters = %+v, want vacancy 1 abandoned over budget", dlq.letters)
+	}
+	if p.stats.Failed() != 1 {
+		t.Errorf("failed = %d, want 1", p.stats.Failed())
+	}
+
+	setArgs(t, append(append([]string{}, testArgs...), "--vacancy-budget=-1s")...)
+	if err := validateConfig(config.LoadConfig()); err == nil {
+		t.Error("negative --vacancy-budget accepted")
+	}
+}
+
+func TestRetryPolicyCapsVacancyBackoff(t *testing.T) {
+	cfg := loadTestConfig(t, "--retry-base=20ms", "--retry-multiplier=10", "--retry-cap=30ms", "--retry-max-attempts=3")
+	client := newFakeAPI(1, 1)
+	var times []time.Time
+	client.detail = func(ctx context.Context, id string) (map[string]interface{}, error) {
+		times = append(times, time.Now())
+		return nil, &api.StatusError{StatusCode: http.StatusTooManyRequests}
+	}
+	p := newTestPipeline(t, cfg, client, storage.NewMemoryStore())
+	executeWithin(t, p, context.Background(), nil)
+
+	if len(times) != 3 {
+		t.Fatalf("%d attempts, want 3", len(times))
+	}
+	// Uncapped, the second wait would be 200ms.
+	first, second := times[1].Sub(times[0]), times[2].Sub(times[1])
+	if first < 20*time.Millisecond || second < 30*time.Millisecond || second > 150*time.Millisecond {
+		t.Errorf("waits %v and %v, want 20ms then the 30ms cap", first, second)
+	}
+}
+
+func TestPaginationDepthStopsPaging(t *testing.T) {
+	cfg := loadTestConfig(t)
+	client := newFakeAPI(5, 2)
+	client.search = func(ctx context.Context, page int) (api.SearchResult, error) {
+		if page >= 2 {
+			return api.SearchResult{}, fmt.Errorf("bad_argument page: %w", api.ErrPaginationDepthExceeded)
+		}
+		return client.page(page), nil
+	}
+	p := newTestPipeline(t, cfg, client, storage.NewMemoryStore())
+	appLogger, errorLog := bufferLogger()
+	p.logger = appLogger
+
+	if err := executeWithin(t, p, context.Background(), nil); err != nil {
+		t.Fatalf("execute = %v, want the reachable pages kept", err)
+	}
+	if got := fmt.Sprint(client.searchCalls); got != "[0 1 2]" {
+		t.Errorf("searched pages %s, want paging to stop at the first page past the limit", got)
+	}
+	if p.stats.Saved() != 4 {
+		t.Errorf("saved = %d, want the 4 vacancies on reachable pages", p.stats.Saved())
+	}
+	if n := strings.Count(errorLog.String(), "past the API's result depth limit"); n != 1 {
+		t.Errorf("depth limit logged %d times, want once:\n%s", n, errorLog)
+	}
+}
+
+func TestDupPolicy(t *testing.T) {
+	tests := []struct {
+		policy string
+		stored string
+	}{
+		{"skip", "1,2"},
+		{"flag", "1,2,3"},
+		{"store", "1,2,3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			cfg := loadTestConfig(t, "--dup-policy="+tt.policy, "--detail-concurrency=1")
+			client := newFakeAPI(1, 3)
+			client.detail = func(ctx context.Context, id string) (map[string]interface{}, error) {
+				data := testVacancy(id)
+				if id == "3" {
+					data["description"] = testVacancy("1")["description"]
+				}
+				return data, nil
+			}
+			store := newCountingStore()
+			p := newTestPipeline(t, cfg, client, store)
+			if err := executeWithin(t, p, context.Background(), nil); err != nil {
+				t.Fatal(err)
+			}
+
+			if got := strings.Join(store.upserts, ","); got != tt.stored {
+				t.Errorf("stored %s, want %s", got, tt.stored)
+			}
+			if p.stats.Duplicates() != 1 {
+				t.Errorf("duplicates = %d, want 1", p.stats.Duplicates())
+			}
+			duplicate := store.docs["3"]
+			if tt.policy == "flag" {
+				if duplicate["is_duplicate"] != true || duplicate["duplicate_of"] != "1" {
+					t.Errorf("flagged duplicate = is_duplicate %v, duplicate_of %v, want true, 1", duplicate["is_duplicate"], duplicate["duplicate_of"])
+				}
+			} else if _, flagged := duplicate["is_duplicate"]; flagged {
+				t.Errorf("%s policy flagged the duplicate", tt.policy)
+			}
+			if _, flagged := store.docs["1"]["is_duplicate"]; flagged {
+				t.Error("original flagged as a duplicate")
+			}
+		})
+	}
+}
+
+func TestDupByIDWins(t *testing.T) {
+	cfg := loadTestConfig(t, "--dup-by-id-wins", "--detail-concurrency=1")
+	client := newFakeAPI(1, 4)
+	client.detail = func(ctx context.Context, id string) (map[string]interface{}, error) {
+		data := testVacancy(id)
+		data["description"] = "<p>Franchise boilerplate</p>"
+		return data, nil
+	}
+	store := newCountingStore()
+	p := newTestPipeline(t, cfg, client, store)
+	if err := executeWithin(t, p, context.Background(), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := strings.Join(store.upserts, ","); got != "1,2,3,4" {
+		t.Errorf("stored %s, want every distinct id", got)
+	}
+	if p.stats.Duplicates() != 3 {
+		t.Errorf("duplicates = %d, want 3 recorded collisions", p.stats.Duplicates())
+	}
+	for _, id := range []string{"2", "3", "4"} {
+		if doc := store.docs[id]; doc["is_duplicate"] != true || doc["duplicate_of"] != "1" {
+			t.Errorf("vacancy %s: is_duplicate %v, duplicate_of %v, want true, 1", id, doc["is_duplicate"], doc["duplicate_of"])
+		}
+	}
+
+	for _, conflict := range []string{"--dup-policy=store", "--no-dedup-description"} {
+		setArgs(t, append(append([]string{}, testArgs...), "--dup-by-id-wins", conflict)...)
+		if err := validateConfig(config.LoadConfig()); err == nil {
+			t.Errorf("--dup-by-id-wins accepted with %s", conflict)
+		}
+	}
+}
+
+// uniqueIndexStore rejects the ids in rejected the way the unique
+// description_hash index does.
+type uniqueIndexStore struct {
+	*countingStore
+	rejected map[string]bool
+}
+
+func (s *uniqueIndexStore) UpsertVacancy(data map[string]interface{}) error {
+	if s.rejected[data["id"].(string)] {
+		return fmt.Errorf("vacancy %v: %w", data["id"], storage.ErrDuplicateDescription)
+	}
+	return s.countingStore.UpsertVacancy(data)
+}
+
+func TestUniqueDescriptionIndexRejection(t *testing.T) {
+	cfg := loadTestConfig(t, "--detail-concurrency=1")
+	store := &uniqueIndexStore{countingStore: newCountingStore(), rejected: map[string]bool{"2": true}}
+	p := newTestPipeline(t, cfg, newFakeAPI(1, 3), store)
+	if err := executeWithin(t, p, context.Background(), nil); err != nil {
+		t.Fatalf("run failed on a rejected duplicate: %v", err)
+	}
+
+	if got := strings.Join(store.upserts, ","); got != "1,3" {
+		t.Errorf("stored %s, want 1,3", got)
+	}
+	if p.stats.Duplicates() != 1 || p.stats.Failed() != 0 || p.stats.Saved() != 2 {
+		t.Errorf("duplicates, failed, saved = %d, %d, %d, want 1, 0, 2", p.stats.Duplicates(), p.stats.Failed(), p.stats.Saved())
+	}
+}
+
+func TestDedupFields(t *testing.T) {
+	tests := []struct {
+		fields string
+		stored string
+	}{
+		{"description", "1,2,3"},
+		{"name", "1,3"},
+		{"name,employer.id", "1,2,3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.fields, func(t *testing.T) {
+			cfg := loadTestConfig(t, "--dedup-fields="+tt.fields, "--detail-concurrency=1")
+			client := newFakeAPI(1, 3)
+			client.detail = func(ctx context.Context, id string) (map[string]interface{}, error) {
+				data := testVacancy(id)
+				data["employer"] = map[string]interface{}{"id": id}
+				if id == "2" {
+					data["name"] = "Vacancy 1"
+				}
+				return data, nil
+			}
+			store := newCountingStore()
+			p := newTestPipeline(t, cfg, client, store)
+			if err := executeWithin(t, p, context.Background(), nil); err != nil {
+				t.Fatal(err)
+			}
+			if got := strings.Join(store.upserts, ","); got != tt.stored {
+				t.Errorf("stored %s, want %s", got, tt.stored)
+			}
+		})
+	}
+
+	if cfg := loadTestConfig(t, "--dedup-fields=description"); cfg.DedupFields != nil {
+		t.Errorf("default dedup fields = %v, want the plain description hash", cfg.DedupFields)
+	}
+}
+
+func TestRegionPath(t *testing.T) {
+	cfg := loadTestConfig(t)
+	client := newFakeAPI(1, 3)
+	client.detail = func(ctx context.Context, id string) (map[string]interface{}, error) {
+		data := testVacancy(id)
+		data["area"] = map[string]interface{}{"id": map[string]string{"1": "2034", "2": "1", "3": "99999"}[id]}
+		return data, nil
+	}
+	store := newCountingStore()
+	p := newTestPipeline(t, cfg, client, store)
+	p.areaPaths = map[string][]string{
+		"1":    {"Россия", "Москва"},
+		"2034": {"Россия", "Московская область", "Химки"},
+	}
+	if err := executeWithin(t, p, context.Background(), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	for id, want := range map[string]string{"1": "[Россия Московская область Химки]", "2": "[Россия Москва]"} {
+		if got := fmt.Sprint(store.docs[id]["region_path"]); got != want {
+			t.Errorf("vacancy %s region_path = %s, want %s", id, got, want)
+		}
+	}
+	if path, ok := store.docs["3"]["region_path"]; ok {
+		t.Errorf("vacancy in an unknown area got region_path %v", path)
+	}
+	if p.stats.Saved() != 3 {
+		t.Errorf("saved %d, want 3 including the unknown area", p.stats.Saved())
+	}
+}
+
+// fieldStore records SetFields calls.
+type fieldStore struct {
+	*countingStore
+	set map[string]map[string]interface{}
+}
+
+func (s *fieldStore) SetFields(id string, fields map[string]interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.set[id] = fields
+	return nil
+}
+
+func TestRefreshStale(t *testing.T) {
+	cfg := loadTestConfig(t, "--refresh-stale=7d")
+	client := newFakeAPI(0, 0)
+	client.detail = func(ctx context.Context, id string) (map[string]interface{}, error) {
+		if id == "2" {
+			return nil, fmt.Errorf("vacancy %s: %w", id, api.ErrVacancyNotFound)
+		}
+		return testVacancy(id), nil
+	}
+	store := &fieldStore{countingStore: newCountingStore(), set: map[string]map[string]interface{}{}}
+	for _, id := range []string{"1", "2", "3"} {
+		if err := store.MemoryStore.UpsertVacancy(testVacancy(id)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	p := newTestPipeline(t, cfg, client, store)
+
+	// The store picked 1 and 2 as stale; 3 was seen recently.
+	if err := executeWithin(t, p, context.Background(), []string{"1", "2"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if search, detail, _ := client.counts(); search != 0 || detail != 2 {
+		t.Errorf("%d searches, %d vacancies fetched, want only the 2 stale ones", search, detail)
+	}
+	if _, ok := store.docs["1"]["last_seen"].(time.Time); !ok {
+		t.Errorf("refreshed vacancy last_seen = %v", store.docs["1"]["last_seen"])
+	}
+	if closed := store.set["2"]; closed["closed"] != true || closed["closed_at"] == nil {
+		t.Errorf("vanished vacancy updated with %v, want it marked closed", closed)
+	}
+	if _, touched := store.docs["3"]; touched || store.set["3"] != nil {
+		t.Error("recently seen vacancy refreshed")
+	}
+}
+
+func TestTimestampsStoredAsDates(t *testing.T) {
+	cfg := loadTestConfig(t)
+	client := newFakeAPI(1, 2)
+	client.detail = func(ctx context.Context, id string) (map[string]interface{}, error) {
+		data := testVacancy(id)
+		if id == "1" {
+			data["created_at"] = "2024-02-20T09:30:00+0300"
+			data["initial_created_at"] = "2024-01-15T12:00:00+0300"
+		} else {
+			delete(data, "published_at")
+		}
+		return data, nil
+	}
+	store := newCountingStore()
+	p := newTestPipeline(t, cfg, client, store)
+	if err := executeWithin(t, p, context.Background(), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	raw, err := bson.Marshal(store.docs["1"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, field := range []string{"published_at_date", "created_at_date", "initial_created_at_date"} {
+		if value := bson.Raw(raw).Lookup(field); value.Type != bson.TypeDateTime {
+			t.Errorf("%s stored as %v, want a BSON date", field, value.Type)
+		}
+	}
+	if published := bson.Raw(raw).Lookup("published_at"); published.Type != bson.TypeString {
+		t.Errorf("published_at stored as %v, want the API string kept", published.Type)
+	}
+
+	if _, ok := store.docs["2"]["published_at_date"]; ok || p.stats.Saved() != 2 {
+		t.Errorf("vacancy without timestamps: published_at_date %v, saved %d", store.docs["2"]["published_at_date"], p.stats.Saved())
+	}
+}
+
+func TestOverflowPolicy(t *testing.T) {
+	for _, policy := range []string{config.OverflowBlock, config.OverflowSpill, config.OverflowDrop} {
+		t.Run(policy, func(t *testing.T) {
+			spillPath := filepath.Join(t.TempDir(), "overflow.txt")
+			cfg := loadTestConfig(t, "--overflow-policy="+policy, "--overflow-file="+spillPath, "--prefetch-buffer=2", "--detail-concurrency=1")
+			client := newFakeAPI(1, 8)
+			release := make(chan struct{})
+			client.detail = func(ctx context.Context, id string) (map[string]interface{}, error) {
+				<-release
+				return testVacancy(id), nil
+			}
+			store := newCountingStore()
+			p := newTestPipeline(t, cfg, client, store)
+			if policy == config.OverflowSpill {
+				spill, err := openIDWriter(spillPath)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer spill.Close()
+				p.spill = spill
+			}
+
+			// The single worker holds one id and the buffer two more, so
+			// the other five overflow unless search waits for them. A
+			// blocked search is released after a while instead.
+			go func() {
+				deadline := time.Now().Add(30 * time.Millisecond)
+				for p.stats.Overflowed() < 5 && (policy != config.OverflowBlock || time.Now().Before(deadline)) {
+					time.Sleep(time.Millisecond)
+				}
+				close(release)
+			}()
+			if err := executeWithin(t, p, context.Background(), nil); err != nil {
+				t.Fatal(err)
+			}
+
+			_, fetched, _ := client.counts()
+			overflowed := p.stats.Overflowed()
+			if fetched+int(overflowed) != 8 || p.stats.Saved() != int64(fetched) {
+				t.Errorf("fetched %d, overflowed %d, saved %d, want every id fetched or overflowed", fetched, overflowed, p.stats.Saved())
+			}
+			if policy == config.OverflowBlock && overflowed != 0 || policy != config.OverflowBlock && overflowed < 5 {
+				t.Errorf("%d ids overflowed under the %s policy", overflowed, policy)
+			}
+
+			data, _ := os.ReadFile(spillPath)
+			spilled := strings.Fields(string(data))
+			if policy == config.OverflowSpill && len(spilled) != int(overflowed) || policy != config.OverflowSpill && len(spilled) != 0 {
+				t.Errorf("spill file holds %v, %d ids overflowed", spilled, overflowed)
+			}
+			for _, id := range spilled {
+				if _, stored := store.docs[id]; stored {
+					t.Errorf("spilled vacancy %s was also fetched", id)
+				}
+			}
+		})
+	}
+
+	setArgs(t, append(append([]string{}, testArgs...), "--overflow-policy=queue")...)
+	if err := validateConfig(config.LoadConfig()); err == nil {
+		t.Error("unknown --overflow-policy accepted")
+	}
+}
+
+func TestSearchOnly(t *testing.T) {
+	cfg := loadTestConfig(t, "--search-only")
+	client := newFakeAPI(2, 2)
+	client.search = func(ctx context.Context, page int) (api.SearchResult, error) {
+		result := client.page(page)
+		for _, item := range result.Items {
+			item["salary"] = map[string]interface{}{"from": 200000.0, "to": nil, "currency": "RUR"}
+			item["snippet"] = map[string]interface{}{"requirement": "Go, SQL"}
+		}
+		return result, nil
+	}
+	store := newCountingStore()
+	if err := store.MemoryStore.UpsertVacancy(testVacancy("2")); err != nil {
+		t.Fatal(err)
+	}
+	p := newTestPipeline(t, cfg, client, store)
+	if err := executeWithin(t, p, context.Background(), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, detail, _ := client.counts(); detail != 0 {
+		t.Errorf("%d detail fetches in --search-only mode", detail)
+	}
+	stored := append([]string{}, store.upserts...)
+	sort.Strings(stored)
+	if got := strings.Join(stored, ","); got != "1,3,4" {
+		t.Errorf("stored %s, want the new search items 1,3,4", got)
+	}
+	doc := store.docs["3"]
+	if snippet, _ := doc["snippet"].(map[string]interface{}); snippet["requirement"] != "Go, SQL" {
+		t.Errorf("snippet = %v", doc["snippet"])
+	}
+	if doc["search_only"] != true || doc["url"] != api.VacancyPageURL("3") || doc["salary_from_num"] != 200000.0 {
+		t.Errorf("search_only %v, url %v, salary_from_num %v", doc["search_only"], doc["url"], doc["salary_from_num"])
+	}
+	if p.stats.Saved() != 3 {
+		t.Errorf("saved %d, want 3", p.stats.Saved())
+	}
+
+	setArgs(t, append(append([]string{}, testArgs...), "--search-only", "--ids-only", "--ids-out=ids.txt")...)
+	if err := validateConfig(config.LoadConfig()); err == nil {
+		t.Error("--search-only accepted with --ids-only")
+	}
+}
+
+func TestDetailsFetchedForSearchOnlySnippets(t *testing.T) {
+	store := newCountingStore()
+	if err := store.MemoryStore.UpsertVacancy(testVacancy("2")); err != nil {
+		t.Fatal(err)
+	}
+	for _, run := range []struct {
+		args    []string
+		details int
+	}{
+		{[]string{"--search-only"}, 0},
+		{[]string{"--search-only"}, 0},
+		{nil, 3},
+		{nil, 0},
+	} {
+		client := newFakeAPI(2, 2)
+		p := newTestPipeline(t, loadTestConfig(t, run.args...), client, store)
+		if err := executeWithin(t, p, context.Background(), nil); err != nil {
+			t.Fatal(err)
+		}
+		if _, details, _ := client.counts(); details != run.details {
+			t.Errorf("run %v: %d detail fetches, want %d", run.args, details, run.details)
+		}
+	}
+	if got := strings.Join(store.upserts, ","); !strings.HasPrefix(got, "1,3,4,") || len(store.upserts) != 6 {
+		t.Errorf("upserts %s, want the snippets once and then their details once", got)
+	}
+	if store.StoredAsSnippet("3") || store.docs["3"]["description"] == nil {
+		t.Errorf("vacancy 3 still stored as a snippet: %v", store.docs["3"])
+	}
+}
+
+func TestNoDedupDescription(t *testing.T) {
+	cfg := loadTestConfig(t, "--no-dedup-description", "--detail-concurrency=1")
+	client := newFakeAPI(1, 2)
+	client.detail = func(ctx context.Context, id string) (map[string]interface{}, error) {
+		data := testVacancy(id)
+		data["description"] = "Same template for every employer"
+		return data, nil
+	}
+	store := newCountingStore()
+	p := newTestPipeline(t, cfg, client, store)
+	if err := executeWithin(t, p, context.Background(), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := strings.Join(store.upserts, ","); got != "1,2" {
+		t.Errorf("stored %s, want both vacancies", got)
+	}
+	first, _ := store.docs["1"]["description_hash"].(string)
+	if first == "" || store.docs["2"]["description_hash"] != first {
+		t.Errorf("description hashes = %v, %v, want the same non-empty hash", store.docs["1"]["description_hash"], store.docs["2"]["description_hash"])
+	}
+}
+
+func TestPrefetchBufferBackpressure(t *testing.T) {
+	cfg := loadTestConfig(t, "--prefetch-buffer=2", "--detail-concurrency=2")
+	client := newFakeAPI(0, 0)
+	client.pages = [][]string{{"1", "2", "3", "4"}, {"3", "5", "6", "7"}, {"8", "9", "1"}}
+	release := make(chan struct{})
+	client.search = func(ctx context.Context, page int) (api.SearchResult, error) {
+		// Page 1 is only reachable if page 0's ids were handed to the
+		// buffer without waiting for their details.
+		if page == 1 {
+			close(release)
+		}
+		return client.page(page), nil
+	}
+	var p *pipeline
+	var maxQueued atomic.Int32
+	client.detail = func(ctx context.Context, id string) (map[string]interface{}, error) {
+		<-release
+		if queued := int32(len(p.detailQueue)); queued > maxQueued.Load() {
+			maxQueued.Store(queued)
+		}
+		time.Sleep(time.Millisecond)
+		return testVacancy(id), nil
+	}
+	store := newCountingStore()
+	p = newTestPipeline(t, cfg, client, store)
+	if err := executeWithin(t, p, context.Background(), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	fetched := map[string]int{}
+	for _, id := range client.detailCalls {
+		fetched[id]++
+	}
+	for id := 1; id <= 9; id++ {
+		if n := fetched[strconv.Itoa(id)]; n != 1 {
+			t.Errorf("vacancy %d fetched %d times, want once", id, n)
+		}
+	}
+	if len(store.upserts) != 9 || p.stats.Saved() != 9 {
+		t.Errorf("stored %d, saved %d, want 9", len(store.upserts), p.stats.Saved())
+	}
+	if maxQueued.Load() > 2 {
+		t.Errorf("%d ids queued, want at most the buffer size 2", maxQueued.Load())
+	}
+}
+
+func TestInvalidTokenFailsFast(t *testing.T) {
+	cfg := loadTestConfig(t)
+	client := newFakeAPI(1, 1)
+	client.detail = func(ctx context.Context, id string) (map[string]interface{}, error) {
+		return nil, fmt.Errorf("token_expired: %w", api.ErrTokenInvalid)
+	}
+	p := newTestPipeline(t, cfg, client, storage.NewMemoryStore())
+	appLogger, errorLog := bufferLogger()
+	p.logger = appLogger
+	executeWithin(t, p, context.Background(), nil)
+
+	if _, detail, _ := client.counts(); detail != 1 {
+		t.Errorf("vacancy fetched %d times with an invalid token, want once", detail)
+	}
+	if !strings.Contains(errorLog.String(), "refresh BEARER_TOKEN") {
+		t.Errorf("no prompt to refresh the token:\n%s", errorLog)
+	}
+}
+
+func TestPublishedAtFilter(t *testing.T) {
+	published := map[string]string{
+		"1": "2024-03-01T10:00:00+0300",
+		"2": "2024-02-28T10:00:00+0300",
+		"3": "2024-03-02T10:00:00+0300",
+		"4": "not a date",
+	}
+	tests := []struct {
+		name        string
+		args        []string
+		stored      string
+		outOfWindow int64
+	}{
+		{"filtered", []string{"--filter-published-at"}, "1,4", 2},
+		{"not filtered", nil, "1,2,3,4", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := loadTestConfig(t, append(tt.args, "--detail-concurrency=1")...)
+			client := newFakeAPI(1, 4)
+			client.detail = func(ctx context.Context, id string) (map[string]interface{}, error) {
+				data := testVacancy(id)
+				data["published_at"] = published[id]
+				return data, nil
+			}
+			store := newCountingStore()
+			p := newTestPipeline(t, cfg, client, store)
+			if err := executeWithin(t, p, context.Background(), nil); err != nil {
+				t.Fatal(err)
+			}
+			if got := strings.Join(store.upserts, ","); got != tt.stored {
+				t.Errorf("stored %s, want %s", got, tt.stored)
+			}
+			if p.stats.OutOfWindow() != tt.outOfWindow {
+				t.Errorf("out of window = %d, want %d", p.stats.OutOfWindow(), tt.outOfWindow)
+			}
+		})
+	}
+}
+
+func TestTruncatedBodiesAreRetried(t *testing.T) {
+	tests := []struct {
+		name      string
+		truncated bool
+		attempts  int
+		saved     int64
+	}{
+		{"truncated", true, 2, 1},
+		{"malformed", false, 1, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := loadTestConfig(t, "--max-failure-ratio=1")
+			client := newFakeAPI(1, 1)
+			client.detail = func(ctx context.Context, id string) (map[string]interface{}, error) {
+				if _, detail, _ := client.counts(); detail == 1 {
+					return nil, &api.DecodeError{StatusCode: http.StatusOK, Body: []byte(`{"id": "1"`), Err: errors.New("unexpected end of JSON input"), Truncated: tt.truncated}
+				}
+				return testVacancy(id), nil
+			}
+			p := newTestPipeline(t, cfg, client, storage.NewMemoryStore())
+			executeWithin(t, p, context.Background(), nil)
+
+			if _, detail, _ := client.counts(); detail != tt.attempts {
+				t.Errorf("vacancy fetched %d times, want %d", detail, tt.attempts)
+			}
+			if p.stats.Saved() != tt.saved {
+				t.Errorf("saved = %d, want %d", p.stats.Saved(), tt.saved)
+			}
+		})
+	}
+}
+
+func TestCaptureContacts(t *testing.T) {
+	for _, capture := range []bool{false, true} {
+		args := []string{}
+		if capture {
+			args = append(args, "--capture-contacts")
+		}
+		cfg := loadTestConfig(t, args...)
+		client := newFakeAPI(1, 2)
+		client.detail = func(ctx context.Context, id string) (map[string]interface{}, error) {
+			data := testVacancy(id)
+			data["contacts"] = nil
+			if id == "1" {
+				data["contacts"] = map[string]interface{}{"name": "Anna", "phones": []interface{}{map[string]interface{}{"formatted": "+7 (999) 123-45-67"}}}
+			}
+			return data, nil
+		}
+		store := newCountingStore()
+		p := newTestPipeline(t, cfg, client, store)
+		if err := executeWithin(t, p, context.Background(), nil); err != nil {
+			t.Fatal(err)
+		}
+
+		contacts, stored := store.docs["1"]["contacts"].(map[string]interface{})
+		if stored != capture {
+			t.Errorf("--capture-contacts=%v: contacts stored: %v", capture, store.docs["1"]["contacts"])
+		}
+		if capture && (contacts["name"] != "Anna" || fmt.Sprint(contacts["phones"]) != "[+7 (999) 123-45-67]") {
+			t.Errorf("contacts = %v, want them normalized", contacts)
+		}
+		if _, ok := store.docs["2"]["contacts"]; ok {
+			t.Errorf("--capture-contacts=%v: null contacts stored", capture)
+		}
+	}
+}
+
+func TestRetryBudgetResumeAt(t *testing.T) {
+	cfg := loadTestConfig(t, "--tz=UTC", "--rate-limit-threshold=5", "--resume-at=00:05", "--resume-after-trips=2")
+	budget := newRetryBudget(cfg)
+	if budget.LongPauseTrips != 2 || budget.ResumeAt == nil {
+		t.Fatalf("long pause after %d trips, ResumeAt set: %v", budget.LongPauseTrips, budget.ResumeAt != nil)
+	}
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	if got, want := budget.ResumeAt(now), time.Date(2024, 3, 2, 0, 5, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("ResumeAt(%v) = %v, want %v", now, got, want)
+	}
+
+	if budget := newRetryBudget(loadTestConfig(t, "--rate-limit-threshold=5")); budget.ResumeAt != nil {
+		t.Error("long pause enabled without --resume-at")
+	}
+}
+
+func TestSalaryFieldsStored(t *testing.T) {
+	for _, disabled := range []bool{false, true} {
+		args := []string{}
+		if disabled {
+			args = append(args, "--no-salary-fields")
+		}
+		client := newFakeAPI(1, 1)
+		client.detail = func(ctx context.Context, id string) (map[string]interface{}, error) {
+			data := testVacancy(id)
+			data["salary"] = map[string]interface{}{"from": 120000.0, "to": nil, "currency": "RUR"}
+			return data, nil
+		}
+		store := newCountingStore()
+		if err := executeWithin(t, newTestPipeline(t, loadTestConfig(t, args...), client, store), context.Background(), nil); err != nil {
+			t.Fatal(err)
+		}
+		doc := store.docs["1"]
+		if disabled {
+			if _, ok := doc["has_salary"]; ok {
+				t.Error("salary fields derived with --no-salary-fields")
+			}
+			continue
+		}
+		if doc["has_salary"] != true || doc["salary_mid_num"] != 120000.0 || doc["salary_to_num"] != nil {
+			t.Errorf("salary fields = has %v, mid %v, to %v", doc["has_salary"], doc["salary_mid_num"], doc["salary_to_num"])
+		}
+	}
+}
+
+// timedAPI records when each role was searched.
+type timedAPI struct {
+	*fakeAPI
+	mu    sync.Mutex
+	times map[string][]time.Time
+}
+
+func (a *timedAPI) GetVacancyIDs(ctx context.Context, query api.SearchQuery, page int) (api.SearchResult, error) {
+	a.mu.Lock()
+	a.times[query.Role] = append(a.times[query.Role], time.Now())
+	a.mu.Unlock()
+	return a.fakeAPI.GetVacancyIDs(ctx, query, page)
+}
+
+func writeTargets(t *testing.T, targets string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "targets.yaml")
+	if err := os.WriteFile(path, []byte(targets), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestInterleaveTargets(t *testing.T) {
+	path := writeTargets(t, "targets:\n  - {name: dev, role: \"96\"}\n  - {name: qa, role: \"124\"}\n")
+	tests := []struct {
+		name        string
+		interleaved bool
+	}{
+		{"sequential", false},
+		{"interleaved", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := loadTestConfig(t, "--targets-file="+path, "--search-concurrency=1", fmt.Sprintf("--interleave-targets=%v", tt.interleaved))
+			client := newFakeAPI(6, 1)
+			p := newTestPipeline(t, cfg, client, newCountingStore())
+			if err := executeWithin(t, p, context.Background(), nil); err != nil {
+				t.Fatal(err)
+			}
+
+			var roles []string
+			for _, query := range client.queries {
+				roles = append(roles, query.Role)
+			}
+			if len(roles) != 12 {
+				t.Fatalf("%d searches, want 6 per target", len(roles))
+			}
+			// Sequential targets search every dev page before the first qa
+			// page; interleaved ones take turns for the single worker.
+			qaEarly := 0
+			for _, role := range roles[:6] {
+				if role == "124" {
+					qaEarly++
+				}
+			}
+			if tt.interleaved && qaEarly < 2 || !tt.interleaved && qaEarly != 0 {
+				t.Errorf("search order %v", roles)
+			}
+			for _, target := range p.targets {
+				if target.pagesDone() != 6 {
+					t.Errorf("target %s: %d pages done, want 6", target.name, target.pagesDone())
+				}
+			}
+		})
+	}
+}
+
+func TestTargetQPSCap(t *testing.T) {
+	path := writeTargets(t, "targets:\n  - {name: dev, role: \"96\", qps: 20}\n  - {name: qa, role: \"124\"}\n")
+	cfg := loadTestConfig(t, "--targets-file="+path, "--search-concurrency=2", "--interleave-targets")
+	client := &timedAPI{fakeAPI: newFakeAPI(4, 1), times: map[string][]time.Time{}}
+	p := newTestPipeline(t, cfg, client, newCountingStore())
+	if err := executeWithin(t, p, context.Background(), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	capped, free := client.times["96"], client.times["124"]
+	if len(capped) != 4 || len(free) != 4 {
+		t.Fatalf("%d and %d searches, want 4 per target", len(capped), len(free))
+	}
+	for i := 1; i < len(capped); i++ {
+		if gap := capped[i].Sub(capped[i-1]); gap < 45*time.Millisecond {
+			t.Errorf("capped target searched %v after its previous page, want about 50ms at 20 qps", gap)
+		}
+	}
+	if !free[len(free)-1].Before(capped[len(capped)-1]) {
+		t.Error("uncapped target was held back by the other target's cap")
+	}
+}
+
+func TestDeterministicOrdering(t *testing.T) {
+	run := func() string {
+		cfg := loadTestConfig(t, "--deterministic", "--detail-concurrency=8", "--search-concurrency=3")
+		client := newFakeAPI(3, 4)
+		client.detail = func(ctx context.Context, id string) (map[string]interface{}, error) {
+			// Later ids answer sooner, which reorders concurrent workers.
+			n, _ := strconv.Atoi(id)
+			time.Sleep(time.Duration(12-n) * time.Millisecond)
+			return testVacancy(id), nil
+		}
+		store := newCountingStore()
+		if err := executeWithin(t, newTestPipeline(t, cfg, client, store), context.Background(), nil); err != nil {
+			t.Fatal(err)
+		}
+		return strings.Join(store.upserts, ",")
+	}
+
+	first, second := run(), run()
+	if first != second {
+		t.Errorf("runs processed %s and %s, want the same order", first, second)
+	}
+	if want := "1,2,3,4,5,6,7,8,9,10,11,12"; first != want {
+		t.Errorf("processed %s, want %s", first, want)
+	}
+}
+
+func TestFirstSeenRunID(t *testing.T) {
+	for _, args := range [][]string{nil, {"--search-only"}} {
+		store := newCountingStore()
+		p := newTestPipeline(t, loadTestConfig(t, args...), newFakeAPI(1, 1), store)
+		p.runID = "run-1"
+		if err := executeWithin(t, p, context.Background(), nil); err != nil {
+			t.Fatal(err)
+		}
+		doc := store.docs["1"]
+		firstSeen, _ := doc["first_seen"].(time.Time)
+		if doc["first_seen_run_id"] != "run-1" || firstSeen.IsZero() || doc["last_seen"] != firstSeen {
+			t.Errorf("%v: first_seen %v, first_seen_run_id %v, last_seen %v", args, doc["first_seen"], doc["first_seen_run_id"], doc["last_seen"])
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"hh_it_scrapper/logger"
+)
+
+const (
+	progressBarWidth    = 30
+	progressTTYInterval = 200 * time.Millisecond
+	progressLogInterval = 30 * time.Second
+)
+
+type progressState struct {
+	pagesDone  int64
+	pagesTotal int64
+	attempted  int64
+	saved      int64
+	failed     int64
+	elapsed    time.Duration
+}
+
+func (s progressState) bar() string {
+	filled := 0
+	if s.pagesTotal > 0 {
+		filled = int(s.pagesDone * progressBarWidth / s.pagesTotal)
+		if filled > progressBarWidth {
+			filled = progressBarWidth
+		}
+	}
+	return "[" + strings.Repeat("=", filled) + strings.Repeat(" ", progressBarWidth-filled) + "]"
+}
+
+func (s progressState) String() string {
+	return fmt.Sprintf("%d/%d pages | %d vacancies (%d saved, %d failed) | %s",
+		s.pagesDone, s.pagesTotal, s.attempted, s.saved, s.failed, s.elapsed.Round(time.Second))
+}
+
+func (p *pipeline) progress(start time.Time) progressState {
+	return progressState{
+		pagesDone:  p.stats.PagesDone(),
+		pagesTotal: p.stats.PagesTotal(),
+		attempted:  p.stats.Attempted(),
+		saved:      p.stats.Saved(),
+		failed:     p.stats.Failed(),
+		elapsed:    time.Since(start),
+	}
+}
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// startProgress redraws a progress bar on out when it is a terminal and
+// otherwise logs the same numbers periodically. Logs go to files, so the
+// bar never interleaves with them. The returned func stops reporting.
+func startProgress(p *pipeline, out io.Writer, tty bool, logger *logger.AppLogger) func() {
+	start := time.Now()
+	interval := progressLogInterval
+	if tty {
+		interval = progressTTYInterval
+	}
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				if tty {
+					state := p.progress(start)
+					fmt.Fprintf(out, "\r%s %s\x1b[K\n", state.bar(), state)
+				}
+				return
+			case <-ticker.C:
+				state := p.progress(start)
+				if tty {
+					fmt.Fprintf(out, "\r%s %s\x1b[K", state.bar(), state)
+				} else {
+					logger.Info.Printf("Progress: %s", state)
+				}
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
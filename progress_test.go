@@ -0,0 +1,60 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"hh_it_scrapper/storage"
+)
+
+func TestProgressBar(t *testing.T) {
+	tests := []struct {
+		done, total int64
+		want        string
+	}{
+		{0, 0, "[" + strings.Repeat(" ", 30) + "]"},
+		{0, 10, "[" + strings.Repeat(" ", 30) + "]"},
+		{5, 10, "[" + strings.Repeat("=", 15) + strings.Repeat(" ", 15) + "]"},
+		{1, 3, "[" + strings.Repeat("=", 10) + strings.Repeat(" ", 20) + "]"},
+		{10, 10, "[" + strings.Repeat("=", 30) + "]"},
+		// Pages of later targets can push done past the first total.
+		{12, 10, "[" + strings.Repeat("=", 30) + "]"},
+	}
+	for _, tt := range tests {
+		if got := (progressState{pagesDone: tt.done, pagesTotal: tt.total}).bar(); got != tt.want {
+			t.Errorf("bar(%d/%d) = %q, want %q", tt.done, tt.total, got, tt.want)
+		}
+	}
+}
+
+func TestProgressString(t *testing.T) {
+	state := progressState{pagesDone: 3, pagesTotal: 20, attempted: 250, saved: 240, failed: 2, elapsed: 83400 * time.Millisecond}
+	if got, want := state.String(), "3/20 pages | 250 vacancies (240 saved, 2 failed) | 1m23s"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+}
+
+func TestProgressFinalLine(t *testing.T) {
+	cfg := loadTestConfig(t)
+	p := newTestPipeline(t, cfg, newFakeAPI(0, 0), storage.NewMemoryStore())
+	p.stats.AddSearchTotals(80, 4)
+	for i := 0; i < 4; i++ {
+		p.stats.IncPagesDone()
+	}
+
+	var out bytes.Buffer
+	stop := startProgress(p, &out, true, testLogger())
+	stop()
+	if got := out.String(); !strings.HasPrefix(got, "\r["+strings.Repeat("=", 30)+"] 4/4 pages") || !strings.HasSuffix(got, "\x1b[K\n") {
+		t.Errorf("final TTY line = %q", got)
+	}
+
+	out.Reset()
+	stop = startProgress(p, &out, false, testLogger())
+	stop()
+	if out.Len() != 0 {
+		t.Errorf("non-TTY progress wrote to the terminal: %q", out.String())
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const rampPollInterval = 50 * time.Millisecond
+
+// concurrencyRamp limits how many detail workers may run at once, growing
+// linearly from start to max over warmup. A rate limit restarts the ramp
+// from half the current limit.
+type concurrencyRamp struct {
+	max    int
+	warmup time.Duration
+	now    func() time.Time
+
+	mu     sync.Mutex
+	base   int
+	since  time.Time
+	active int
+}
+
+func newConcurrencyRamp(start, max int, warmup time.Duration) *concurrencyRamp {
+	if start < 1 {
+		start = 1
+	}
+	if start > max {
+		start = max
+	}
+	return &concurrencyRamp{max: max, warmup: warmup, now: time.Now, base: start, since: time.Now()}
+}
+
+func (r *concurrencyRamp) limit() int {
+	elapsed := r.now().Sub(r.since)
+	if r.warmup <= 0 || elapsed >= r.warmup {
+		return r.max
+	}
+	return r.base + int(int64(r.max-r.base)*int64(elapsed)/int64(r.warmup))
+}
+
+func (r *concurrencyRamp) acquire(ctx context.Context) error {
+	for {
+		r.mu.Lock()
+		if r.active < r.limit() {
+			r.active++
+			r.mu.Unlock()
+			return nil
+		}
+		r.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(rampPollInterval):
+		}
+	}
+}
+
+func (r *concurrencyRamp) release() {
+	r.mu.Lock()
+	r.active--
+	r.mu.Unlock()
+}
+
+func (r *concurrencyRamp) backOff() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.base = r.limit() / 2
+	if r.base < 1 {
+		r.base = 1
+	}
+	r.since = r.now()
+}
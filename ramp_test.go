@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"hh_it_scrapper/storage"
+)
+
+// rampClock is a settable clock for concurrencyRamp.
+type rampClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *rampClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *rampClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	c.mu.Unlock()
+}
+
+func newTestRamp(start, max int, warmup time.Duration) (*concurrencyRamp, *rampClock) {
+	clock := &rampClock{now: time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)}
+	r := newConcurrencyRamp(start, max, warmup)
+	r.now, r.since = clock.Now, clock.Now()
+	return r, clock
+}
+
+func TestRampLimitGrows(t *testing.T) {
+	r, clock := newTestRamp(2, 10, 8*time.Second)
+	for _, want := range []int{2, 4, 6, 8, 10, 10} {
+		if got := r.limit(); got != want {
+			t.Errorf("limit after %v = %d, want %d", clock.Now().Sub(r.since), got, want)
+		}
+		clock.Advance(2 * time.Second)
+	}
+}
+
+func TestRampAcquireWaitsForLimit(t *testing.T) {
+	r, clock := newTestRamp(2, 4, 4*time.Second)
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		if err := r.acquire(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	short, cancel := context.WithTimeout(ctx, 3*rampPollInterval)
+	defer cancel()
+	if err := r.acquire(short); err == nil {
+		t.Fatal("third worker started before the ramp allowed it")
+	}
+
+	acquired := make(chan error, 1)
+	go func() { acquired <- r.acquire(ctx) }()
+	clock.Advance(2 * time.Second)
+	select {
+	case err := <-acquired:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("third worker did not start once the limit grew")
+	}
+
+	r.release()
+	if r.active != 2 {
+		t.Errorf("active = %d after a release, want 2", r.active)
+	}
+}
+
+func TestRampBacksOff(t *testing.T) {
+	r, clock := newTestRamp(2, 10, 8*time.Second)
+	clock.Advance(4 * time.Second)
+	r.backOff()
+	if got := r.limit(); got != 3 {
+		t.Errorf("limit after backing off from 6 = %d, want 3", got)
+	}
+	clock.Advance(8 * time.Second)
+	if got := r.limit(); got != 10 {
+		t.Errorf("limit after a full warm-up = %d, want 10", got)
+	}
+
+	r, _ = newTestRamp(1, 10, 8*time.Second)
+	r.backOff()
+	if got := r.limit(); got != 1 {
+		t.Errorf("backed off below one worker: limit %d", got)
+	}
+}
+
+func TestRampStartClamped(t *testing.T) {
+	if r, _ := newTestRamp(0, 10, time.Second); r.limit() != 1 {
+		t.Errorf("start 0: limit %d, want 1", r.limit())
+	}
+	if r, _ := newTestRamp(20, 10, time.Second); r.limit() != 10 {
+		t.Errorf("start 20: limit %d, want the max 10", r.limit())
+	}
+	if r, _ := newTestRamp(2, 10, 0); r.limit() != 10 {
+		t.Errorf("no warm-up: limit %d, want 10", r.limit())
+	}
+}
+
+func TestRampLimitsDetailWorkers(t *testing.T) {
+	cfg := loadTestConfig(t, "--ramp-up=1h", "--ramp-start=1", "--detail-concurrency=4")
+	client := newFakeAPI(1, 6)
+	var details peakCounter
+	client.detail = func(ctx context.Context, id string) (map[string]interface{}, error) {
+		details.hold(2 * time.Millisecond)
+		return testVacancy(id), nil
+	}
+	p := newTestPipeline(t, cfg, client, storage.NewMemoryStore())
+	if err := executeWithin(t, p, context.Background(), nil); err != nil {
+		t.Fatal(err)
+	}
+	if details.max() != 1 || p.stats.Saved() != 6 {
+		t.Errorf("%d detail requests in flight, %d saved, want 1 at a time early in the ramp and all 6 saved", details.max(), p.stats.Saved())
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+const (
+	rawModeJSON = "json"
+	rawModeGzip = "gzip"
+
+	// maxRawBytes keeps the raw copy well under MongoDB's 16MB document
+	// limit, leaving room for the parsed fields next to it.
+	maxRawBytes = 8 << 20
+)
+
+// encodeRaw serializes the untouched API payload for the raw field: a JSON
+// string, or gzipped JSON bytes. It returns nil when the encoded payload is
+// too large to store.
+func encodeRaw(data map[string]interface{}, mode string) (interface{}, error) {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if mode == rawModeGzip {
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		if _, err := gz.Write(encoded); err != nil {
+			return nil, err
+		}
+		if err := gz.Close(); err != nil {
+			return nil, err
+		}
+		if buf.Len() > maxRawBytes {
+			return nil, nil
+		}
+		return buf.Bytes(), nil
+	}
+
+	if len(encoded) > maxRawBytes {
+		return nil, nil
+	}
+	return string(encoded), nil
+}
+
+// decodeRaw parses a raw field written by encodeRaw in either mode.
+func decodeRaw(raw interface{}) (map[string]interface{}, error) {
+	var encoded []byte
+	switch v := raw.(type) {
+	case string:
+		encoded = []byte(v)
+	case []byte:
+		gz, err := gzip.NewReader(bytes.NewReader(v))
+		if err != nil {
+			return nil, fmt.Errorf("raw payload is not gzip: %w", err)
+		}
+		defer gz.Close()
+		if encoded, err = io.ReadAll(gz); err != nil {
+			return nil, fmt.Errorf("failed to decompress raw payload: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("unexpected raw payload type %T", raw)
+	}
+
+	var data map[string]interface{}
+	if err := json.Unmarshal(encoded, &data); err != nil {
+		return nil, fmt.Errorf("failed to parse raw payload: %w", err)
+	}
+	return data, nil
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEncodeRawRoundTrip(t *testing.T) {
+	payload := testVacancy("101")
+	payload["key_skills"] = []interface{}{map[string]interface{}{"name": "Go"}}
+	for _, mode := range []string{rawModeJSON, rawModeGzip} {
+		raw, err := encodeRaw(payload, mode)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, isString := raw.(string); isString != (mode == rawModeJSON) {
+			t.Errorf("%s: raw stored as %T", mode, raw)
+		}
+		decoded, err := decodeRaw(raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(decoded, payload) {
+			t.Errorf("%s: decoded %v, want %v", mode, decoded, payload)
+		}
+	}
+}
+
+func TestEncodeRawSizeLimit(t *testing.T) {
+	payload := map[string]interface{}{"id": "101", "description": strings.Repeat("x", maxRawBytes)}
+	if raw, err := encodeRaw(payload, rawModeJSON); raw != nil || err != nil {
+		t.Errorf("oversized JSON payload = %T, %v, want nothing stored", raw, err)
+	}
+	// The same payload compresses well below the limit.
+	if raw, err := encodeRaw(payload, rawModeGzip); raw == nil || err != nil {
+		t.Errorf("compressible payload = %T, %v, want it stored", raw, err)
+	}
+}
+
+func TestDecodeRawErrors(t *testing.T) {
+	for _, raw := range []interface{}{"{not json", []byte("not gzip"), 42} {
+		if _, err := decodeRaw(raw); err == nil {
+			t.Errorf("decodeRaw(%v) accepted", raw)
+		}
+	}
+}
+
+func TestStoreRawRoundTripsThroughReprocess(t *testing.T) {
+	cfg := loadTestConfig(t, "--store-raw=gzip")
+	client := newFakeAPI(1, 2)
+	client.detail = func(ctx context.Context, id string) (map[string]interface{}, error) {
+		data := testVacancy(id)
+		data["salary"] = map[string]interface{}{"from": 100000.0, "to": 200000.0, "currency": "RUR"}
+		return data, nil
+	}
+	fetched := newCountingStore()
+	if err := executeWithin(t, newTestPipeline(t, cfg, client, fetched), context.Background(), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	var seeded []map[string]interface{}
+	for id, doc := range fetched.docs {
+		payload, err := decodeRaw(doc["raw"])
+		if err != nil {
+			t.Fatalf("vacancy %s raw: %v", id, err)
+		}
+		if payload["description"] != testVacancy(id)["description"] || payload["salary_mid_num"] != nil {
+			t.Errorf("vacancy %s raw is not the untouched payload: %v", id, payload)
+		}
+		// Only the id and raw payload survive, as if the derived fields
+		// had never been stored.
+		seeded = append(seeded, map[string]interface{}{"id": id, "raw": doc["raw"]})
+	}
+
+	store := &scanStore{countingStore: newCountingStore(), seeded: seeded}
+	p := newTestPipeline(t, loadTestConfig(t, "--reprocess"), newFakeAPI(0, 0), store)
+	if err := executeWithin(t, p, context.Background(), nil); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"1", "2"} {
+		doc := store.docs[id]
+		if doc == nil || doc["salary_mid_num"] != 150000.0 || doc["name"] != "Vacancy "+id {
+			t.Errorf("vacancy %s not rebuilt from its raw payload: %v", id, doc)
+		}
+	}
+}
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestNewRunID(t *testing.T) {
+	uuid := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	seen := map[string]bool{}
+	for i := 0; i < 100; i++ {
+		id := newRunID()
+		if !uuid.MatchString(id) {
+			t.Fatalf("run id %q is not a version 4 UUID", id)
+		}
+		if seen[id] {
+			t.Fatalf("run id %q repeated", id)
+		}
+		seen[id] = true
+	}
+}
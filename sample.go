@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"time"
+
+	"hh_it_scrapper/storage"
+)
+
+// runSample implements "sample [-n 10] [--from DATE] [--to DATE] [--role ID]
+// [--seed N]", printing random stored vacancies as indented JSON.
+func runSample(args []string) int {
+	fs := flag.NewFlagSet("sample", flag.ContinueOnError)
+	n := fs.Int("n", 10, "Number of vacancies to return")
+	from := fs.String("from", "", "Only vacancies published on or after this date (YYYY-MM-DD)")
+	to := fs.String("to", "", "Only vacancies published before this date (YYYY-MM-DD)")
+	role := fs.String("role", "", "Only vacancies with this professional role id")
+	seed := fs.Int64("seed", 0, "Pick the sample client-side with this seed for reproducible output (0 uses $sample)")
+	timeout := fs.Duration("timeout", time.Minute, "Timeout for the whole command")
+	if err := fs.Parse(args); err != nil {
+		return exitConfigError
+	}
+	if *n < 1 {
+		log.Print("-n must be at least 1")
+		return exitConfigError
+	}
+
+	mongoURI := os.Getenv("MONGO_URI")
+	if mongoURI == "" {
+		log.Print("MONGO_URI must be provided")
+		return exitConfigError
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	mongoStore, err := storage.NewMongoStore(mongoURI, "vacancy_db", "vacancies")
+	if err != nil {
+		log.Print(err)
+		return exitDBError
+	}
+	defer mongoStore.Collection.Database().Client().Disconnect(context.Background())
+
+	var rng *rand.Rand
+	if *seed != 0 {
+		rng = rand.New(rand.NewSource(*seed))
+	}
+	filter := storage.SampleFilter{PublishedFrom: *from, PublishedTo: *to, Role: *role}
+	docs, err := mongoStore.Sample(ctx, filter, *n, rng)
+	if err != nil {
+		log.Print(err)
+		return exitDBError
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	for _, doc := range docs {
+		if err := enc.Encode(doc); err != nil {
+			log.Print(err)
+			return exitConfigError
+		}
+	}
+	fmt.Fprintf(os.Stderr, "%d vacancies sampled\n", len(docs))
+	return exitOK
+}
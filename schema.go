@@ -0,0 +1,38 @@
+package main
+
+import "hh_it_scrapper/transform"
+
+// schemaVersion tags stored documents with the shape deriveFields produces,
+// so later migrations can tell old documents apart. Bump it whenever the
+// canonical fields or derived fields change; it is part of the content
+// hash, so the next refresh then rewrites every vacancy.
+const schemaVersion = 1
+
+// canonicalFields are present in every stored document; fields the API
+// left out are stored as null rather than missing.
+var canonicalFields = []string{
+	"id",
+	"name",
+	"url",
+	"published_at",
+	"archived",
+	"area",
+	"employer",
+	"salary",
+	"professional_roles",
+	"key_skills",
+	"description_hash",
+	"content_hash",
+	"source_query",
+}
+
+// applySchema runs after the field map, so canonical fields are looked up
+// and filled under their mapped names.
+func applySchema(data map[string]interface{}, fieldMap transform.FieldMap) {
+	fieldMap.FillMissing(data, canonicalFields)
+	data["schema_version"] = schemaVersion
+}
+
+func fillCanonicalFields(data map[string]interface{}) {
+	transform.FieldMap(nil).FillMissing(data, canonicalFields)
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"hh_it_scrapper/transform"
+)
+
+func TestApplySchema(t *testing.T) {
+	data := map[string]interface{}{"id": "1", "name": "Go developer", "custom": true}
+	applySchema(data, nil)
+
+	for _, field := range canonicalFields {
+		if _, ok := data[field]; !ok {
+			t.Errorf("canonical field %s missing", field)
+		}
+	}
+	if data["name"] != "Go developer" || data["custom"] != true {
+		t.Errorf("existing fields changed: %v", data)
+	}
+	if data["salary"] != nil {
+		t.Errorf("missing salary = %v, want null", data["salary"])
+	}
+	if data["schema_version"] != schemaVersion {
+		t.Errorf("schema_version = %v, want %d", data["schema_version"], schemaVersion)
+	}
+}
+
+func TestApplySchemaUsesMappedNames(t *testing.T) {
+	fieldMap, err := transform.ParseFieldMap("name=title,key_skills=skills")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := map[string]interface{}{"id": "1", "name": "Go developer"}
+	fieldMap.Apply(data)
+	applySchema(data, fieldMap)
+
+	if data["title"] != "Go developer" {
+		t.Errorf("title = %v, want the mapped name", data["title"])
+	}
+	if _, ok := data["skills"]; !ok {
+		t.Error("mapped canonical field skills missing")
+	}
+	for _, field := range []string{"name", "key_skills"} {
+		if _, ok := data[field]; ok {
+			t.Errorf("canonical field %s filled under its unmapped name", field)
+		}
+	}
+}
+
+func TestStoredDocumentsAreCanonical(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{"details", nil},
+		{"search only", []string{"--search-only"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := loadTestConfig(t, tt.args...)
+			store := newCountingStore()
+			p := newTestPipeline(t, cfg, newFakeAPI(1, 2), store)
+			if err := executeWithin(t, p, context.Background(), nil); err != nil {
+				t.Fatal(err)
+			}
+
+			if len(store.docs) != 2 {
+				t.Fatalf("%d documents stored, want 2", len(store.docs))
+			}
+			for id, doc := range store.docs {
+				for _, field := range canonicalFields {
+					if _, ok := doc[field]; !ok {
+						t.Errorf("vacancy %s: canonical field %s missing", id, field)
+					}
+				}
+				if doc["schema_version"] != schemaVersion {
+					t.Errorf("vacancy %s: schema_version = %v, want %d", id, doc["schema_version"], schemaVersion)
+				}
+				if doc["id"] != id || doc["source_query"] == nil {
+					t.Errorf("vacancy %s: id %v, source_query %v", id, doc["id"], doc["source_query"])
+				}
+			}
+		})
+	}
+}
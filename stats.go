@@ -0,0 +1,56 @@
+package main
+
+import "sync/atomic"
+
+// RunStats holds the counters of one run. Workers update it concurrently;
+// every method is safe for concurrent use.
+type RunStats struct {
+	attempted    int64
+	saved        int64
+	failed       int64
+	duplicates   int64
+	unchanged    int64
+	outOfWindow  int64
+	deadLettered int64
+	overflowed   int64
+	flushed      int64
+	seen         int64
+	found        int64
+	pagesDone    int64
+	pagesTotal   int64
+}
+
+func (s *RunStats) IncAttempted()    { atomic.AddInt64(&s.attempted, 1) }
+func (s *RunStats) IncSaved()        { atomic.AddInt64(&s.saved, 1) }
+func (s *RunStats) IncFailed()       { atomic.AddInt64(&s.failed, 1) }
+func (s *RunStats) IncDuplicate()    { atomic.AddInt64(&s.duplicates, 1) }
+func (s *RunStats) IncUnchanged()    { atomic.AddInt64(&s.unchanged, 1) }
+func (s *RunStats) IncOutOfWindow()  { atomic.AddInt64(&s.outOfWindow, 1) }
+func (s *RunStats) IncDeadLettered() { atomic.AddInt64(&s.deadLettered, 1) }
+func (s *RunStats) IncOverflowed()   { atomic.AddInt64(&s.overflowed, 1) }
+func (s *RunStats) IncSeen()         { atomic.AddInt64(&s.seen, 1) }
+func (s *RunStats) IncPagesDone()    { atomic.AddInt64(&s.pagesDone, 1) }
+
+// AddSearchTotals records the totals the API reports on a target's first
+// search page.
+func (s *RunStats) AddSearchTotals(found, pages int) {
+	atomic.AddInt64(&s.found, int64(found))
+	atomic.AddInt64(&s.pagesTotal, int64(pages))
+}
+
+// SetFlushed records n buffered vacancies written on shutdown.
+func (s *RunStats) SetFlushed(n int) { atomic.StoreInt64(&s.flushed, int64(n)) }
+
+func (s *RunStats) Attempted() int64    { return atomic.LoadInt64(&s.attempted) }
+func (s *RunStats) Saved() int64        { return atomic.LoadInt64(&s.saved) }
+func (s *RunStats) Failed() int64       { return atomic.LoadInt64(&s.failed) }
+func (s *RunStats) Duplicates() int64   { return atomic.LoadInt64(&s.duplicates) }
+func (s *RunStats) Unchanged() int64    { return atomic.LoadInt64(&s.unchanged) }
+func (s *RunStats) OutOfWindow() int64  { return atomic.LoadInt64(&s.outOfWindow) }
+func (s *RunStats) DeadLettered() int64 { return atomic.LoadInt64(&s.deadLettered) }
+func (s *RunStats) Overflowed() int64   { return atomic.LoadInt64(&s.overflowed) }
+func (s *RunStats) Flushed() int64      { return atomic.LoadInt64(&s.flushed) }
+func (s *RunStats) Seen() int64         { return atomic.LoadInt64(&s.seen) }
+func (s *RunStats) Found() int64        { return atomic.LoadInt64(&s.found) }
+func (s *RunStats) PagesDone() int64    { return atomic.LoadInt64(&s.pagesDone) }
+func (s *RunStats) PagesTotal() int64   { return atomic.LoadInt64(&s.pagesTotal) }
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestRunStatsConcurrentIncrements(t *testing.T) {
+	const workers, perWorker = 16, 1000
+	var stats RunStats
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < perWorker; i++ {
+				stats.IncAttempted()
+				stats.IncSaved()
+				stats.IncFailed()
+				stats.IncDuplicate()
+				stats.IncUnchanged()
+				stats.IncOutOfWindow()
+				stats.IncDeadLettered()
+				stats.IncOverflowed()
+				stats.IncSeen()
+				stats.IncPagesDone()
+			}
+			stats.AddSearchTotals(10, 2)
+		}()
+	}
+	wg.Wait()
+
+	const want = workers * perWorker
+	for name, got := range map[string]int64{
+		"attempted":     stats.Attempted(),
+		"saved":         stats.Saved(),
+		"failed":        stats.Failed(),
+		"duplicates":    stats.Duplicates(),
+		"unchanged":     stats.Unchanged(),
+		"out of window": stats.OutOfWindow(),
+		"dead lettered": stats.DeadLettered(),
+		"overflowed":    stats.Overflowed(),
+		"seen":          stats.Seen(),
+		"pages done":    stats.PagesDone(),
+	} {
+		if got != want {
+			t.Errorf("%s = %d, want %d", name, got, want)
+		}
+	}
+	if stats.Found() != 10*workers || stats.PagesTotal() != 2*workers {
+		t.Errorf("found %d, pages total %d, want %d and %d", stats.Found(), stats.PagesTotal(), 10*workers, 2*workers)
+	}
+}
+
+func TestRunStatsSetFlushed(t *testing.T) {
+	var stats RunStats
+	stats.SetFlushed(3)
+	stats.SetFlushed(5)
+	if stats.Flushed() != 5 {
+		t.Errorf("flushed = %d, want the last value 5", stats.Flushed())
+	}
+}
@@ -0,0 +1,101 @@
+package storage
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const flushTimeout = 30 * time.Second
+
+// BatchWriter buffers upserts and writes them to the underlying MongoStore in
+// bulk once size documents are pending. Callers must Flush before exiting so
+// that a partially filled batch is not lost. UpsertVacancy returning nil
+// only means the document was buffered; the function passed to NotifyWrites
+// learns when it was actually written.
+type BatchWriter struct {
+	*MongoStore
+	size    int
+	mu      sync.Mutex
+	pending []map[string]interface{}
+	notify  func(data map[string]interface{}, err error)
+}
+
+func NewBatchWriter(store *MongoStore, size int) *BatchWriter {
+	return &BatchWriter{
+		MongoStore: store,
+		size:       size,
+		pending:    make([]map[string]interface{}, 0, size),
+	}
+}
+
+func (w *BatchWriter) NotifyWrites(fn func(data map[string]interface{}, err error)) bool {
+	w.notify = fn
+	return true
+}
+
+// UpsertVacancy flushes the batch once it is full. If that write fails, the
+// rest of the batch is requeued but data is not: the error is returned for
+// it, and the caller decides whether to upsert it again.
+func (w *BatchWriter) UpsertVacancy(data map[string]interface{}) error {
+	w.mu.Lock()
+	w.pending = append(w.pending, data)
+	if len(w.pending) < w.size {
+		w.mu.Unlock()
+		return nil
+	}
+	batch := w.pending
+	w.pending = make([]map[string]interface{}, 0, w.size)
+	w.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), flushTimeout)
+	defer cancel()
+	if err := w.write(ctx, batch); err != nil {
+		w.requeue(batch[:len(batch)-1])
+		return err
+	}
+	return nil
+}
+
+func (w *BatchWriter) Flush(ctx context.Context) error {
+	w.mu.Lock()
+	batch := w.pending
+	w.pending = make([]map[string]interface{}, 0, w.size)
+	w.mu.Unlock()
+
+	if err := w.write(ctx, batch); err != nil {
+		w.requeue(batch)
+		return err
+	}
+	return nil
+}
+
+func (w *BatchWriter) write(ctx context.Context, batch []map[string]interface{}) error {
+	rejected, err := w.bulkUpsert(ctx, batch)
+	if err != nil {
+		return err
+	}
+	if w.notify == nil {
+		return nil
+	}
+	for i, data := range batch {
+		if rejected[i] {
+			w.notify(data, ErrDuplicateDescription)
+		} else {
+			w.notify(data, nil)
+		}
+	}
+	return nil
+}
+
+func (w *BatchWriter) requeue(batch []map[string]interface{}) {
+	w.mu.Lock()
+	w.pending = append(batch, w.pending...)
+	w.mu.Unlock()
+}
+
+func (w *BatchWriter) Pending() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return len(w.pending)
+}
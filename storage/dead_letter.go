@@ -0,0 +1,67 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type DeadLetter struct {
+	VacancyID string    `bson:"vacancy_id" json:"vacancy_id"`
+	Reason    string    `bson:"reason" json:"reason"`
+	Raw       string    `bson:"raw" json:"raw"`
+	RunID     string    `bson:"run_id" json:"run_id"`
+	FailedAt  time.Time `bson:"failed_at" json:"failed_at"`
+}
+
+type DeadLetterQueue interface {
+	Add(ctx context.Context, letter DeadLetter) error
+	Close() error
+}
+
+type MongoDeadLetters struct {
+	Collection *mongo.Collection
+}
+
+func (q *MongoDeadLetters) Add(ctx context.Context, letter DeadLetter) error {
+	if _, err := q.Collection.InsertOne(ctx, letter); err != nil {
+		return fmt.Errorf("failed to insert dead letter: %w", err)
+	}
+	return nil
+}
+
+func (q *MongoDeadLetters) Close() error {
+	return nil
+}
+
+type FileDeadLetters struct {
+	mu   sync.Mutex
+	file *os.File
+	enc  *json.Encoder
+}
+
+func NewFileDeadLetters(path string) (*FileDeadLetters, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0666)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open dead-letter file: %w", err)
+	}
+	return &FileDeadLetters{file: file, enc: json.NewEncoder(file)}, nil
+}
+
+func (q *FileDeadLetters) Add(_ context.Context, letter DeadLetter) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if err := q.enc.Encode(letter); err != nil {
+		return fmt.Errorf("failed to write dead letter: %w", err)
+	}
+	return nil
+}
+
+func (q *FileDeadLetters) Close() error {
+	return q.file.Close()
+}
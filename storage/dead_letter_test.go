@@ -0,0 +1,77 @@
+package storage
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestFileDeadLetters(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dlq.jsonl")
+	failedAt := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	// Each run appends to the file.
+	for _, id := range []string{"1", "2"} {
+		q, err := NewFileDeadLetters(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		letter := DeadLetter{VacancyID: id, Reason: "invalid description", Raw: `{"id":"` + id + `"}`, RunID: "run-1", FailedAt: failedAt}
+		if err := q.Add(context.Background(), letter); err != nil {
+			t.Fatal(err)
+		}
+		if err := q.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	var letters []DeadLetter
+	for scanner := bufio.NewScanner(file); scanner.Scan(); {
+		var letter DeadLetter
+		if err := json.Unmarshal(scanner.Bytes(), &letter); err != nil {
+			t.Fatalf("line %q: %v", scanner.Text(), err)
+		}
+		letters = append(letters, letter)
+	}
+	if len(letters) != 2 || letters[0].VacancyID != "1" || letters[1].VacancyID != "2" {
+		t.Fatalf("letters = %+v, want vacancies 1 and 2", letters)
+	}
+	if got := letters[1]; got.Reason != "invalid description" || got.Raw != `{"id":"2"}` || got.RunID != "run-1" || !got.FailedAt.Equal(failedAt) {
+		t.Errorf("letter = %+v", got)
+	}
+}
+
+func TestMongoDeadLetters(t *testing.T) {
+	withMockStore(t, func(mt *mtest.T, s *MongoStore) {
+		t := mt.T
+		q := &MongoDeadLetters{Collection: mt.DB.Collection("dead_letters")}
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}), errorReply)
+
+		if err := q.Add(context.Background(), DeadLetter{VacancyID: "1", Reason: "bad JSON", Raw: "{"}); err != nil {
+			t.Fatal(err)
+		}
+		sent := mt.GetStartedEvent().Command
+		if coll := sent.Lookup("insert").StringValue(); coll != "dead_letters" {
+			t.Errorf("inserted into %q, want dead_letters", coll)
+		}
+		doc := sent.Lookup("documents").Array().Index(0).Value().Document()
+		if doc.Lookup("vacancy_id").StringValue() != "1" || doc.Lookup("reason").StringValue() != "bad JSON" || doc.Lookup("raw").StringValue() != "{" {
+			t.Errorf("dead letter document = %v", doc)
+		}
+
+		if err := q.Add(context.Background(), DeadLetter{VacancyID: "2"}); err == nil {
+			t.Error("failed insert not reported")
+		}
+	})
+}
@@ -0,0 +1,84 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// ExportFilter narrows Export to a subset of the stored vacancies. Empty
+// fields match all.
+type ExportFilter struct {
+	Area          string
+	Currency      string
+	MinSalary     int
+	Role          string
+	PublishedFrom string
+	PublishedTo   string
+}
+
+// ParseExportFilter parses "key=value" pairs separated by commas, e.g.
+// "area=1,currency=RUR,min-salary=200000,from=2024-01-01,to=2024-07-01".
+func ParseExportFilter(expr string) (ExportFilter, error) {
+	var filter ExportFilter
+	for _, pair := range strings.Split(expr, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(pair, "=")
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		if !ok || value == "" {
+			return ExportFilter{}, fmt.Errorf("invalid filter %q, expected key=value", pair)
+		}
+		switch key {
+		case "area":
+			filter.Area = value
+		case "currency":
+			filter.Currency = value
+		case "min-salary":
+			salary, err := strconv.Atoi(value)
+			if err != nil || salary < 0 {
+				return ExportFilter{}, fmt.Errorf("invalid min-salary %q", value)
+			}
+			filter.MinSalary = salary
+		case "role":
+			filter.Role = value
+		case "from":
+			filter.PublishedFrom = value
+		case "to":
+			filter.PublishedTo = value
+		default:
+			return ExportFilter{}, fmt.Errorf("unknown filter key %q (want area, currency, min-salary, role, from or to)", key)
+		}
+	}
+	return filter, nil
+}
+
+// Query translates the filter into a MongoDB query. min-salary matches when
+// either bound of the offered range reaches it; from/to compare against
+// published_at as in [from, to).
+func (f ExportFilter) Query() bson.M {
+	query := SampleFilter{PublishedFrom: f.PublishedFrom, PublishedTo: f.PublishedTo, Role: f.Role}.query()
+	if f.Area != "" {
+		query["area.id"] = f.Area
+	}
+	if f.Currency != "" {
+		query["salary.currency"] = f.Currency
+	}
+	if f.MinSalary > 0 {
+		query["$or"] = bson.A{
+			bson.M{"salary.from": bson.M{"$gte": f.MinSalary}},
+			bson.M{"salary.to": bson.M{"$gte": f.MinSalary}},
+		}
+	}
+	return query
+}
+
+// Export calls fn for every stored vacancy matching filter.
+func (s *MongoStore) Export(ctx context.Context, filter ExportFilter, fn func(data map[string]interface{}) error) error {
+	return s.eachMatching(ctx, filter.Query(), fn)
+}
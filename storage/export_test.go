@@ -0,0 +1,82 @@
+package storage
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestParseExportFilter(t *testing.T) {
+	filter, err := ParseExportFilter(" area=1, currency=RUR,min-salary=200000,role=96,from=2024-01-01,to=2024-07-01,")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := ExportFilter{Area: "1", Currency: "RUR", MinSalary: 200000, Role: "96", PublishedFrom: "2024-01-01", PublishedTo: "2024-07-01"}
+	if filter != want {
+		t.Errorf("filter = %+v, want %+v", filter, want)
+	}
+	if filter, err := ParseExportFilter(""); err != nil || filter != (ExportFilter{}) {
+		t.Errorf("empty filter = %+v, %v", filter, err)
+	}
+
+	for expr, want := range map[string]string{
+		"city=1":         `unknown filter key "city"`,
+		"area":           `invalid filter "area"`,
+		"area=":          `invalid filter "area="`,
+		"min-salary=lot": `invalid min-salary "lot"`,
+		"min-salary=-1":  `invalid min-salary "-1"`,
+	} {
+		if _, err := ParseExportFilter(expr); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("ParseExportFilter(%q) error = %v, want %s", expr, err, want)
+		}
+	}
+}
+
+func TestExportFilterQuery(t *testing.T) {
+	filter := ExportFilter{Area: "1", Currency: "RUR", MinSalary: 200000, Role: "96", PublishedFrom: "2024-01-01", PublishedTo: "2024-07-01"}
+	want := bson.M{
+		"area.id":               "1",
+		"salary.currency":       "RUR",
+		"professional_roles.id": "96",
+		"published_at":          bson.M{"$gte": "2024-01-01", "$lt": "2024-07-01"},
+		"$or": bson.A{
+			bson.M{"salary.from": bson.M{"$gte": 200000}},
+			bson.M{"salary.to": bson.M{"$gte": 200000}},
+		},
+	}
+	if got := filter.Query(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Query = %v, want %v", got, want)
+	}
+	if got := (ExportFilter{}).Query(); len(got) != 0 {
+		t.Errorf("empty filter query = %v, want all documents", got)
+	}
+}
+
+func TestExport(t *testing.T) {
+	withMockStore(t, func(mt *mtest.T, s *MongoStore) {
+		t := mt.T
+		mt.AddMockResponses(cursorReply(
+			bson.D{{Key: "_id", Value: 1}, {Key: "id", Value: "101"}, {Key: "area", Value: bson.D{{Key: "id", Value: "1"}}}},
+			bson.D{{Key: "_id", Value: 2}, {Key: "id", Value: "102"}, {Key: "area", Value: bson.D{{Key: "id", Value: "1"}}}},
+		))
+		var exported []string
+		err := s.Export(context.Background(), ExportFilter{Area: "1"}, func(data map[string]interface{}) error {
+			exported = append(exported, data["id"].(string))
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Join(exported, ",") != "101,102" {
+			t.Errorf("exported %v", exported)
+		}
+		filter := mt.GetStartedEvent().Command.Lookup("filter").Document()
+		if area := filter.Lookup("area.id").StringValue(); area != "1" {
+			t.Errorf("find filter = %v, want area.id 1", filter)
+		}
+	})
+}
@@ -0,0 +1,51 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// FileStore appends every upserted vacancy to a JSONL file. It keeps no
+// index, so it is meant to be a secondary sink behind a MultiStore.
+type FileStore struct {
+	mu     sync.Mutex
+	file   *os.File
+	enc    *json.Encoder
+	hashes sync.Map
+}
+
+func NewFileStore(path string) (*FileStore, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0666)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open sink file: %w", err)
+	}
+	return &FileStore{file: file, enc: json.NewEncoder(file)}, nil
+}
+
+func (s *FileStore) VacancyExists(id string) bool {
+	return false
+}
+
+func (s *FileStore) DescriptionHashExists(hash string) bool {
+	_, ok := s.hashes.Load(hash)
+	return ok
+}
+
+func (s *FileStore) AddDescriptionHash(hash string) {
+	s.hashes.Store(hash, true)
+}
+
+func (s *FileStore) UpsertVacancy(data map[string]interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.enc.Encode(data); err != nil {
+		return fmt.Errorf("failed to write vacancy to file: %w", err)
+	}
+	return nil
+}
+
+func (s *FileStore) Close() error {
+	return s.file.Close()
+}
@@ -0,0 +1,28 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// ErrLocked is returned by AcquireLock when another process holds the lock.
+var ErrLocked = errors.New("lock is held by another process")
+
+// AcquireLock takes an advisory lock by creating path exclusively. The
+// returned func removes it. A lock left behind by a crashed process has to
+// be deleted by hand; it records the holder's pid to make that easy.
+func AcquireLock(path string) (func(), error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if errors.Is(err, os.ErrExist) {
+		holder, _ := os.ReadFile(path)
+		return nil, fmt.Errorf("%s (pid %s): %w", path, holder, ErrLocked)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create lock file: %w", err)
+	}
+	file.WriteString(strconv.Itoa(os.Getpid()))
+	file.Close()
+	return func() { os.Remove(path) }, nil
+}
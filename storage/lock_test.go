@@ -0,0 +1,33 @@
+package storage
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestAcquireLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.lock")
+	release, err := AcquireLock(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if holder, _ := os.ReadFile(path); string(holder) != strconv.Itoa(os.Getpid()) {
+		t.Errorf("lock holder = %q, want this pid", holder)
+	}
+
+	_, err = AcquireLock(path)
+	if !errors.Is(err, ErrLocked) || !strings.Contains(err.Error(), strconv.Itoa(os.Getpid())) {
+		t.Errorf("second AcquireLock error = %v, want ErrLocked naming the holder", err)
+	}
+
+	release()
+	release, err = AcquireLock(path)
+	if err != nil {
+		t.Fatalf("lock not reusable after release: %v", err)
+	}
+	release()
+}
@@ -0,0 +1,255 @@
+package storage
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// MemoryStore keeps dedup state in memory only. It is meant for local runs
+// without MongoDB; Save and Load carry the state between runs.
+type MemoryStore struct {
+	mu            sync.RWMutex
+	ids           map[string]bool
+	hashes        map[string]bool
+	contentHashes map[string]string
+	owners        map[string]string
+	// current is the description hash each vacancy was last stored with,
+	// and closed the vacancies the API no longer serves. Compact prunes
+	// by them.
+	current map[string]string
+	closed  map[string]bool
+	// snippets are the vacancies stored from --search-only snippets.
+	snippets map[string]bool
+}
+
+type memorySnapshot struct {
+	IDs               []string          `json:"ids"`
+	Hashes            []string          `json:"hashes"`
+	ContentHashes     map[string]string `json:"content_hashes,omitempty"`
+	Owners            map[string]string `json:"owners,omitempty"`
+	DescriptionHashes map[string]string `json:"description_hashes,omitempty"`
+	Closed            []string          `json:"closed,omitempty"`
+	Snippets          []string          `json:"snippets,omitempty"`
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		ids:           make(map[string]bool),
+		hashes:        make(map[string]bool),
+		contentHashes: make(map[string]string),
+		owners:        make(map[string]string),
+		current:       make(map[string]string),
+		closed:        make(map[string]bool),
+		snippets:      make(map[string]bool),
+	}
+}
+
+func (s *MemoryStore) VacancyExists(id string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.ids[id]
+}
+
+func (s *MemoryStore) DescriptionHashExists(hash string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.hashes[hash]
+}
+
+func (s *MemoryStore) AddDescriptionHash(hash string) {
+	s.mu.Lock()
+	s.hashes[hash] = true
+	s.mu.Unlock()
+}
+
+func (s *MemoryStore) ContentUnchanged(id, hash string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return hash != "" && s.contentHashes[id] == hash
+}
+
+func (s *MemoryStore) StoredAsSnippet(id string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.snippets[id]
+}
+
+func (s *MemoryStore) UpsertVacancy(data map[string]interface{}) error {
+	id, ok := data["id"].(string)
+	if !ok {
+		return fmt.Errorf("vacancy has no string id")
+	}
+
+	s.mu.Lock()
+	s.ids[id] = true
+	if snippet, _ := data["search_only"].(bool); snippet {
+		s.snippets[id] = true
+	} else {
+		delete(s.snippets, id)
+	}
+	if hash, ok := data["content_hash"].(string); ok {
+		s.contentHashes[id] = hash
+	}
+	if hash, ok := data["description_hash"].(string); ok && hash != "" {
+		s.current[id] = hash
+		if s.owners[hash] == "" {
+			s.owners[hash] = id
+		}
+	}
+	s.mu.Unlock()
+	return nil
+}
+
+// SetFields only keeps track of closed vacancies; the store holds no other
+// fields.
+func (s *MemoryStore) SetFields(id string, fields map[string]interface{}) error {
+	if closed, _ := fields["closed"].(bool); closed {
+		s.mu.Lock()
+		s.closed[id] = true
+		s.mu.Unlock()
+	}
+	return nil
+}
+
+func (s *MemoryStore) DescriptionHashOwner(hash string) (string, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	owner, ok := s.owners[hash]
+	return owner, ok
+}
+
+// Save writes the id and hash sets to path as gzipped JSON. It writes a
+// temporary file first so an interrupted save keeps the previous snapshot.
+func (s *MemoryStore) Save(path string) error {
+	s.mu.RLock()
+	snapshot := memorySnapshot{
+		IDs:           sortedKeys(s.ids),
+		Hashes:        sortedKeys(s.hashes),
+		ContentHashes: make(map[string]string, len(s.contentHashes)),
+	}
+	for id, hash := range s.contentHashes {
+		snapshot.ContentHashes[id] = hash
+	}
+	snapshot.Owners = make(map[string]string, len(s.owners))
+	for hash, id := range s.owners {
+		snapshot.Owners[hash] = id
+	}
+	snapshot.DescriptionHashes = make(map[string]string, len(s.current))
+	for id, hash := range s.current {
+		snapshot.DescriptionHashes[id] = hash
+	}
+	snapshot.Closed = sortedKeys(s.closed)
+	snapshot.Snippets = sortedKeys(s.snippets)
+	s.mu.RUnlock()
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to create state file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	gz := gzip.NewWriter(tmp)
+	if err := json.NewEncoder(gz).Encode(snapshot); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to encode state: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to compress state: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write state file: %w", err)
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Load merges a snapshot written by Save into the store. A missing file
+// is reported as an error wrapping os.ErrNotExist.
+func (s *MemoryStore) Load(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open state file: %w", err)
+	}
+	defer file.Close()
+
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		return fmt.Errorf("failed to read state file: %w", err)
+	}
+	defer gz.Close()
+
+	var snapshot memorySnapshot
+	if err := json.NewDecoder(gz).Decode(&snapshot); err != nil {
+		return fmt.Errorf("failed to decode state file: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, id := range snapshot.IDs {
+		s.ids[id] = true
+	}
+	for _, hash := range snapshot.Hashes {
+		s.hashes[hash] = true
+	}
+	for id, hash := range snapshot.ContentHashes {
+		s.contentHashes[id] = hash
+	}
+	for hash, id := range snapshot.Owners {
+		if s.owners[hash] == "" {
+			s.owners[hash] = id
+		}
+	}
+	for id, hash := range snapshot.DescriptionHashes {
+		s.current[id] = hash
+	}
+	for _, id := range snapshot.Closed {
+		s.closed[id] = true
+	}
+	for _, id := range snapshot.Snippets {
+		s.snippets[id] = true
+	}
+	return nil
+}
+
+// Compact rebuilds the hash set from the vacancies still stored: a hash is
+// dropped once its owner was closed or re-stored with another description,
+// unless an open vacancy currently has it. Hashes without a recorded owner,
+// and those of owners whose current hash predates its tracking, are kept
+// since nothing tells whether they are still in use. It returns how many
+// hashes were kept and pruned.
+func (s *MemoryStore) Compact() (kept, pruned int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	live := make(map[string]bool, len(s.current))
+	for id, hash := range s.current {
+		if !s.closed[id] {
+			live[hash] = true
+		}
+	}
+	for hash := range s.hashes {
+		owner, known := s.owners[hash]
+		current, tracked := s.current[owner]
+		if live[hash] || !known || (!s.closed[owner] && (!tracked || current == hash)) {
+			kept++
+			continue
+		}
+		delete(s.hashes, hash)
+		delete(s.owners, hash)
+		pruned++
+	}
+	return kept, pruned
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
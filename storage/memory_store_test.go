@@ -0,0 +1,134 @@
+package storage
+
+import (
+	"compress/gzip"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMemoryStoreSnapshotRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json.gz")
+	s := NewMemoryStore()
+	s.UpsertVacancy(map[string]interface{}{"id": "101", "description_hash": "abc", "content_hash": "c101"})
+	s.UpsertVacancy(map[string]interface{}{"id": "103", "search_only": true})
+	s.AddDescriptionHash("abc")
+	s.AddDescriptionHash("def")
+	if err := s.Save(path); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := gzip.NewReader(file); err != nil {
+		t.Errorf("snapshot is not gzipped: %v", err)
+	}
+	file.Close()
+
+	loaded := NewMemoryStore()
+	if err := loaded.Load(path); err != nil {
+		t.Fatal(err)
+	}
+	if !loaded.VacancyExists("101") || loaded.VacancyExists("102") {
+		t.Error("ids not restored")
+	}
+	if !loaded.DescriptionHashExists("abc") || !loaded.DescriptionHashExists("def") {
+		t.Error("description hashes not restored")
+	}
+	if !loaded.ContentUnchanged("101", "c101") {
+		t.Error("content hashes not restored")
+	}
+	if owner, ok := loaded.DescriptionHashOwner("abc"); !ok || owner != "101" {
+		t.Errorf("owner of abc = %q, %v, want 101", owner, ok)
+	}
+	if !loaded.StoredAsSnippet("103") || loaded.StoredAsSnippet("101") {
+		t.Error("search-only snippets not restored")
+	}
+
+	matches, _ := filepath.Glob(path + ".*")
+	if len(matches) != 0 {
+		t.Errorf("temporary files left behind: %v", matches)
+	}
+}
+
+func TestMemoryStoreLoadErrors(t *testing.T) {
+	dir := t.TempDir()
+	if err := NewMemoryStore().Load(filepath.Join(dir, "missing.json.gz")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("missing file: error = %v, want os.ErrNotExist", err)
+	}
+
+	corrupt := filepath.Join(dir, "corrupt.json.gz")
+	os.WriteFile(corrupt, []byte("not gzip"), 0o644)
+	if err := NewMemoryStore().Load(corrupt); err == nil || errors.Is(err, os.ErrNotExist) {
+		t.Errorf("corrupt file: error = %v", err)
+	}
+}
+
+// storeVacancy writes a vacancy the way the pipeline does: upsert, then
+// register its description hash.
+func storeVacancy(t *testing.T, s *MemoryStore, id, hash string) {
+	t.Helper()
+	if err := s.UpsertVacancy(map[string]interface{}{"id": id, "description_hash": hash}); err != nil {
+		t.Fatal(err)
+	}
+	s.AddDescriptionHash(hash)
+}
+
+func TestMemoryStoreCompact(t *testing.T) {
+	s := NewMemoryStore()
+	storeVacancy(t, s, "101", "open")
+	storeVacancy(t, s, "102", "closed")
+	storeVacancy(t, s, "103", "edited-before")
+	storeVacancy(t, s, "103", "edited-after")
+	// 104 is a stored duplicate of 105's description; closing 105 must
+	// keep the hash 104 still has.
+	storeVacancy(t, s, "105", "shared")
+	storeVacancy(t, s, "104", "shared")
+	s.AddDescriptionHash("unowned")
+	for _, id := range []string{"102", "105"} {
+		if err := s.SetFields(id, map[string]interface{}{"closed": true, "closed_at": "now"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if kept, pruned := s.Compact(); kept != 4 || pruned != 2 {
+		t.Errorf("Compact = %d kept, %d pruned, want 4, 2", kept, pruned)
+	}
+	for hash, want := range map[string]bool{
+		"open": true, "edited-after": true, "shared": true, "unowned": true,
+		"closed": false, "edited-before": false,
+	} {
+		if s.DescriptionHashExists(hash) != want {
+			t.Errorf("hash %s kept = %v, want %v", hash, !want, want)
+		}
+	}
+	if !s.VacancyExists("102") {
+		t.Error("closed vacancy forgotten; it would be fetched again")
+	}
+
+	if kept, pruned := s.Compact(); kept != 4 || pruned != 0 {
+		t.Errorf("second Compact = %d kept, %d pruned, want 4, 0", kept, pruned)
+	}
+}
+
+func TestMemoryStoreCompactAfterReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json.gz")
+	s := NewMemoryStore()
+	storeVacancy(t, s, "101", "open")
+	storeVacancy(t, s, "102", "closed")
+	s.SetFields("102", map[string]interface{}{"closed": true})
+	if err := s.Save(path); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := NewMemoryStore()
+	if err := loaded.Load(path); err != nil {
+		t.Fatal(err)
+	}
+	if kept, pruned := loaded.Compact(); kept != 1 || pruned != 1 || loaded.DescriptionHashExists("closed") {
+		t.Errorf("Compact after reload = %d kept, %d pruned, want the closed vacancy's hash pruned", kept, pruned)
+	}
+}
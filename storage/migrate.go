@@ -0,0 +1,27 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// EachBelowSchemaVersion calls fn for every stored vacancy whose
+// schema_version is missing or lower than version.
+func (s *MongoStore) EachBelowSchemaVersion(ctx context.Context, version int, fn func(data map[string]interface{}) error) error {
+	query := bson.M{"$or": bson.A{
+		bson.M{"schema_version": bson.M{"$exists": false}},
+		bson.M{"schema_version": bson.M{"$lt": version}},
+	}}
+	return s.eachMatching(ctx, query, fn)
+}
+
+// ReplaceVacancy overwrites the stored document with the same id, so
+// fields removed from data are removed from the document as well.
+func (s *MongoStore) ReplaceVacancy(ctx context.Context, data map[string]interface{}) error {
+	if _, err := s.Collection.ReplaceOne(ctx, s.upsertFilter(data), data); err != nil {
+		return fmt.Errorf("failed to replace vacancy %v: %w", data["id"], err)
+	}
+	return nil
+}
@@ -2,44 +2,67 @@ package storage
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"sync"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+const lookupTimeout = 10 * time.Second
+
 type MongoStore struct {
 	Collection                *mongo.Collection
-	existingVacancyIDs        map[string]struct{}
+	BatchSize                 int32
+	ShardKey                  []string
+	lazy                      bool
+	mu                        sync.RWMutex
+	existingVacancyIDs        map[string]bool
 	existingDescriptionHashes *sync.Map
+	contentHashes             map[string]string
+	snippetIDs                map[string]bool
+	descriptionOwners         sync.Map
 }
 
-func NewMongoStore(uri, dbName, collectionName string) (*MongoStore, error) {
+func NewMongoStore(uri, dbName, collectionName string, collectionOpts ...*options.CollectionOptions) (*MongoStore, error) {
 	clientOptions := options.Client().ApplyURI(uri)
 	client, err := mongo.Connect(context.TODO(), clientOptions)
 	if err != nil {
 		return nil, fmt.Errorf("MongoDB connection error: %w", err)
 	}
 
-	collection := client.Database(dbName).Collection(collectionName)
+	return NewMongoStoreFromClient(client, dbName, collectionName, collectionOpts...), nil
+}
+
+func NewMongoStoreFromClient(client *mongo.Client, dbName, collectionName string, collectionOpts ...*options.CollectionOptions) *MongoStore {
+	collection := client.Database(dbName).Collection(collectionName, collectionOpts...)
 	return &MongoStore{
 		Collection: collection,
-	}, nil
+	}
+}
+
+func (s *MongoStore) Ping(ctx context.Context) error {
+	return s.Collection.Database().Client().Ping(ctx, nil)
 }
 
 func (s *MongoStore) LoadExistingData() error {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
-	s.existingVacancyIDs = make(map[string]struct{})
+	s.existingVacancyIDs = make(map[string]bool)
 	s.existingDescriptionHashes = &sync.Map{}
+	s.contentHashes = make(map[string]string)
+	s.snippetIDs = make(map[string]bool)
 
-	cursor, err := s.Collection.Find(ctx, bson.D{}, options.Find().SetProjection(bson.D{
-		{"id", 1},
-		{"description_hash", 1},
+	cursor, err := s.Collection.Find(ctx, bson.D{}, s.scanOptions().SetProjection(bson.D{
+		{Key: "id", Value: 1},
+		{Key: "description_hash", Value: 1},
+		{Key: "content_hash", Value: 1},
+		{Key: "search_only", Value: 1},
 	}))
 	if err != nil {
 		return fmt.Errorf("failed to fetch existing vacancies: %w", err)
@@ -50,36 +73,396 @@ func (s *MongoStore) LoadExistingData() error {
 		var doc struct {
 			ID              string `bson:"id"`
 			DescriptionHash string `bson:"description_hash"`
+			ContentHash     string `bson:"content_hash"`
+			SearchOnly      bool   `bson:"search_only"`
 		}
 		if err := cursor.Decode(&doc); err != nil {
 			return fmt.Errorf("failed to decode document: %w", err)
 		}
-		s.existingVacancyIDs[doc.ID] = struct{}{}
+		s.existingVacancyIDs[doc.ID] = true
+		if doc.SearchOnly {
+			s.snippetIDs[doc.ID] = true
+		}
+		if doc.ContentHash != "" {
+			s.contentHashes[doc.ID] = doc.ContentHash
+		}
 		if doc.DescriptionHash != "" {
-			s.existingDescriptionHashes.Store(doc.DescriptionHash, struct{}{})
+			s.existingDescriptionHashes.Store(doc.DescriptionHash, true)
+			s.descriptionOwners.LoadOrStore(doc.DescriptionHash, doc.ID)
 		}
 	}
 
 	return cursor.Err()
 }
 
+// UseLazyLookups skips the upfront scan of LoadExistingData and resolves
+// existence checks with indexed queries on demand, caching the answers for
+// the lifetime of the store.
+func (s *MongoStore) UseLazyLookups() {
+	s.lazy = true
+	s.existingVacancyIDs = make(map[string]bool)
+	s.existingDescriptionHashes = &sync.Map{}
+	s.contentHashes = make(map[string]string)
+	s.snippetIDs = make(map[string]bool)
+}
+
+// VacancyExists answers false when a lazy lookup fails; callers that must
+// tell the two apart use LookupVacancy.
 func (s *MongoStore) VacancyExists(id string) bool {
-	_, exists := s.existingVacancyIDs[id]
+	exists, _ := s.LookupVacancy(id)
 	return exists
 }
 
+func (s *MongoStore) LookupVacancy(id string) (bool, error) {
+	s.mu.RLock()
+	exists, cached := s.existingVacancyIDs[id]
+	s.mu.RUnlock()
+	if cached || !s.lazy {
+		return exists, nil
+	}
+
+	exists, err := s.documentExists(bson.M{"id": id})
+	if err != nil {
+		return false, fmt.Errorf("vacancy %s: %w", id, err)
+	}
+	s.mu.Lock()
+	s.existingVacancyIDs[id] = exists
+	s.mu.Unlock()
+	return exists, nil
+}
+
 func (s *MongoStore) DescriptionHashExists(hash string) bool {
-	_, exists := s.existingDescriptionHashes.Load(hash)
+	value, cached := s.existingDescriptionHashes.Load(hash)
+	if cached || !s.lazy {
+		return cached && value.(bool)
+	}
+
+	exists, err := s.documentExists(bson.M{"description_hash": hash})
+	if err != nil {
+		return false
+	}
+	s.existingDescriptionHashes.Store(hash, exists)
 	return exists
 }
 
+func (s *MongoStore) ContentUnchanged(id, hash string) bool {
+	s.mu.RLock()
+	stored, cached := s.contentHashes[id]
+	s.mu.RUnlock()
+	if cached || !s.lazy {
+		return stored == hash
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), lookupTimeout)
+	defer cancel()
+	var doc struct {
+		ContentHash string `bson:"content_hash"`
+	}
+	err := s.Collection.FindOne(ctx, bson.M{"id": id}, options.FindOne().SetProjection(bson.M{"content_hash": 1})).Decode(&doc)
+	if err != nil {
+		return false
+	}
+	s.mu.Lock()
+	s.contentHashes[id] = doc.ContentHash
+	s.mu.Unlock()
+	return doc.ContentHash == hash
+}
+
+func (s *MongoStore) StoredAsSnippet(id string) bool {
+	s.mu.RLock()
+	snippet, cached := s.snippetIDs[id]
+	s.mu.RUnlock()
+	if cached || !s.lazy {
+		return snippet
+	}
+
+	snippet, err := s.documentExists(bson.M{"id": id, "search_only": true})
+	if err != nil {
+		return false
+	}
+	s.mu.Lock()
+	s.snippetIDs[id] = snippet
+	s.mu.Unlock()
+	return snippet
+}
+
 func (s *MongoStore) AddDescriptionHash(hash string) {
-	s.existingDescriptionHashes.Store(hash, struct{}{})
+	s.existingDescriptionHashes.Store(hash, true)
+}
+
+// insertOnlyFields record how a vacancy was first discovered. They are
+// written with $setOnInsert, so later upserts never overwrite them.
+var insertOnlyFields = []string{"first_seen", "first_seen_run_id"}
+
+func upsertUpdate(data map[string]interface{}) bson.M {
+	set := make(bson.M, len(data))
+	onInsert := bson.M{}
+	for key, value := range data {
+		set[key] = value
+	}
+	for _, key := range insertOnlyFields {
+		if value, ok := set[key]; ok {
+			onInsert[key] = value
+			delete(set, key)
+		}
+	}
+	update := bson.M{"$set": set}
+	if len(onInsert) > 0 {
+		update["$setOnInsert"] = onInsert
+	}
+	// A vacancy first stored from its search snippet stops being one once
+	// the full details are written over it.
+	if _, ok := data["search_only"]; !ok {
+		update["$unset"] = bson.M{"search_only": ""}
+	}
+	return update
 }
 
 func (s *MongoStore) UpsertVacancy(data map[string]interface{}) error {
-	filter := bson.M{"id": data["id"]}
-	update := bson.M{"$set": data}
+	filter := s.upsertFilter(data)
+	update := upsertUpdate(data)
 	_, err := s.Collection.UpdateOne(context.TODO(), filter, update, options.Update().SetUpsert(true))
+	if isDuplicateDescription(err) {
+		return fmt.Errorf("vacancy %v: %w", data["id"], ErrDuplicateDescription)
+	}
+	if err != nil {
+		return err
+	}
+
+	s.markStored(data)
+	return nil
+}
+
+func (s *MongoStore) UpsertVacancies(ctx context.Context, docs []map[string]interface{}) error {
+	_, err := s.bulkUpsert(ctx, docs)
 	return err
 }
+
+// bulkUpsert returns the indexes of the documents the unique description
+// index rejected; all others were stored.
+func (s *MongoStore) bulkUpsert(ctx context.Context, docs []map[string]interface{}) (map[int]bool, error) {
+	rejected := map[int]bool{}
+	if len(docs) == 0 {
+		return rejected, nil
+	}
+
+	models := make([]mongo.WriteModel, 0, len(docs))
+	for _, data := range docs {
+		models = append(models, mongo.NewUpdateOneModel().
+			SetFilter(s.upsertFilter(data)).
+			SetUpdate(upsertUpdate(data)).
+			SetUpsert(true))
+	}
+
+	// The write is unordered, so documents rejected by the unique
+	// description index are skipped while the rest of the batch lands.
+	if _, err := s.Collection.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false)); err != nil {
+		var bulkErr mongo.BulkWriteException
+		if !errors.As(err, &bulkErr) || bulkErr.WriteConcernError != nil {
+			return nil, fmt.Errorf("bulk upsert failed: %w", err)
+		}
+		for _, writeErr := range bulkErr.WriteErrors {
+			if !isDuplicateDescription(writeErr) {
+				return nil, fmt.Errorf("bulk upsert failed: %w", err)
+			}
+			rejected[writeErr.Index] = true
+		}
+	}
+
+	for i, data := range docs {
+		if !rejected[i] {
+			s.markStored(data)
+		}
+	}
+	return rejected, nil
+}
+
+func (s *MongoStore) markStored(data map[string]interface{}) {
+	id, ok := data["id"].(string)
+	if !ok {
+		return
+	}
+
+	s.mu.Lock()
+	s.existingVacancyIDs[id] = true
+	if hash, ok := data["content_hash"].(string); ok {
+		s.contentHashes[id] = hash
+	}
+	snippet, _ := data["search_only"].(bool)
+	s.snippetIDs[id] = snippet
+	s.mu.Unlock()
+	if hash, ok := data["description_hash"].(string); ok && hash != "" {
+		s.descriptionOwners.LoadOrStore(hash, id)
+	}
+}
+
+func (s *MongoStore) DescriptionHashOwner(hash string) (string, bool) {
+	if owner, ok := s.descriptionOwners.Load(hash); ok {
+		return owner.(string), true
+	}
+	if !s.lazy {
+		return "", false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), lookupTimeout)
+	defer cancel()
+	var doc struct {
+		ID string `bson:"id"`
+	}
+	err := s.Collection.FindOne(ctx, bson.M{"description_hash": hash}, options.FindOne().SetProjection(bson.M{"id": 1})).Decode(&doc)
+	if err != nil {
+		return "", false
+	}
+	owner, _ := s.descriptionOwners.LoadOrStore(hash, doc.ID)
+	return owner.(string), true
+}
+
+// UpsertVacancyTrackingChanges upserts the vacancy and, when the stored
+// description hash differs from the incoming one, pushes the previous
+// description onto description_history. It reports whether a change was
+// recorded; a first-seen vacancy never gets a history entry.
+func (s *MongoStore) UpsertVacancyTrackingChanges(data map[string]interface{}) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), lookupTimeout)
+	defer cancel()
+
+	var stored struct {
+		Description     string `bson:"description"`
+		DescriptionHash string `bson:"description_hash"`
+	}
+	filter := s.upsertFilter(data)
+	err := s.Collection.FindOne(ctx, filter, options.FindOne().SetProjection(bson.M{
+		"description":      1,
+		"description_hash": 1,
+	})).Decode(&stored)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return false, s.UpsertVacancy(data)
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to load stored vacancy: %w", err)
+	}
+
+	update := upsertUpdate(data)
+	changed := stored.DescriptionHash != "" && stored.DescriptionHash != data["description_hash"]
+	if changed {
+		update["$push"] = bson.M{"description_history": bson.M{
+			"description":      stored.Description,
+			"description_hash": stored.DescriptionHash,
+			"replaced_at":      time.Now().UTC(),
+		}}
+	}
+
+	if _, err := s.Collection.UpdateOne(context.TODO(), filter, update, options.Update().SetUpsert(true)); err != nil {
+		return false, err
+	}
+	s.markStored(data)
+	return changed, nil
+}
+
+func (s *MongoStore) MaxVacancyID(ctx context.Context) (int64, error) {
+	cursor, err := s.Collection.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: nil},
+			{Key: "max", Value: bson.D{{Key: "$max", Value: bson.D{{Key: "$toLong", Value: "$id"}}}}},
+		}}},
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to query max vacancy id: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var result struct {
+		Max int64 `bson:"max"`
+	}
+	if cursor.Next(ctx) {
+		if err := cursor.Decode(&result); err != nil {
+			return 0, fmt.Errorf("failed to decode max vacancy id: %w", err)
+		}
+	}
+	return result.Max, cursor.Err()
+}
+
+func (s *MongoStore) EachVacancy(ctx context.Context, fn func(data map[string]interface{}) error) error {
+	return s.eachMatching(ctx, bson.D{}, fn)
+}
+
+func (s *MongoStore) eachMatching(ctx context.Context, query interface{}, fn func(data map[string]interface{}) error) error {
+	cursor, err := s.Collection.Find(ctx, query, s.scanOptions())
+	if err != nil {
+		return fmt.Errorf("failed to scan vacancies: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var doc bson.M
+		if err := cursor.Decode(&doc); err != nil {
+			return fmt.Errorf("failed to decode vacancy: %w", err)
+		}
+		delete(doc, "_id")
+		if err := fn(plainDocument(doc)); err != nil {
+			return err
+		}
+		// Next only checks ctx when it has to fetch a batch, so a cancelled
+		// scan would otherwise run through the rest of the current one.
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
+
+// scanOptions streams full-collection reads in BatchSize chunks instead of
+// the server default.
+func (s *MongoStore) scanOptions() *options.FindOptions {
+	opts := options.Find()
+	if s.BatchSize > 0 {
+		opts.SetBatchSize(s.BatchSize)
+	}
+	return opts
+}
+
+// plainDocument converts decoded BSON documents and arrays into the plain
+// maps and slices the API client produces, so transforms see the same shapes.
+func plainDocument(doc bson.M) map[string]interface{} {
+	plain := make(map[string]interface{}, len(doc))
+	for key, value := range doc {
+		plain[key] = plainValue(value)
+	}
+	return plain
+}
+
+func plainValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case bson.M:
+		return plainDocument(v)
+	case bson.D:
+		doc := make(bson.M, len(v))
+		for _, e := range v {
+			doc[e.Key] = e.Value
+		}
+		return plainDocument(doc)
+	case primitive.Binary:
+		return v.Data
+	case bson.A:
+		items := make([]interface{}, len(v))
+		for i, item := range v {
+			items[i] = plainValue(item)
+		}
+		return items
+	default:
+		return value
+	}
+}
+
+func (s *MongoStore) documentExists(filter bson.M) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), lookupTimeout)
+	defer cancel()
+
+	err := s.Collection.FindOne(ctx, filter, options.FindOne().SetProjection(bson.M{"_id": 1})).Err()
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("existence lookup failed: %w", err)
+	}
+	return true, nil
+}
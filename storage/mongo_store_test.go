@@ -0,0 +1,584 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// withMockStore runs fn against a MongoStore whose collection is served by
+// the driver's mock deployment; fn queues the server replies with
+// mt.AddMockResponses and reads the sent commands back from mt's events.
+func withMockStore(t *testing.T, fn func(mt *mtest.T, s *MongoStore)) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	mt.Run("mock", func(mt *mtest.T) {
+		fn(mt, &MongoStore{Collection: mt.Coll})
+	})
+}
+
+// cursorReply is a find reply returning docs in a single batch.
+func cursorReply(docs ...bson.D) bson.D {
+	return mtest.CreateCursorResponse(0, "test.vacancies", mtest.FirstBatch, docs...)
+}
+
+var errorReply = mtest.CreateCommandErrorResponse(mtest.CommandError{Code: 2, Name: "BadValue", Message: "bad value"})
+
+func preloadedStore(n int) *MongoStore {
+	s := &MongoStore{
+		existingVacancyIDs:        make(map[string]bool),
+		existingDescriptionHashes: &sync.Map{},
+		contentHashes:             make(map[string]string),
+		snippetIDs:                make(map[string]bool),
+	}
+	for i := 0; i < n; i++ {
+		s.existingVacancyIDs[strconv.Itoa(i)] = true
+		s.AddDescriptionHash("hash" + strconv.Itoa(i))
+	}
+	return s
+}
+
+func BenchmarkDescriptionHashExists(b *testing.B) {
+	s := preloadedStore(100000)
+	// Half of the probes miss, as new vacancies do.
+	probes := make([]string, 200000)
+	for i := range probes {
+		probes[i] = "hash" + strconv.Itoa(i)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			s.DescriptionHashExists(probes[i%len(probes)])
+			i++
+		}
+	})
+}
+
+func TestLazyLookupCachesAnswers(t *testing.T) {
+	withMockStore(t, func(mt *mtest.T, s *MongoStore) {
+		t := mt.T
+		s.UseLazyLookups()
+		mt.AddMockResponses(cursorReply(bson.D{{Key: "_id", Value: 1}}), cursorReply())
+
+		for round := 0; round < 2; round++ {
+			if exists, err := s.LookupVacancy("1"); !exists || err != nil {
+				t.Errorf("round %d: LookupVacancy(1) = %v, %v, want true", round, exists, err)
+			}
+			if exists, err := s.LookupVacancy("2"); exists || err != nil {
+				t.Errorf("round %d: LookupVacancy(2) = %v, %v, want false", round, exists, err)
+			}
+		}
+
+		events := mt.GetAllStartedEvents()
+		if len(events) != 2 {
+			t.Fatalf("%d queries sent, want one per id", len(events))
+		}
+		if filter := events[0].Command.Lookup("filter").Document().Lookup("id").StringValue(); filter != "1" {
+			t.Errorf("first query filters on id %q", filter)
+		}
+	})
+}
+
+func TestLazyLookupFailureIsNotCached(t *testing.T) {
+	withMockStore(t, func(mt *mtest.T, s *MongoStore) {
+		t := mt.T
+		s.UseLazyLookups()
+		mt.AddMockResponses(errorReply, cursorReply(bson.D{{Key: "_id", Value: 1}}))
+
+		if _, err := s.LookupVacancy("1"); err == nil {
+			t.Fatal("LookupVacancy hid the failed query")
+		}
+		if exists, err := s.LookupVacancy("1"); !exists || err != nil {
+			t.Errorf("LookupVacancy after the failure = %v, %v, want true from a new query", exists, err)
+		}
+	})
+}
+
+func TestLazyDescriptionHashLookup(t *testing.T) {
+	withMockStore(t, func(mt *mtest.T, s *MongoStore) {
+		t := mt.T
+		s.UseLazyLookups()
+		mt.AddMockResponses(cursorReply())
+		if s.DescriptionHashExists("abc") {
+			t.Error("unknown hash reported as stored")
+		}
+		s.AddDescriptionHash("abc")
+		if !s.DescriptionHashExists("abc") {
+			t.Error("hash added during the run not found")
+		}
+		if n := len(mt.GetAllStartedEvents()); n != 1 {
+			t.Errorf("%d queries sent, want 1", n)
+		}
+	})
+}
+
+func TestPreloadedLookupsStayInMemory(t *testing.T) {
+	// Collection is nil, so any query would panic.
+	s := preloadedStore(10)
+	if exists, err := s.LookupVacancy("3"); !exists || err != nil {
+		t.Errorf("LookupVacancy(3) = %v, %v", exists, err)
+	}
+	if exists, err := s.LookupVacancy("42"); exists || err != nil {
+		t.Errorf("LookupVacancy(42) = %v, %v", exists, err)
+	}
+	if !s.DescriptionHashExists("hash3") || s.DescriptionHashExists("hash42") {
+		t.Error("preloaded hashes answered wrongly")
+	}
+}
+
+// benchmarkCollection returns a collection seeded with n vacancies in the
+// MongoDB at MONGO_TEST_URI, skipping the benchmark when it is not set.
+func benchmarkCollection(b *testing.B, n int) *mongo.Collection {
+	uri := os.Getenv("MONGO_TEST_URI")
+	if uri == "" {
+		b.Skip("MONGO_TEST_URI not set")
+	}
+	ctx := context.Background()
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() { client.Disconnect(ctx) })
+
+	collection := client.Database("hh_it_scrapper_bench").Collection("vacancies_" + strconv.Itoa(n))
+	if count, err := collection.EstimatedDocumentCount(ctx); err == nil && count == int64(n) {
+		return collection
+	}
+	collection.Drop(ctx)
+	if _, err := collection.Indexes().CreateOne(ctx, mongo.IndexModel{Keys: bson.D{{Key: "id", Value: 1}}}); err != nil {
+		b.Fatal(err)
+	}
+	docs := make([]interface{}, 0, 1000)
+	for i := 0; i < n; i++ {
+		id := strconv.Itoa(i)
+		docs = append(docs, bson.M{"id": id, "description_hash": "hash" + id, "content_hash": "content" + id})
+		if len(docs) == cap(docs) || i == n-1 {
+			if _, err := collection.InsertMany(ctx, docs); err != nil {
+				b.Fatal(err)
+			}
+			docs = docs[:0]
+		}
+	}
+	return collection
+}
+
+// BenchmarkStartup compares getting ready for a run that checks 100 ids:
+// preloading every id and hash against looking the 100 up on demand.
+func BenchmarkStartup(b *testing.B) {
+	collection := benchmarkCollection(b, 200000)
+	b.Run("preload", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			s := &MongoStore{Collection: collection, BatchSize: 1000}
+			if err := s.LoadExistingData(); err != nil {
+				b.Fatal(err)
+			}
+			for id := 0; id < 100; id++ {
+				s.VacancyExists(strconv.Itoa(id * 1000))
+			}
+		}
+	})
+	b.Run("lazy", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			s := &MongoStore{Collection: collection}
+			s.UseLazyLookups()
+			for id := 0; id < 100; id++ {
+				if _, err := s.LookupVacancy(strconv.Itoa(id * 1000)); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	})
+}
+
+var updateReply = mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1})
+
+// sentUpdate returns the update document of the last update command sent.
+func sentUpdate(mt *mtest.T) bson.Raw {
+	mt.Helper()
+	var update bson.Raw
+	for _, event := range mt.GetAllStartedEvents() {
+		if event.CommandName == "update" {
+			update = event.Command.Lookup("updates").Array().Index(0).Value().Document().Lookup("u").Document()
+		}
+	}
+	if update == nil {
+		mt.Fatal("no update sent")
+	}
+	return update
+}
+
+func TestTrackChangesHistory(t *testing.T) {
+	tests := []struct {
+		name    string
+		stored  []bson.D
+		changed bool
+	}{
+		{"first seen", nil, false},
+		{"description unchanged", []bson.D{{{Key: "description", Value: "<p>Go</p>"}, {Key: "description_hash", Value: "new"}}}, false},
+		{"description edited", []bson.D{{{Key: "description", Value: "<p>Old</p>"}, {Key: "description_hash", Value: "old"}}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withMockStore(t, func(mt *mtest.T, s *MongoStore) {
+				t := mt.T
+				s.UseLazyLookups()
+				mt.AddMockResponses(cursorReply(tt.stored...), updateReply)
+
+				changed, err := s.UpsertVacancyTrackingChanges(map[string]interface{}{
+					"id": "1", "description": "<p>Go</p>", "description_hash": "new",
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if changed != tt.changed {
+					t.Errorf("changed = %v, want %v", changed, tt.changed)
+				}
+
+				push, err := sentUpdate(mt).LookupErr("$push", "description_history")
+				if !tt.changed {
+					if err == nil {
+						t.Errorf("history entry pushed without a change: %v", push)
+					}
+					return
+				}
+				if err != nil {
+					t.Fatal("no history entry pushed for the edited description")
+				}
+				entry := push.Document()
+				if entry.Lookup("description").StringValue() != "<p>Old</p>" || entry.Lookup("description_hash").StringValue() != "old" {
+					t.Errorf("history entry = %v, want the previous description", entry)
+				}
+				if _, err := entry.LookupErr("replaced_at"); err != nil {
+					t.Error("history entry has no replaced_at")
+				}
+			})
+		})
+	}
+}
+
+func TestBatchWriterFlushesPartialBatch(t *testing.T) {
+	withMockStore(t, func(mt *mtest.T, s *MongoStore) {
+		t := mt.T
+		s.UseLazyLookups()
+		w := NewBatchWriter(s, 5)
+		var written []string
+		w.NotifyWrites(func(data map[string]interface{}, err error) {
+			if err != nil {
+				t.Errorf("vacancy %v: %v", data["id"], err)
+			}
+			written = append(written, data["id"].(string))
+		})
+
+		for i := 1; i <= 3; i++ {
+			if err := w.UpsertVacancy(map[string]interface{}{"id": strconv.Itoa(i)}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if sent := len(mt.GetAllStartedEvents()); sent != 0 || w.Pending() != 3 {
+			t.Fatalf("%d commands sent, %d pending before Flush, want 0 and 3", sent, w.Pending())
+		}
+
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 3}))
+		if err := w.Flush(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		events := mt.GetAllStartedEvents()
+		if len(events) != 1 || events[0].CommandName != "update" {
+			t.Fatalf("Flush sent %d commands, want one update", len(events))
+		}
+		if updates, _ := events[0].Command.Lookup("updates").Array().Values(); len(updates) != 3 {
+			t.Errorf("bulk write carried %d updates, want 3", len(updates))
+		}
+		if w.Pending() != 0 || len(written) != 3 {
+			t.Errorf("after Flush: %d pending, %d reported written", w.Pending(), len(written))
+		}
+		if exists, _ := s.LookupVacancy("2"); !exists {
+			t.Error("flushed vacancy not marked as stored")
+		}
+	})
+}
+
+func TestBatchWriterKeepsBatchWhenFlushFails(t *testing.T) {
+	withMockStore(t, func(mt *mtest.T, s *MongoStore) {
+		t := mt.T
+		s.UseLazyLookups()
+		w := NewBatchWriter(s, 5)
+		w.UpsertVacancy(map[string]interface{}{"id": "1"})
+		w.UpsertVacancy(map[string]interface{}{"id": "2"})
+
+		mt.AddMockResponses(errorReply)
+		if err := w.Flush(context.Background()); err == nil {
+			t.Fatal("Flush succeeded against a failing server")
+		}
+		if w.Pending() != 2 {
+			t.Errorf("%d pending after a failed Flush, want both vacancies requeued", w.Pending())
+		}
+	})
+}
+
+func TestContentUnchanged(t *testing.T) {
+	withMockStore(t, func(mt *mtest.T, s *MongoStore) {
+		t := mt.T
+		s.UseLazyLookups()
+		mt.AddMockResponses(cursorReply(bson.D{{Key: "content_hash", Value: "abc"}}), cursorReply())
+
+		if !s.ContentUnchanged("1", "abc") {
+			t.Error("same content hash reported as changed")
+		}
+		if s.ContentUnchanged("1", "def") {
+			t.Error("different content hash reported as unchanged")
+		}
+		if s.ContentUnchanged("2", "abc") {
+			t.Error("vacancy without a stored hash reported as unchanged")
+		}
+		if n := len(mt.GetAllStartedEvents()); n != 2 {
+			t.Errorf("%d lookups, want one per vacancy", n)
+		}
+
+		s.markStored(map[string]interface{}{"id": "1", "content_hash": "def"})
+		if !s.ContentUnchanged("1", "def") {
+			t.Error("hash of the last write not remembered")
+		}
+	})
+}
+
+func TestStoredAsSnippet(t *testing.T) {
+	withMockStore(t, func(mt *mtest.T, s *MongoStore) {
+		t := mt.T
+		mt.AddMockResponses(
+			cursorReply(
+				bson.D{{Key: "id", Value: "1"}, {Key: "search_only", Value: true}},
+				bson.D{{Key: "id", Value: "2"}, {Key: "description_hash", Value: "abc"}},
+			),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}),
+		)
+		if err := s.LoadExistingData(); err != nil {
+			t.Fatal(err)
+		}
+		if !s.StoredAsSnippet("1") || s.StoredAsSnippet("2") {
+			t.Errorf("snippets 1, 2 = %v, %v, want only 1", s.StoredAsSnippet("1"), s.StoredAsSnippet("2"))
+		}
+
+		if err := s.UpsertVacancy(map[string]interface{}{"id": "1", "description": "<p>Go</p>"}); err != nil {
+			t.Fatal(err)
+		}
+		if s.StoredAsSnippet("1") {
+			t.Error("vacancy still a snippet after its details were stored")
+		}
+		if _, err := sentUpdate(mt).LookupErr("$unset", "search_only"); err != nil {
+			t.Error("details upsert does not clear search_only")
+		}
+	})
+}
+
+func TestNewMongoStoreFromClient(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	mt.Run("mock", func(mt *mtest.T) {
+		t := mt.T
+		s := NewMongoStoreFromClient(mt.Client, "jobs", "hh_vacancies")
+		mt.AddMockResponses(cursorReply(), updateReply)
+
+		if err := s.LoadExistingData(); err != nil {
+			t.Fatal(err)
+		}
+		if s.VacancyExists("1") {
+			t.Fatal("empty collection reports vacancy 1")
+		}
+		if err := s.UpsertVacancy(map[string]interface{}{"id": "1", "description_hash": "abc"}); err != nil {
+			t.Fatal(err)
+		}
+		if !s.VacancyExists("1") {
+			t.Error("upserted vacancy not reported as existing")
+		}
+
+		for _, event := range mt.GetAllStartedEvents() {
+			if event.DatabaseName != "jobs" {
+				t.Errorf("%s sent to database %q, want jobs", event.CommandName, event.DatabaseName)
+			}
+			if coll := event.Command.Lookup(event.CommandName).StringValue(); coll != "hh_vacancies" {
+				t.Errorf("%s sent to collection %q, want hh_vacancies", event.CommandName, coll)
+			}
+		}
+	})
+}
+
+func TestUpsertReplacesSourceQuery(t *testing.T) {
+	withMockStore(t, func(mt *mtest.T, s *MongoStore) {
+		t := mt.T
+		s.UseLazyLookups()
+		mt.AddMockResponses(updateReply)
+		err := s.UpsertVacancy(map[string]interface{}{
+			"id":           "1",
+			"source_query": map[string]interface{}{"target": "go-spb", "run_id": "run-2"},
+			"first_seen":   "2024-03-01T00:00:00Z",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		update := sentUpdate(mt)
+		if target, err := update.LookupErr("$set", "source_query", "target"); err != nil || target.StringValue() != "go-spb" {
+			t.Errorf("source_query not replaced with $set: %v", update)
+		}
+		if _, err := update.LookupErr("$set", "first_seen"); err == nil {
+			t.Errorf("first_seen overwritten on re-upsert: %v", update)
+		}
+	})
+}
+
+func TestUpsertKeepsFirstSeenRunID(t *testing.T) {
+	withMockStore(t, func(mt *mtest.T, s *MongoStore) {
+		t := mt.T
+		s.UseLazyLookups()
+		mt.AddMockResponses(updateReply, updateReply, cursorReply(), updateReply)
+		vacancy := func(runID string) map[string]interface{} {
+			return map[string]interface{}{"id": "1", "first_seen": "2024-03-01T00:00:00Z", "first_seen_run_id": runID, "last_seen": runID}
+		}
+
+		if err := s.UpsertVacancy(vacancy("run-1")); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.UpsertVacancies(context.Background(), []map[string]interface{}{vacancy("run-2")}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.UpsertVacancyTrackingChanges(vacancy("run-3")); err != nil {
+			t.Fatal(err)
+		}
+
+		var updates []bson.Raw
+		for _, event := range mt.GetAllStartedEvents() {
+			if event.CommandName == "update" {
+				updates = append(updates, event.Command.Lookup("updates").Array().Index(0).Value().Document().Lookup("u").Document())
+			}
+		}
+		if len(updates) != 3 {
+			t.Fatalf("sent %d updates, want 3", len(updates))
+		}
+		for i, update := range updates {
+			runID := fmt.Sprintf("run-%d", i+1)
+			if value, err := update.LookupErr("$setOnInsert", "first_seen_run_id"); err != nil || value.StringValue() != runID {
+				t.Errorf("update %d: first_seen_run_id not set on insert only: %v", i, update)
+			}
+			for _, field := range []string{"first_seen", "first_seen_run_id"} {
+				if _, err := update.LookupErr("$set", field); err == nil {
+					t.Errorf("update %d: re-upsert overwrites %s: %v", i, field, update)
+				}
+			}
+			if value, err := update.LookupErr("$set", "last_seen"); err != nil || value.StringValue() != runID {
+				t.Errorf("update %d: last_seen not updated: %v", i, update)
+			}
+		}
+	})
+}
+
+func TestMaxVacancyID(t *testing.T) {
+	withMockStore(t, func(mt *mtest.T, s *MongoStore) {
+		t := mt.T
+		mt.AddMockResponses(cursorReply(bson.D{{Key: "_id", Value: nil}, {Key: "max", Value: int64(98765)}}), cursorReply())
+
+		if max, err := s.MaxVacancyID(context.Background()); err != nil || max != 98765 {
+			t.Errorf("MaxVacancyID = %d, %v, want 98765", max, err)
+		}
+		if max, err := s.MaxVacancyID(context.Background()); err != nil || max != 0 {
+			t.Errorf("MaxVacancyID of an empty collection = %d, %v, want 0", max, err)
+		}
+		group := mt.GetStartedEvent().Command.Lookup("pipeline").Array().Index(0).Value().Document()
+		if field, err := group.LookupErr("$group", "max", "$max", "$toLong"); err != nil || field.StringValue() != "$id" {
+			t.Errorf("ids not compared as numbers: %v", group)
+		}
+	})
+}
+
+// batchedCursor replies to a find with two batches of two vacancies.
+func batchedCursor(mt *mtest.T) {
+	mt.AddMockResponses(
+		mtest.CreateCursorResponse(42, "test.vacancies", mtest.FirstBatch,
+			bson.D{{Key: "id", Value: "1"}}, bson.D{{Key: "id", Value: "2"}}),
+		mtest.CreateCursorResponse(0, "test.vacancies", mtest.NextBatch,
+			bson.D{{Key: "id", Value: "3"}}, bson.D{{Key: "id", Value: "4"}}),
+	)
+}
+
+func TestEachVacancyStreamsBatches(t *testing.T) {
+	withMockStore(t, func(mt *mtest.T, s *MongoStore) {
+		t := mt.T
+		s.BatchSize = 2
+		batchedCursor(mt)
+
+		var ids []string
+		err := s.EachVacancy(context.Background(), func(data map[string]interface{}) error {
+			ids = append(ids, data["id"].(string))
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(ids) != 4 {
+			t.Errorf("visited %v, want all 4 vacancies", ids)
+		}
+
+		var commands []string
+		for _, event := range mt.GetAllStartedEvents() {
+			commands = append(commands, event.CommandName)
+			if size, err := event.Command.LookupErr("batchSize"); err != nil || size.Int32() != 2 {
+				t.Errorf("%s sent without batchSize 2: %v", event.CommandName, event.Command)
+			}
+		}
+		if len(commands) != 2 || commands[0] != "find" || commands[1] != "getMore" {
+			t.Errorf("commands = %v, want find and one getMore", commands)
+		}
+	})
+}
+
+func TestEachVacancyStopsOnCancel(t *testing.T) {
+	withMockStore(t, func(mt *mtest.T, s *MongoStore) {
+		t := mt.T
+		s.BatchSize = 2
+		batchedCursor(mt)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		visited := 0
+		err := s.EachVacancy(ctx, func(data map[string]interface{}) error {
+			visited++
+			cancel()
+			return nil
+		})
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("EachVacancy error = %v, want context.Canceled", err)
+		}
+		if visited != 1 {
+			t.Errorf("visited %d vacancies, want the scan to stop right after the cancel", visited)
+		}
+		for _, event := range mt.GetAllStartedEvents() {
+			if event.CommandName == "getMore" {
+				t.Error("next batch requested after cancellation")
+			}
+		}
+	})
+}
+
+func TestEachVacancyStopsOnError(t *testing.T) {
+	withMockStore(t, func(mt *mtest.T, s *MongoStore) {
+		t := mt.T
+		batchedCursor(mt)
+		stop := errors.New("stop")
+		visited := 0
+		err := s.EachVacancy(context.Background(), func(data map[string]interface{}) error {
+			visited++
+			return stop
+		})
+		if !errors.Is(err, stop) || visited != 1 {
+			t.Errorf("EachVacancy = %v after %d vacancies, want stop after one", err, visited)
+		}
+	})
+}
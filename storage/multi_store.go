@@ -0,0 +1,149 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// MultiStore writes every vacancy to all of its stores. Existence and
+// dedup checks, as well as the optional capabilities, are answered by the
+// primary store alone; the others only receive writes.
+type MultiStore struct {
+	Primary     Store
+	Secondaries []Store
+}
+
+func NewMultiStore(primary Store, secondaries ...Store) *MultiStore {
+	return &MultiStore{Primary: primary, Secondaries: secondaries}
+}
+
+func (m *MultiStore) all() []Store {
+	return append([]Store{m.Primary}, m.Secondaries...)
+}
+
+func (m *MultiStore) VacancyExists(id string) bool {
+	return m.Primary.VacancyExists(id)
+}
+
+func (m *MultiStore) LookupVacancy(id string) (bool, error) {
+	if lookup, ok := m.Primary.(VacancyLookup); ok {
+		return lookup.LookupVacancy(id)
+	}
+	return m.Primary.VacancyExists(id), nil
+}
+
+func (m *MultiStore) NotifyWrites(fn func(data map[string]interface{}, err error)) bool {
+	notifier, ok := m.Primary.(WriteNotifier)
+	return ok && notifier.NotifyWrites(fn)
+}
+
+func (m *MultiStore) DescriptionHashExists(hash string) bool {
+	return m.Primary.DescriptionHashExists(hash)
+}
+
+func (m *MultiStore) AddDescriptionHash(hash string) {
+	for _, store := range m.all() {
+		store.AddDescriptionHash(hash)
+	}
+}
+
+// UpsertVacancy writes to every store even when an earlier one fails and
+// returns the failures joined together. A vacancy the primary rejects as a
+// duplicate description is skipped, so the secondaries never receive it.
+func (m *MultiStore) UpsertVacancy(data map[string]interface{}) error {
+	err := m.Primary.UpsertVacancy(data)
+	if errors.Is(err, ErrDuplicateDescription) {
+		return err
+	}
+	var errs []error
+	if err != nil {
+		errs = append(errs, fmt.Errorf("sink 0: %w", err))
+	}
+	return errors.Join(append(errs, m.upsertSecondaries(data)...)...)
+}
+
+func (m *MultiStore) upsertSecondaries(data map[string]interface{}) []error {
+	var errs []error
+	for i, store := range m.Secondaries {
+		if err := store.UpsertVacancy(data); err != nil {
+			errs = append(errs, fmt.Errorf("sink %d: %w", i+1, err))
+		}
+	}
+	return errs
+}
+
+func (m *MultiStore) UpsertVacancyTrackingChanges(data map[string]interface{}) (bool, error) {
+	tracker, ok := m.Primary.(ChangeTracker)
+	if !ok {
+		return false, errors.New("primary store does not support change tracking")
+	}
+
+	changed, err := tracker.UpsertVacancyTrackingChanges(data)
+	if errors.Is(err, ErrDuplicateDescription) {
+		return false, err
+	}
+	return changed, errors.Join(append([]error{err}, m.upsertSecondaries(data)...)...)
+}
+
+func (m *MultiStore) ContentUnchanged(id, hash string) bool {
+	checker, ok := m.Primary.(ContentChecker)
+	return ok && checker.ContentUnchanged(id, hash)
+}
+
+func (m *MultiStore) StoredAsSnippet(id string) bool {
+	checker, ok := m.Primary.(SnippetChecker)
+	return ok && checker.StoredAsSnippet(id)
+}
+
+func (m *MultiStore) DescriptionHashOwner(hash string) (string, bool) {
+	owner, ok := m.Primary.(DescriptionOwner)
+	if !ok {
+		return "", false
+	}
+	return owner.DescriptionHashOwner(hash)
+}
+
+func (m *MultiStore) SetFields(id string, fields map[string]interface{}) error {
+	setter, ok := m.Primary.(FieldSetter)
+	if !ok {
+		return errors.New("primary store does not support field updates")
+	}
+	return setter.SetFields(id, fields)
+}
+
+func (m *MultiStore) MaxVacancyID(ctx context.Context) (int64, error) {
+	marker, ok := m.Primary.(HighWaterMarker)
+	if !ok {
+		return 0, errors.New("primary store does not track a high-water mark")
+	}
+	return marker.MaxVacancyID(ctx)
+}
+
+func (m *MultiStore) EachVacancy(ctx context.Context, fn func(data map[string]interface{}) error) error {
+	scanner, ok := m.Primary.(VacancyScanner)
+	if !ok {
+		return errors.New("primary store does not support scanning")
+	}
+	return scanner.EachVacancy(ctx, fn)
+}
+
+func (m *MultiStore) Flush(ctx context.Context) error {
+	var errs []error
+	for _, store := range m.all() {
+		if flusher, ok := store.(Flusher); ok {
+			errs = append(errs, flusher.Flush(ctx))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (m *MultiStore) Pending() int {
+	pending := 0
+	for _, store := range m.all() {
+		if flusher, ok := store.(Flusher); ok {
+			pending += flusher.Pending()
+		}
+	}
+	return pending
+}
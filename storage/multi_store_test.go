@@ -0,0 +1,131 @@
+package storage
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// failingStore rejects every write.
+type failingStore struct {
+	*MemoryStore
+}
+
+func (s failingStore) UpsertVacancy(data map[string]interface{}) error {
+	return errors.New("disk full")
+}
+
+// readJSONL returns the ids of the vacancies in a file sink.
+func readJSONL(t *testing.T, path string) []string {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	var ids []string
+	for scanner := bufio.NewScanner(file); scanner.Scan(); {
+		var data map[string]interface{}
+		if err := json.Unmarshal(scanner.Bytes(), &data); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, data["id"].(string))
+	}
+	return ids
+}
+
+func TestMultiStoreWritesToEverySink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vacancies.jsonl")
+	file, err := NewFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	primary := NewMemoryStore()
+	store := NewMultiStore(primary, file)
+
+	if err := store.UpsertVacancy(map[string]interface{}{"id": "101", "name": "Go developer"}); err != nil {
+		t.Fatal(err)
+	}
+	store.AddDescriptionHash("abc")
+	file.Close()
+
+	if !primary.VacancyExists("101") {
+		t.Error("vacancy missing from the primary store")
+	}
+	if ids := readJSONL(t, path); len(ids) != 1 || ids[0] != "101" {
+		t.Errorf("file sink holds %v, want [101]", ids)
+	}
+	if !primary.DescriptionHashExists("abc") || !file.DescriptionHashExists("abc") {
+		t.Error("description hash not added to every sink")
+	}
+}
+
+func TestMultiStoreDedupUsesPrimary(t *testing.T) {
+	primary, secondary := NewMemoryStore(), NewMemoryStore()
+	secondary.UpsertVacancy(map[string]interface{}{"id": "101"})
+	secondary.AddDescriptionHash("abc")
+	store := NewMultiStore(primary, secondary)
+
+	if store.VacancyExists("101") || store.DescriptionHashExists("abc") {
+		t.Error("dedup answered by a secondary sink")
+	}
+	primary.UpsertVacancy(map[string]interface{}{"id": "102"})
+	if exists, err := store.LookupVacancy("102"); !exists || err != nil {
+		t.Errorf("LookupVacancy = %v, %v, want the primary's answer", exists, err)
+	}
+}
+
+func TestMultiStoreKeepsWritingAfterFailure(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vacancies.jsonl")
+	file, err := NewFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	primary := NewMemoryStore()
+	store := NewMultiStore(primary, failingStore{NewMemoryStore()}, file)
+
+	err = store.UpsertVacancy(map[string]interface{}{"id": "101"})
+	file.Close()
+	if err == nil || !strings.Contains(err.Error(), "sink 1: disk full") {
+		t.Errorf("error = %v, want the failing sink reported", err)
+	}
+	if !primary.VacancyExists("101") {
+		t.Error("failure dropped the write to the primary store")
+	}
+	if ids := readJSONL(t, path); len(ids) != 1 {
+		t.Errorf("failure dropped the write to the file sink: %v", ids)
+	}
+}
+
+// duplicateStore rejects every write as a duplicate description.
+type duplicateStore struct {
+	*MemoryStore
+}
+
+func (s duplicateStore) UpsertVacancy(data map[string]interface{}) error {
+	return fmt.Errorf("vacancy %v: %w", data["id"], ErrDuplicateDescription)
+}
+
+func (s duplicateStore) UpsertVacancyTrackingChanges(data map[string]interface{}) (bool, error) {
+	return false, s.UpsertVacancy(data)
+}
+
+func TestMultiStoreSkipsDuplicatesRejectedByPrimary(t *testing.T) {
+	secondary := NewMemoryStore()
+	store := NewMultiStore(duplicateStore{NewMemoryStore()}, secondary)
+
+	if err := store.UpsertVacancy(map[string]interface{}{"id": "101"}); !errors.Is(err, ErrDuplicateDescription) {
+		t.Errorf("UpsertVacancy error = %v, want ErrDuplicateDescription", err)
+	}
+	if _, err := store.UpsertVacancyTrackingChanges(map[string]interface{}{"id": "102"}); !errors.Is(err, ErrDuplicateDescription) {
+		t.Errorf("UpsertVacancyTrackingChanges error = %v, want ErrDuplicateDescription", err)
+	}
+	if secondary.VacancyExists("101") || secondary.VacancyExists("102") {
+		t.Error("duplicate rejected by the primary reached a secondary store")
+	}
+}
@@ -0,0 +1,44 @@
+package storage
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"go.mongodb.org/mongo-driver/mongo/writeconcern"
+)
+
+// CollectionOptions builds collection options from textual settings such as
+// "majority" or "1" for the write concern and "secondaryPreferred" for the
+// read preference. Empty values keep the driver defaults.
+func CollectionOptions(writeConcern, readPreference string) (*options.CollectionOptions, error) {
+	opts := options.Collection()
+
+	switch wc := strings.TrimPrefix(strings.TrimSpace(writeConcern), "w="); {
+	case wc == "":
+	case wc == "majority":
+		opts.SetWriteConcern(writeconcern.Majority())
+	default:
+		w, err := strconv.Atoi(wc)
+		if err != nil || w < 0 {
+			return nil, fmt.Errorf("invalid write concern %q", writeConcern)
+		}
+		opts.SetWriteConcern(&writeconcern.WriteConcern{W: w})
+	}
+
+	if rp := strings.TrimSpace(readPreference); rp != "" {
+		mode, err := readpref.ModeFromString(rp)
+		if err != nil {
+			return nil, fmt.Errorf("invalid read preference %q: %w", readPreference, err)
+		}
+		pref, err := readpref.New(mode)
+		if err != nil {
+			return nil, fmt.Errorf("invalid read preference %q: %w", readPreference, err)
+		}
+		opts.SetReadPreference(pref)
+	}
+
+	return opts, nil
+}
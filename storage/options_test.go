@@ -0,0 +1,81 @@
+package storage
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+)
+
+func TestCollectionOptions(t *testing.T) {
+	tests := []struct {
+		writeConcern, readPreference string
+		w                            interface{}
+		mode                         readpref.Mode
+	}{
+		{"", "", nil, 0},
+		{"majority", "", "majority", 0},
+		{"w=majority", "", "majority", 0},
+		{"1", "secondaryPreferred", 1, readpref.SecondaryPreferredMode},
+		{" w=0 ", "nearest", 0, readpref.NearestMode},
+	}
+	for _, tt := range tests {
+		opts, err := CollectionOptions(tt.writeConcern, tt.readPreference)
+		if err != nil {
+			t.Errorf("CollectionOptions(%q, %q): %v", tt.writeConcern, tt.readPreference, err)
+			continue
+		}
+		if tt.w == nil {
+			if opts.WriteConcern != nil {
+				t.Errorf("%q: write concern %+v set, want the driver default", tt.writeConcern, opts.WriteConcern)
+			}
+		} else if opts.WriteConcern == nil || opts.WriteConcern.W != tt.w {
+			t.Errorf("%q: write concern %+v, want w=%v", tt.writeConcern, opts.WriteConcern, tt.w)
+		}
+		if tt.mode == 0 {
+			if opts.ReadPreference != nil {
+				t.Errorf("%q: read preference %v set, want the driver default", tt.readPreference, opts.ReadPreference)
+			}
+		} else if opts.ReadPreference == nil || opts.ReadPreference.Mode() != tt.mode {
+			t.Errorf("%q: read preference %v, want %v", tt.readPreference, opts.ReadPreference, tt.mode)
+		}
+	}
+}
+
+func TestCollectionOptionsInvalid(t *testing.T) {
+	for _, tt := range [][2]string{{"all", ""}, {"-1", ""}, {"", "fastest"}} {
+		if _, err := CollectionOptions(tt[0], tt[1]); err == nil {
+			t.Errorf("CollectionOptions(%q, %q) accepted invalid settings", tt[0], tt[1])
+		}
+	}
+}
+
+func TestCollectionOptionsApplied(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	mt.Run("mock", func(mt *mtest.T) {
+		t := mt.T
+		opts, err := CollectionOptions("majority", "secondaryPreferred")
+		if err != nil {
+			t.Fatal(err)
+		}
+		s := NewMongoStoreFromClient(mt.Client, "vacancy_db", "vacancies", opts)
+
+		s.UseLazyLookups()
+		mt.AddMockResponses(updateReply, cursorReply())
+		if err := s.UpsertVacancy(map[string]interface{}{"id": "1"}); err != nil {
+			t.Fatal(err)
+		}
+		sent := mt.GetStartedEvent().Command
+		if w, err := sent.LookupErr("writeConcern", "w"); err != nil || w.StringValue() != "majority" {
+			t.Errorf("update sent without w=majority: %v", sent)
+		}
+
+		if _, err := s.LookupVacancy("2"); err != nil {
+			t.Fatal(err)
+		}
+		sent = mt.GetStartedEvent().Command
+		if mode, err := sent.LookupErr("$readPreference", "mode"); err != nil || mode.StringValue() != "secondaryPreferred" {
+			t.Errorf("find sent without the secondaryPreferred read preference: %v", sent)
+		}
+	})
+}
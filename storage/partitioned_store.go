@@ -0,0 +1,254 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"hh_it_scrapper/api"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// PartitionedStore routes new vacancies into one collection per publication
+// month, named <prefix>_YYYY_MM. Existence and dedup checks look at every
+// partition. A stored vacancy stays in the partition that holds it, even if
+// it is later re-published in another month, so it is never duplicated.
+type PartitionedStore struct {
+	Database  *mongo.Database
+	Prefix    string
+	BatchSize int32
+	// UniqueDescriptions adds the unique description_hash index to each
+	// partition. MongoDB enforces it per collection, so only the scraper's
+	// own dedup check keeps a description out of two partitions.
+	UniqueDescriptions bool
+	collectionOpts     []*options.CollectionOptions
+
+	lazy       bool
+	mu         sync.RWMutex
+	partitions map[string]*MongoStore
+	hashes     sync.Map
+}
+
+func NewPartitionedStore(db *mongo.Database, prefix string, collectionOpts ...*options.CollectionOptions) *PartitionedStore {
+	return &PartitionedStore{
+		Database:       db,
+		Prefix:         prefix,
+		collectionOpts: collectionOpts,
+		partitions:     make(map[string]*MongoStore),
+	}
+}
+
+// Open attaches every existing partition, preloading their ids and hashes
+// unless lazy is set.
+func (s *PartitionedStore) Open(ctx context.Context, lazy bool) error {
+	s.lazy = lazy
+	names, err := s.Database.ListCollectionNames(ctx, bson.M{"name": bson.M{"$regex": "^" + s.Prefix + `_(\d{4}_\d{2}|undated)$`}})
+	if err != nil {
+		return fmt.Errorf("failed to list partitions: %w", err)
+	}
+	for _, name := range names {
+		if _, err := s.partition(ctx, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PartitionName returns the collection a vacancy belongs in, derived from
+// its published_at. Vacancies without a parseable date go to <prefix>_undated.
+func PartitionName(prefix string, data map[string]interface{}) string {
+	publishedAt, _ := data["published_at"].(string)
+	published, err := time.Parse(api.TimeLayout, publishedAt)
+	if err != nil {
+		return prefix + "_undated"
+	}
+	return prefix + "_" + published.Format("2006_01")
+}
+
+func (s *PartitionedStore) partition(ctx context.Context, name string) (*MongoStore, error) {
+	s.mu.RLock()
+	store, ok := s.partitions[name]
+	s.mu.RUnlock()
+	if ok {
+		return store, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if store, ok := s.partitions[name]; ok {
+		return store, nil
+	}
+
+	collection := s.Database.Collection(name, s.collectionOpts...)
+	if _, err := collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "id", Value: 1}}},
+		{Keys: bson.D{{Key: "description_hash", Value: 1}}},
+	}); err != nil {
+		return nil, fmt.Errorf("failed to create indexes on %s: %w", name, err)
+	}
+	if s.UniqueDescriptions {
+		if _, err := collection.Indexes().CreateOne(ctx, uniqueDescriptionIndex); err != nil {
+			return nil, fmt.Errorf("failed to create unique description_hash index on %s: %w", name, err)
+		}
+	}
+
+	store = &MongoStore{Collection: collection, BatchSize: s.BatchSize}
+	if s.lazy {
+		store.UseLazyLookups()
+	} else if err := store.LoadExistingData(); err != nil {
+		return nil, fmt.Errorf("partition %s: %w", name, err)
+	}
+	s.partitions[name] = store
+	return store, nil
+}
+
+func (s *PartitionedStore) all() []*MongoStore {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	names := make([]string, 0, len(s.partitions))
+	for name := range s.partitions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	stores := make([]*MongoStore, 0, len(names))
+	for _, name := range names {
+		stores = append(stores, s.partitions[name])
+	}
+	return stores
+}
+
+// route returns the partition already holding the vacancy, or the one its
+// published_at selects for a new vacancy.
+func (s *PartitionedStore) route(data map[string]interface{}) (*MongoStore, error) {
+	if id, ok := data["id"].(string); ok {
+		holder, err := s.holder(id)
+		if err != nil {
+			return nil, err
+		}
+		if holder != nil {
+			return holder, nil
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), lookupTimeout)
+	defer cancel()
+	return s.partition(ctx, PartitionName(s.Prefix, data))
+}
+
+func (s *PartitionedStore) holder(id string) (*MongoStore, error) {
+	for _, store := range s.all() {
+		exists, err := store.LookupVacancy(id)
+		if err != nil {
+			return nil, err
+		}
+		if exists {
+			return store, nil
+		}
+	}
+	return nil, nil
+}
+
+func (s *PartitionedStore) VacancyExists(id string) bool {
+	exists, _ := s.LookupVacancy(id)
+	return exists
+}
+
+func (s *PartitionedStore) LookupVacancy(id string) (bool, error) {
+	holder, err := s.holder(id)
+	return holder != nil, err
+}
+
+func (s *PartitionedStore) DescriptionHashExists(hash string) bool {
+	if _, ok := s.hashes.Load(hash); ok {
+		return true
+	}
+	for _, store := range s.all() {
+		if store.DescriptionHashExists(hash) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *PartitionedStore) AddDescriptionHash(hash string) {
+	s.hashes.Store(hash, true)
+}
+
+func (s *PartitionedStore) ContentUnchanged(id, hash string) bool {
+	for _, store := range s.all() {
+		if store.ContentUnchanged(id, hash) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *PartitionedStore) StoredAsSnippet(id string) bool {
+	for _, store := range s.all() {
+		if store.StoredAsSnippet(id) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *PartitionedStore) DescriptionHashOwner(hash string) (string, bool) {
+	for _, store := range s.all() {
+		if owner, ok := store.DescriptionHashOwner(hash); ok {
+			return owner, true
+		}
+	}
+	return "", false
+}
+
+func (s *PartitionedStore) UpsertVacancy(data map[string]interface{}) error {
+	store, err := s.route(data)
+	if err != nil {
+		return err
+	}
+	return store.UpsertVacancy(data)
+}
+
+func (s *PartitionedStore) UpsertVacancyTrackingChanges(data map[string]interface{}) (bool, error) {
+	store, err := s.route(data)
+	if err != nil {
+		return false, err
+	}
+	return store.UpsertVacancyTrackingChanges(data)
+}
+
+func (s *PartitionedStore) SetFields(id string, fields map[string]interface{}) error {
+	holder, err := s.holder(id)
+	if err != nil || holder == nil {
+		return err
+	}
+	return holder.SetFields(id, fields)
+}
+
+func (s *PartitionedStore) MaxVacancyID(ctx context.Context) (int64, error) {
+	var max int64
+	for _, store := range s.all() {
+		id, err := store.MaxVacancyID(ctx)
+		if err != nil {
+			return 0, err
+		}
+		if id > max {
+			max = id
+		}
+	}
+	return max, nil
+}
+
+func (s *PartitionedStore) EachVacancy(ctx context.Context, fn func(data map[string]interface{}) error) error {
+	for _, store := range s.all() {
+		if err := store.EachVacancy(ctx, fn); err != nil {
+			return fmt.Errorf("partition %s: %w", store.Collection.Name(), err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package storage
+
+import (
+	"context"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestPartitionName(t *testing.T) {
+	tests := []struct {
+		publishedAt interface{}
+		want        string
+	}{
+		{"2024-06-15T10:00:00+0300", "vacancies_2024_06"},
+		{"2024-07-01T01:00:00+0300", "vacancies_2024_07"},
+		{"2024-06-15", "vacancies_undated"},
+		{nil, "vacancies_undated"},
+	}
+	for _, tt := range tests {
+		data := map[string]interface{}{"id": "1", "published_at": tt.publishedAt}
+		if got := PartitionName("vacancies", data); got != tt.want {
+			t.Errorf("PartitionName(%v) = %s, want %s", tt.publishedAt, got, tt.want)
+		}
+	}
+}
+
+// updatedCollection returns the collection the last update was sent to.
+func updatedCollection(mt *mtest.T) string {
+	mt.Helper()
+	name := ""
+	for _, event := range mt.GetAllStartedEvents() {
+		if event.CommandName == "update" {
+			name = event.Command.Lookup("update").StringValue()
+		}
+	}
+	return name
+}
+
+func TestPartitionedStoreRoutesByMonth(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	mt.Run("mock", func(mt *mtest.T) {
+		t := mt.T
+		ok := mtest.CreateSuccessResponse()
+		s := NewPartitionedStore(mt.DB, "vacancies")
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "test.$cmd.listCollections", mtest.FirstBatch,
+				bson.D{{Key: "name", Value: "vacancies_2024_05"}, {Key: "type", Value: "collection"}}),
+			ok,
+		)
+		if err := s.Open(context.Background(), true); err != nil {
+			t.Fatal(err)
+		}
+
+		tests := []struct {
+			name    string
+			id      string
+			replies []bson.D
+			want    string
+		}{
+			// Not in the May partition, so June is created for it.
+			{"new month", "101", []bson.D{cursorReply(), ok, updateReply}, "vacancies_2024_06"},
+			// Already in May, where it stays although published in June.
+			{"stored earlier", "7", []bson.D{cursorReply(bson.D{{Key: "_id", Value: 1}}), updateReply}, "vacancies_2024_05"},
+			{"known partition", "102", []bson.D{cursorReply(), cursorReply(), updateReply}, "vacancies_2024_06"},
+		}
+		for _, tt := range tests {
+			mt.ClearEvents()
+			mt.AddMockResponses(tt.replies...)
+			if err := s.UpsertVacancy(map[string]interface{}{"id": tt.id, "published_at": "2024-06-15T10:00:00+0300"}); err != nil {
+				t.Fatalf("%s: %v", tt.name, err)
+			}
+			if got := updatedCollection(mt); got != tt.want {
+				t.Errorf("%s: vacancy %s written to %q, want %q", tt.name, tt.id, got, tt.want)
+			}
+		}
+
+		var created []string
+		for _, event := range mt.GetAllStartedEvents() {
+			if event.CommandName == "createIndexes" {
+				created = append(created, event.Command.Lookup("createIndexes").StringValue())
+			}
+		}
+		if len(created) != 0 {
+			t.Errorf("indexes recreated on %v for a known partition", created)
+		}
+	})
+}
+
+func TestPartitionedStoreDedupSpansPartitions(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	mt.Run("mock", func(mt *mtest.T) {
+		t := mt.T
+		ok := mtest.CreateSuccessResponse()
+		s := NewPartitionedStore(mt.DB, "vacancies")
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "test.$cmd.listCollections", mtest.FirstBatch,
+				bson.D{{Key: "name", Value: "vacancies_2024_05"}},
+				bson.D{{Key: "name", Value: "vacancies_2024_06"}}),
+			ok, ok,
+		)
+		if err := s.Open(context.Background(), true); err != nil {
+			t.Fatal(err)
+		}
+
+		// The hash is only stored in the June partition.
+		mt.AddMockResponses(cursorReply(), cursorReply(bson.D{{Key: "_id", Value: 1}}))
+		if !s.DescriptionHashExists("abc") {
+			t.Error("hash stored in a later partition not found")
+		}
+		mt.AddMockResponses(cursorReply(), cursorReply())
+		if exists, err := s.LookupVacancy("101"); exists || err != nil {
+			t.Errorf("LookupVacancy = %v, %v, want false", exists, err)
+		}
+	})
+}
@@ -0,0 +1,52 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	RunStatusRunning   = "running"
+	RunStatusSucceeded = "succeeded"
+	RunStatusFailed    = "failed"
+)
+
+// RunLog records each execution in the runs collection: a document is
+// inserted when the run starts and finalized with its status and stats.
+type RunLog struct {
+	Collection *mongo.Collection
+}
+
+func (l *RunLog) Start(ctx context.Context, runID string, params map[string]interface{}) error {
+	_, err := l.Collection.UpdateOne(ctx, bson.M{"run_id": runID}, bson.M{"$set": bson.M{
+		"run_id":     runID,
+		"started_at": time.Now().UTC(),
+		"status":     RunStatusRunning,
+		"params":     params,
+	}}, options.Update().SetUpsert(true))
+	if err != nil {
+		return fmt.Errorf("failed to record run start: %w", err)
+	}
+	return nil
+}
+
+func (l *RunLog) Finish(ctx context.Context, runID, status, runErr string, stats interface{}) error {
+	set := bson.M{
+		"finished_at": time.Now().UTC(),
+		"status":      status,
+		"stats":       stats,
+	}
+	if runErr != "" {
+		set["error"] = runErr
+	}
+	_, err := l.Collection.UpdateOne(ctx, bson.M{"run_id": runID}, bson.M{"$set": set}, options.Update().SetUpsert(true))
+	if err != nil {
+		return fmt.Errorf("failed to record run finish: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package storage
+
+import (
+	"context"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestRunLog(t *testing.T) {
+	withMockStore(t, func(mt *mtest.T, s *MongoStore) {
+		t := mt.T
+		runs := &RunLog{Collection: s.Collection}
+		mt.AddMockResponses(updateReply, updateReply, updateReply)
+
+		if err := runs.Start(context.Background(), "run-1", map[string]interface{}{"role": "96"}); err != nil {
+			t.Fatal(err)
+		}
+		if err := runs.Finish(context.Background(), "run-1", RunStatusFailed, "page 0: 502", bson.M{"saved": 3}); err != nil {
+			t.Fatal(err)
+		}
+		if err := runs.Finish(context.Background(), "run-2", RunStatusSucceeded, "", bson.M{"saved": 5}); err != nil {
+			t.Fatal(err)
+		}
+
+		events := mt.GetAllStartedEvents()
+		if len(events) != 3 {
+			t.Fatalf("%d commands sent, want 3 updates", len(events))
+		}
+		statement := func(i int) bson.Raw {
+			return events[i].Command.Lookup("updates").Array().Index(0).Value().Document()
+		}
+
+		start := statement(0)
+		if start.Lookup("q", "run_id").StringValue() != "run-1" || !start.Lookup("upsert").Boolean() {
+			t.Errorf("start is not an upsert keyed by run_id: %v", start)
+		}
+		set := start.Lookup("u", "$set").Document()
+		if set.Lookup("status").StringValue() != RunStatusRunning || set.Lookup("params", "role").StringValue() != "96" {
+			t.Errorf("start $set = %v", set)
+		}
+		if _, err := set.LookupErr("started_at"); err != nil {
+			t.Error("started_at not recorded")
+		}
+
+		set = statement(1).Lookup("u", "$set").Document()
+		if set.Lookup("status").StringValue() != RunStatusFailed || set.Lookup("error").StringValue() != "page 0: 502" {
+			t.Errorf("failed finish $set = %v", set)
+		}
+		if set.Lookup("stats", "saved").Int32() != 3 {
+			t.Errorf("stats = %v", set.Lookup("stats"))
+		}
+
+		set = statement(2).Lookup("u", "$set").Document()
+		if set.Lookup("status").StringValue() != RunStatusSucceeded {
+			t.Errorf("succeeded finish $set = %v", set)
+		}
+		if _, err := set.LookupErr("error"); err == nil {
+			t.Error("error recorded for a successful run")
+		}
+	})
+}
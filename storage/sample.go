@@ -0,0 +1,102 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sort"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// SampleFilter narrows Sample to vacancies published in [PublishedFrom,
+// PublishedTo) with the given professional role. Empty fields match all.
+type SampleFilter struct {
+	PublishedFrom string
+	PublishedTo   string
+	Role          string
+}
+
+func (f SampleFilter) query() bson.M {
+	query := bson.M{}
+	published := bson.M{}
+	if f.PublishedFrom != "" {
+		published["$gte"] = f.PublishedFrom
+	}
+	if f.PublishedTo != "" {
+		published["$lt"] = f.PublishedTo
+	}
+	if len(published) > 0 {
+		query["published_at"] = published
+	}
+	if f.Role != "" {
+		query["professional_roles.id"] = f.Role
+	}
+	return query
+}
+
+// Sample returns up to n random vacancies matching filter. A nil rng uses
+// $sample on the server. With an rng the matching ids are read in sorted
+// order and chosen client-side, so the same seed picks the same documents
+// as long as the collection is unchanged.
+func (s *MongoStore) Sample(ctx context.Context, filter SampleFilter, n int, rng *rand.Rand) ([]map[string]interface{}, error) {
+	query := filter.query()
+	if rng == nil {
+		cursor, err := s.Collection.Aggregate(ctx, mongo.Pipeline{
+			{{Key: "$match", Value: query}},
+			{{Key: "$sample", Value: bson.D{{Key: "size", Value: n}}}},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to sample vacancies: %w", err)
+		}
+		return decodeAll(ctx, cursor)
+	}
+
+	cursor, err := s.Collection.Find(ctx, query, s.scanOptions().SetProjection(bson.M{"id": 1}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list vacancy ids: %w", err)
+	}
+	var ids []string
+	for cursor.Next(ctx) {
+		var doc struct {
+			ID string `bson:"id"`
+		}
+		if err := cursor.Decode(&doc); err != nil {
+			cursor.Close(ctx)
+			return nil, fmt.Errorf("failed to decode vacancy id: %w", err)
+		}
+		ids = append(ids, doc.ID)
+	}
+	cursor.Close(ctx)
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.Strings(ids)
+	rng.Shuffle(len(ids), func(i, j int) { ids[i], ids[j] = ids[j], ids[i] })
+	if len(ids) > n {
+		ids = ids[:n]
+	}
+
+	cursor, err = s.Collection.Find(ctx, bson.M{"id": bson.M{"$in": ids}}, options.Find().SetSort(bson.D{{Key: "id", Value: 1}}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load sampled vacancies: %w", err)
+	}
+	return decodeAll(ctx, cursor)
+}
+
+func decodeAll(ctx context.Context, cursor *mongo.Cursor) ([]map[string]interface{}, error) {
+	defer cursor.Close(ctx)
+	var docs []map[string]interface{}
+	for cursor.Next(ctx) {
+		var doc bson.M
+		if err := cursor.Decode(&doc); err != nil {
+			return nil, fmt.Errorf("failed to decode vacancy: %w", err)
+		}
+		delete(doc, "_id")
+		docs = append(docs, plainDocument(doc))
+	}
+	return docs, cursor.Err()
+}
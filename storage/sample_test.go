@@ -0,0 +1,90 @@
+package storage
+
+import (
+	"context"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestSampleServerSide(t *testing.T) {
+	withMockStore(t, func(mt *mtest.T, s *MongoStore) {
+		t := mt.T
+		mt.AddMockResponses(cursorReply(
+			bson.D{{Key: "_id", Value: 1}, {Key: "id", Value: "101"}},
+			bson.D{{Key: "_id", Value: 2}, {Key: "id", Value: "102"}},
+		))
+		filter := SampleFilter{PublishedFrom: "2024-03-01", PublishedTo: "2024-04-01", Role: "96"}
+		docs, err := s.Sample(context.Background(), filter, 2, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(docs) != 2 || docs[0]["id"] != "101" {
+			t.Errorf("docs = %v, want the 2 sampled vacancies", docs)
+		}
+		if _, ok := docs[0]["_id"]; ok {
+			t.Error("_id not stripped")
+		}
+
+		pipeline := mt.GetStartedEvent().Command.Lookup("pipeline").Array()
+		match := pipeline.Index(0).Value().Document().Lookup("$match").Document()
+		if got := match.Lookup("published_at", "$gte").StringValue(); got != "2024-03-01" {
+			t.Errorf("published_at $gte = %q", got)
+		}
+		if got := match.Lookup("published_at", "$lt").StringValue(); got != "2024-04-01" {
+			t.Errorf("published_at $lt = %q", got)
+		}
+		if got := match.Lookup("professional_roles.id").StringValue(); got != "96" {
+			t.Errorf("role filter = %q", got)
+		}
+		if size := pipeline.Index(1).Value().Document().Lookup("$sample", "size").AsInt64(); size != 2 {
+			t.Errorf("$sample size = %d, want 2", size)
+		}
+	})
+}
+
+func TestSampleFilterEmptyMatchesAll(t *testing.T) {
+	if query := (SampleFilter{}).query(); len(query) != 0 {
+		t.Errorf("empty filter = %v, want no conditions", query)
+	}
+}
+
+func TestSampleSeeded(t *testing.T) {
+	sampled := func(seed int64, stored ...string) string {
+		var ids []bson.D
+		for _, id := range stored {
+			ids = append(ids, bson.D{{Key: "id", Value: id}})
+		}
+		var got string
+		withMockStore(t, func(mt *mtest.T, s *MongoStore) {
+			t := mt.T
+			mt.AddMockResponses(cursorReply(ids...), cursorReply(bson.D{{Key: "id", Value: "x"}}))
+			if _, err := s.Sample(context.Background(), SampleFilter{Role: "96"}, 2, rand.New(rand.NewSource(seed))); err != nil {
+				t.Fatal(err)
+			}
+			events := mt.GetAllStartedEvents()
+			if role := events[0].Command.Lookup("filter", "professional_roles.id").StringValue(); role != "96" {
+				t.Errorf("id listing filter role = %q", role)
+			}
+			values, _ := events[1].Command.Lookup("filter", "id", "$in").Array().Values()
+			var picked []string
+			for _, value := range values {
+				picked = append(picked, value.StringValue())
+			}
+			got = strings.Join(picked, ",")
+		})
+		return got
+	}
+
+	first := sampled(42, "105", "101", "104", "102", "103")
+	if n := len(strings.Split(first, ",")); n != 2 {
+		t.Errorf("sampled %s, want 2 ids", first)
+	}
+	// The server may list ids in any order.
+	if again := sampled(42, "101", "102", "103", "104", "105"); again != first {
+		t.Errorf("seed 42 picked %s, then %s", first, again)
+	}
+}
@@ -0,0 +1,59 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// upsertFilter matches the document by id and, on a sharded collection, by
+// the ShardKey fields as well so mongos routes the write to one shard.
+// Dotted fields such as area.id are read from the nested maps in data.
+func (s *MongoStore) upsertFilter(data map[string]interface{}) bson.M {
+	filter := bson.M{"id": data["id"]}
+	for _, field := range s.ShardKey {
+		if field != "id" {
+			filter[field] = fieldValue(data, field)
+		}
+	}
+	return filter
+}
+
+func fieldValue(data map[string]interface{}, path string) interface{} {
+	var value interface{} = data
+	for _, part := range strings.Split(path, ".") {
+		m, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = m[part]
+	}
+	return value
+}
+
+// EnsureShardKeyIndex creates the compound index on the ShardKey fields,
+// followed by id when the key does not include it. Sharding the collection
+// on that key is left to the cluster administrator.
+func (s *MongoStore) EnsureShardKeyIndex(ctx context.Context) error {
+	if len(s.ShardKey) == 0 {
+		return nil
+	}
+	keys := bson.D{}
+	hasID := false
+	for _, field := range s.ShardKey {
+		keys = append(keys, bson.E{Key: field, Value: 1})
+		hasID = hasID || field == "id"
+	}
+	if !hasID {
+		keys = append(keys, bson.E{Key: "id", Value: 1})
+	}
+	index := mongo.IndexModel{Keys: keys, Options: options.Index().SetName("shard_key")}
+	if _, err := s.Collection.Indexes().CreateOne(ctx, index); err != nil {
+		return fmt.Errorf("failed to create shard key index on %s: %w", s.Collection.Name(), err)
+	}
+	return nil
+}
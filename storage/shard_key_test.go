@@ -0,0 +1,84 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestUpsertFilter(t *testing.T) {
+	data := map[string]interface{}{
+		"id":       "7",
+		"area":     map[string]interface{}{"id": "1", "name": "Moscow"},
+		"employer": map[string]interface{}{"id": "42"},
+	}
+	tests := []struct {
+		shardKey []string
+		want     bson.M
+	}{
+		{nil, bson.M{"id": "7"}},
+		{[]string{"area.id", "id"}, bson.M{"id": "7", "area.id": "1"}},
+		{[]string{"employer.id"}, bson.M{"id": "7", "employer.id": "42"}},
+		{[]string{"schedule.id"}, bson.M{"id": "7", "schedule.id": nil}},
+	}
+	for _, tt := range tests {
+		s := &MongoStore{ShardKey: tt.shardKey}
+		if got := s.upsertFilter(data); fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("shard key %v: filter = %v, want %v", tt.shardKey, got, tt.want)
+		}
+	}
+}
+
+func TestUpsertSendsShardKey(t *testing.T) {
+	withMockStore(t, func(mt *mtest.T, s *MongoStore) {
+		t := mt.T
+		s.ShardKey = []string{"area.id", "id"}
+		s.UseLazyLookups()
+		mt.AddMockResponses(updateReply)
+		if err := s.UpsertVacancy(map[string]interface{}{"id": "7", "area": map[string]interface{}{"id": "1"}}); err != nil {
+			t.Fatal(err)
+		}
+		filter := mt.GetStartedEvent().Command.Lookup("updates").Array().Index(0).Value().Document().Lookup("q").Document()
+		if filter.Lookup("area.id").StringValue() != "1" || filter.Lookup("id").StringValue() != "7" {
+			t.Errorf("upsert filter = %v, want id and area.id", filter)
+		}
+	})
+}
+
+func TestEnsureShardKeyIndex(t *testing.T) {
+	tests := []struct {
+		shardKey []string
+		keys     []string
+	}{
+		{[]string{"area.id", "id"}, []string{"area.id", "id"}},
+		{[]string{"area.id"}, []string{"area.id", "id"}},
+	}
+	for _, tt := range tests {
+		withMockStore(t, func(mt *mtest.T, s *MongoStore) {
+			t := mt.T
+			s.ShardKey = tt.shardKey
+			mt.AddMockResponses(mtest.CreateSuccessResponse())
+			if err := s.EnsureShardKeyIndex(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			index := mt.GetStartedEvent().Command.Lookup("indexes").Array().Index(0).Value().Document()
+			elements, _ := index.Lookup("key").Document().Elements()
+			var keys []string
+			for _, element := range elements {
+				keys = append(keys, element.Key())
+			}
+			if fmt.Sprint(keys) != fmt.Sprint(tt.keys) || index.Lookup("name").StringValue() != "shard_key" {
+				t.Errorf("shard key %v: index %v, want shard_key on %v", tt.shardKey, index, tt.keys)
+			}
+		})
+	}
+
+	withMockStore(t, func(mt *mtest.T, s *MongoStore) {
+		if err := s.EnsureShardKeyIndex(context.Background()); err != nil || len(mt.GetAllStartedEvents()) != 0 {
+			mt.Errorf("EnsureShardKeyIndex without a shard key = %v, sent %d commands", err, len(mt.GetAllStartedEvents()))
+		}
+	})
+}
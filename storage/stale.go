@@ -0,0 +1,54 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// StaleVacancyIDs returns up to limit ids of open vacancies last seen
+// before cutoff, or never stamped with last_seen, oldest first.
+func (s *MongoStore) StaleVacancyIDs(ctx context.Context, cutoff time.Time, limit int) ([]string, error) {
+	query := bson.M{
+		"closed": bson.M{"$ne": true},
+		"$or": bson.A{
+			bson.M{"last_seen": bson.M{"$lt": cutoff}},
+			bson.M{"last_seen": bson.M{"$exists": false}},
+		},
+	}
+	opts := options.Find().
+		SetProjection(bson.M{"id": 1}).
+		SetSort(bson.D{{Key: "last_seen", Value: 1}}).
+		SetLimit(int64(limit))
+	cursor, err := s.Collection.Find(ctx, query, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query stale vacancies: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var ids []string
+	for cursor.Next(ctx) {
+		var doc struct {
+			ID string `bson:"id"`
+		}
+		if err := cursor.Decode(&doc); err != nil {
+			return nil, fmt.Errorf("failed to decode vacancy id: %w", err)
+		}
+		ids = append(ids, doc.ID)
+	}
+	return ids, cursor.Err()
+}
+
+// SetFields sets fields on the stored vacancy with the given id without
+// touching the rest of the document.
+func (s *MongoStore) SetFields(id string, fields map[string]interface{}) error {
+	ctx, cancel := context.WithTimeout(context.Background(), lookupTimeout)
+	defer cancel()
+	if _, err := s.Collection.UpdateOne(ctx, bson.M{"id": id}, bson.M{"$set": fields}); err != nil {
+		return fmt.Errorf("failed to update vacancy %s: %w", id, err)
+	}
+	return nil
+}
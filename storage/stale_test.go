@@ -0,0 +1,63 @@
+package storage
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestStaleVacancyIDs(t *testing.T) {
+	withMockStore(t, func(mt *mtest.T, s *MongoStore) {
+		t := mt.T
+		mt.AddMockResponses(cursorReply(bson.D{{Key: "id", Value: "7"}}, bson.D{{Key: "id", Value: "3"}}))
+		cutoff := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+		ids, err := s.StaleVacancyIDs(context.Background(), cutoff, 50)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Join(ids, ",") != "7,3" {
+			t.Errorf("ids = %v, want the server's order", ids)
+		}
+
+		find := mt.GetStartedEvent().Command
+		filter := find.Lookup("filter").Document()
+		if before := filter.Lookup("$or").Array().Index(0).Value().Document().Lookup("last_seen", "$lt"); !before.Time().Equal(cutoff) {
+			t.Errorf("filter = %v, want last_seen before %v", filter, cutoff)
+		}
+		if closed := filter.Lookup("closed", "$ne"); !closed.Boolean() {
+			t.Errorf("filter = %v, want closed vacancies left out", filter)
+		}
+		if limit := find.Lookup("limit").AsInt64(); limit != 50 {
+			t.Errorf("limit = %d, want 50", limit)
+		}
+		if order := find.Lookup("sort", "last_seen").AsInt64(); order != 1 {
+			t.Errorf("sort = %v, want oldest first", find.Lookup("sort"))
+		}
+
+		mt.AddMockResponses(errorReply)
+		if _, err := s.StaleVacancyIDs(context.Background(), cutoff, 50); err == nil {
+			t.Error("query error swallowed")
+		}
+	})
+}
+
+func TestSetFields(t *testing.T) {
+	withMockStore(t, func(mt *mtest.T, s *MongoStore) {
+		t := mt.T
+		mt.AddMockResponses(updateReply)
+		if err := s.SetFields("7", map[string]interface{}{"closed": true}); err != nil {
+			t.Fatal(err)
+		}
+		update := sentUpdate(mt)
+		if !update.Lookup("$set", "closed").Boolean() {
+			t.Errorf("update = %v, want $set closed", update)
+		}
+		if _, err := update.LookupErr("$set", "id"); err == nil {
+			t.Errorf("update = %v touches other fields", update)
+		}
+	})
+}
@@ -0,0 +1,64 @@
+package storage
+
+import "context"
+
+type Store interface {
+	VacancyExists(id string) bool
+	DescriptionHashExists(hash string) bool
+	AddDescriptionHash(hash string)
+	UpsertVacancy(data map[string]interface{}) error
+}
+
+// VacancyLookup is VacancyExists for stores whose lookups can fail. A failed
+// lookup is reported instead of being answered as "not stored".
+type VacancyLookup interface {
+	LookupVacancy(id string) (bool, error)
+}
+
+type ChangeTracker interface {
+	UpsertVacancyTrackingChanges(data map[string]interface{}) (bool, error)
+}
+
+type Flusher interface {
+	Flush(ctx context.Context) error
+	Pending() int
+}
+
+// WriteNotifier is implemented by stores that buffer writes. NotifyWrites
+// registers fn, which is called for every buffered document once it was
+// written (err nil) or rejected (err ErrDuplicateDescription), and reports
+// whether writes are actually buffered.
+type WriteNotifier interface {
+	NotifyWrites(fn func(data map[string]interface{}, err error)) bool
+}
+
+type ContentChecker interface {
+	ContentUnchanged(id, hash string) bool
+}
+
+// VacancyScanner streams every stored vacancy to fn, stopping at the first
+// error fn returns.
+type VacancyScanner interface {
+	EachVacancy(ctx context.Context, fn func(data map[string]interface{}) error) error
+}
+
+// DescriptionOwner reports which vacancy id first stored a description hash.
+type DescriptionOwner interface {
+	DescriptionHashOwner(hash string) (string, bool)
+}
+
+// FieldSetter updates individual fields of a stored vacancy, e.g. to stamp
+// last_seen on an unchanged vacancy or mark a vanished one closed.
+type FieldSetter interface {
+	SetFields(id string, fields map[string]interface{}) error
+}
+
+// SnippetChecker reports vacancies stored from a --search-only snippet,
+// whose details were never fetched.
+type SnippetChecker interface {
+	StoredAsSnippet(id string) bool
+}
+
+type HighWaterMarker interface {
+	MaxVacancyID(ctx context.Context) (int64, error)
+}
@@ -0,0 +1,41 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrDuplicateDescription is returned by UpsertVacancy when the unique
+// description_hash index rejected the write.
+var ErrDuplicateDescription = errors.New("description already stored")
+
+// uniqueDescriptionIndex is unique on description_hash but only covers
+// non-empty hashes, so documents without one never collide.
+var uniqueDescriptionIndex = mongo.IndexModel{
+	Keys: bson.D{{Key: "description_hash", Value: 1}},
+	Options: options.Index().
+		SetName("description_hash_unique").
+		SetUnique(true).
+		SetPartialFilterExpression(bson.M{"description_hash": bson.M{"$type": "string", "$gt": ""}}),
+}
+
+// EnsureUniqueDescriptionIndex creates the partial unique description_hash
+// index. It fails if stored documents already share a hash.
+func (s *MongoStore) EnsureUniqueDescriptionIndex(ctx context.Context) error {
+	if _, err := s.Collection.Indexes().CreateOne(ctx, uniqueDescriptionIndex); err != nil {
+		return fmt.Errorf("failed to create unique description_hash index on %s: %w", s.Collection.Name(), err)
+	}
+	return nil
+}
+
+// isDuplicateDescription reports whether err is a duplicate key error from
+// a description_hash index rather than the id index.
+func isDuplicateDescription(err error) bool {
+	return mongo.IsDuplicateKeyError(err) && strings.Contains(err.Error(), "description_hash")
+}
@@ -0,0 +1,58 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestEnsureUniqueDescriptionIndex(t *testing.T) {
+	withMockStore(t, func(mt *mtest.T, s *MongoStore) {
+		t := mt.T
+		mt.AddMockResponses(mtest.CreateSuccessResponse())
+		if err := s.EnsureUniqueDescriptionIndex(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		index := mt.GetStartedEvent().Command.Lookup("indexes").Array().Index(0).Value().Document()
+		if !index.Lookup("unique").Boolean() || index.Lookup("key", "description_hash").IsZero() {
+			t.Errorf("index = %v, want unique on description_hash", index)
+		}
+		if _, err := index.LookupErr("partialFilterExpression", "description_hash", "$gt"); err != nil {
+			t.Errorf("index = %v, want it to skip empty hashes", index)
+		}
+
+		mt.AddMockResponses(mtest.CreateCommandErrorResponse(mtest.CommandError{Code: 11000, Name: "DuplicateKey", Message: "E11000 duplicate key error"}))
+		if err := s.EnsureUniqueDescriptionIndex(context.Background()); err == nil {
+			t.Error("index created over stored duplicates")
+		}
+	})
+}
+
+func TestUpsertDuplicateDescription(t *testing.T) {
+	tests := []struct {
+		name      string
+		message   string
+		duplicate bool
+	}{
+		{"description hash", "E11000 duplicate key error collection: test.vacancies index: description_hash_unique dup key: { description_hash: \"abc\" }", true},
+		{"id", "E11000 duplicate key error collection: test.vacancies index: id_1 dup key: { id: \"1\" }", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withMockStore(t, func(mt *mtest.T, s *MongoStore) {
+				t := mt.T
+				s.UseLazyLookups()
+				mt.AddMockResponses(mtest.CreateWriteErrorsResponse(mtest.WriteError{Index: 0, Code: 11000, Message: tt.message}))
+				err := s.UpsertVacancy(map[string]interface{}{"id": "2", "description_hash": "abc"})
+				if err == nil {
+					t.Fatal("duplicate key error swallowed")
+				}
+				if got := errors.Is(err, ErrDuplicateDescription); got != tt.duplicate {
+					t.Errorf("error %v is ErrDuplicateDescription: %v, want %v", err, got, tt.duplicate)
+				}
+			})
+		})
+	}
+}
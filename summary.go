@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+)
+
+type targetSummary struct {
+	Name  string `json:"name" bson:"name"`
+	Saved int64  `json:"saved" bson:"saved"`
+	Pages int64  `json:"pages" bson:"pages"`
+}
+
+// runSummary is the end-of-run report printed as text or JSON.
+type runSummary struct {
+	RunID           string          `json:"run_id" bson:"run_id"`
+	Duration        string          `json:"duration" bson:"duration"`
+	TokenRateLimits []int           `json:"token_rate_limits,omitempty" bson:"token_rate_limits,omitempty"`
+	Saved           int64           `json:"saved" bson:"saved"`
+	Targets         []targetSummary `json:"targets,omitempty" bson:"targets,omitempty"`
+	Seen            int64           `json:"seen" bson:"seen"`
+	Found           int64           `json:"found" bson:"found"`
+	LowCoverage     bool            `json:"low_coverage" bson:"low_coverage"`
+	Failed          int64           `json:"failed" bson:"failed"`
+	Duplicates      int64           `json:"duplicates" bson:"duplicates"`
+	DeadLettered    int64           `json:"dead_lettered" bson:"dead_lettered"`
+	Unchanged       int64           `json:"unchanged" bson:"unchanged"`
+	OutOfWindow     int64           `json:"out_of_window" bson:"out_of_window"`
+	Flushed         int64           `json:"flushed" bson:"flushed"`
+	Overflowed      int64           `json:"overflowed" bson:"overflowed"`
+	Latency         latencySummary  `json:"detail_latency" bson:"detail_latency"`
+	Warnings        []string        `json:"warnings,omitempty" bson:"warnings,omitempty"`
+	ExitCode        int             `json:"exit_code" bson:"exit_code"`
+	ExitDescription string          `json:"exit_description" bson:"exit_description"`
+}
+
+func (s runSummary) writeText(w io.Writer) {
+	fmt.Fprintf(w, "Run ID: %s\n", s.RunID)
+	if len(s.TokenRateLimits) > 1 {
+		fmt.Fprintf(w, "Rate limits per token: %v\n", s.TokenRateLimits)
+	}
+	fmt.Fprintf(w, "Number of successfully saved vacancies: %d\n", s.Saved)
+	if len(s.Targets) > 1 {
+		for _, t := range s.Targets {
+			fmt.Fprintf(w, "  %s: %d (%d search pages)\n", t.Name, t.Saved, t.Pages)
+		}
+	}
+	if s.Found > 0 {
+		fmt.Fprintf(w, "Unique vacancies seen in search: %d of %d reported found\n", s.Seen, s.Found)
+		if s.LowCoverage {
+			fmt.Fprintln(w, "Coverage warning: fewer vacancies seen than found, narrow the date window or split targets")
+		}
+	}
+	if s.Failed > 0 {
+		fmt.Fprintf(w, "Vacancies that failed after retries: %d\n", s.Failed)
+	}
+	if s.Duplicates > 0 {
+		fmt.Fprintf(w, "Vacancies with a duplicate description: %d\n", s.Duplicates)
+	}
+	if s.DeadLettered > 0 {
+		fmt.Fprintf(w, "Vacancies sent to the dead-letter queue: %d\n", s.DeadLettered)
+	}
+	if s.Unchanged > 0 {
+		fmt.Fprintf(w, "Unchanged vacancies skipped: %d\n", s.Unchanged)
+	}
+	if s.OutOfWindow > 0 {
+		fmt.Fprintf(w, "Vacancies discarded as published outside the window: %d\n", s.OutOfWindow)
+	}
+	if s.Flushed > 0 {
+		fmt.Fprintf(w, "Buffered vacancies flushed on shutdown: %d\n", s.Flushed)
+	}
+	if s.Overflowed > 0 {
+		fmt.Fprintf(w, "Vacancies spilled or dropped on a full prefetch buffer: %d\n", s.Overflowed)
+	}
+	if s.Latency.Count > 0 {
+		fmt.Fprintf(w, "Detail fetch latency: min %.0fms, avg %.0fms, p95 %.0fms over %d requests\n",
+			s.Latency.MinMS, s.Latency.AvgMS, s.Latency.P95MS, s.Latency.Count)
+	}
+	for _, warning := range s.Warnings {
+		fmt.Fprintf(w, "Config warning: %s\n", warning)
+	}
+	fmt.Fprintf(w, "Exit code: %d (%s)\n", s.ExitCode, s.ExitDescription)
+}
+
+// writeSummary writes s to dest: "-" is stdout, an empty dest suppresses
+// the summary and anything else is a file path that is overwritten.
+func writeSummary(s runSummary, dest, format string) error {
+	if dest == "" {
+		return nil
+	}
+
+	var w io.Writer = os.Stdout
+	if dest != "-" {
+		file, err := os.Create(dest)
+		if err != nil {
+			return fmt.Errorf("failed to create summary file: %w", err)
+		}
+		defer file.Close()
+		w = file
+	}
+
+	if format == "json" {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(s)
+	}
+	s.writeText(w)
+	return nil
+}
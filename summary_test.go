@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"hh_it_scrapper/config"
+)
+
+func TestSummaryReportsWarnings(t *testing.T) {
+	summary := runSummary{RunID: "run-1", Warnings: []string{"per-page 250 exceeds the API maximum, clamped to 100"}}
+	dir := t.TempDir()
+
+	textPath := filepath.Join(dir, "summary.txt")
+	if err := writeSummary(summary, textPath, "text"); err != nil {
+		t.Fatal(err)
+	}
+	text, _ := os.ReadFile(textPath)
+	if !strings.Contains(string(text), "per-page 250 exceeds the API maximum, clamped to 100") {
+		t.Errorf("text summary lacks the warning:\n%s", text)
+	}
+
+	jsonPath := filepath.Join(dir, "summary.json")
+	if err := writeSummary(summary, jsonPath, "json"); err != nil {
+		t.Fatal(err)
+	}
+	var decoded runSummary
+	data, _ := os.ReadFile(jsonPath)
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded.Warnings) != 1 {
+		t.Errorf("JSON summary warnings = %q", decoded.Warnings)
+	}
+}
+
+// captureStdout returns what fn writes to stdout.
+func captureStdout(t *testing.T, fn func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+	fn()
+	w.Close()
+	data, _ := io.ReadAll(r)
+	return string(data)
+}
+
+func TestWriteSummaryDestinations(t *testing.T) {
+	summary := runSummary{RunID: "run-1", Saved: 42, ExitDescription: "success"}
+	wantText := "Run ID: run-1\nNumber of successfully saved vacancies: 42\nExit code: 0 (success)\n"
+
+	path := filepath.Join(t.TempDir(), "summary.txt")
+	var err error
+	if out := captureStdout(t, func() { err = writeSummary(summary, path, "text") }); err != nil || out != "" {
+		t.Fatalf("writing to a file: error %v, stdout %q", err, out)
+	}
+	if text, _ := os.ReadFile(path); string(text) != wantText {
+		t.Errorf("file summary = %q, want %q", text, wantText)
+	}
+
+	if out := captureStdout(t, func() { err = writeSummary(summary, "-", "text") }); err != nil || out != wantText {
+		t.Errorf("stdout summary = %q, %v, want %q", out, err, wantText)
+	}
+
+	out := captureStdout(t, func() { err = writeSummary(summary, "-", "json") })
+	var decoded runSummary
+	if err != nil || json.Unmarshal([]byte(out), &decoded) != nil || decoded.RunID != "run-1" || decoded.Saved != 42 {
+		t.Errorf("JSON summary on stdout = %q, %v", out, err)
+	}
+
+	if out := captureStdout(t, func() { err = writeSummary(summary, "", "json") }); err != nil || out != "" {
+		t.Errorf("suppressed summary: error %v, stdout %q", err, out)
+	}
+
+	if err := writeSummary(summary, filepath.Join(t.TempDir(), "missing", "summary.txt"), "text"); err == nil {
+		t.Error("unwritable summary path accepted")
+	}
+}
+
+func TestValidateConfigSummaryFormat(t *testing.T) {
+	cfg := loadTestConfig(t)
+	if cfg.SummaryOut != "-" || cfg.SummaryFormat != "text" {
+		t.Errorf("summary defaults to %q as %q, want text on stdout", cfg.SummaryOut, cfg.SummaryFormat)
+	}
+	setArgs(t, append(append([]string{}, testArgs...), "--summary-format=yaml")...)
+	if err := validateConfig(config.LoadConfig()); err == nil {
+		t.Error("--summary-format=yaml accepted")
+	}
+}
@@ -0,0 +1,58 @@
+package transform
+
+import "strings"
+
+// NormalizeContacts turns the API's contacts block into
+// {"name", "email", "phones": ["+7 (999) 123-45-67", ...]}, keeping only
+// the fields that are set. It returns false when contacts are absent, null
+// or empty. Already normalized input passes through unchanged.
+func NormalizeContacts(raw interface{}) (map[string]interface{}, bool) {
+	block, ok := raw.(map[string]interface{})
+	if !ok {
+		return nil, false
+	}
+
+	contacts := map[string]interface{}{}
+	if name, ok := block["name"].(string); ok && name != "" {
+		contacts["name"] = name
+	}
+	if email, ok := block["email"].(string); ok && email != "" {
+		contacts["email"] = email
+	}
+
+	var phones []interface{}
+	list, _ := block["phones"].([]interface{})
+	for _, item := range list {
+		if phone := formatPhone(item); phone != "" {
+			phones = append(phones, phone)
+		}
+	}
+	if len(phones) > 0 {
+		contacts["phones"] = phones
+	}
+
+	return contacts, len(contacts) > 0
+}
+
+func formatPhone(item interface{}) string {
+	switch phone := item.(type) {
+	case string:
+		return phone
+	case map[string]interface{}:
+		if formatted, ok := phone["formatted"].(string); ok && formatted != "" {
+			return formatted
+		}
+		var parts []string
+		for _, key := range []string{"country", "city", "number"} {
+			if part, ok := phone[key].(string); ok && part != "" {
+				parts = append(parts, part)
+			}
+		}
+		if len(parts) == 0 {
+			return ""
+		}
+		return "+" + strings.Join(parts, " ")
+	default:
+		return ""
+	}
+}
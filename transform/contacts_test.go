@@ -0,0 +1,45 @@
+package transform
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNormalizeContacts(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  interface{}
+		want map[string]interface{}
+	}{
+		{"absent", nil, nil},
+		{"empty", map[string]interface{}{"name": "", "phones": []interface{}{}}, nil},
+		{
+			"full",
+			map[string]interface{}{
+				"name":  "Anna Recruiter",
+				"email": "anna@example.com",
+				"phones": []interface{}{
+					map[string]interface{}{"country": "7", "city": "999", "number": "1234567", "formatted": "+7 (999) 123-45-67"},
+					map[string]interface{}{"country": "7", "city": "495", "number": "7654321", "formatted": nil},
+					map[string]interface{}{"comment": "after 18:00"},
+				},
+			},
+			map[string]interface{}{
+				"name":   "Anna Recruiter",
+				"email":  "anna@example.com",
+				"phones": []interface{}{"+7 (999) 123-45-67", "+7 495 7654321"},
+			},
+		},
+		{
+			"already normalized",
+			map[string]interface{}{"email": "anna@example.com", "phones": []interface{}{"+7 (999) 123-45-67"}},
+			map[string]interface{}{"email": "anna@example.com", "phones": []interface{}{"+7 (999) 123-45-67"}},
+		},
+	}
+	for _, tt := range tests {
+		got, ok := NormalizeContacts(tt.raw)
+		if ok != (tt.want != nil) || tt.want != nil && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: NormalizeContacts = %v, %v, want %v", tt.name, got, ok, tt.want)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package transform
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// dedupSeparator joins field values; it does not occur in API text.
+const dedupSeparator = "\x1f"
+
+// DedupKey concatenates the values of the dot-separated fields of doc in
+// the given order, ready to be hashed. Strings are used as they are and
+// other values as JSON, whose object keys are sorted. A single string field
+// yields exactly that string, so the default key is the bare description.
+// It reports false when none of the fields is set.
+func DedupKey(doc map[string]interface{}, fields []string) (string, bool) {
+	parts := make([]string, len(fields))
+	found := false
+	for i, field := range fields {
+		value, ok := lookupPath(doc, field)
+		if !ok || value == nil {
+			continue
+		}
+		found = true
+		if s, ok := value.(string); ok {
+			parts[i] = s
+			continue
+		}
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			continue
+		}
+		parts[i] = string(encoded)
+	}
+	return strings.Join(parts, dedupSeparator), found
+}
+
+func lookupPath(doc map[string]interface{}, path string) (interface{}, bool) {
+	parts := strings.Split(path, ".")
+	current := doc
+	for _, part := range parts[:len(parts)-1] {
+		next, ok := current[part].(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		current = next
+	}
+	value, ok := current[parts[len(parts)-1]]
+	return value, ok
+}
@@ -0,0 +1,68 @@
+package transform
+
+import "testing"
+
+func TestDedupKey(t *testing.T) {
+	original := map[string]interface{}{
+		"name":        "Go developer",
+		"description": "<p>We write Go</p>",
+		"employer":    map[string]interface{}{"id": "42", "name": "Acme"},
+	}
+	retitled := map[string]interface{}{
+		"name":        "Senior Go developer",
+		"description": "<p>We write Go</p>",
+		"employer":    map[string]interface{}{"id": "42", "name": "Acme"},
+	}
+	reposted := map[string]interface{}{
+		"name":        "Go developer",
+		"description": "<p>We write Go!</p>",
+		"employer":    map[string]interface{}{"name": "Acme", "id": "42"},
+	}
+	otherEmployer := map[string]interface{}{
+		"name":        "Go developer",
+		"description": "<p>We write Go</p>",
+		"employer":    map[string]interface{}{"id": "7", "name": "Initech"},
+	}
+
+	tests := []struct {
+		name   string
+		fields []string
+		other  map[string]interface{}
+		same   bool
+	}{
+		{"description ignores the title", []string{"description"}, retitled, true},
+		{"description catches edits", []string{"description"}, reposted, false},
+		{"title ignores edited bodies", []string{"name"}, reposted, true},
+		{"title catches retitles", []string{"name"}, retitled, false},
+		{"employer and title", []string{"name", "employer.id"}, reposted, true},
+		{"employer object key order", []string{"employer"}, reposted, true},
+		{"employer and description", []string{"employer.id", "description"}, otherEmployer, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, okA := DedupKey(original, tt.fields)
+			b, okB := DedupKey(tt.other, tt.fields)
+			if !okA || !okB {
+				t.Fatalf("DedupKey found no fields in %v", tt.fields)
+			}
+			if (a == b) != tt.same {
+				t.Errorf("keys %q and %q collide: %v, want %v", a, b, a == b, tt.same)
+			}
+		})
+	}
+}
+
+func TestDedupKeyFields(t *testing.T) {
+	doc := map[string]interface{}{"description": "<p>Body</p>", "name": "Title", "salary": nil}
+	if key, _ := DedupKey(doc, []string{"description"}); key != "<p>Body</p>" {
+		t.Errorf("single field key = %q, want the bare description", key)
+	}
+	// Empty values keep their position, so fields cannot shift into each
+	// other's place.
+	if a, _ := DedupKey(doc, []string{"name", "missing", "description"}); a == "Title"+dedupSeparator+"<p>Body</p>" {
+		t.Errorf("missing field dropped from key %q", a)
+	}
+	if _, ok := DedupKey(doc, []string{"salary", "employer.id"}); ok {
+		t.Error("key reported found with only null and missing fields")
+	}
+}
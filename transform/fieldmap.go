@@ -0,0 +1,158 @@
+package transform
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// FieldMap renames document fields. Keys and values are dot-separated paths,
+// so "employer.name" addresses the name field of the employer subdocument.
+type FieldMap map[string]string
+
+// ParseFieldMap reads a mapping either from a JSON file (when spec names an
+// existing file) or from an inline "from=to,from=to" list.
+func ParseFieldMap(spec string) (FieldMap, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return nil, nil
+	}
+
+	mapping := FieldMap{}
+	if data, err := os.ReadFile(spec); err == nil {
+		if err := json.Unmarshal(data, &mapping); err != nil {
+			return nil, fmt.Errorf("failed to parse field map file: %w", err)
+		}
+	} else {
+		for _, pair := range strings.Split(spec, ",") {
+			from, to, ok := strings.Cut(strings.TrimSpace(pair), "=")
+			if !ok || from == "" || to == "" {
+				return nil, fmt.Errorf("invalid field mapping %q, expected from=to", pair)
+			}
+			mapping[strings.TrimSpace(from)] = strings.TrimSpace(to)
+		}
+	}
+
+	for from, to := range mapping {
+		for _, path := range []string{from, to} {
+			if field, ok := protectedField(path); ok {
+				return nil, fmt.Errorf("field mapping %s=%s touches %s, which the scraper reads back", from, to, field)
+			}
+		}
+	}
+	return mapping, nil
+}
+
+// protectedFields are read back by the scraper itself: for dedup and change
+// detection, partitioning, --reprocess, insert-only bookkeeping or the
+// export, sample and stale-refresh queries. Renaming them would break those
+// silently.
+var protectedFields = []string{
+	"id", "description", "description_hash", "content_hash", "description_history",
+	"published_at", "archived", "raw", "schema_version", "source_query",
+	"area", "salary", "professional_roles",
+	"first_seen", "first_seen_run_id", "last_seen", "closed", "closed_at",
+	"is_duplicate", "duplicate_of", "search_only",
+}
+
+// protectedField returns the protected field that path equals, lies within
+// or contains.
+func protectedField(path string) (string, bool) {
+	for _, field := range protectedFields {
+		if path == field || strings.HasPrefix(path, field+".") || strings.HasPrefix(field, path+".") {
+			return field, true
+		}
+	}
+	return "", false
+}
+
+// Apply renames the mapped fields of doc in place. Missing source fields are
+// ignored, a null source never replaces a field already stored under the
+// target name, and unmapped fields are left untouched.
+func (m FieldMap) Apply(doc map[string]interface{}) {
+	froms := make([]string, 0, len(m))
+	for from := range m {
+		froms = append(froms, from)
+	}
+	sort.Strings(froms)
+
+	moved := make(map[string]interface{}, len(m))
+	for _, from := range froms {
+		if value, ok := removePath(doc, from); ok {
+			moved[m[from]] = value
+		}
+	}
+	for to, value := range moved {
+		if value == nil && hasPath(doc, to) {
+			continue
+		}
+		setPath(doc, to, value)
+	}
+}
+
+// Name returns the path field is stored under once the mapping is applied.
+func (m FieldMap) Name(field string) string {
+	if to, ok := m[field]; ok {
+		return to
+	}
+	return field
+}
+
+// FillMissing sets each of fields to null, under its mapped name, when doc
+// does not have it yet.
+func (m FieldMap) FillMissing(doc map[string]interface{}, fields []string) {
+	for _, field := range fields {
+		if name := m.Name(field); !hasPath(doc, name) {
+			setPath(doc, name, nil)
+		}
+	}
+}
+
+func hasPath(doc map[string]interface{}, path string) bool {
+	parts := strings.Split(path, ".")
+	current := doc
+	for _, part := range parts[:len(parts)-1] {
+		next, ok := current[part].(map[string]interface{})
+		if !ok {
+			return false
+		}
+		current = next
+	}
+	_, ok := current[parts[len(parts)-1]]
+	return ok
+}
+
+func removePath(doc map[string]interface{}, path string) (interface{}, bool) {
+	parts := strings.Split(path, ".")
+	current := doc
+	for _, part := range parts[:len(parts)-1] {
+		next, ok := current[part].(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		current = next
+	}
+
+	last := parts[len(parts)-1]
+	value, ok := current[last]
+	if ok {
+		delete(current, last)
+	}
+	return value, ok
+}
+
+func setPath(doc map[string]interface{}, path string, value interface{}) {
+	parts := strings.Split(path, ".")
+	current := doc
+	for _, part := range parts[:len(parts)-1] {
+		next, ok := current[part].(map[string]interface{})
+		if !ok {
+			next = map[string]interface{}{}
+			current[part] = next
+		}
+		current = next
+	}
+	current[parts[len(parts)-1]] = value
+}
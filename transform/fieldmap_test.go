@@ -0,0 +1,116 @@
+package transform
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestFieldMapApply(t *testing.T) {
+	mapping, err := ParseFieldMap("name=title, alternate_url=url, employer.name=company, address.city=location.city, address.metro=metro")
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc := map[string]interface{}{
+		"name":          "Go developer",
+		"alternate_url": "https://hh.ru/vacancy/1",
+		"url":           "https://api.hh.ru/vacancies/1",
+		"employer":      map[string]interface{}{"id": "42", "name": "Acme"},
+		"address":       map[string]interface{}{"city": "Moscow"},
+		"schedule":      "remote",
+	}
+	mapping.Apply(doc)
+
+	want := map[string]interface{}{
+		"title":    "Go developer",
+		"url":      "https://hh.ru/vacancy/1",
+		"company":  "Acme",
+		"employer": map[string]interface{}{"id": "42"},
+		"address":  map[string]interface{}{},
+		"location": map[string]interface{}{"city": "Moscow"},
+		"schedule": "remote",
+	}
+	if !reflect.DeepEqual(doc, want) {
+		t.Errorf("mapped document = %v, want %v", doc, want)
+	}
+}
+
+func TestFieldMapSwap(t *testing.T) {
+	mapping, err := ParseFieldMap("name=alias,alias=name")
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc := map[string]interface{}{"name": "a", "alias": "b"}
+	mapping.Apply(doc)
+	if doc["name"] != "b" || doc["alias"] != "a" {
+		t.Errorf("swapped document = %v", doc)
+	}
+}
+
+func TestFieldMapKeepsTargetOverNull(t *testing.T) {
+	mapping, err := ParseFieldMap("name=title,schedule=work_schedule")
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc := map[string]interface{}{"name": nil, "title": "Go developer", "work_schedule": "remote"}
+	mapping.Apply(doc)
+
+	want := map[string]interface{}{"title": "Go developer", "work_schedule": "remote"}
+	if !reflect.DeepEqual(doc, want) {
+		t.Errorf("mapped document = %v, want %v", doc, want)
+	}
+
+	doc = map[string]interface{}{"name": nil}
+	mapping.Apply(doc)
+	if value, ok := doc["title"]; !ok || value != nil {
+		t.Errorf("null source with no target = %v, want title null", doc)
+	}
+}
+
+func TestFillMissing(t *testing.T) {
+	mapping, err := ParseFieldMap("name=title,employer=company.info")
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc := map[string]interface{}{"title": "Go developer"}
+	mapping.FillMissing(doc, []string{"name", "employer", "salary"})
+
+	want := map[string]interface{}{
+		"title":   "Go developer",
+		"company": map[string]interface{}{"info": nil},
+		"salary":  nil,
+	}
+	if !reflect.DeepEqual(doc, want) {
+		t.Errorf("filled document = %v, want %v", doc, want)
+	}
+}
+
+func TestParseFieldMapFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fields.json")
+	if err := os.WriteFile(path, []byte(`{"name": "title", "employer.name": "company"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	mapping, err := ParseFieldMap(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (FieldMap{"name": "title", "employer.name": "company"}); !reflect.DeepEqual(mapping, want) {
+		t.Errorf("mapping = %v, want %v", mapping, want)
+	}
+}
+
+func TestParseFieldMapInvalid(t *testing.T) {
+	for _, spec := range []string{
+		"name", "name=", "=title",
+		"description=text", "name=id", "source_query.area=area", "first_seen=seen",
+		"area.id=area_id", "salary.from=pay", "professional_roles=roles",
+	} {
+		if _, err := ParseFieldMap(spec); err == nil {
+			t.Errorf("ParseFieldMap(%q) accepted an invalid mapping", spec)
+		}
+	}
+	if mapping, err := ParseFieldMap(" "); mapping != nil || err != nil {
+		t.Errorf("ParseFieldMap of an empty spec = %v, %v", mapping, err)
+	}
+}
@@ -0,0 +1,46 @@
+package transform
+
+// SalaryFields derives sortable numeric fields from the API's salary block:
+// salary_from_num and salary_to_num mirror the bounds, salary_mid_num is
+// their midpoint (or the only bound of an open-ended range) and has_salary
+// reports whether any bound is set. Missing bounds are stored as null.
+func SalaryFields(raw interface{}) map[string]interface{} {
+	block, _ := raw.(map[string]interface{})
+	from, hasFrom := toFloat(block["from"])
+	to, hasTo := toFloat(block["to"])
+
+	fields := map[string]interface{}{
+		"salary_from_num": nil,
+		"salary_to_num":   nil,
+		"salary_mid_num":  nil,
+		"has_salary":      hasFrom || hasTo,
+	}
+	if hasFrom {
+		fields["salary_from_num"] = from
+		fields["salary_mid_num"] = from
+	}
+	if hasTo {
+		fields["salary_to_num"] = to
+		fields["salary_mid_num"] = to
+	}
+	if hasFrom && hasTo {
+		fields["salary_mid_num"] = (from + to) / 2
+	}
+	return fields
+}
+
+// toFloat accepts the number types produced by both JSON decoding and BSON
+// (for documents read back by --reprocess).
+func toFloat(value interface{}) (float64, bool) {
+	switch n := value.(type) {
+	case float64:
+		return n, true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	}
+	return 0, false
+}
@@ -0,0 +1,33 @@
+package transform
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSalaryFields(t *testing.T) {
+	tests := []struct {
+		name          string
+		salary        interface{}
+		from, to, mid interface{}
+		hasSalary     bool
+	}{
+		{"both", map[string]interface{}{"from": 100000.0, "to": 200000.0, "currency": "RUR"}, 100000.0, 200000.0, 150000.0, true},
+		{"from only", map[string]interface{}{"from": 100000.0, "to": nil}, 100000.0, nil, 100000.0, true},
+		{"to only", map[string]interface{}{"from": nil, "to": 200000.0}, nil, 200000.0, 200000.0, true},
+		{"null bounds", map[string]interface{}{"from": nil, "to": nil}, nil, nil, nil, false},
+		{"null salary", nil, nil, nil, nil, false},
+		{"BSON integers", map[string]interface{}{"from": int32(100000), "to": int64(300000)}, 100000.0, 300000.0, 200000.0, true},
+	}
+	for _, tt := range tests {
+		want := map[string]interface{}{
+			"salary_from_num": tt.from,
+			"salary_to_num":   tt.to,
+			"salary_mid_num":  tt.mid,
+			"has_salary":      tt.hasSalary,
+		}
+		if got := SalaryFields(tt.salary); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: SalaryFields = %v, want %v", tt.name, got, want)
+		}
+	}
+}
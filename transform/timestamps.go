@@ -0,0 +1,31 @@
+package transform
+
+import (
+	"time"
+
+	"hh_it_scrapper/api"
+)
+
+// timestampFields are the API's timestamp strings, each stored as a date
+// under the same name with a _date suffix.
+var timestampFields = []string{"published_at", "created_at", "initial_created_at"}
+
+// Timestamps parses the timestamp fields present in doc into UTC times keyed
+// by "<field>_date". Missing or unparseable fields are left out.
+func Timestamps(doc map[string]interface{}) map[string]interface{} {
+	dates := map[string]interface{}{}
+	for _, field := range timestampFields {
+		value, ok := doc[field].(string)
+		if !ok || value == "" {
+			continue
+		}
+		parsed, err := time.Parse(api.TimeLayout, value)
+		if err != nil {
+			if parsed, err = time.Parse(time.RFC3339, value); err != nil {
+				continue
+			}
+		}
+		dates[field+"_date"] = parsed.UTC()
+	}
+	return dates
+}
@@ -0,0 +1,42 @@
+package transform
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTimestamps(t *testing.T) {
+	dates := Timestamps(map[string]interface{}{
+		"published_at":       "2024-03-01T10:00:00+0300",
+		"created_at":         "2024-02-20T09:30:00Z",
+		"initial_created_at": "2024-01-15T12:00:00+03:00",
+	})
+	want := map[string]time.Time{
+		"published_at_date":       time.Date(2024, 3, 1, 7, 0, 0, 0, time.UTC),
+		"created_at_date":         time.Date(2024, 2, 20, 9, 30, 0, 0, time.UTC),
+		"initial_created_at_date": time.Date(2024, 1, 15, 9, 0, 0, 0, time.UTC),
+	}
+	if len(dates) != len(want) {
+		t.Errorf("dates = %v, want %d fields", dates, len(want))
+	}
+	for key, wantTime := range want {
+		got, ok := dates[key].(time.Time)
+		if !ok || !got.Equal(wantTime) || got.Location() != time.UTC {
+			t.Errorf("%s = %v, want %v in UTC", key, dates[key], wantTime)
+		}
+	}
+}
+
+func TestTimestampsMissingOrInvalid(t *testing.T) {
+	dates := Timestamps(map[string]interface{}{
+		"published_at":       "2024-03-01T10:00:00+0300",
+		"created_at":         "yesterday",
+		"initial_created_at": nil,
+	})
+	if len(dates) != 1 || dates["published_at_date"] == nil {
+		t.Errorf("dates = %v, want only published_at_date", dates)
+	}
+	if dates := Timestamps(map[string]interface{}{"id": "1"}); len(dates) != 0 {
+		t.Errorf("dates = %v for a vacancy without timestamps", dates)
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// watch runs cycles until ctx is cancelled by SIGINT or SIGTERM. After the first cycle, which
+// uses --from/--to, each cycle covers the time since the previous one
+// started so vacancies published during a run are not missed.
+//
+// Every cycle first checks the token, and opens the store if no earlier
+// cycle managed to, so a failure there counts as a failed cycle. A
+// failed cycle is logged and its window retried in the next cycle; watching
+// stops after --max-consecutive-failures failed cycles in a row. Without
+// --resilient a configuration or MongoDB failure stops watching at once.
+func (r *runner) watch(ctx context.Context) int {
+	failures := 0
+	for cycle := 1; ; cycle++ {
+		cycleStart := time.Now()
+		r.logger.Info.Printf("Watch cycle %d: %s to %s", cycle, r.cfg.StartDate, r.cfg.EndDate)
+		code := r.prepare()
+		if code == exitOK {
+			code = r.runCycle(ctx)
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		nextFrom := cycleStart
+		if code == exitOK {
+			failures = 0
+		} else {
+			failures++
+			if !r.cfg.Resilient && (code == exitConfigError || code == exitDBError) {
+				r.logger.Error.Printf("Watch mode stopped: cycle %d failed (%s)", cycle, exitCodeDescriptions[code])
+				return code
+			}
+			if failures >= r.cfg.MaxConsecutiveFailures {
+				r.logger.Error.Printf("Watch mode stopped after %d consecutive failed cycles", failures)
+				return code
+			}
+			r.logger.Error.Printf("Watch cycle %d failed (%s), retrying its window next cycle (%d/%d failures)",
+				cycle, exitCodeDescriptions[code], failures, r.cfg.MaxConsecutiveFailures)
+			if from, _, err := r.cfg.Window(); err == nil {
+				nextFrom = from
+			}
+		}
+
+		r.logger.Info.Printf("Watch cycle %d done, next run in %v", cycle, r.cfg.Interval)
+		select {
+		case <-ctx.Done():
+		case <-time.After(r.cfg.Interval):
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		r.cfg.SetWindow(nextFrom, time.Now())
+	}
+
+	r.logger.Info.Println("Watch mode stopped by signal")
+	return exitOK
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"hh_it_scrapper/api"
+	"hh_it_scrapper/config"
+	"hh_it_scrapper/storage"
+)
+
+func TestWatchRunsCyclesUntilCancelled(t *testing.T) {
+	cfg := loadTestConfig(t, "--watch", "--interval=10ms", "--skip-auth-check", "--summary-format=json")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client := newFakeAPI(1, 2)
+	var searches atomic.Int32
+	client.search = func(ctx context.Context, page int) (api.SearchResult, error) {
+		// Stop during the third cycle, after two full ones.
+		if searches.Add(1) == 3 {
+			cancel()
+		}
+		return client.page(page), nil
+	}
+	r := newTestRunner(t, cfg, client, storage.NewMemoryStore())
+	var infoLog bytes.Buffer
+	r.logger.Info = log.New(&infoLog, "", 0)
+	cfg.SummaryOut = filepath.Join(t.TempDir(), "summary.json")
+
+	done := make(chan int, 1)
+	go func() { done <- r.watch(ctx) }()
+	select {
+	case code := <-done:
+		if code != exitOK {
+			t.Errorf("exit code = %d, want %d", code, exitOK)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("watch did not stop after cancel")
+	}
+
+	output := infoLog.String()
+	for _, want := range []string{"Watch cycle 1 done", "Watch cycle 2 done", "Watch mode stopped by signal"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("log does not contain %q:\n%s", want, output)
+		}
+	}
+	if strings.Count(output, "Run ID: ") != 3 {
+		t.Errorf("want a run per cycle:\n%s", output)
+	}
+
+	// The first cycle searches --from/--to, later ones the time since the
+	// previous cycle started.
+	if len(client.queries) != 3 || client.queries[0].DateFrom != "2024-03-01T00:00:00+0000" ||
+		!strings.HasPrefix(client.queries[1].DateFrom, time.Now().UTC().Format("2006-01-02")) {
+		t.Errorf("queries = %+v, want the configured window then an incremental one", client.queries)
+	}
+
+	var summary runSummary
+	data, _ := os.ReadFile(cfg.SummaryOut)
+	if err := json.Unmarshal(data, &summary); err != nil {
+		t.Fatal(err)
+	}
+	if summary.RunID == "" || !strings.Contains(output, "Run ID: "+summary.RunID) {
+		t.Errorf("summary run %q is not one of the cycles", summary.RunID)
+	}
+}
+
+// meTransport answers the /me auth check with 401 for the first
+// unauthorized calls and 200 after that.
+type meTransport struct {
+	unauthorized int32
+	calls        atomic.Int32
+}
+
+func (t *meTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	status := http.StatusOK
+	if t.calls.Add(1) <= t.unauthorized {
+		status = http.StatusUnauthorized
+	}
+	return &http.Response{StatusCode: status, Header: http.Header{}, Body: io.NopCloser(strings.NewReader("{}")), Request: req}, nil
+}
+
+func TestWatchFailedCycles(t *testing.T) {
+	tests := []struct {
+		name         string
+		args         []string
+		unauthorized int32
+		code         int
+		cycles       int32
+		searches     int
+	}{
+		{"resilient recovers", []string{"--resilient"}, 1, exitOK, 2, 1},
+		{"stops without resilient", nil, 1, exitConfigError, 1, 0},
+		{"resilient gives up", []string{"--resilient", "--max-consecutive-failures=3"}, 100, exitConfigError, 3, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := loadTestConfig(t, append([]string{"--watch", "--interval=10ms"}, tt.args...)...)
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			client := newFakeAPI(1, 2)
+			client.search = func(ctx context.Context, page int) (api.SearchResult, error) {
+				cancel()
+				return client.page(page), nil
+			}
+			r := newTestRunner(t, cfg, client, storage.NewMemoryStore())
+			auth := &meTransport{unauthorized: tt.unauthorized}
+			r.authClient = api.NewHHClient("test-token")
+			r.authClient.HTTPClient.Transport = auth
+			appLogger, errorLog := bufferLogger()
+			r.logger = appLogger
+
+			done := make(chan int, 1)
+			go func() { done <- r.watch(ctx) }()
+			select {
+			case code := <-done:
+				if code != tt.code {
+					t.Errorf("exit code = %d, want %d\n%s", code, tt.code, errorLog)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("watch did not stop")
+			}
+
+			if got := auth.calls.Load(); got != tt.cycles {
+				t.Errorf("%d auth checks, want one per cycle (%d)", got, tt.cycles)
+			}
+			if len(client.queries) != tt.searches {
+				t.Fatalf("%d searches, want %d", len(client.queries), tt.searches)
+			}
+			// The failed cycle's window is searched again.
+			if tt.searches > 0 && client.queries[0].DateFrom != "2024-03-01T00:00:00+0000" {
+				t.Errorf("recovered cycle searched from %s, want the failed cycle's window", client.queries[0].DateFrom)
+			}
+			if tt.code == exitOK && !strings.Contains(errorLog.String(), "Watch cycle 1 failed") {
+				t.Errorf("failed cycle not logged:\n%s", errorLog)
+			}
+		})
+	}
+}
+
+func TestValidateConfigResilient(t *testing.T) {
+	for _, args := range [][]string{
+		{"--resilient"},
+		{"--watch", "--max-consecutive-failures=0"},
+	} {
+		setArgs(t, append(append([]string{}, testArgs...), args...)...)
+		if err := validateConfig(config.LoadConfig()); err == nil {
+			t.Errorf("%v accepted", args)
+		}
+	}
+}